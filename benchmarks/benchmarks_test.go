@@ -0,0 +1,131 @@
+package benchmarks
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+)
+
+var corpora = Corpora()
+
+var settings = []struct {
+	name string
+	s    zip.CompressionSettings
+}{
+	{"Default", zip.DefaultCompressionSettings()},
+	{"Best", zip.BestCompressionSettings()},
+	{"Fastest", zip.CompressionSettings{Flate: zip.FlateSettings{Level: 1, BlockSize: 256 << 10, Blocks: 16}}},
+	{"SingleBlock", zip.CompressionSettings{Flate: zip.FlateSettings{Level: 6, BlockSize: 256 << 10, Blocks: 1}}},
+}
+
+func TestCorpora(t *testing.T) {
+	again := Corpora()
+	for i, c := range corpora {
+		if c.Size() == 0 || c.Size() != again[i].Size() {
+			t.Errorf("%s: sizes %d and %d", c.Name, c.Size(), again[i].Size())
+		}
+		if !bytes.Equal(c.Files[0].Data, again[i].Files[0].Data) {
+			t.Errorf("%s: not deterministic", c.Name)
+		}
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	for _, c := range corpora {
+		for _, s := range settings {
+			b.Run(c.Name+"/"+s.name, func(b *testing.B) {
+				b.SetBytes(c.Size())
+				for i := 0; i < b.N; i++ {
+					if _, err := c.Zip(s.s); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	for _, c := range corpora {
+		zb, err := c.Zip(zip.DefaultCompressionSettings())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.Name, func(b *testing.B) {
+			b.SetBytes(c.Size())
+			for i := 0; i < b.N; i++ {
+				zr, err := zip.NewReader(bytes.NewReader(zb), int64(len(zb)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, f := range zr.File {
+					rc, err := f.Open()
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+						b.Fatal(err)
+					}
+					rc.Close()
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExtract(b *testing.B) {
+	dir, err := ioutil.TempDir("", "arkive-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, c := range corpora {
+		zb, err := c.Zip(zip.DefaultCompressionSettings())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.Name, func(b *testing.B) {
+			b.SetBytes(c.Size())
+			for i := 0; i < b.N; i++ {
+				zr, err := zip.NewReader(bytes.NewReader(zb), int64(len(zb)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := extract(zr, filepath.Join(dir, c.Name)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// extract writes the files of zr under dir, the simplest way.
+func extract(zr *zip.Reader, dir string) error {
+	for _, f := range zr.File {
+		path := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(path)
+		if err == nil {
+			_, err = io.Copy(out, rc)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Package benchmarks synthesizes archives representative of what itch.io
+// packages, and measures reading, writing and extracting them with
+// go test -bench, so that performance regressions, in the pflate
+// integration in particular, show up locally and in CI.
+package benchmarks
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// A File is an entry of a Corpus.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// A Corpus is a set of files that archives are built from.
+type Corpus struct {
+	Name  string
+	Files []File
+}
+
+// Size returns the total size of the files of c.
+func (c *Corpus) Size() int64 {
+	var n int64
+	for _, f := range c.Files {
+		n += int64(len(f.Data))
+	}
+	return n
+}
+
+// Zip returns c as a zip archive, written with the given settings.
+func (c *Corpus) Zip(s zip.CompressionSettings) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := zw.SetCompressionSettings(s); err != nil {
+		return nil, err
+	}
+	for _, f := range c.Files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Corpora returns the standard corpora. They are generated from a fixed
+// seed, so they are the same on every run.
+func Corpora() []*Corpus {
+	r := rand.New(rand.NewSource(1))
+	return []*Corpus{
+		manySmall(r),
+		fewHuge(r),
+		precompressed(r),
+	}
+}
+
+// words makes text-like data of the given size, compressing about as
+// well as source code or scripts.
+func words(r *rand.Rand, size int) []byte {
+	vocabulary := []string{"func", "return", "player", "sprite", "level", "if", "else", "for",
+		"x", "y", "velocity", "update", "draw", "{", "}", "(", ")", "=", "+", "\n", "\t", " "}
+	b := make([]byte, 0, size+16)
+	for len(b) < size {
+		b = append(b, vocabulary[r.Intn(len(vocabulary))]...)
+		b = append(b, ' ')
+	}
+	return b[:size]
+}
+
+// manySmall is like a game's scripts and data files: thousands of small,
+// compressible files.
+func manySmall(r *rand.Rand) *Corpus {
+	c := &Corpus{Name: "ManySmall"}
+	for i := 0; i < 5000; i++ {
+		name := fmt.Sprintf("data/%02d/file%04d.lua", i%50, i)
+		c.Files = append(c.Files, File{Name: name, Data: words(r, 512+r.Intn(4096))})
+	}
+	return c
+}
+
+// fewHuge is like a game's packed data files: a few large files, partly
+// compressible.
+func fewHuge(r *rand.Rand) *Corpus {
+	c := &Corpus{Name: "FewHuge"}
+	for i := 0; i < 3; i++ {
+		data := words(r, 8<<20)
+		// Every other megabyte is noise, as in packed binary assets.
+		for off := 1 << 20; off < len(data); off += 2 << 20 {
+			r.Read(data[off : off+1<<20])
+		}
+		c.Files = append(c.Files, File{Name: fmt.Sprintf("game%d.pak", i), Data: data})
+	}
+	return c
+}
+
+// precompressed is like textures, music and videos: files that deflate
+// cannot shrink.
+func precompressed(r *rand.Rand) *Corpus {
+	c := &Corpus{Name: "Precompressed"}
+	for i := 0; i < 40; i++ {
+		data := make([]byte, 64<<10+r.Intn(1<<20))
+		r.Read(data)
+		c.Files = append(c.Files, File{Name: fmt.Sprintf("assets/texture%02d.png", i), Data: data})
+	}
+	return c
+}
@@ -0,0 +1,112 @@
+package cab
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression methods, in the low bits of a folder's compression type.
+const (
+	Store   = 0
+	MSZIP   = 1
+	Quantum = 2
+	LZX     = 3
+
+	compressionMask = 0x000f
+)
+
+// A BlockDecoder decompresses the data blocks of one folder, in order.
+// Methods such as MSZIP and LZX keep state from one block to the next.
+type BlockDecoder interface {
+	// Decode decompresses src, which holds size bytes once
+	// decompressed.
+	Decode(src []byte, size int) ([]byte, error)
+}
+
+// A Decompressor returns a BlockDecoder for a folder. compression is the
+// folder's whole compression type, with the method in its low 4 bits and
+// parameters, such as the LZX window size, in bits 8 to 12.
+type Decompressor func(compression uint16) (BlockDecoder, error)
+
+var decompressors sync.Map // map[uint16]Decompressor
+
+func init() {
+	decompressors.Store(uint16(Store), Decompressor(newStoreDecoder))
+	decompressors.Store(uint16(MSZIP), Decompressor(newMSZIPDecoder))
+	decompressors.Store(uint16(LZX), Decompressor(newLZXDecoder))
+}
+
+// RegisterDecompressor registers a decompressor for a compression
+// method, such as Quantum, which is not built in.
+func RegisterDecompressor(method uint16, dcomp Decompressor) {
+	if _, dup := decompressors.LoadOrStore(method, dcomp); dup {
+		panic("decompressor already registered")
+	}
+}
+
+func decompressor(method uint16) Decompressor {
+	d, ok := decompressors.Load(method)
+	if !ok {
+		return nil
+	}
+	return d.(Decompressor)
+}
+
+// CompressionName returns the name of the method of a folder compression
+// type, such as "MSZIP".
+func CompressionName(compression uint16) string {
+	switch compression & compressionMask {
+	case Store:
+		return "stored"
+	case MSZIP:
+		return "MSZIP"
+	case Quantum:
+		return "Quantum"
+	case LZX:
+		return "LZX"
+	}
+	return fmt.Sprintf("compression %d", compression&compressionMask)
+}
+
+type storeDecoder struct{}
+
+func newStoreDecoder(compression uint16) (BlockDecoder, error) {
+	return storeDecoder{}, nil
+}
+
+func (storeDecoder) Decode(src []byte, size int) ([]byte, error) {
+	return src, nil
+}
+
+var errMSZIP = errors.New("cab: invalid MSZIP block")
+
+// An mszipDecoder inflates MSZIP blocks: deflate streams, each using
+// the block before it as a preset dictionary.
+type mszipDecoder struct {
+	history []byte
+}
+
+func newMSZIPDecoder(compression uint16) (BlockDecoder, error) {
+	return &mszipDecoder{}, nil
+}
+
+func (d *mszipDecoder) Decode(src []byte, size int) ([]byte, error) {
+	if len(src) < 2 || src[0] != 'C' || src[1] != 'K' {
+		return nil, errMSZIP
+	}
+	fr := flate.NewReaderDict(bytes.NewReader(src[2:]), d.history)
+	defer fr.Close()
+	out := make([]byte, size)
+	if _, err := io.ReadFull(fr, out); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errMSZIP
+		}
+		return nil, err
+	}
+	d.history = out
+	return out, nil
+}
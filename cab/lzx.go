@@ -0,0 +1,476 @@
+package cab
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// This file is an LZX decoder, following the description of the format
+// in Microsoft's LZX DELTA specification ([MS-PATCH]) and the libmspack
+// sources, which cabinets use with frames of one data block each.
+
+var errLZX = errors.New("cab: invalid LZX data")
+
+const (
+	lzxMinMatch        = 2
+	lzxNumChars        = 256
+	lzxPretreeSize     = 20
+	lzxAlignedSize     = 8
+	lzxNumPrimaryLens  = 7
+	lzxLengthTreeSize  = 249
+	lzxMaxCodeLen      = 16
+	lzxFrameSize       = 32768
+	lzxBlockVerbatim   = 1
+	lzxBlockAligned    = 2
+	lzxBlockStored     = 3
+	lzxE8MaxFrames     = 32768 // translation stops after 1GiB
+	lzxMaxPositionSlot = 50
+)
+
+// lzxExtraBits and lzxPositionBase describe the offsets of each
+// position slot.
+var (
+	lzxExtraBits    [lzxMaxPositionSlot]uint8
+	lzxPositionBase [lzxMaxPositionSlot]uint32
+)
+
+func init() {
+	var base uint32
+	for i := range lzxExtraBits {
+		extra := 0
+		if i >= 4 {
+			extra = (i - 2) / 2
+			if extra > 17 {
+				extra = 17
+			}
+		}
+		lzxExtraBits[i] = uint8(extra)
+		lzxPositionBase[i] = base
+		base += 1 << uint(extra)
+	}
+}
+
+// lzxPositionSlots returns the number of position slots of a window of
+// 1<<bits bytes.
+func lzxPositionSlots(bits uint) int {
+	switch bits {
+	case 20:
+		return 42
+	case 21:
+		return 50
+	}
+	return int(bits) * 2
+}
+
+// lzxBits reads the LZX bit stream of a data block: 16-bit little-endian
+// words, most significant bit first. Past the end of the block, it reads
+// a few zero bits, which Huffman decoding may look ahead to.
+type lzxBits struct {
+	src []byte
+	pos int
+	buf uint64 // n bits, at the top
+	n   uint
+	err error
+}
+
+func (b *lzxBits) ensure(n uint) {
+	for b.n < n {
+		var w uint64
+		switch {
+		case b.pos+1 < len(b.src):
+			w = uint64(binary.LittleEndian.Uint16(b.src[b.pos:]))
+		case b.pos < len(b.src):
+			w = uint64(b.src[b.pos])
+		case b.pos >= len(b.src)+4:
+			b.err = errLZX
+		}
+		b.pos += 2
+		b.buf |= w << (48 - b.n)
+		b.n += 16
+	}
+}
+
+func (b *lzxBits) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	b.ensure(n)
+	v := uint32(b.buf >> (64 - n))
+	b.buf <<= n
+	b.n -= n
+	return v
+}
+
+// align drops the bits left in the current word.
+func (b *lzxBits) align() {
+	b.buf <<= b.n & 15
+	b.n -= b.n & 15
+}
+
+// lzxTree is a canonical Huffman code.
+type lzxTree struct {
+	count  [lzxMaxCodeLen + 1]uint16 // codes of each length
+	symbol []uint16                  // by code
+	empty  bool
+}
+
+// build makes the code of the given code lengths. Codes must be
+// complete, unless every length is zero and empty is allowed.
+func (t *lzxTree) build(lens []uint8, allowEmpty bool) error {
+	t.count = [lzxMaxCodeLen + 1]uint16{}
+	for _, l := range lens {
+		t.count[l]++
+	}
+	t.empty = int(t.count[0]) == len(lens)
+	if t.empty {
+		if !allowEmpty {
+			return errLZX
+		}
+		return nil
+	}
+	left := 1
+	var offs [lzxMaxCodeLen + 2]uint16
+	for l := 1; l <= lzxMaxCodeLen; l++ {
+		left = left<<1 - int(t.count[l])
+		if left < 0 {
+			return errLZX
+		}
+		offs[l+1] = offs[l] + t.count[l]
+	}
+	if left != 0 {
+		return errLZX
+	}
+	if cap(t.symbol) < len(lens) {
+		t.symbol = make([]uint16, len(lens))
+	}
+	t.symbol = t.symbol[:len(lens)]
+	for s, l := range lens {
+		if l != 0 {
+			t.symbol[offs[l]] = uint16(s)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+func (t *lzxTree) decode(b *lzxBits) uint32 {
+	if t.empty {
+		b.err = errLZX
+		return 0
+	}
+	b.ensure(lzxMaxCodeLen)
+	code, first, index := 0, 0, 0
+	for l := 1; l <= lzxMaxCodeLen; l++ {
+		code |= int(b.buf >> 63)
+		b.buf <<= 1
+		b.n--
+		count := int(t.count[l])
+		if code-first < count {
+			return uint32(t.symbol[index+code-first])
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	b.err = errLZX
+	return 0
+}
+
+// An lzxDecoder decodes the data blocks of an LZX folder, each of which
+// is a frame of the LZX stream.
+type lzxDecoder struct {
+	window     []byte
+	windowPosn int
+	frameStart int   // position of the current frame in window
+	total      int64 // bytes of the frames before it
+	frames     int
+
+	headerRead bool
+	e8Size     int32 // Intel E8 translation size, 0 for none
+	e8Started  bool
+	r          [3]uint32
+
+	blockType      int
+	blockRemaining int
+	storedLen      int // of the current block, if stored
+
+	mainLens    []uint8
+	lengthLens  [lzxLengthTreeSize]uint8
+	alignedLens [lzxAlignedSize]uint8
+	mainTree    lzxTree
+	lengthTree  lzxTree
+	alignedTree lzxTree
+	pretree     lzxTree
+
+	out []byte
+}
+
+func newLZXDecoder(compression uint16) (BlockDecoder, error) {
+	bits := uint(compression>>8) & 0x1f
+	if bits < 15 || bits > 21 {
+		return nil, errors.New("cab: invalid LZX window size")
+	}
+	return &lzxDecoder{
+		window:   make([]byte, 1<<bits),
+		r:        [3]uint32{1, 1, 1},
+		mainLens: make([]uint8, lzxNumChars+lzxPositionSlots(bits)*8),
+	}, nil
+}
+
+func (d *lzxDecoder) Decode(src []byte, size int) ([]byte, error) {
+	if size > lzxFrameSize || d.windowPosn+size > len(d.window) {
+		return nil, errLZX
+	}
+	b := &lzxBits{src: src}
+	if !d.headerRead {
+		if b.read(1) == 1 {
+			hi := b.read(16)
+			d.e8Size = int32(hi<<16 | b.read(16))
+		}
+		d.headerRead = true
+	}
+
+	d.frameStart = d.windowPosn
+	for todo := size; todo > 0; {
+		if d.blockRemaining == 0 {
+			if err := d.readBlockHeader(b); err != nil {
+				return nil, err
+			}
+		}
+		run := d.blockRemaining
+		if run > todo {
+			run = todo
+		}
+		var err error
+		if d.blockType == lzxBlockStored {
+			err = d.copyStored(b, run)
+		} else {
+			err = d.decodeRun(b, run)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		todo -= run
+		d.blockRemaining -= run
+		if d.blockType == lzxBlockStored && d.blockRemaining == 0 && d.storedLen&1 != 0 {
+			b.pos++ // padding
+		}
+	}
+	b.align()
+
+	if cap(d.out) < size {
+		d.out = make([]byte, lzxFrameSize)
+	}
+	out := d.out[:size]
+	copy(out, d.window[d.frameStart:d.windowPosn])
+	if d.e8Started && d.e8Size != 0 && d.frames < lzxE8MaxFrames && size > 10 {
+		d.translateE8(out)
+	}
+	d.frames++
+	d.total += int64(size)
+	if d.windowPosn == len(d.window) {
+		d.windowPosn = 0
+	}
+	return out, nil
+}
+
+func (d *lzxDecoder) readBlockHeader(b *lzxBits) error {
+	d.blockType = int(b.read(3))
+	hi := b.read(16)
+	d.blockRemaining = int(hi<<8 | b.read(8))
+	if d.blockRemaining == 0 {
+		return errLZX
+	}
+	switch d.blockType {
+	case lzxBlockAligned:
+		for i := range d.alignedLens {
+			d.alignedLens[i] = uint8(b.read(3))
+		}
+		if err := d.alignedTree.build(d.alignedLens[:], false); err != nil {
+			return err
+		}
+		fallthrough
+	case lzxBlockVerbatim:
+		if err := d.readLengths(b, d.mainLens[:lzxNumChars]); err != nil {
+			return err
+		}
+		if err := d.readLengths(b, d.mainLens[lzxNumChars:]); err != nil {
+			return err
+		}
+		if err := d.mainTree.build(d.mainLens, false); err != nil {
+			return err
+		}
+		if d.mainLens[0xe8] != 0 {
+			d.e8Started = true
+		}
+		if err := d.readLengths(b, d.lengthLens[:]); err != nil {
+			return err
+		}
+		return d.lengthTree.build(d.lengthLens[:], true)
+	case lzxBlockStored:
+		d.e8Started = true
+		d.storedLen = d.blockRemaining
+		// Skip to the next word, a whole one if the bits are aligned.
+		// Fewer than 16 bits are left after reading the header.
+		if b.n == 0 {
+			b.ensure(16)
+		}
+		b.buf, b.n = 0, 0
+		if b.pos+12 > len(b.src) {
+			return errLZX
+		}
+		for i := range d.r {
+			d.r[i] = binary.LittleEndian.Uint32(b.src[b.pos+4*i:])
+		}
+		b.pos += 12
+		return nil
+	}
+	return errLZX
+}
+
+// readLengths reads code lengths, encoded as differences from the
+// previous ones with a pretree.
+func (d *lzxDecoder) readLengths(b *lzxBits, lens []uint8) error {
+	var pre [lzxPretreeSize]uint8
+	for i := range pre {
+		pre[i] = uint8(b.read(4))
+	}
+	if err := d.pretree.build(pre[:], false); err != nil {
+		return err
+	}
+	for i := 0; i < len(lens); {
+		z := d.pretree.decode(b)
+		run, zero := 1, false
+		switch z {
+		case 17:
+			run, zero = 4+int(b.read(4)), true
+		case 18:
+			run, zero = 20+int(b.read(5)), true
+		case 19:
+			run = 4 + int(b.read(1))
+			z = d.pretree.decode(b)
+			if z > 16 {
+				return errLZX
+			}
+		}
+		if b.err != nil {
+			return b.err
+		}
+		if i+run > len(lens) {
+			return errLZX
+		}
+		for ; run > 0; run-- {
+			if zero {
+				lens[i] = 0
+			} else {
+				lens[i] = uint8((int(lens[i]) - int(z) + 17) % 17)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+func (d *lzxDecoder) copyStored(b *lzxBits, n int) error {
+	if b.pos+n > len(b.src) {
+		return errLZX
+	}
+	copy(d.window[d.windowPosn:], b.src[b.pos:b.pos+n])
+	b.pos += n
+	d.windowPosn += n
+	return nil
+}
+
+// decodeRun decodes n bytes of a verbatim or aligned block. Matches may
+// not run past them: they would cross a frame or a block.
+func (d *lzxDecoder) decodeRun(b *lzxBits, n int) error {
+	end := d.windowPosn + n
+	for d.windowPosn < end {
+		if b.err != nil {
+			return b.err
+		}
+		sym := d.mainTree.decode(b)
+		if sym < lzxNumChars {
+			d.window[d.windowPosn] = byte(sym)
+			d.windowPosn++
+			continue
+		}
+
+		sym -= lzxNumChars
+		length := int(sym & 7)
+		if length == lzxNumPrimaryLens {
+			length += int(d.lengthTree.decode(b))
+		}
+		length += lzxMinMatch
+
+		slot := int(sym >> 3)
+		var offset uint32
+		switch slot {
+		case 0:
+			offset = d.r[0]
+		case 1:
+			offset = d.r[1]
+			d.r[1] = d.r[0]
+			d.r[0] = offset
+		case 2:
+			offset = d.r[2]
+			d.r[2] = d.r[0]
+			d.r[0] = offset
+		default:
+			extra := uint(lzxExtraBits[slot])
+			offset = lzxPositionBase[slot] - 2
+			if d.blockType == lzxBlockAligned && extra >= 3 {
+				offset += b.read(extra-3) << 3
+				offset += d.alignedTree.decode(b)
+			} else {
+				offset += b.read(extra)
+			}
+			d.r[2], d.r[1], d.r[0] = d.r[1], d.r[0], offset
+		}
+
+		if d.windowPosn+length > end {
+			return errLZX
+		}
+		if offset == 0 || int(offset) > len(d.window) || int64(offset) > d.total+int64(d.windowPosn-d.frameStart) {
+			return errLZX
+		}
+		src := d.windowPosn - int(offset)
+		if src < 0 {
+			src += len(d.window)
+		}
+		for i := 0; i < length; i++ {
+			d.window[d.windowPosn] = d.window[src]
+			d.windowPosn++
+			if src++; src == len(d.window) {
+				src = 0
+			}
+		}
+	}
+	return nil
+}
+
+// translateE8 undoes the translation of the operands of x86 CALL
+// instructions, made absolute by the compressor, in a frame.
+func (d *lzxDecoder) translateE8(out []byte) {
+	curpos := int32(d.total)
+	for i := 0; i < len(out)-10; {
+		if out[i] != 0xe8 {
+			i++
+			curpos++
+			continue
+		}
+		abs := int32(binary.LittleEndian.Uint32(out[i+1:]))
+		if abs >= -curpos && abs < d.e8Size {
+			rel := abs - curpos
+			if abs < 0 {
+				rel = abs + d.e8Size
+			}
+			binary.LittleEndian.PutUint32(out[i+1:], uint32(rel))
+		}
+		i += 5
+		curpos += 5
+	}
+}
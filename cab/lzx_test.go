@@ -0,0 +1,470 @@
+package cab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// lzxEncoder is a small LZX compressor for tests. It writes the
+// literals and matches it is given, with fixed code lengths, and cuts
+// the stream into frames of one data block each, as cabinets do.
+type lzxEncoder struct {
+	t      *testing.T
+	blocks [][]byte // finished frames
+	cur    []byte
+	acc    uint32
+	n      uint
+	pos    int // bytes encoded
+	r      [3]uint32
+
+	mainLens, lengthLens []uint8 // of the previous block
+}
+
+// lzxOp is a literal, or a match if length is not zero.
+type lzxOp struct {
+	lit    byte
+	length int
+	offset uint32
+}
+
+func newLZXEncoder(t *testing.T, slots int, e8Size uint32) *lzxEncoder {
+	e := &lzxEncoder{
+		t:          t,
+		r:          [3]uint32{1, 1, 1},
+		mainLens:   make([]uint8, lzxNumChars+slots*8),
+		lengthLens: make([]uint8, lzxLengthTreeSize),
+	}
+	if e8Size != 0 {
+		e.bits(1, 1)
+		e.bits(e8Size>>16, 16)
+		e.bits(e8Size&0xffff, 16)
+	} else {
+		e.bits(0, 1)
+	}
+	return e
+}
+
+func (e *lzxEncoder) bits(v uint32, n uint) {
+	for ; n > 0; n-- {
+		e.acc = e.acc<<1 | v>>(n-1)&1
+		if e.n++; e.n == 16 {
+			e.cur = append(e.cur, byte(e.acc), byte(e.acc>>8))
+			e.acc, e.n = 0, 0
+		}
+	}
+}
+
+func (e *lzxEncoder) align() {
+	if e.n > 0 {
+		e.bits(0, 16-e.n)
+	}
+}
+
+// advance counts n bytes out, and ends the frame once it is full.
+func (e *lzxEncoder) advance(n int) {
+	e.pos += n
+	if e.pos%lzxFrameSize == 0 {
+		e.endFrame()
+	}
+}
+
+func (e *lzxEncoder) endFrame() {
+	e.align()
+	e.blocks = append(e.blocks, e.cur)
+	e.cur = nil
+}
+
+// close ends the last frame, if it is not full.
+func (e *lzxEncoder) close() [][]byte {
+	if e.pos%lzxFrameSize != 0 {
+		e.endFrame()
+	}
+	return e.blocks
+}
+
+func (e *lzxEncoder) header(typ, length int) {
+	e.bits(uint32(typ), 3)
+	e.bits(uint32(length>>8), 16)
+	e.bits(uint32(length&0xff), 8)
+}
+
+// canonicalCodes returns the codes of the given lengths.
+func canonicalCodes(lens []uint8) []uint32 {
+	var count [lzxMaxCodeLen + 1]uint32
+	for _, l := range lens {
+		count[l]++
+	}
+	count[0] = 0
+	var next [lzxMaxCodeLen + 2]uint32
+	for l := 1; l <= lzxMaxCodeLen; l++ {
+		next[l+1] = (next[l] + count[l]) << 1
+	}
+	codes := make([]uint32, len(lens))
+	for s, l := range lens {
+		if l != 0 {
+			codes[s] = next[l]
+			next[l]++
+		}
+	}
+	return codes
+}
+
+// The pretree has 12 codes of 4 bits and 8 of 5 bits, and the aligned
+// offset tree codes of 2 to 4 bits.
+var (
+	pretreeLens  = []uint8{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 5, 5, 5, 5, 5, 5, 5, 5}
+	pretreeCodes = canonicalCodes(pretreeLens)
+	alignedLens  = []uint8{2, 2, 3, 3, 4, 4, 4, 4}
+	alignedCodes = canonicalCodes(alignedLens)
+)
+
+func (e *lzxEncoder) pretreeSym(z int) {
+	e.bits(pretreeCodes[z], uint(pretreeLens[z]))
+}
+
+// lengths writes lens as differences from prev, using runs of zeros and
+// of equal differences where it can.
+func (e *lzxEncoder) lengths(prev, lens []uint8) {
+	for _, l := range pretreeLens {
+		e.bits(uint32(l), 4)
+	}
+	delta := func(i int) int { return (int(prev[i]) - int(lens[i]) + 17) % 17 }
+	for i := 0; i < len(lens); {
+		zeros := 0
+		for i+zeros < len(lens) && lens[i+zeros] == 0 {
+			zeros++
+		}
+		same := 1
+		for i+same < len(lens) && same < 5 && delta(i+same) == delta(i) {
+			same++
+		}
+		switch {
+		case zeros >= 20:
+			if zeros > 51 {
+				zeros = 51
+			}
+			e.pretreeSym(18)
+			e.bits(uint32(zeros-20), 5)
+			i += zeros
+		case zeros >= 4:
+			if zeros > 19 {
+				zeros = 19
+			}
+			e.pretreeSym(17)
+			e.bits(uint32(zeros-4), 4)
+			i += zeros
+		case same >= 4:
+			e.pretreeSym(19)
+			e.bits(uint32(same-4), 1)
+			e.pretreeSym(delta(i))
+			i += same
+		default:
+			e.pretreeSym(delta(i))
+			i++
+		}
+	}
+	copy(prev, lens)
+}
+
+// compressed writes a verbatim or aligned block of ops, with the given
+// main and length tree code lengths. Aligned blocks use alignedLens.
+func (e *lzxEncoder) compressed(typ int, ops []lzxOp, mainLens, lengthLens []uint8) {
+	length := 0
+	for _, op := range ops {
+		if op.length == 0 {
+			length++
+		} else {
+			length += op.length
+		}
+	}
+	e.header(typ, length)
+	if typ == lzxBlockAligned {
+		for _, l := range alignedLens {
+			e.bits(uint32(l), 3)
+		}
+	}
+	e.lengths(e.mainLens[:lzxNumChars], mainLens[:lzxNumChars])
+	e.lengths(e.mainLens[lzxNumChars:], mainLens[lzxNumChars:])
+	e.lengths(e.lengthLens, lengthLens)
+	mainCodes := canonicalCodes(mainLens)
+	lengthCodes := canonicalCodes(lengthLens)
+
+	sym := func(codes []uint32, lens []uint8, s int) {
+		if lens[s] == 0 {
+			e.t.Fatalf("symbol %d has no code", s)
+		}
+		e.bits(codes[s], uint(lens[s]))
+	}
+	for _, op := range ops {
+		if op.length == 0 {
+			sym(mainCodes, mainLens, int(op.lit))
+			e.advance(1)
+			continue
+		}
+
+		var slot int
+		var footer uint32
+		switch op.offset {
+		case e.r[0]:
+			slot = 0
+		case e.r[1]:
+			slot = 1
+			e.r[0], e.r[1] = e.r[1], e.r[0]
+		case e.r[2]:
+			slot = 2
+			e.r[0], e.r[2] = e.r[2], e.r[0]
+		default:
+			formatted := op.offset + 2
+			for slot = 3; slot+1 < lzxMaxPositionSlot && lzxPositionBase[slot+1] <= formatted; slot++ {
+			}
+			footer = formatted - lzxPositionBase[slot]
+			e.r[2], e.r[1], e.r[0] = e.r[1], e.r[0], op.offset
+		}
+		l := op.length - lzxMinMatch
+		primary := l
+		if primary > lzxNumPrimaryLens {
+			primary = lzxNumPrimaryLens
+		}
+		sym(mainCodes, mainLens, lzxNumChars+slot<<3|primary)
+		if primary == lzxNumPrimaryLens {
+			sym(lengthCodes, lengthLens, l-lzxNumPrimaryLens)
+		}
+		if slot >= 3 {
+			extra := uint(lzxExtraBits[slot])
+			if typ == lzxBlockAligned && extra >= 3 {
+				e.bits(footer>>3, extra-3)
+				e.bits(alignedCodes[footer&7], uint(alignedLens[footer&7]))
+			} else {
+				e.bits(footer, extra)
+			}
+		}
+		e.advance(op.length)
+	}
+}
+
+// stored writes a stored block of data.
+func (e *lzxEncoder) stored(data []byte) {
+	e.header(lzxBlockStored, len(data))
+	if e.n == 0 {
+		e.bits(0, 16)
+	} else {
+		e.align()
+	}
+	for _, r := range e.r {
+		e.cur = append(e.cur, byte(r), byte(r>>8), byte(r>>16), byte(r>>24))
+	}
+	for i, c := range data {
+		e.cur = append(e.cur, c)
+		if i == len(data)-1 && len(data)%2 == 1 {
+			e.cur = append(e.cur, 0)
+		}
+		e.advance(1)
+	}
+}
+
+// lzxOps makes literals and matches for n bytes, following out, which
+// they are appended to. Matches stay within the block and the frame,
+// reach at most maxOffset back, and often reuse recent offsets.
+func lzxOps(out *[]byte, n int, maxOffset uint32, seed uint32) []lzxOp {
+	x := seed
+	rand := func(m int) int {
+		x = x*1103515245 + 12345
+		return int(x>>8) % m
+	}
+	var ops []lzxOp
+	var recent []uint32
+	for end := len(*out) + n; len(*out) < end; {
+		room := end - len(*out)
+		if r := lzxFrameSize - len(*out)%lzxFrameSize; r < room {
+			room = r
+		}
+		if room > 257 {
+			room = 257
+		}
+		avail := uint32(len(*out))
+		if avail > maxOffset {
+			avail = maxOffset
+		}
+		if room < 2 || avail == 0 || rand(3) == 0 {
+			c := byte('a' + rand(26))
+			ops = append(ops, lzxOp{lit: c})
+			*out = append(*out, c)
+			continue
+		}
+		length := 2 + rand(8)
+		if rand(4) == 0 {
+			length = 2 + rand(256)
+		}
+		if length > room {
+			length = room
+		}
+		var offset uint32
+		if len(recent) > 0 && rand(3) == 0 {
+			offset = recent[rand(len(recent))]
+		} else {
+			offset = 1 + uint32(rand(int(avail)))
+		}
+		if offset > avail {
+			offset = avail
+		}
+		recent = append(recent, offset)
+		if len(recent) > 3 {
+			recent = recent[1:]
+		}
+		ops = append(ops, lzxOp{length: length, offset: offset})
+		for i := 0; i < length; i++ {
+			*out = append(*out, (*out)[len(*out)-int(offset)])
+		}
+	}
+	return ops
+}
+
+// lzxTestStream encodes a stream of a verbatim block, an aligned block
+// crossing into the second frame, and a stored block with x86 CALL
+// instructions, for a window of 32KiB, and returns its frames with the
+// decompressed contents.
+func lzxTestStream(t *testing.T) (blocks [][]byte, want []byte) {
+	const (
+		slots  = 30
+		e8Size = 1 << 20
+	)
+	e := newLZXEncoder(t, slots, e8Size)
+
+	// Every main symbol has a code, and long lengths too.
+	mainA := make([]uint8, lzxNumChars+slots*8)
+	for i := range mainA {
+		mainA[i] = 9
+		if i < 16 {
+			mainA[i] = 8
+		}
+	}
+	lengthA := make([]uint8, lzxLengthTreeSize)
+	for i := range lengthA {
+		lengthA[i] = 8
+		if i < 7 {
+			lengthA[i] = 7
+		}
+	}
+	var out []byte
+	e.compressed(lzxBlockVerbatim, lzxOps(&out, 20000, 1<<15, 1), mainA, lengthA)
+
+	// Offsets below 254 only, and no long lengths: the length tree is
+	// empty.
+	mainB := make([]uint8, lzxNumChars+slots*8)
+	for i := range mainB[:lzxNumChars+16*8] {
+		mainB[i] = 9
+		if i < 128 {
+			mainB[i] = 8
+		}
+	}
+	lengthB := make([]uint8, lzxLengthTreeSize)
+	var opsB []lzxOp
+	for _, op := range lzxOps(&out, 15000, 253, 2) {
+		// Split long matches in short ones at the same offset.
+		for l := op.length; l > lzxMinMatch+lzxNumPrimaryLens-1; {
+			n := lzxMinMatch + lzxNumPrimaryLens - 1
+			if l-n < lzxMinMatch {
+				n = l - lzxMinMatch
+			}
+			opsB = append(opsB, lzxOp{length: n, offset: op.offset})
+			l -= n
+			op.length = l
+		}
+		opsB = append(opsB, op)
+	}
+	e.compressed(lzxBlockAligned, opsB, mainB, lengthB)
+
+	// The stored block starts at 35000, in the second frame.
+	stored := bytes.Repeat([]byte("stored "), 2001/7+1)[:2001]
+	call := func(j int, abs int32) {
+		stored[j] = 0xe8
+		binary.LittleEndian.PutUint32(stored[j+1:], uint32(abs))
+	}
+	call(100, 35100+1000) // becomes 1000
+	call(200, 5000000)    // past e8Size: left alone
+	call(300, -10)        // becomes e8Size-10
+	call(1993, 35000)     // in the last 10 bytes of the frame: left alone
+	e.stored(stored)
+	blocks = e.close()
+
+	want = append(out, stored...)
+	want = append([]byte{}, want...)
+	binary.LittleEndian.PutUint32(want[35000+101:], 1000)
+	binary.LittleEndian.PutUint32(want[35000+301:], e8Size-10)
+	return blocks, want
+}
+
+func TestLZX(t *testing.T) {
+	blocks, want := lzxTestStream(t)
+	if len(blocks) != 2 {
+		t.Fatalf("encoded %d frames", len(blocks))
+	}
+	b := buildCabinet(t, []testFolder{{LZX | 15<<8, true, blocks}}, []testFile{
+		{name: "a.bin", data: want[:30000]},
+		{name: "b.bin", data: want[30000:]},
+	})
+	cr, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for _, f := range cr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		got = append(got, data...)
+	}
+	if !bytes.Equal(got, want) {
+		for i := range got {
+			if i >= len(want) || got[i] != want[i] {
+				t.Fatalf("contents differ at %d of %d", i, len(want))
+			}
+		}
+		t.Fatalf("got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestLZXCorrupt(t *testing.T) {
+	blocks, want := lzxTestStream(t)
+	for _, tt := range []struct {
+		name   string
+		mangle func(b [][]byte)
+	}{
+		{"truncated", func(b [][]byte) { b[0] = b[0][:len(b[0])/2] }},
+		{"bad block type", func(b [][]byte) { b[0][5] |= 0x70 }},
+		{"bad window", nil},
+	} {
+		dcomp := decompressor(LZX)
+		compression := uint16(LZX | 15<<8)
+		if tt.mangle == nil {
+			compression = LZX | 22<<8
+		}
+		dec, err := dcomp(compression)
+		if err != nil {
+			if tt.mangle != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		b := make([][]byte, len(blocks))
+		for i := range blocks {
+			b[i] = append([]byte{}, blocks[i]...)
+		}
+		tt.mangle(b)
+		_, err = dec.Decode(b[0], lzxFrameSize)
+		if err == nil {
+			_, err = dec.Decode(b[1], len(want)-lzxFrameSize)
+		}
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Package cab reads Microsoft cabinet (.cab) files, as found in Windows
+// installers and, embedded, in MSI packages (see package msi).
+//
+// Stored, MSZIP and LZX folders are supported out of the box; a
+// decompressor for Quantum can be added with RegisterDecompressor. Cabinet
+// sets spanning several files are not supported: entries continued from
+// or into another cabinet fail to open.
+package cab
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFormat is returned for files that are not cabinets.
+	ErrFormat = errors.New("cab: not a valid cabinet file")
+	// ErrChecksum is returned when a data block is corrupt.
+	ErrChecksum = errors.New("cab: checksum error")
+	// ErrSpanned is returned when opening an entry that is continued
+	// from or into another cabinet.
+	ErrSpanned = errors.New("cab: entry spans several cabinets")
+)
+
+const (
+	headerLen = 36
+	folderLen = 8
+	fileLen   = 16
+	dataLen   = 8
+
+	flagPrevCabinet    = 0x0001
+	flagNextCabinet    = 0x0002
+	flagReservePresent = 0x0004
+
+	// Folder indices of entries spanning cabinets.
+	folderContinuedFromPrev    = 0xfffd
+	folderContinuedToNext      = 0xfffe
+	folderContinuedPrevAndNext = 0xffff
+
+	// maxBlockSize is the largest uncompressed CFDATA block.
+	maxBlockSize = 32768
+)
+
+// Attributes of entries.
+const (
+	AttrReadOnly  = 0x01
+	AttrHidden    = 0x02
+	AttrSystem    = 0x04
+	AttrArchive   = 0x20
+	AttrExec      = 0x40
+	AttrNameIsUTF = 0x80
+)
+
+// A Reader serves content from a cabinet.
+type Reader struct {
+	r       io.ReaderAt
+	size    int64
+	File    []*File
+	folders []*folder
+
+	// SetID and Index identify the cabinet within a set.
+	SetID uint16
+	Index uint16
+}
+
+// A ReadCloser is a Reader that must be closed when no longer needed.
+type ReadCloser struct {
+	f *os.File
+	Reader
+}
+
+type folder struct {
+	dataStart   int64
+	blocks      int
+	compression uint16
+	dataReserve int
+}
+
+// FileHeader describes an entry of a cabinet.
+type FileHeader struct {
+	// Name is the path of the entry, with forward slashes; cabinets
+	// store backslashes.
+	Name string
+
+	Size       int64
+	Modified   time.Time // in local time, which is all cabinets record
+	Attributes uint16
+}
+
+// Mode returns the permission bits suggested by the entry's attributes.
+func (h *FileHeader) Mode() os.FileMode {
+	mode := os.FileMode(0644)
+	if h.Attributes&AttrReadOnly != 0 {
+		mode = 0444
+	}
+	if h.Attributes&AttrExec != 0 {
+		mode |= 0111
+	}
+	return mode
+}
+
+// A File is a single entry of a cabinet. Its contents are read with
+// Open.
+type File struct {
+	FileHeader
+	r      *Reader
+	folder int
+	offset int64 // in the uncompressed data of the folder
+}
+
+// OpenReader opens the cabinet file specified by name.
+func OpenReader(name string) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := new(ReadCloser)
+	if err := r.init(f, fi.Size()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f = f
+	return r, nil
+}
+
+// Close closes the cabinet file.
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// NewReader returns a new Reader reading from r, which is assumed to
+// have the given size in bytes.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	cr := new(Reader)
+	if err := cr.init(r, size); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *Reader) init(r io.ReaderAt, size int64) error {
+	cr.r = r
+	cr.size = size
+	sr := io.NewSectionReader(r, 0, size)
+	le := binary.LittleEndian
+
+	var hdr [headerLen]byte
+	if _, err := io.ReadFull(sr, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrFormat
+		}
+		return err
+	}
+	if string(hdr[0:4]) != "MSCF" {
+		return ErrFormat
+	}
+	if hdr[25] != 1 || hdr[24] != 3 {
+		return fmt.Errorf("cab: unsupported version %d.%d", hdr[25], hdr[24])
+	}
+	filesStart := int64(le.Uint32(hdr[16:]))
+	nFolders := int(le.Uint16(hdr[26:]))
+	nFiles := int(le.Uint16(hdr[28:]))
+	flags := le.Uint16(hdr[30:])
+	cr.SetID = le.Uint16(hdr[32:])
+	cr.Index = le.Uint16(hdr[34:])
+
+	folderReserve, dataReserve := 0, 0
+	if flags&flagReservePresent != 0 {
+		var res [4]byte
+		if _, err := io.ReadFull(sr, res[:]); err != nil {
+			return ErrFormat
+		}
+		headerReserve := int64(le.Uint16(res[0:]))
+		folderReserve = int(res[2])
+		dataReserve = int(res[3])
+		if _, err := sr.Seek(headerReserve, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	// The names of the neighbouring cabinets and their disks.
+	skip := 0
+	if flags&flagPrevCabinet != 0 {
+		skip += 2
+	}
+	if flags&flagNextCabinet != 0 {
+		skip += 2
+	}
+	for i := 0; i < skip; i++ {
+		if _, err := readString(sr); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < nFolders; i++ {
+		b := make([]byte, folderLen+folderReserve)
+		if _, err := io.ReadFull(sr, b); err != nil {
+			return ErrFormat
+		}
+		cr.folders = append(cr.folders, &folder{
+			dataStart:   int64(le.Uint32(b[0:])),
+			blocks:      int(le.Uint16(b[4:])),
+			compression: le.Uint16(b[6:]),
+			dataReserve: dataReserve,
+		})
+	}
+
+	if _, err := sr.Seek(filesStart, io.SeekStart); err != nil {
+		return err
+	}
+	for i := 0; i < nFiles; i++ {
+		var b [fileLen]byte
+		if _, err := io.ReadFull(sr, b[:]); err != nil {
+			return ErrFormat
+		}
+		name, err := readString(sr)
+		if err != nil {
+			return err
+		}
+		f := &File{
+			FileHeader: FileHeader{
+				Name:       strings.Replace(name, `\`, "/", -1),
+				Size:       int64(le.Uint32(b[0:])),
+				Modified:   msDosTimeToTime(le.Uint16(b[10:]), le.Uint16(b[12:])),
+				Attributes: le.Uint16(b[14:]),
+			},
+			r:      cr,
+			offset: int64(le.Uint32(b[4:])),
+			folder: int(le.Uint16(b[8:])),
+		}
+		if f.folder < folderContinuedFromPrev && f.folder >= len(cr.folders) {
+			return ErrFormat
+		}
+		cr.File = append(cr.File, f)
+	}
+	return nil
+}
+
+// readString reads a NUL-terminated string of at most 256 bytes.
+func readString(r io.Reader) (string, error) {
+	var b [1]byte
+	var s []byte
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return "", ErrFormat
+		}
+		if b[0] == 0 {
+			return string(s), nil
+		}
+		if len(s) == 256 {
+			return "", ErrFormat
+		}
+		s = append(s, b[0])
+	}
+}
+
+// msDosTimeToTime converts an MS-DOS date and time into a time.Time.
+// The resolution is 2s.
+func msDosTimeToTime(dosDate, dosTime uint16) time.Time {
+	return time.Date(
+		int(dosDate>>9+1980),
+		time.Month(dosDate>>5&0xf),
+		int(dosDate&0x1f),
+		int(dosTime>>11),
+		int(dosTime>>5&0x3f),
+		int(dosTime&0x1f*2),
+		0,
+		time.Local,
+	)
+}
+
+// Open returns a ReadCloser that provides access to the File's contents.
+// The folder holding the entry is decompressed from its start, so
+// opening every entry of a large solid folder in turn is slow; Extract
+// reads each folder once. Multiple files may be read concurrently.
+func (f *File) Open() (io.ReadCloser, error) {
+	if f.folder >= folderContinuedFromPrev {
+		return nil, ErrSpanned
+	}
+	fr, err := f.r.openFolder(f.folder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, fr, f.offset); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &fileReader{r: io.LimitReader(fr, f.Size), size: f.Size}, nil
+}
+
+type fileReader struct {
+	r     io.Reader
+	nread int64
+	size  int64
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.nread += int64(n)
+	if err == io.EOF && r.nread != r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *fileReader) Close() error {
+	return nil
+}
+
+// Extract calls fn for every entry, in the order they are stored, with a
+// reader of its contents, decompressing each folder only once. The
+// reader is only valid until fn returns, and need not be read entirely.
+func (cr *Reader) Extract(fn func(f *File, r io.Reader) error) error {
+	var fr *folderReader
+	current := -1
+	var pos int64
+	for _, f := range cr.File {
+		if f.folder >= folderContinuedFromPrev {
+			return ErrSpanned
+		}
+		if f.folder != current || f.offset < pos {
+			var err error
+			if fr, err = cr.openFolder(f.folder); err != nil {
+				return err
+			}
+			current, pos = f.folder, 0
+		}
+		n, err := io.CopyN(ioutil.Discard, fr, f.offset-pos)
+		pos += n
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		r := &countReader{r: &fileReader{r: io.LimitReader(fr, f.Size), size: f.Size}}
+		err = fn(f, r)
+		pos += r.n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// folderReader reads the uncompressed contents of a folder.
+type folderReader struct {
+	cr    *Reader
+	f     *folder
+	dec   BlockDecoder
+	pos   int64 // of the next data block
+	block int   // index of the next data block
+	buf   []byte
+}
+
+func (cr *Reader) openFolder(i int) (*folderReader, error) {
+	f := cr.folders[i]
+	dcomp := decompressor(f.compression & compressionMask)
+	if dcomp == nil {
+		return nil, fmt.Errorf("cab: unsupported %s compression", CompressionName(f.compression))
+	}
+	dec, err := dcomp(f.compression)
+	if err != nil {
+		return nil, err
+	}
+	return &folderReader{cr: cr, f: f, dec: dec, pos: f.dataStart}, nil
+}
+
+func (fr *folderReader) Read(p []byte) (int, error) {
+	for len(fr.buf) == 0 {
+		if fr.block == fr.f.blocks {
+			return 0, io.EOF
+		}
+		if err := fr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+// next decompresses the next data block.
+func (fr *folderReader) next() error {
+	le := binary.LittleEndian
+	hdr := make([]byte, dataLen+fr.f.dataReserve)
+	if _, err := fr.cr.r.ReadAt(hdr, fr.pos); err != nil {
+		return fr.ioErr(err)
+	}
+	sum := le.Uint32(hdr[0:])
+	compSize := int(le.Uint16(hdr[4:]))
+	size := int(le.Uint16(hdr[6:]))
+	if size == 0 {
+		return ErrSpanned
+	}
+	if size > maxBlockSize || compSize > maxBlockSize+6144 {
+		return ErrFormat
+	}
+	src := make([]byte, compSize)
+	if _, err := fr.cr.r.ReadAt(src, fr.pos+int64(len(hdr))); err != nil {
+		return fr.ioErr(err)
+	}
+	if sum != 0 && checksum(hdr[4:8], checksum(src, 0)) != sum {
+		return ErrChecksum
+	}
+	fr.pos += int64(len(hdr) + compSize)
+	fr.block++
+
+	data, err := fr.dec.Decode(src, size)
+	if err != nil {
+		return err
+	}
+	if len(data) != size {
+		return errors.New("cab: data block has the wrong size")
+	}
+	fr.buf = data
+	return nil
+}
+
+func (fr *folderReader) ioErr(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// checksum is the CFDATA checksum of b, seeded with sum.
+func checksum(b []byte, sum uint32) uint32 {
+	for ; len(b) >= 4; b = b[4:] {
+		sum ^= binary.LittleEndian.Uint32(b)
+	}
+	var tail uint32
+	for _, c := range b {
+		tail = tail<<8 | uint32(c)
+	}
+	return sum ^ tail
+}
@@ -0,0 +1,243 @@
+package cab
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testFile struct {
+	name   string
+	data   []byte
+	folder int
+	attrs  uint16
+}
+
+type testFolder struct {
+	compression uint16
+	checksums   bool
+	blocks      [][]byte // compressed data blocks, for LZX
+}
+
+var testTime = time.Date(2019, 3, 14, 15, 9, 26, 0, time.Local)
+
+func timeToMsDos(t time.Time) (date, tim uint16) {
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tim = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return
+}
+
+// buildCabinet writes a cabinet holding files, cutting each folder into
+// blocks of 32KiB. LZX folders take their compressed blocks from
+// testFolder.blocks.
+func buildCabinet(t *testing.T, folders []testFolder, files []testFile) []byte {
+	le := binary.LittleEndian
+	var filesPart []byte
+	offsets := make([]int, len(folders))
+	contents := make([][]byte, len(folders))
+	for _, f := range files {
+		var b [fileLen]byte
+		le.PutUint32(b[0:], uint32(len(f.data)))
+		le.PutUint32(b[4:], uint32(offsets[f.folder]))
+		le.PutUint16(b[8:], uint16(f.folder))
+		date, tim := timeToMsDos(testTime)
+		le.PutUint16(b[10:], date)
+		le.PutUint16(b[12:], tim)
+		le.PutUint16(b[14:], f.attrs)
+		filesPart = append(filesPart, b[:]...)
+		filesPart = append(filesPart, strings.Replace(f.name, "/", `\`, -1)...)
+		filesPart = append(filesPart, 0)
+		offsets[f.folder] += len(f.data)
+		contents[f.folder] = append(contents[f.folder], f.data...)
+	}
+
+	filesStart := headerLen + folderLen*len(folders)
+	dataStart := filesStart + len(filesPart)
+	var foldersPart, dataPart []byte
+	for i, folder := range folders {
+		var blocks [][]byte
+		var history []byte
+		for j, rest := 0, contents[i]; len(rest) > 0; j++ {
+			n := len(rest)
+			if n > maxBlockSize {
+				n = maxBlockSize
+			}
+			block := rest[:n]
+			rest = rest[n:]
+			comp := block
+			if folder.compression&compressionMask == LZX {
+				comp = folder.blocks[j]
+			}
+			if folder.compression == MSZIP {
+				var buf bytes.Buffer
+				buf.WriteString("CK")
+				fw, err := flate.NewWriterDict(&buf, flate.BestCompression, history)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fw.Write(block)
+				fw.Close()
+				comp = buf.Bytes()
+				history = block
+			}
+			var hdr [dataLen]byte
+			le.PutUint16(hdr[4:], uint16(len(comp)))
+			le.PutUint16(hdr[6:], uint16(len(block)))
+			if folder.checksums {
+				le.PutUint32(hdr[0:], checksum(hdr[4:8], checksum(comp, 0)))
+			}
+			blocks = append(blocks, append(hdr[:], comp...))
+		}
+		var b [folderLen]byte
+		le.PutUint32(b[0:], uint32(dataStart+len(dataPart)))
+		le.PutUint16(b[4:], uint16(len(blocks)))
+		le.PutUint16(b[6:], folder.compression)
+		foldersPart = append(foldersPart, b[:]...)
+		for _, block := range blocks {
+			dataPart = append(dataPart, block...)
+		}
+	}
+
+	hdr := make([]byte, headerLen)
+	copy(hdr, "MSCF")
+	le.PutUint32(hdr[8:], uint32(dataStart+len(dataPart)))
+	le.PutUint32(hdr[16:], uint32(filesStart))
+	hdr[24], hdr[25] = 3, 1
+	le.PutUint16(hdr[26:], uint16(len(folders)))
+	le.PutUint16(hdr[28:], uint16(len(files)))
+	le.PutUint16(hdr[32:], 1234)
+	cab := append(hdr, foldersPart...)
+	cab = append(cab, filesPart...)
+	return append(cab, dataPart...)
+}
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = "abcdefgh"[i*i%8] + byte(i/1000)
+	}
+	return b
+}
+
+var testFiles = []testFile{
+	{name: "readme.txt", data: []byte("Read me first.\r\n"), folder: 0, attrs: AttrReadOnly},
+	{name: "data/a.bin", data: testData(70000), folder: 1},
+	{name: "data/b.exe", data: []byte("MZ not really"), folder: 1, attrs: AttrExec | AttrArchive},
+	{name: "empty", data: nil, folder: 1},
+}
+
+func newTestCabinet(t *testing.T) *Reader {
+	b := buildCabinet(t, []testFolder{{Store, false, nil}, {MSZIP, true, nil}}, testFiles)
+	cr, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cr
+}
+
+func TestReader(t *testing.T) {
+	cr := newTestCabinet(t)
+	if cr.SetID != 1234 {
+		t.Errorf("SetID = %d", cr.SetID)
+	}
+	if len(cr.File) != len(testFiles) {
+		t.Fatalf("got %d files, want %d", len(cr.File), len(testFiles))
+	}
+	for i, f := range cr.File {
+		tf := testFiles[i]
+		if f.Name != tf.name || f.Size != int64(len(tf.data)) {
+			t.Errorf("file %d = %s (%d bytes), want %s (%d bytes)", i, f.Name, f.Size, tf.name, len(tf.data))
+		}
+		if !f.Modified.Equal(testTime) {
+			t.Errorf("%s: Modified = %v, want %v", f.Name, f.Modified, testTime)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+		}
+		if !bytes.Equal(got, tf.data) {
+			t.Errorf("%s: contents differ", f.Name)
+		}
+	}
+	if m := cr.File[0].Mode(); m != 0444 {
+		t.Errorf("read-only mode = %v", m)
+	}
+	if m := cr.File[2].Mode(); m != 0755 {
+		t.Errorf("exec mode = %v", m)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	cr := newTestCabinet(t)
+	var names []string
+	err := cr.Extract(func(f *File, r io.Reader) error {
+		names = append(names, f.Name)
+		if f.Name == "data/a.bin" {
+			// Leave most of it unread.
+			_, err := io.CopyN(ioutil.Discard, r, 100)
+			return err
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		for _, tf := range testFiles {
+			if tf.name == f.Name && !bytes.Equal(got, tf.data) {
+				t.Errorf("%s: contents differ", f.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(testFiles) {
+		t.Errorf("extracted %q", names)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	b := buildCabinet(t, []testFolder{{MSZIP, true, nil}}, []testFile{{name: "x", data: testData(1000)}})
+	b[len(b)-1] ^= 0xff
+	cr, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := cr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(rc); err != ErrChecksum {
+		t.Errorf("got %v, want ErrChecksum", err)
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	b := buildCabinet(t, []testFolder{{Quantum | 7<<4, false, nil}}, []testFile{{name: "x", data: []byte("x")}})
+	cr, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cr.File[0].Open()
+	if err == nil || !strings.Contains(err.Error(), "Quantum") {
+		t.Errorf("got %v, want an error naming Quantum", err)
+	}
+}
+
+func TestNotCabinet(t *testing.T) {
+	b := []byte("PK\x03\x04 definitely not a cabinet file header")
+	if _, err := NewReader(bytes.NewReader(b), int64(len(b))); err != ErrFormat {
+		t.Errorf("got %v, want ErrFormat", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Package gzipseek gives random access to gzip streams made of several
+// members, for reading parts of compressed tarballs (.tar.gz).
+//
+// Parallel compressors such as bgzip or mgzip, and concatenating .gz
+// files, produce streams of independently compressed members, which any
+// gzip decoder reads as one. Member boundaries are the only places
+// decompression can start from, so a Reader finds them all once, then
+// only decompresses the members covering the bytes asked for:
+//
+//	zr, _ := gzipseek.NewReader(f, size)
+//	tr := tar.NewReader(io.NewSectionReader(zr, offset, zr.Size()-offset))
+//	hdr, _ := tr.Next()
+//
+// Streams of a single member can be read too, but reads then decompress
+// everything before the bytes asked for.
+package gzipseek
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// A Member locates one gzip member of a stream, both in the stream and
+// in its decompressed contents.
+type Member struct {
+	CompressedOffset int64
+	CompressedSize   int64
+	Offset           int64 // decompressed
+	Size             int64 // decompressed
+}
+
+// Scan decompresses the gzip stream of the given size in r to find the
+// boundaries of its members.
+func Scan(r io.ReaderAt, size int64) ([]Member, error) {
+	cr := &countReader{r: bufio.NewReader(io.NewSectionReader(r, 0, size))}
+	var members []Member
+	var zr *gzip.Reader
+	var offset int64
+	for cr.n < size {
+		m := Member{CompressedOffset: cr.n, Offset: offset}
+		var err error
+		if zr == nil {
+			zr, err = gzip.NewReader(cr)
+		} else {
+			err = zr.Reset(cr)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		// The count is exact since gzip reads byte by byte from an
+		// io.ByteReader, and never past the end of a member.
+		zr.Multistream(false)
+		m.Size, err = io.Copy(ioutil.Discard, zr)
+		if err != nil {
+			return nil, err
+		}
+		m.CompressedSize = cr.n - m.CompressedOffset
+		offset += m.Size
+		members = append(members, m)
+	}
+	if len(members) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return members, nil
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// A Reader gives random access to the decompressed contents of a gzip
+// stream. It implements io.ReaderAt, which is safe for concurrent use,
+// and io.ReadSeeker.
+type Reader struct {
+	r       io.ReaderAt
+	members []Member
+	size    int64
+	pos     int64 // for Read and Seek
+
+	mu     sync.Mutex
+	dec    *gzip.Reader // positioned at decOff, in member decMem
+	decMem int
+	decOff int64
+}
+
+// NewReader scans the gzip stream of the given size in r for members
+// (see Scan).
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	members, err := Scan(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return NewReaderMembers(r, members), nil
+}
+
+// NewReaderMembers returns a Reader of r given its members, as returned
+// by Scan earlier, so that they need not be found again.
+func NewReaderMembers(r io.ReaderAt, members []Member) *Reader {
+	zr := &Reader{r: r, members: members, decMem: -1}
+	if n := len(members); n > 0 {
+		zr.size = members[n-1].Offset + members[n-1].Size
+	}
+	return zr
+}
+
+// Size returns the decompressed size of the stream.
+func (zr *Reader) Size() int64 {
+	return zr.size
+}
+
+// Members returns the members of the stream.
+func (zr *Reader) Members() []Member {
+	return zr.members
+}
+
+// Close releases the resources of the decoder. It does not close the
+// underlying reader.
+func (zr *Reader) Close() error {
+	zr.mu.Lock()
+	defer zr.mu.Unlock()
+	zr.dec = nil
+	zr.decMem = -1
+	return nil
+}
+
+// ReadAt reads decompressed data starting at off, decompressing the
+// members it spans from their start. The position reached is kept, so
+// sequential reads decompress each member once.
+func (zr *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gzipseek: negative offset")
+	}
+	n := 0
+	for len(p) > 0 {
+		if off >= zr.size {
+			return n, io.EOF
+		}
+		i := sort.Search(len(zr.members), func(i int) bool {
+			m := zr.members[i]
+			return m.Offset+m.Size > off
+		})
+		m, err := zr.readMember(i, p, off)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// readMember copies the decompressed contents of member i, from the
+// stream offset off, to p.
+func (zr *Reader) readMember(i int, p []byte, off int64) (int, error) {
+	zr.mu.Lock()
+	defer zr.mu.Unlock()
+	m := zr.members[i]
+	if zr.decMem != i || zr.decOff > off {
+		sr := bufio.NewReader(io.NewSectionReader(zr.r, m.CompressedOffset, m.CompressedSize))
+		var err error
+		if zr.dec == nil {
+			zr.dec, err = gzip.NewReader(sr)
+		} else {
+			err = zr.dec.Reset(sr)
+		}
+		if err != nil {
+			zr.decMem = -1
+			return 0, err
+		}
+		zr.dec.Multistream(false)
+		zr.decMem, zr.decOff = i, m.Offset
+	}
+	if skip := off - zr.decOff; skip > 0 {
+		if _, err := io.CopyN(ioutil.Discard, zr.dec, skip); err != nil {
+			zr.decMem = -1
+			return 0, unexpected(err)
+		}
+		zr.decOff = off
+	}
+	if left := m.Offset + m.Size - off; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := io.ReadFull(zr.dec, p)
+	zr.decOff += int64(n)
+	if err != nil {
+		zr.decMem = -1
+		return n, unexpected(err)
+	}
+	return n, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Read reads decompressed data from the current position.
+func (zr *Reader) Read(p []byte) (int, error) {
+	n, err := zr.ReadAt(p, zr.pos)
+	zr.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position for the next Read.
+func (zr *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += zr.pos
+	case io.SeekEnd:
+		offset += zr.size
+	default:
+		return 0, errors.New("gzipseek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gzipseek: negative position")
+	}
+	zr.pos = offset
+	return offset, nil
+}
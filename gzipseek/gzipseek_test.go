@@ -0,0 +1,154 @@
+package gzipseek
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/itchio/arkive/tar"
+)
+
+// memberWriter compresses everything written between calls to Cut into
+// a gzip member of its own, like bgzip does.
+type memberWriter struct {
+	out bytes.Buffer
+	buf bytes.Buffer
+	n   int64 // decompressed bytes written
+}
+
+func (w *memberWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return w.buf.Write(p)
+}
+
+func (w *memberWriter) Cut() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	zw := gzip.NewWriter(&w.out)
+	zw.Write(w.buf.Bytes())
+	zw.Close()
+	w.buf.Reset()
+}
+
+func TestMultiMemberTar(t *testing.T) {
+	mw := new(memberWriter)
+	tw := tar.NewWriter(mw)
+	offsets := make(map[string]int64)
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("file%02d.txt", i)
+		body := bytes.Repeat([]byte(name), 100*i+1)
+		if err := tw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			mw.Cut()
+		}
+		offsets[name] = mw.n
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mw.Cut()
+	compressed := mw.out.Bytes()
+
+	// Any gzip decoder reads the members as one stream.
+	dec, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err := ioutil.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(whole)) != mw.n {
+		t.Fatalf("decompressed %d bytes, want %d", len(whole), mw.n)
+	}
+
+	zr, err := NewReader(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if zr.Size() != mw.n || len(zr.Members()) != 7 {
+		t.Fatalf("got size %d in %d members, want %d in 7", zr.Size(), len(zr.Members()), mw.n)
+	}
+	var next int64
+	for i, m := range zr.Members() {
+		if m.CompressedOffset != next || m.CompressedSize <= 0 {
+			t.Errorf("member %d: %+v, want it at %d", i, m, next)
+		}
+		next += m.CompressedSize
+	}
+	if next != int64(len(compressed)) {
+		t.Errorf("members end at %d, want %d", next, len(compressed))
+	}
+
+	// Random access matches the decompressed stream, in any order.
+	for _, off := range []int64{10000, 0, 100, 4095, zr.Size() - 10, 4096} {
+		p := make([]byte, 5000)
+		n, err := zr.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(p[:n], whole[off:off+int64(n)]) {
+			t.Errorf("ReadAt(%d): contents differ", off)
+		}
+	}
+
+	// Jump straight to an entry.
+	off := offsets["file13.txt"]
+	tr := tar.NewReader(io.NewSectionReader(zr, off, zr.Size()-off))
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "file13.txt" || !bytes.Equal(body, bytes.Repeat([]byte(hdr.Name), 1301)) {
+		t.Errorf("got %s with %d bytes", hdr.Name, len(body))
+	}
+
+	// Known members need not be scanned again.
+	zr2 := NewReaderMembers(bytes.NewReader(compressed), zr.Members())
+	if _, err := zr2.Seek(off, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(zr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, whole[off:]) {
+		t.Errorf("Read after Seek: contents differ")
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bytes.Repeat([]byte("gzip "), 1000))
+	zw.Close()
+	b := buf.Bytes()
+
+	if _, err := Scan(bytes.NewReader(b), int64(len(b)-4)); err == nil {
+		t.Error("truncated stream scanned")
+	}
+	junk := append(append([]byte(nil), b...), "junk"...)
+	if _, err := Scan(bytes.NewReader(junk), int64(len(junk))); err == nil {
+		t.Error("stream with trailing junk scanned")
+	}
+	if _, err := Scan(bytes.NewReader(nil), 0); err == nil {
+		t.Error("empty stream scanned")
+	}
+}
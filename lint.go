@@ -0,0 +1,134 @@
+package arkive
+
+import (
+	"fmt"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// Checks reported by Lint, as found in LintWarning.Check.
+const (
+	// LintNonUTF8Name: a name has non-ASCII bytes but not the UTF-8
+	// flag nor a Unicode path extra field, so tools decode it with
+	// whatever legacy code page they assume, usually wrongly.
+	LintNonUTF8Name = "non-utf8-name"
+	// LintMissingZip64: an entry is too large, or too far into the
+	// archive, for the 32-bit fields of its header, and has no Zip64
+	// extra field to hold the real values.
+	LintMissingZip64 = "missing-zip64"
+	// LintZip64Version: an entry uses Zip64 but does not ask for
+	// version 4.5 to extract it, which some tools rely on.
+	LintZip64Version = "zip64-version"
+	// LintDirectoryBloat: the central directory is a large part of the
+	// archive, from many tiny entries or large extra fields; it is read
+	// in full before anything else, see Writer.SetDirectoryCompression.
+	LintDirectoryBloat = "directory-bloat"
+	// LintMisordered: entries are not listed in the order of their
+	// data, so reading them in order seeks back and forth.
+	LintMisordered = "misordered"
+	// LintHugeComment: the archive or an entry has a comment large
+	// enough to be data hidden in it rather than a note.
+	LintHugeComment = "huge-comment"
+	// LintUncommonMethod: an entry uses a compression method other than
+	// Store and Deflate, which many tools cannot read.
+	LintUncommonMethod = "uncommon-method"
+)
+
+// Thresholds of the Lint checks.
+const (
+	lintArchiveCommentSize = 4 << 10
+	lintEntryCommentSize   = 1 << 10
+	lintDirectorySize      = 1 << 20
+	lintDirectoryShare     = 0.1
+)
+
+// A LintWarning is a practice Lint found in an archive that hurts its
+// compatibility with other tools, or the performance of reading it.
+type LintWarning struct {
+	Check   string `json:"check"`
+	Entry   string `json:"entry,omitempty"` // empty for the whole archive
+	Message string `json:"message"`
+}
+
+func (w LintWarning) String() string {
+	if w.Entry == "" {
+		return fmt.Sprintf("%s: %s", w.Check, w.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", w.Check, w.Entry, w.Message)
+}
+
+// Lint looks for practices in r that hurt compatibility or performance,
+// for upload validation pipelines to report to the people packaging
+// archives. It only looks at the central directory. Warnings about the
+// whole archive come first, then those about entries in directory order.
+func Lint(r *zip.Reader) []LintWarning {
+	var archive, entries []LintWarning
+
+	if n := len(r.Comment); n > lintArchiveCommentSize {
+		archive = append(archive, LintWarning{Check: LintHugeComment,
+			Message: fmt.Sprintf("archive comment is %d bytes", n)})
+	}
+
+	var dirSize, dataSize int64
+	for _, f := range r.File {
+		dirSize += int64(46 + len(f.NameRaw) + len(f.Extra) + len(f.Comment))
+		dataSize += int64(30+len(f.NameRaw)) + int64(f.CompressedSize64)
+		entries = append(entries, lintEntry(f)...)
+	}
+	if total := dirSize + dataSize; dirSize > lintDirectorySize && float64(dirSize) > lintDirectoryShare*float64(total) {
+		archive = append(archive, LintWarning{Check: LintDirectoryBloat,
+			Message: fmt.Sprintf("central directory is %d bytes, %.0f%% of the archive", dirSize, 100*float64(dirSize)/float64(total))})
+	}
+
+	for i, f := range r.FilesByOffset() {
+		if f != r.File[i] {
+			archive = append(archive, LintWarning{Check: LintMisordered,
+				Message: fmt.Sprintf("entries are not listed in the order of their data, starting with %s", r.File[i].Name)})
+			break
+		}
+	}
+
+	return append(archive, entries...)
+}
+
+func lintEntry(f *zip.File) []LintWarning {
+	var warnings []LintWarning
+	warn := func(check, format string, args ...interface{}) {
+		warnings = append(warnings, LintWarning{Check: check, Entry: f.Name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if f.Flags&0x800 == 0 && f.NameUnicode == "" && !isASCII(f.NameRaw) {
+		warn(LintNonUTF8Name, "name has non-ASCII bytes but not the UTF-8 flag")
+	}
+
+	hasZip64 := false
+	for _, field := range f.ExtraFields() {
+		if field.ID == 0x0001 {
+			hasZip64 = true
+		}
+	}
+	const uint32max = 1<<32 - 1
+	if !hasZip64 && (f.UncompressedSize64 >= uint32max || f.CompressedSize64 >= uint32max) {
+		warn(LintMissingZip64, "%d bytes do not fit a header without Zip64", f.UncompressedSize64)
+	}
+	if hasZip64 && f.ReaderVersion < 45 {
+		warn(LintZip64Version, "uses Zip64 but asks for version %d.%d to extract, not 4.5", f.ReaderVersion/10, f.ReaderVersion%10)
+	}
+
+	if n := len(f.Comment); n > lintEntryCommentSize {
+		warn(LintHugeComment, "comment is %d bytes", n)
+	}
+	if f.Method != zip.Store && f.Method != zip.Deflate {
+		warn(LintUncommonMethod, "compressed with %s", zip.MethodName(f.Method))
+	}
+	return warnings
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
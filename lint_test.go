@@ -0,0 +1,74 @@
+package arkive
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "github.com/itchio/arkive/methods/zstd"
+	"github.com/itchio/arkive/zip"
+)
+
+func TestLint(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	w.SetDirectoryOrder(zip.ByName)
+	for _, fh := range []*zip.FileHeader{
+		{Name: "b.txt", Method: zip.Deflate},
+		{Name: "a.txt", Method: zip.Deflate, Comment: strings.Repeat("c", 2000)},
+		{Name: "caf\xe9.txt", Method: zip.Deflate, NonUTF8: true},
+		{Name: "d.bin", Method: zip.Zstd},
+	} {
+		if _, err := w.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.SetComment(strings.Repeat("x", 5000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, w := range Lint(r) {
+		got = append(got, w.Check+" "+w.Entry)
+	}
+	want := []string{
+		LintHugeComment + " ",
+		LintMisordered + " ",
+		LintHugeComment + " a.txt",
+		LintNonUTF8Name + " " + r.File[2].Name, // decoded as CP437
+		LintUncommonMethod + " d.bin",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLintDirectoryBloat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for i := 0; i < 12000; i++ {
+		name := fmt.Sprintf("assets/textures/very/deeply/nested/directory/%05d.png", i)
+		if _, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := Lint(r)
+	if len(warnings) != 1 || warnings[0].Check != LintDirectoryBloat {
+		t.Errorf("got %v, want a single %s warning", warnings, LintDirectoryBloat)
+	}
+}
@@ -0,0 +1,299 @@
+// Package arkive holds what is common to the archive formats of its
+// subpackages, such as listing any supported archive the same way.
+package arkive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/itchio/arkive/cab"
+	"github.com/itchio/arkive/msi"
+	"github.com/itchio/arkive/squashfs"
+	"github.com/itchio/arkive/tar"
+	"github.com/itchio/arkive/zip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnknownFormat is returned by List for files that are not in any of
+// the supported formats.
+var ErrUnknownFormat = errors.New("arkive: unknown archive format")
+
+// Formats, as reported in Listing.Format.
+const (
+	FormatZip      = "zip"
+	FormatTar      = "tar"
+	FormatTarGzip  = "tar.gz"
+	FormatTarZstd  = "tar.zst"
+	FormatSquashfs = "squashfs"
+	FormatCab      = "cab"
+	FormatMSI      = "msi"
+)
+
+// A Listing is the list of entries of an archive. Its JSON encoding is
+// the same for every format, so tools can rely on it.
+type Listing struct {
+	Format  string   `json:"format"`
+	Entries []*Entry `json:"entries"`
+}
+
+// An Entry describes one entry of a listed archive. Fields a format does
+// not record are left zero, and omitted from JSON when optional.
+type Entry struct {
+	// Name is the slash-separated path of the entry. Directories do not
+	// end with a slash.
+	Name string `json:"name"`
+
+	// Size is the uncompressed size of the entry, in bytes.
+	Size int64 `json:"size"`
+
+	// CompressedSize is the size of the entry as stored, for formats
+	// that compress entries individually.
+	CompressedSize int64 `json:"compressedSize,omitempty"`
+
+	// Method is the compression method, such as "Deflate".
+	Method string `json:"method,omitempty"`
+
+	ModTime time.Time `json:"mtime"`
+
+	// Mode holds the permission bits, as given to chmod, including the
+	// setuid, setgid and sticky bits.
+	Mode uint32 `json:"mode"`
+
+	IsDir bool `json:"isDir"`
+
+	// Symlink is the target of symbolic links.
+	Symlink string `json:"symlink,omitempty"`
+
+	// Hashes holds the checksums the archive records, by name, such as
+	// "crc32", in lowercase hexadecimal.
+	Hashes map[string]string `json:"hashes,omitempty"`
+
+	// Visibility is the access control tag of the entry, such as
+	// "public", for zip entries tagged with zip.FileHeader.SetVisibility.
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// List lists the archive in the named file.
+func List(name string) (*Listing, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ListReader(f, fi.Size())
+}
+
+// ListReader lists the archive in r, which is assumed to have the given
+// size in bytes. The format is detected from the contents.
+func ListReader(r io.ReaderAt, size int64) (*Listing, error) {
+	var magic [512]byte
+	n, err := r.ReadAt(magic[:], 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	b := magic[:n]
+
+	switch {
+	case bytes.HasPrefix(b, []byte("hsqs")):
+		return listSquashfs(r, size)
+	case bytes.HasPrefix(b, []byte("MSCF")):
+		return listCab(r, size)
+	case bytes.HasPrefix(b, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}):
+		return listMSI(r, size)
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return listTar(FormatTarGzip, zr)
+	case bytes.HasPrefix(b, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return listTar(FormatTarZstd, zr)
+	case len(b) == 512 && string(b[257:262]) == "ustar":
+		return listTar(FormatTar, io.NewSectionReader(r, 0, size))
+	}
+
+	// Zip archives may have data prepended, so they are recognized by
+	// their end.
+	l, err := listZip(r, size)
+	if err == zip.ErrFormat {
+		return nil, ErrUnknownFormat
+	}
+	return l, err
+}
+
+func listZip(r io.ReaderAt, size int64) (*Listing, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listing{Format: FormatZip}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		e := &Entry{
+			Name:           strings.TrimSuffix(f.Name, "/"),
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			Method:         zip.MethodName(f.Method),
+			ModTime:        f.Modified,
+			Mode:           unixPerm(mode),
+			IsDir:          mode.IsDir(),
+			Hashes:         map[string]string{"crc32": fmt.Sprintf("%08x", f.CRC32)},
+			Visibility:     f.Visibility(),
+		}
+		if mode&os.ModeSymlink != 0 {
+			// Zip archives store link targets as the entry's contents.
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			target, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			e.Symlink = string(target)
+		}
+		l.Entries = append(l.Entries, e)
+	}
+	return l, nil
+}
+
+func listTar(format string, r io.Reader) (*Listing, error) {
+	tr := tar.NewReader(r)
+	l := &Listing{Format: format}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return l, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		mode := hdr.FileInfo().Mode()
+		e := &Entry{
+			Name:    strings.TrimSuffix(hdr.Name, "/"),
+			Size:    hdr.Size,
+			ModTime: hdr.ModTime,
+			Mode:    unixPerm(mode),
+			IsDir:   mode.IsDir(),
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			e.Symlink = hdr.Linkname
+		}
+		l.Entries = append(l.Entries, e)
+	}
+}
+
+func listSquashfs(r io.ReaderAt, size int64) (*Listing, error) {
+	sr, err := squashfs.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listing{Format: FormatSquashfs}
+	err = sr.Walk(func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		e := &Entry{
+			Name:    name,
+			ModTime: fi.ModTime(),
+			Mode:    unixPerm(fi.Mode()),
+			IsDir:   fi.IsDir(),
+		}
+		if fi.Mode().IsRegular() {
+			e.Size = fi.Size()
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if e.Symlink, err = sr.ReadLink(name); err != nil {
+				return err
+			}
+		}
+		l.Entries = append(l.Entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func listCab(r io.ReaderAt, size int64) (*Listing, error) {
+	cr, err := cab.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listing{Format: FormatCab}
+	for _, f := range cr.File {
+		l.Entries = append(l.Entries, &Entry{
+			Name:    f.Name,
+			Size:    f.Size,
+			ModTime: f.Modified,
+			Mode:    unixPerm(f.Mode()),
+		})
+	}
+	return l, nil
+}
+
+// listMSI lists the files of the cabinets embedded in an MSI package.
+func listMSI(r io.ReaderAt, size int64) (*Listing, error) {
+	mr, err := msi.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	cabs, err := mr.Cabinets()
+	if err != nil {
+		return nil, err
+	}
+	l := &Listing{Format: FormatMSI}
+	for _, s := range cabs {
+		sr, err := s.Open()
+		if err != nil {
+			return nil, err
+		}
+		cl, err := listCab(sr, s.Size)
+		if err != nil {
+			return nil, fmt.Errorf("arkive: listing %s: %v", s.Name, err)
+		}
+		for _, e := range cl.Entries {
+			e.Name = path.Join(s.Name, e.Name)
+		}
+		l.Entries = append(l.Entries, cl.Entries...)
+	}
+	return l, nil
+}
+
+// unixPerm returns the chmod bits of mode.
+func unixPerm(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
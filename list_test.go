@@ -0,0 +1,164 @@
+package arkive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itchio/arkive/tar"
+	"github.com/itchio/arkive/zip"
+)
+
+var listTime = time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+
+func testZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, mode os.FileMode, method uint16, data string) {
+		h := &zip.FileHeader{Name: name, Method: method, Modified: listTime}
+		h.SetMode(mode)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	add("bin/", os.ModeDir|0755, zip.Store, "")
+	add("bin/game", 0755, zip.Deflate, strings.Repeat("game ", 100))
+	add("game", os.ModeSymlink|0777, zip.Store, "bin/game")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestListZip(t *testing.T) {
+	b := testZip(t)
+	l, err := ListReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Format != FormatZip || len(l.Entries) != 3 {
+		t.Fatalf("got %s with %d entries", l.Format, len(l.Entries))
+	}
+	dir, exe, link := l.Entries[0], l.Entries[1], l.Entries[2]
+	if dir.Name != "bin" || !dir.IsDir || dir.Mode != 0755 {
+		t.Errorf("dir = %+v", dir)
+	}
+	if exe.Name != "bin/game" || exe.Size != 500 || exe.Method != "Deflate" ||
+		exe.CompressedSize >= exe.Size || exe.Hashes["crc32"] == "" || !exe.ModTime.Equal(listTime) {
+		t.Errorf("file = %+v", exe)
+	}
+	if link.Symlink != "bin/game" {
+		t.Errorf("symlink = %+v", link)
+	}
+
+	j, err := json.Marshal(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"name":`, `"size":`, `"method":`, `"mtime":`, `"mode":`, `"isDir":`, `"hashes":`} {
+		if !bytes.Contains(j, []byte(key)) {
+			t.Errorf("JSON %s lacks %s", j, key)
+		}
+	}
+	if bytes.Contains(j, []byte(`"symlink"`)) || bytes.Contains(j, []byte(`"visibility"`)) {
+		t.Errorf("JSON %s has an empty symlink or visibility", j)
+	}
+}
+
+func TestListZipVisibility(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"icon.png", "game"} {
+		h := &zip.FileHeader{Name: name}
+		if name == "icon.png" {
+			h.SetVisibility(zip.VisibilityPublic)
+		}
+		if _, err := zw.CreateHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+
+	b := buf.Bytes()
+	l, err := ListReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := l.Entries[0].Visibility; v != zip.VisibilityPublic {
+		t.Errorf("icon.png: visibility %q", v)
+	}
+	if v := l.Entries[1].Visibility; v != "" {
+		t.Errorf("game: visibility %q", v)
+	}
+}
+
+func TestListTarGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	headers := []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: listTime},
+		{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 04755, Size: 5, ModTime: listTime},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/file", Mode: 0777, ModTime: listTime},
+	}
+	for _, h := range headers {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			tw.Write([]byte("hello"))
+		}
+	}
+	tw.Close()
+	zw.Close()
+
+	b := buf.Bytes()
+	l, err := ListReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Format != FormatTarGzip || len(l.Entries) != 3 {
+		t.Fatalf("got %s with %d entries", l.Format, len(l.Entries))
+	}
+	if e := l.Entries[0]; e.Name != "dir" || !e.IsDir {
+		t.Errorf("dir = %+v", e)
+	}
+	if e := l.Entries[1]; e.Size != 5 || e.Mode != 04755 || !e.ModTime.Equal(listTime) {
+		t.Errorf("file = %+v", e)
+	}
+	if e := l.Entries[2]; e.Symlink != "dir/file" {
+		t.Errorf("symlink = %+v", e)
+	}
+
+	// Streams of several members, as parallel compressors write, read
+	// as one.
+	zr, _ := gzip.NewReader(bytes.NewReader(b))
+	plain, _ := ioutil.ReadAll(zr)
+	var multi bytes.Buffer
+	for _, part := range [][]byte{plain[:700], plain[700:]} {
+		zw := gzip.NewWriter(&multi)
+		zw.Write(part)
+		zw.Close()
+	}
+	b = multi.Bytes()
+	if l, err = ListReader(bytes.NewReader(b), int64(len(b))); err != nil {
+		t.Fatal(err)
+	}
+	if l.Format != FormatTarGzip || len(l.Entries) != 3 {
+		t.Errorf("several members: got %s with %d entries", l.Format, len(l.Entries))
+	}
+}
+
+func TestListUnknown(t *testing.T) {
+	b := []byte(strings.Repeat("not an archive ", 100))
+	if _, err := ListReader(bytes.NewReader(b), int64(len(b))); err != ErrUnknownFormat {
+		t.Errorf("got %v, want ErrUnknownFormat", err)
+	}
+}
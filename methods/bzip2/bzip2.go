@@ -0,0 +1,24 @@
+// Package bzip2 registers a decompressor for zip entries compressed
+// with bzip2 (method 12), as written by Info-ZIP with -Z bzip2 and by
+// Python's zipfile, when imported:
+//
+//	import _ "github.com/itchio/arkive/methods/bzip2"
+//
+// No compressor is registered.
+package bzip2
+
+import (
+	"compress/bzip2"
+	"io"
+	"io/ioutil"
+
+	"github.com/itchio/arkive/zip"
+)
+
+func init() {
+	zip.RegisterDecompressor(zip.BZIP2, zip.Decompressor(newReader))
+}
+
+func newReader(r io.Reader, f *zip.File) io.ReadCloser {
+	return ioutil.NopCloser(bzip2.NewReader(r))
+}
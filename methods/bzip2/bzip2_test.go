@@ -0,0 +1,44 @@
+package bzip2
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+)
+
+func TestRegistered(t *testing.T) {
+	r, err := zip.OpenReader("testdata/bzip2.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f := r.File[0]
+	if f.Method != zip.BZIP2 {
+		t.Fatalf("method %s, want BZIP2", zip.MethodName(f.Method))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("hello, bzip2\n", 100); string(b) != want {
+		t.Errorf("read %q", b)
+	}
+
+	var found bool
+	for _, m := range zip.RegisteredMethods() {
+		if m.ID == zip.BZIP2 {
+			found = m.Read && !m.Write
+		}
+	}
+	if !found {
+		t.Error("BZIP2 is not listed as readable")
+	}
+}
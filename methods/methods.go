@@ -0,0 +1,18 @@
+// Package methods documents how compression methods that are not built
+// into arkive are added to it.
+//
+// Store and Deflate are built into package zip, gzip and zstd into
+// package squashfs, and stored, MSZIP and LZX folders into package
+// cab. Other methods live in subpackages of this one, each registering
+// its compressors and decompressors with the packages whose formats use
+// them when it is imported, so binaries only pull in the dependencies
+// of the methods they need:
+//
+//	import _ "github.com/itchio/arkive/methods/zstd"
+//
+// Subpackages register methods from their init function, with the
+// RegisterCompressor and RegisterDecompressor functions of the format
+// packages, and panic if the method was registered already, as those
+// functions do. Programs that want a different implementation register
+// it themselves instead of importing the subpackage.
+package methods
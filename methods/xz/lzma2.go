@@ -0,0 +1,593 @@
+package xz
+
+import (
+	"errors"
+	"io"
+)
+
+// This file is an LZMA2 decoder, following the description of the
+// format in the XZ Embedded sources and the LZMA SDK.
+
+var errCorrupt = errors.New("xz: corrupt data")
+
+const (
+	numStates    = 12
+	maxPosStates = 1 << 4
+	minMatchLen  = 2
+
+	numLenStates    = 4
+	numPosSlotBits  = 6
+	startPosModel   = 4
+	endPosModel     = 14
+	numFullDistance = 1 << (endPosModel >> 1)
+	numAlignBits    = 4
+
+	probInit = 1 << 10
+)
+
+// rangeDecoder decodes the bits of an LZMA chunk.
+type rangeDecoder struct {
+	br   io.ByteReader
+	rng  uint32
+	code uint32
+	err  error // sticky, from br
+}
+
+func (rc *rangeDecoder) init(br io.ByteReader) error {
+	rc.br = br
+	rc.rng = 0xffffffff
+	rc.code = 0
+	rc.err = nil
+	b, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != 0 {
+		return errCorrupt
+	}
+	for i := 0; i < 4; i++ {
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+	if rc.code == rc.rng {
+		return errCorrupt
+	}
+	return rc.err
+}
+
+func (rc *rangeDecoder) readByte() byte {
+	b, err := rc.br.ReadByte()
+	if err != nil && rc.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		rc.err = err
+	}
+	return b
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng < 1<<24 {
+		rc.rng <<= 8
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+}
+
+// bit decodes a bit with the probability p of it being 0, and adapts p.
+func (rc *rangeDecoder) bit(p *uint16) uint32 {
+	rc.normalize()
+	bound := (rc.rng >> 11) * uint32(*p)
+	if rc.code < bound {
+		rc.rng = bound
+		*p += (1<<11 - *p) >> 5
+		return 0
+	}
+	rc.rng -= bound
+	rc.code -= bound
+	*p -= *p >> 5
+	return 1
+}
+
+// direct decodes n bits of equal probability.
+func (rc *rangeDecoder) direct(n uint) uint32 {
+	var v uint32
+	for ; n > 0; n-- {
+		rc.normalize()
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		v = v<<1 + t + 1
+	}
+	return v
+}
+
+// tree decodes a symbol of len(probs) bits, most significant first.
+func (rc *rangeDecoder) tree(probs []uint16) uint32 {
+	m := uint32(1)
+	for m < uint32(len(probs)) {
+		m = m<<1 | rc.bit(&probs[m])
+	}
+	return m - uint32(len(probs))
+}
+
+// reverseTree decodes a symbol of n bits, least significant first.
+func (rc *rangeDecoder) reverseTree(probs []uint16, n uint) uint32 {
+	m := uint32(1)
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		b := rc.bit(&probs[m])
+		m = m<<1 | b
+		v |= b << i
+	}
+	return v
+}
+
+// lenDecoder decodes match lengths.
+type lenDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [maxPosStates][1 << 3]uint16
+	mid     [maxPosStates][1 << 3]uint16
+	high    [1 << 8]uint16
+}
+
+func (ld *lenDecoder) reset() {
+	ld.choice = probInit
+	ld.choice2 = probInit
+	resetProbs(ld.high[:])
+	for i := range ld.low {
+		resetProbs(ld.low[i][:])
+		resetProbs(ld.mid[i][:])
+	}
+}
+
+// decode returns the length of a match, minus minMatchLen.
+func (ld *lenDecoder) decode(rc *rangeDecoder, posState uint32) uint32 {
+	if rc.bit(&ld.choice) == 0 {
+		return rc.tree(ld.low[posState][:])
+	}
+	if rc.bit(&ld.choice2) == 0 {
+		return 8 + rc.tree(ld.mid[posState][:])
+	}
+	return 16 + rc.tree(ld.high[:])
+}
+
+func resetProbs(probs []uint16) {
+	for i := range probs {
+		probs[i] = probInit
+	}
+}
+
+// window is the dictionary of the decoder: the last bytes it produced,
+// which matches copy from. It grows as needed up to its size.
+type window struct {
+	buf  []byte
+	size int
+	pos  int // where the next byte goes, once buf is full
+	full bool
+}
+
+func (w *window) reset() {
+	w.buf = w.buf[:0]
+	w.pos = 0
+	w.full = false
+}
+
+func (w *window) put(b byte) {
+	if !w.full {
+		w.buf = append(w.buf, b)
+		if len(w.buf) == w.size {
+			w.full = true
+		}
+		return
+	}
+	w.buf[w.pos] = b
+	w.pos++
+	if w.pos == len(w.buf) {
+		w.pos = 0
+	}
+}
+
+// back returns the byte dist+1 bytes back.
+func (w *window) back(dist uint32) byte {
+	if !w.full {
+		return w.buf[len(w.buf)-1-int(dist)]
+	}
+	i := w.pos - 1 - int(dist)
+	if i < 0 {
+		i += len(w.buf)
+	}
+	return w.buf[i]
+}
+
+// has reports whether the byte dist+1 bytes back is there.
+func (w *window) has(dist uint32) bool {
+	return int64(dist) < int64(len(w.buf))
+}
+
+// lzma2Reader decodes an LZMA2 stream, up to its end marker.
+type lzma2Reader struct {
+	br  io.ByteReader
+	win window
+	rc  rangeDecoder
+
+	// current chunk
+	chunk      chunkReader
+	unpacked   int  // bytes left to produce
+	compressed bool // LZMA rather than stored
+	needDict   bool // the first chunk must reset the dictionary
+	needProps  bool // the next LZMA chunk must set properties
+	eof        bool
+	err        error
+
+	// LZMA state
+	lc, lp, pb uint
+	state      uint32
+	rep        [4]uint32
+	pending    int    // bytes of the current match left to copy
+	total      uint32 // bytes since the dictionary was reset, for its low bits
+
+	isMatch    [numStates * maxPosStates]uint16
+	isRep      [numStates]uint16
+	isRepG0    [numStates]uint16
+	isRepG1    [numStates]uint16
+	isRepG2    [numStates]uint16
+	isRep0Long [numStates * maxPosStates]uint16
+	posSlot    [numLenStates][1 << numPosSlotBits]uint16
+	posSpecial [1 + numFullDistance - endPosModel]uint16
+	align      [1 << numAlignBits]uint16
+	lenDec     lenDecoder
+	repLenDec  lenDecoder
+	literal    []uint16
+}
+
+// chunkReader limits the range decoder to the bytes of a chunk.
+type chunkReader struct {
+	br io.ByteReader
+	n  int
+}
+
+func (cr *chunkReader) ReadByte() (byte, error) {
+	if cr.n <= 0 {
+		return 0, errCorrupt
+	}
+	cr.n--
+	return cr.br.ReadByte()
+}
+
+func newLZMA2Reader(br io.ByteReader, dictSize int) *lzma2Reader {
+	z := &lzma2Reader{br: br, needDict: true, needProps: true}
+	z.win.size = dictSize
+	return z
+}
+
+func (z *lzma2Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && z.err == nil {
+		if z.unpacked == 0 {
+			if z.compressed {
+				// The encoder normalizes after the last bit, the
+				// decoder before every bit.
+				z.rc.normalize()
+				if z.rc.err != nil || z.chunk.n != 0 || z.pending > 0 {
+					z.err = errCorrupt
+					break
+				}
+				z.compressed = false
+			}
+			z.err = z.nextChunk()
+			continue
+		}
+		out := p[n:]
+		if len(out) > z.unpacked {
+			out = out[:z.unpacked]
+		}
+		var m int
+		if z.compressed {
+			m = z.decode(out)
+		} else {
+			m, z.err = z.copyStored(out)
+		}
+		n += m
+		z.unpacked -= m
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, z.err
+}
+
+// nextChunk reads the header of the next chunk. It returns io.EOF at
+// the end of the stream.
+func (z *lzma2Reader) nextChunk() error {
+	if z.eof {
+		return io.EOF
+	}
+	control, err := z.readByte()
+	if err != nil {
+		return err
+	}
+	if control == 0 {
+		z.eof = true
+		return io.EOF
+	}
+	if control == 1 || control == 2 {
+		if control == 1 {
+			z.resetDict()
+		} else if z.needDict {
+			return errCorrupt
+		}
+		size, err := z.readUint16()
+		if err != nil {
+			return err
+		}
+		z.compressed = false
+		z.unpacked = int(size) + 1
+		return nil
+	}
+	if control < 0x80 {
+		return errCorrupt
+	}
+
+	reset := control >> 5 & 3
+	if reset == 3 {
+		z.resetDict()
+	} else if z.needDict {
+		return errCorrupt
+	}
+	size, err := z.readUint16()
+	if err != nil {
+		return err
+	}
+	z.unpacked = int(control&0x1f)<<16 + int(size) + 1
+	size, err = z.readUint16()
+	if err != nil {
+		return err
+	}
+	z.chunk = chunkReader{br: z.br, n: int(size) + 1}
+	if reset >= 2 {
+		props, err := z.readByte()
+		if err != nil {
+			return err
+		}
+		if err := z.setProps(props); err != nil {
+			return err
+		}
+		z.needProps = false
+	} else if z.needProps {
+		return errCorrupt
+	}
+	if reset >= 1 {
+		z.resetState()
+	}
+	z.compressed = true
+	return z.rc.init(&z.chunk)
+}
+
+func (z *lzma2Reader) resetDict() {
+	z.win.reset()
+	z.total = 0
+	z.needDict = false
+}
+
+func (z *lzma2Reader) readByte() (byte, error) {
+	b, err := z.br.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+func (z *lzma2Reader) readUint16() (uint16, error) {
+	hi, err := z.readByte()
+	if err != nil {
+		return 0, err
+	}
+	lo, err := z.readByte()
+	return uint16(hi)<<8 | uint16(lo), err
+}
+
+func (z *lzma2Reader) setProps(props byte) error {
+	if props >= 9*5*5 {
+		return errCorrupt
+	}
+	z.pb = uint(props / 45)
+	props %= 45
+	z.lp = uint(props / 9)
+	z.lc = uint(props % 9)
+	if z.lc+z.lp > 4 {
+		return errCorrupt
+	}
+	return nil
+}
+
+func (z *lzma2Reader) resetState() {
+	z.state = 0
+	z.rep = [4]uint32{}
+	z.pending = 0
+	resetProbs(z.isMatch[:])
+	resetProbs(z.isRep[:])
+	resetProbs(z.isRepG0[:])
+	resetProbs(z.isRepG1[:])
+	resetProbs(z.isRepG2[:])
+	resetProbs(z.isRep0Long[:])
+	for i := range z.posSlot {
+		resetProbs(z.posSlot[i][:])
+	}
+	resetProbs(z.posSpecial[:])
+	resetProbs(z.align[:])
+	z.lenDec.reset()
+	z.repLenDec.reset()
+	n := 0x300 << (z.lc + z.lp)
+	if cap(z.literal) < n {
+		z.literal = make([]uint16, n)
+	}
+	z.literal = z.literal[:n]
+	resetProbs(z.literal)
+}
+
+func (z *lzma2Reader) copyStored(out []byte) (int, error) {
+	for i := range out {
+		b, err := z.readByte()
+		if err != nil {
+			return i, err
+		}
+		out[i] = b
+		z.win.put(b)
+	}
+	return len(out), nil
+}
+
+// decode fills out from the current LZMA chunk, which has at least
+// len(out) bytes left.
+func (z *lzma2Reader) decode(out []byte) int {
+	rc := &z.rc
+	n := 0
+	for n < len(out) {
+		if z.pending > 0 {
+			out[n] = z.emit(z.win.back(z.rep[0]))
+			n++
+			z.pending--
+			continue
+		}
+		if rc.err != nil {
+			z.err = rc.err
+			return n
+		}
+
+		posState := z.total & (1<<z.pb - 1)
+		if rc.bit(&z.isMatch[z.state*maxPosStates+posState]) == 0 {
+			out[n] = z.emit(z.decodeLiteral())
+			n++
+			continue
+		}
+
+		var length uint32
+		if rc.bit(&z.isRep[z.state]) == 0 {
+			length = z.lenDec.decode(rc, posState) + minMatchLen
+			z.rep[3], z.rep[2], z.rep[1] = z.rep[2], z.rep[1], z.rep[0]
+			z.rep[0] = z.decodeDistance(length)
+			if z.state < 7 {
+				z.state = 7
+			} else {
+				z.state = 10
+			}
+		} else {
+			if rc.bit(&z.isRepG0[z.state]) == 0 {
+				if rc.bit(&z.isRep0Long[z.state*maxPosStates+posState]) == 0 {
+					// a single byte at rep0
+					if z.state < 7 {
+						z.state = 9
+					} else {
+						z.state = 11
+					}
+					length = 1
+				}
+			} else {
+				var dist uint32
+				if rc.bit(&z.isRepG1[z.state]) == 0 {
+					dist = z.rep[1]
+				} else {
+					if rc.bit(&z.isRepG2[z.state]) == 0 {
+						dist = z.rep[2]
+					} else {
+						dist = z.rep[3]
+						z.rep[3] = z.rep[2]
+					}
+					z.rep[2] = z.rep[1]
+				}
+				z.rep[1] = z.rep[0]
+				z.rep[0] = dist
+			}
+			if length == 0 {
+				length = z.repLenDec.decode(rc, posState) + minMatchLen
+				if z.state < 7 {
+					z.state = 8
+				} else {
+					z.state = 11
+				}
+			}
+		}
+		// Matches may not reach before the start of the dictionary,
+		// nor past the end of the chunk. An end marker, which LZMA2
+		// does not use, fails the first test.
+		z.pending = int(length)
+		if !z.win.has(z.rep[0]) || z.pending > z.unpacked-n {
+			z.err = errCorrupt
+			return n
+		}
+	}
+	return n
+}
+
+// emit adds b to the dictionary and returns it.
+func (z *lzma2Reader) emit(b byte) byte {
+	z.win.put(b)
+	z.total++
+	return b
+}
+
+func (z *lzma2Reader) decodeLiteral() byte {
+	var prev uint32
+	if len(z.win.buf) > 0 {
+		prev = uint32(z.win.back(0))
+	}
+	lpMask := uint32(1)<<z.lp - 1
+	i := 0x300 * ((z.total&lpMask)<<z.lc + prev>>(8-z.lc))
+	probs := z.literal[i : i+0x300]
+
+	rc := &z.rc
+	sym := uint32(1)
+	if z.state >= 7 && z.win.has(z.rep[0]) {
+		// After a match, the byte following the match in the
+		// dictionary predicts the literal.
+		match := uint32(z.win.back(z.rep[0]))
+		offset := uint32(0x100)
+		for sym < 0x100 {
+			match <<= 1
+			matchBit := match & offset
+			if rc.bit(&probs[offset+matchBit+sym]) == 1 {
+				sym = sym<<1 | 1
+				offset = matchBit
+			} else {
+				sym <<= 1
+				offset ^= matchBit
+			}
+		}
+	} else {
+		for sym < 0x100 {
+			sym = sym<<1 | rc.bit(&probs[sym])
+		}
+	}
+
+	switch {
+	case z.state < 4:
+		z.state = 0
+	case z.state < 10:
+		z.state -= 3
+	default:
+		z.state -= 6
+	}
+	return byte(sym)
+}
+
+// decodeDistance decodes the distance of a match of the given length,
+// as a number of bytes back minus one.
+func (z *lzma2Reader) decodeDistance(length uint32) uint32 {
+	rc := &z.rc
+	lenState := length - minMatchLen
+	if lenState > numLenStates-1 {
+		lenState = numLenStates - 1
+	}
+	slot := rc.tree(z.posSlot[lenState][:])
+	if slot < startPosModel {
+		return slot
+	}
+	bits := uint(slot>>1) - 1
+	dist := (2 | slot&1) << bits
+	if slot < endPosModel {
+		return dist + rc.reverseTree(z.posSpecial[dist-slot:], bits)
+	}
+	dist += rc.direct(bits-numAlignBits) << numAlignBits
+	return dist + rc.reverseTree(z.align[:], numAlignBits)
+}
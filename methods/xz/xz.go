@@ -0,0 +1,459 @@
+// Package xz registers decompressors for data compressed with XZ when
+// imported: zip entries of method 95, as written by 7-Zip and Info-ZIP,
+// and squashfs images made with mksquashfs -comp xz, such as many
+// AppImages:
+//
+//	import _ "github.com/itchio/arkive/methods/xz"
+//
+// Only the LZMA2 filter is supported, which is what xz and mksquashfs
+// use unless told to add branch converters. No compressor is
+// registered.
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"io/ioutil"
+
+	"github.com/itchio/arkive/squashfs"
+	"github.com/itchio/arkive/zip"
+)
+
+func init() {
+	zip.RegisterDecompressor(zip.XZ, zip.Decompressor(newZipReader))
+	squashfs.RegisterDecompressor(squashfs.XZ, squashfs.Decompressor(decompressBlock))
+}
+
+func newZipReader(r io.Reader, f *zip.File) io.ReadCloser {
+	return ioutil.NopCloser(newReader(r))
+}
+
+// decompressBlock decompresses a squashfs block, which is a whole XZ
+// stream of at most size bytes once decompressed.
+func decompressBlock(src []byte, size int) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(newReader(bytes.NewReader(src)), int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > size {
+		return nil, errors.New("xz: block larger than the block size")
+	}
+	return b, nil
+}
+
+const (
+	headerMagic   = "\xfd7zXZ\x00"
+	footerMagic   = "YZ"
+	streamHdrLen  = 12
+	lzma2FilterID = 0x21
+)
+
+// Integrity checks, from the stream flags.
+const (
+	checkNone   = 0
+	checkCRC32  = 1
+	checkCRC64  = 4
+	checkSHA256 = 10
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// reader decodes XZ streams, one after the other, as the xz command
+// does with concatenated files.
+type reader struct {
+	br *countingReader
+
+	streams int
+	check   byte
+	blocks  []blockRecord // of the current stream
+	block   *lzma2Reader  // nil between blocks
+	start   int64         // of the current block
+	hash    hash.Hash     // of the current block, nil for checkNone
+	size    int64         // produced by the current block
+	err     error
+
+	indexSize int64 // of the current stream, once read
+}
+
+type blockRecord struct {
+	unpadded, uncompressed int64
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{br: &countingReader{r: bufio.NewReader(r)}}
+}
+
+func (z *reader) Read(p []byte) (int, error) {
+	for z.err == nil {
+		if z.block == nil {
+			z.err = z.nextBlock()
+			continue
+		}
+		n, err := z.block.Read(p)
+		z.size += int64(n)
+		if z.hash != nil {
+			z.hash.Write(p[:n])
+		}
+		if err == io.EOF {
+			err = z.endBlock()
+		}
+		if err != nil {
+			z.err = err
+		}
+		if n > 0 || len(p) == 0 {
+			return n, nil
+		}
+	}
+	return 0, z.err
+}
+
+// nextBlock reads the header of the next block, going through the index
+// and the footer of the current stream, and the header of the next one,
+// as needed. It returns io.EOF after the last stream.
+func (z *reader) nextBlock() error {
+	if z.streams == 0 {
+		if err := z.readStreamHeader(); err != nil {
+			return err
+		}
+	}
+	z.start = z.br.n
+	size, err := z.br.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	if size == 0 {
+		if err := z.readIndex(); err != nil {
+			return err
+		}
+		if err := z.readStreamFooter(); err != nil {
+			return err
+		}
+		return z.nextStream()
+	}
+
+	hdr := make([]byte, (int(size)+1)*4)
+	hdr[0] = size
+	if _, err := io.ReadFull(z.br, hdr[1:]); err != nil {
+		return unexpected(err)
+	}
+	n := len(hdr) - 4
+	if crc32.ChecksumIEEE(hdr[:n]) != binary.LittleEndian.Uint32(hdr[n:]) {
+		return errors.New("xz: block header checksum mismatch")
+	}
+	b := hdr[1:n]
+	flags := b[0]
+	b = b[1:]
+	if flags&0x3c != 0 {
+		return errors.New("xz: unsupported block flags")
+	}
+	if flags&0x40 != 0 {
+		if _, b, err = uvarint(b); err != nil {
+			return err
+		}
+	}
+	if flags&0x80 != 0 {
+		if _, b, err = uvarint(b); err != nil {
+			return err
+		}
+	}
+	if flags&3 != 0 {
+		return errors.New("xz: filters other than LZMA2 are not supported")
+	}
+	id, b, err := uvarint(b)
+	if err != nil {
+		return err
+	}
+	propsLen, b, err := uvarint(b)
+	if err != nil {
+		return err
+	}
+	if id != lzma2FilterID {
+		return fmt.Errorf("xz: filter %#x is not supported", id)
+	}
+	if propsLen != 1 || len(b) < 1 {
+		return errCorrupt
+	}
+	dictSize, err := lzma2DictSize(b[0])
+	if err != nil {
+		return err
+	}
+	for _, pad := range b[1:] {
+		if pad != 0 {
+			return errCorrupt
+		}
+	}
+
+	z.block = newLZMA2Reader(z.br, dictSize)
+	z.size = 0
+	switch z.check {
+	case checkCRC32:
+		z.hash = crc32.NewIEEE()
+	case checkCRC64:
+		z.hash = crc64.New(crc64Table)
+	case checkSHA256:
+		z.hash = sha256.New()
+	default:
+		z.hash = nil
+	}
+	return nil
+}
+
+// endBlock reads the padding and check of the block just decoded.
+func (z *reader) endBlock() error {
+	unpadded := z.br.n - z.start
+	for z.br.n%4 != 0 {
+		b, err := z.br.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		if b != 0 {
+			return errCorrupt
+		}
+	}
+	sum := make([]byte, checkSize(z.check))
+	if _, err := io.ReadFull(z.br, sum); err != nil {
+		return unexpected(err)
+	}
+	if z.hash != nil {
+		got := z.hash.Sum(nil)
+		if z.check != checkSHA256 {
+			// CRCs are stored little-endian.
+			for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+				got[i], got[j] = got[j], got[i]
+			}
+		}
+		if !bytes.Equal(got, sum) {
+			return errors.New("xz: checksum mismatch")
+		}
+	}
+	z.blocks = append(z.blocks, blockRecord{unpadded + int64(len(sum)), z.size})
+	z.block = nil
+	return nil
+}
+
+func (z *reader) readStreamHeader() error {
+	var hdr [streamHdrLen]byte
+	if _, err := io.ReadFull(z.br, hdr[:]); err != nil {
+		if z.streams > 0 && err == io.EOF {
+			return io.EOF
+		}
+		return unexpected(err)
+	}
+	if string(hdr[:6]) != headerMagic {
+		return errors.New("xz: not an XZ stream")
+	}
+	if hdr[6] != 0 || hdr[7] > 0x0f || crc32.ChecksumIEEE(hdr[6:8]) != binary.LittleEndian.Uint32(hdr[8:]) {
+		return errors.New("xz: unsupported or corrupt stream flags")
+	}
+	z.check = hdr[7]
+	z.blocks = z.blocks[:0]
+	z.streams++
+	return nil
+}
+
+// readIndex reads the index of the current stream, whose indicator was
+// read already, and checks it lists the blocks decoded.
+func (z *reader) readIndex() error {
+	h := crc32.NewIEEE()
+	h.Write([]byte{0})
+	r := &countingReader{r: io.TeeReader(z.br, h), n: 1}
+	count, err := readUvarint(r)
+	if err != nil {
+		return err
+	}
+	if count != uint64(len(z.blocks)) {
+		return errors.New("xz: index does not match the blocks")
+	}
+	for _, rec := range z.blocks {
+		unpadded, err := readUvarint(r)
+		if err != nil {
+			return err
+		}
+		uncompressed, err := readUvarint(r)
+		if err != nil {
+			return err
+		}
+		if unpadded != uint64(rec.unpadded) || uncompressed != uint64(rec.uncompressed) {
+			return errors.New("xz: index does not match the blocks")
+		}
+	}
+	for r.n%4 != 0 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		if b != 0 {
+			return errCorrupt
+		}
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(z.br, sum[:]); err != nil {
+		return unexpected(err)
+	}
+	if h.Sum32() != binary.LittleEndian.Uint32(sum[:]) {
+		return errors.New("xz: index checksum mismatch")
+	}
+	z.indexSize = r.n + 4
+	return nil
+}
+
+func (z *reader) readStreamFooter() error {
+	var ftr [streamHdrLen]byte
+	if _, err := io.ReadFull(z.br, ftr[:]); err != nil {
+		return unexpected(err)
+	}
+	if string(ftr[10:]) != footerMagic || crc32.ChecksumIEEE(ftr[4:10]) != binary.LittleEndian.Uint32(ftr[:4]) {
+		return errors.New("xz: corrupt stream footer")
+	}
+	if ftr[8] != 0 || ftr[9] != z.check {
+		return errors.New("xz: stream footer flags do not match the header")
+	}
+	if (int64(binary.LittleEndian.Uint32(ftr[4:]))+1)*4 != z.indexSize {
+		return errors.New("xz: stream footer does not match the index")
+	}
+	return nil
+}
+
+// nextStream skips stream padding, then reads the header of the next
+// stream, if any.
+func (z *reader) nextStream() error {
+	for {
+		b, err := z.br.peek()
+		if err == io.EOF {
+			if z.br.n%4 != 0 {
+				return errCorrupt
+			}
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+		if b != 0 {
+			break
+		}
+		z.br.ReadByte()
+	}
+	if z.br.n%4 != 0 {
+		return errCorrupt
+	}
+	if err := z.readStreamHeader(); err != nil {
+		return err
+	}
+	return z.nextBlock()
+}
+
+// lzma2DictSize decodes the dictionary size in the properties of the
+// LZMA2 filter. Sizes that do not fit in an int are clamped, since the
+// dictionary only grows as data is decoded.
+func lzma2DictSize(props byte) (int, error) {
+	if props > 40 {
+		return 0, errCorrupt
+	}
+	size := uint64(0xffffffff)
+	if props < 40 {
+		size = uint64(2|props&1) << (props/2 + 11)
+	}
+	if maxInt := uint64(^uint(0) >> 1); size > maxInt {
+		size = maxInt
+	}
+	return int(size), nil
+}
+
+// checkSize returns the size of the check of the given type. Types not
+// defined yet have sizes reserved for them.
+func checkSize(check byte) int {
+	switch {
+	case check == 0:
+		return 0
+	case check <= 3:
+		return 4
+	case check <= 6:
+		return 8
+	case check <= 9:
+		return 16
+	case check <= 12:
+		return 32
+	}
+	return 64
+}
+
+// uvarint decodes a variable-length integer, as used in XZ headers, at
+// the start of b.
+func uvarint(b []byte) (uint64, []byte, error) {
+	v, err := readUvarint(bytes.NewReader(b))
+	if err != nil {
+		return 0, nil, err
+	}
+	n := 1
+	for b[n-1]&0x80 != 0 {
+		n++
+	}
+	return v, b[n:], nil
+}
+
+func readUvarint(br io.ByteReader) (uint64, error) {
+	var v uint64
+	for i := uint(0); i < 9; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, unexpected(err)
+		}
+		v |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			if b == 0 && i > 0 {
+				return 0, errCorrupt
+			}
+			return v, nil
+		}
+	}
+	return 0, errCorrupt
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader counts the bytes read through it, for the alignment
+// of XZ structures.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	if br, ok := cr.r.(io.ByteReader); ok {
+		b, err := br.ReadByte()
+		if err == nil {
+			cr.n++
+		}
+		return b, err
+	}
+	var b [1]byte
+	_, err := io.ReadFull(cr, b[:])
+	return b[0], err
+}
+
+func (cr *countingReader) peek() (byte, error) {
+	b, err := cr.r.(*bufio.Reader).Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
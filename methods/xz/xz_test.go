@@ -0,0 +1,145 @@
+package xz
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// The files in testdata were made with Python's lzma module and the xz
+// command from testContents, whose generator they share.
+func testContents(n int) []byte {
+	words := []string{"arkive ", "squashfs ", "xz ", "lzma2 ", "zip ", "block ", "dictionary ", "\n"}
+	var b []byte
+	x := uint32(1)
+	for len(b) < n {
+		x = x*1103515245 + 12345
+		b = append(b, words[(x>>16)%uint32(len(words))]...)
+	}
+	return b[:n]
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	contents := testContents(200000)
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		// CRC64 check, one block
+		{"stream.xz", contents},
+		// SHA-256 check, several blocks with sizes in their headers,
+		// then stream padding and a stream with a CRC32 check
+		{"multi.xz", append(append([]byte{}, contents...), "second stream\n"...)},
+		// lc=2 lp=2 pb=1, no check
+		{"props.xz", contents[:50000]},
+	}
+	for _, tt := range tests {
+		got, err := ioutil.ReadAll(newReader(bytes.NewReader(readTestdata(t, tt.name))))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: decoded %d bytes, not the expected %d", tt.name, len(got), len(tt.want))
+		}
+	}
+}
+
+func TestStoredChunks(t *testing.T) {
+	// Two uncompressed LZMA2 chunks, the first resetting the
+	// dictionary, then the end marker.
+	stream := []byte{1, 0, 4, 'h', 'e', 'l', 'l', 'o', 2, 0, 5, ',', ' ', 'x', 'z', '!', '\n', 0}
+	got, err := ioutil.ReadAll(newLZMA2Reader(bytes.NewReader(stream), 1<<12))
+	if err != nil || string(got) != "hello, xz!\n" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	// Without a dictionary reset first
+	stream[0] = 2
+	if _, err := ioutil.ReadAll(newLZMA2Reader(bytes.NewReader(stream), 1<<12)); err == nil {
+		t.Error("no error without a dictionary reset")
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	src := readTestdata(t, "stream.xz")
+	for _, off := range []int{3, 20, len(src) / 2, len(src) - 20, len(src) - 3} {
+		b := append([]byte{}, src...)
+		b[off] ^= 0x55
+		if _, err := ioutil.ReadAll(newReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("no error with byte %d corrupted", off)
+		}
+	}
+	_, err := ioutil.ReadAll(newReader(bytes.NewReader(src[:len(src)-8])))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestSquashfsBlock(t *testing.T) {
+	src := readTestdata(t, "block.xz")
+	got, err := decompressBlock(src, 4096)
+	if err != nil || !bytes.Equal(got, testContents(4096)) {
+		t.Errorf("decompressBlock = %d bytes, %v", len(got), err)
+	}
+	if _, err := decompressBlock(src, 4095); err == nil {
+		t.Error("no error for a block larger than the block size")
+	}
+}
+
+func TestZipEntry(t *testing.T) {
+	src := readTestdata(t, "stream.xz")
+	contents := testContents(200000)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fw, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "contents.txt",
+		Method:             zip.XZ,
+		CRC32:              crc32.ChecksumIEEE(contents),
+		CompressedSize64:   uint64(len(src)),
+		UncompressedSize64: uint64(len(contents)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(src)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := r.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := ioutil.ReadAll(rc)
+	if err != nil || !bytes.Equal(got, contents) {
+		t.Errorf("read %d bytes, %v", len(got), err)
+	}
+
+	var found bool
+	for _, m := range zip.RegisteredMethods() {
+		if m.ID == zip.XZ {
+			found = m.Read && !m.Write
+		}
+	}
+	if !found {
+		t.Error("XZ is not listed as readable")
+	}
+}
@@ -0,0 +1,53 @@
+// Package zstd registers a compressor and a decompressor for zip entries
+// compressed with Zstandard (method 93) when imported:
+//
+//	import _ "github.com/itchio/arkive/methods/zstd"
+//
+// The compressor is configured by the Zstd section of the Writer's
+// zip.CompressionSettings, and the decompressor uses less memory for
+// Readers with the LowMemory option.
+package zstd
+
+import (
+	"io"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	zip.RegisterCompressor(zip.Zstd, zip.Compressor(newWriter))
+	zip.RegisterDecompressor(zip.Zstd, zip.Decompressor(newReader))
+}
+
+// newWriter returns a Zstandard compressor configured by s.Zstd.
+func newWriter(s zip.CompressionSettings, w io.Writer) (io.WriteCloser, error) {
+	zs := s.Zstd
+	zs.Normalize()
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(zs.Level)),
+		zstd.WithEncoderConcurrency(zs.Workers),
+	}
+	if zs.Window != 0 {
+		opts = append(opts, zstd.WithWindowSize(zs.Window))
+	}
+	return zstd.NewWriter(w, opts...)
+}
+
+func newReader(r io.Reader, f *zip.File) io.ReadCloser {
+	// Entries are read one goroutine at a time anyway.
+	lowmem := f != nil && f.ReaderOptions().LowMemory
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(lowmem))
+	if err != nil {
+		return &errReadCloser{err}
+	}
+	return zr.IOReadCloser()
+}
+
+// errReadCloser fails every Read with err.
+type errReadCloser struct {
+	err error
+}
+
+func (r *errReadCloser) Read(p []byte) (int, error) { return 0, r.err }
+func (r *errReadCloser) Close() error               { return nil }
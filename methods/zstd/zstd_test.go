@@ -0,0 +1,53 @@
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("zstandard in zip ", 10000))
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	s := zip.DefaultCompressionSettings()
+	s.Zstd = zip.ZstdSettings{Level: 19, Window: 1 << 20, Workers: 2}
+	if err := w.SetCompressionSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.CreateHeader(&zip.FileHeader{Name: "a.txt", Method: zip.Zstd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lowmem := range []bool{false, true} {
+		z, err := zip.NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), zip.ReaderOptions{LowMemory: lowmem})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := z.File[0]
+		if f.Method != zip.Zstd || f.CompressedSize64 >= f.UncompressedSize64 {
+			t.Errorf("method %d, %d bytes compressed to %d", f.Method, f.UncompressedSize64, f.CompressedSize64)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("lowmem=%v: read back %d bytes, %v", lowmem, len(got), err)
+		}
+	}
+
+	if read, write := zip.SupportsMethod(zip.Zstd); !read || !write {
+		t.Errorf("SupportsMethod(Zstd) = %v, %v once imported", read, write)
+	}
+}
@@ -0,0 +1,450 @@
+// Package msi reads the streams of Windows Installer packages (.msi).
+//
+// MSI packages are compound files (OLE structured storage): a small file
+// system of named streams. The installer's files are usually in cabinets
+// stored as streams, which package cab can then read:
+//
+//	mr, _ := msi.OpenReader("setup.msi")
+//	cabs, _ := mr.Cabinets()
+//	for _, s := range cabs {
+//		sr, _ := s.Open()
+//		cr, _ := cab.NewReader(sr, s.Size)
+//		...
+//	}
+//
+// The database tables are not parsed, so files are named as in their
+// cabinets, not as they would be installed.
+package msi
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"unicode/utf16"
+)
+
+var (
+	// ErrFormat is returned for files that are not compound files.
+	ErrFormat = errors.New("msi: not a valid compound file")
+	// ErrCorrupt is returned when the structures of a file are
+	// inconsistent.
+	ErrCorrupt = errors.New("msi: corrupt compound file")
+)
+
+var signature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+const (
+	headerLen    = 512
+	dirEntryLen  = 128
+	headerDIFATs = 109
+
+	maxRegSect = 0xfffffffa
+	endOfChain = 0xfffffffe
+	noStream   = 0xffffffff
+
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+)
+
+// A Reader serves the streams of a compound file.
+type Reader struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int64
+	miniSize   int64
+	miniCutoff int64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream *chainReader
+
+	// Streams lists every stream of the file, in directory order.
+	Streams []*Stream
+}
+
+// A ReadCloser is a Reader that must be closed when no longer needed.
+type ReadCloser struct {
+	f *os.File
+	Reader
+}
+
+// A Stream is a named stream of a compound file.
+type Stream struct {
+	// Name is the path of the stream, with storages separated by
+	// slashes. Names MSI compresses are decoded, and those of database
+	// tables start with "!".
+	Name string
+	Size int64
+
+	r     *Reader
+	start uint32
+}
+
+// OpenReader opens the compound file specified by name.
+func OpenReader(name string) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := new(ReadCloser)
+	if err := r.init(f, fi.Size()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f = f
+	return r, nil
+}
+
+// Close closes the compound file.
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// NewReader returns a new Reader reading from r, which is assumed to
+// have the given size in bytes.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	mr := new(Reader)
+	if err := mr.init(r, size); err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
+func (mr *Reader) init(r io.ReaderAt, size int64) error {
+	mr.r = r
+	mr.size = size
+	le := binary.LittleEndian
+
+	hdr := make([]byte, headerLen)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		if err == io.EOF {
+			return ErrFormat
+		}
+		return err
+	}
+	for i, b := range signature {
+		if hdr[i] != b {
+			return ErrFormat
+		}
+	}
+	sectorShift := le.Uint16(hdr[30:])
+	miniShift := le.Uint16(hdr[32:])
+	if sectorShift != 9 && sectorShift != 12 || miniShift != 6 {
+		return ErrCorrupt
+	}
+	mr.sectorSize = 1 << sectorShift
+	mr.miniSize = 1 << miniShift
+	numFATSectors := le.Uint32(hdr[44:])
+	firstDirSector := le.Uint32(hdr[48:])
+	mr.miniCutoff = int64(le.Uint32(hdr[56:]))
+	firstMiniFATSector := le.Uint32(hdr[60:])
+	firstDIFATSector := le.Uint32(hdr[68:])
+	numDIFATSectors := le.Uint32(hdr[72:])
+	if int64(numFATSectors) > size/mr.sectorSize || int64(numDIFATSectors) > size/mr.sectorSize {
+		return ErrCorrupt
+	}
+
+	// The DIFAT lists the sectors of the FAT: the first ones are in the
+	// header, the rest in a chain of DIFAT sectors.
+	var fatSectors []uint32
+	for i := 0; i < headerDIFATs && len(fatSectors) < int(numFATSectors); i++ {
+		fatSectors = append(fatSectors, le.Uint32(hdr[76+4*i:]))
+	}
+	sector := make([]byte, mr.sectorSize)
+	perSector := int(mr.sectorSize / 4)
+	next := firstDIFATSector
+	for i := uint32(0); i < numDIFATSectors && len(fatSectors) < int(numFATSectors); i++ {
+		if err := mr.readSector(next, sector); err != nil {
+			return err
+		}
+		for j := 0; j < perSector-1 && len(fatSectors) < int(numFATSectors); j++ {
+			fatSectors = append(fatSectors, le.Uint32(sector[4*j:]))
+		}
+		next = le.Uint32(sector[4*(perSector-1):])
+	}
+	if len(fatSectors) != int(numFATSectors) {
+		return ErrCorrupt
+	}
+	for _, s := range fatSectors {
+		if err := mr.readSector(s, sector); err != nil {
+			return err
+		}
+		for j := 0; j < perSector; j++ {
+			mr.fat = append(mr.fat, le.Uint32(sector[4*j:]))
+		}
+	}
+
+	dir, err := mr.readChain(firstDirSector)
+	if err != nil {
+		return err
+	}
+	entries, err := parseDirectory(dir)
+	if err != nil {
+		return err
+	}
+	root := entries[0]
+	if root.typ != typeRoot {
+		return ErrCorrupt
+	}
+
+	if firstMiniFATSector < maxRegSect {
+		b, err := mr.readChain(firstMiniFATSector)
+		if err != nil {
+			return err
+		}
+		mr.miniFAT = make([]uint32, len(b)/4)
+		for i := range mr.miniFAT {
+			mr.miniFAT[i] = le.Uint32(b[4*i:])
+		}
+	}
+	sectors, err := chain(mr.fat, root.start)
+	if err != nil {
+		return err
+	}
+	mr.miniStream = &chainReader{r: r, sectors: sectors, unit: mr.sectorSize, base: 1}
+
+	return mr.collect(entries, root.child, "")
+}
+
+func (mr *Reader) readSector(s uint32, b []byte) error {
+	if s >= maxRegSect {
+		return ErrCorrupt
+	}
+	if _, err := mr.r.ReadAt(b, (int64(s)+1)*mr.sectorSize); err != nil {
+		if err == io.EOF {
+			return ErrCorrupt
+		}
+		return err
+	}
+	return nil
+}
+
+// readChain reads the whole chain of sectors starting at s.
+func (mr *Reader) readChain(s uint32) ([]byte, error) {
+	sectors, err := chain(mr.fat, s)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, int64(len(sectors))*mr.sectorSize)
+	for i, s := range sectors {
+		if err := mr.readSector(s, b[int64(i)*mr.sectorSize:int64(i+1)*mr.sectorSize]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// chain follows the allocation table fat from sector s.
+func chain(fat []uint32, s uint32) ([]uint32, error) {
+	var sectors []uint32
+	for s != endOfChain {
+		if int(s) >= len(fat) || len(sectors) >= len(fat) {
+			return nil, ErrCorrupt
+		}
+		sectors = append(sectors, s)
+		s = fat[s]
+	}
+	return sectors, nil
+}
+
+type dirEntry struct {
+	name               string
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               int64
+}
+
+func parseDirectory(b []byte) ([]dirEntry, error) {
+	le := binary.LittleEndian
+	var entries []dirEntry
+	for ; len(b) >= dirEntryLen; b = b[dirEntryLen:] {
+		nameLen := int(le.Uint16(b[64:]))
+		if nameLen > 64 || nameLen%2 != 0 {
+			return nil, ErrCorrupt
+		}
+		u := make([]uint16, 0, 32)
+		for i := 0; i+2 <= nameLen; i += 2 {
+			if c := le.Uint16(b[i:]); c != 0 {
+				u = append(u, c)
+			}
+		}
+		entries = append(entries, dirEntry{
+			name:  decodeName(u),
+			typ:   b[66],
+			left:  le.Uint32(b[68:]),
+			right: le.Uint32(b[72:]),
+			child: le.Uint32(b[76:]),
+			start: le.Uint32(b[116:]),
+			size:  int64(le.Uint64(b[120:])),
+		})
+	}
+	if len(entries) == 0 {
+		return nil, ErrCorrupt
+	}
+	return entries, nil
+}
+
+// collect adds the streams in the tree of siblings rooted at id, and in
+// their storages, to mr.Streams.
+func (mr *Reader) collect(entries []dirEntry, id uint32, prefix string) error {
+	seen := make(map[uint32]bool)
+	var visit func(id uint32, prefix string) error
+	visit = func(id uint32, prefix string) error {
+		if id == noStream {
+			return nil
+		}
+		if int(id) >= len(entries) || seen[id] {
+			return ErrCorrupt
+		}
+		seen[id] = true
+		e := entries[id]
+		if err := visit(e.left, prefix); err != nil {
+			return err
+		}
+		switch e.typ {
+		case typeStream:
+			size := e.size
+			if mr.sectorSize == 512 {
+				// Version 3 files only use the low 32 bits.
+				size &= 0xffffffff
+			}
+			if size > mr.size {
+				return ErrCorrupt
+			}
+			mr.Streams = append(mr.Streams, &Stream{
+				Name:  prefix + e.name,
+				Size:  size,
+				r:     mr,
+				start: e.start,
+			})
+		case typeStorage:
+			if err := visit(e.child, prefix+e.name+"/"); err != nil {
+				return err
+			}
+		}
+		return visit(e.right, prefix)
+	}
+	return visit(id, prefix)
+}
+
+// Open returns a reader of the stream's contents.
+func (s *Stream) Open() (*io.SectionReader, error) {
+	mr := s.r
+	var cr *chainReader
+	if s.Size < mr.miniCutoff {
+		sectors, err := chain(mr.miniFAT, s.start)
+		if err != nil && s.Size > 0 {
+			return nil, err
+		}
+		cr = &chainReader{r: mr.miniStream, sectors: sectors, unit: mr.miniSize}
+	} else {
+		sectors, err := chain(mr.fat, s.start)
+		if err != nil {
+			return nil, err
+		}
+		cr = &chainReader{r: mr.r, sectors: sectors, unit: mr.sectorSize, base: 1}
+	}
+	if int64(len(cr.sectors))*cr.unit < s.Size {
+		return nil, ErrCorrupt
+	}
+	return io.NewSectionReader(cr, 0, s.Size), nil
+}
+
+// Cabinets returns the streams that hold cabinets, which are where MSI
+// packages keep the files they install.
+func (mr *Reader) Cabinets() ([]*Stream, error) {
+	var cabs []*Stream
+	for _, s := range mr.Streams {
+		if s.Size < 4 {
+			continue
+		}
+		sr, err := s.Open()
+		if err != nil {
+			return nil, err
+		}
+		var magic [4]byte
+		if _, err := sr.ReadAt(magic[:], 0); err != nil {
+			return nil, err
+		}
+		if string(magic[:]) == "MSCF" {
+			cabs = append(cabs, s)
+		}
+	}
+	return cabs, nil
+}
+
+// A chainReader reads a chain of sectors of unit bytes, sector s being
+// at (s+base)*unit in r.
+type chainReader struct {
+	r       io.ReaderAt
+	sectors []uint32
+	unit    int64
+	base    int64
+}
+
+func (cr *chainReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		i := off / cr.unit
+		if i >= int64(len(cr.sectors)) {
+			return n, io.EOF
+		}
+		within := off % cr.unit
+		m := int64(len(p))
+		if m > cr.unit-within {
+			m = cr.unit - within
+		}
+		k, err := cr.r.ReadAt(p[:m], (int64(cr.sectors[i])+cr.base)*cr.unit+within)
+		n += k
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		p = p[m:]
+		off += m
+	}
+	return n, nil
+}
+
+// decodeName undoes the compression MSI applies to stream names, which
+// packs two characters of [0-9A-Za-z._] into one code unit.
+func decodeName(u []uint16) string {
+	out := make([]uint16, 0, 2*len(u))
+	for _, c := range u {
+		switch {
+		case c >= 0x3800 && c < 0x4800:
+			c -= 0x3800
+			out = append(out, nameChar(c&0x3f), nameChar(c>>6&0x3f))
+		case c >= 0x4800 && c < 0x4840:
+			out = append(out, nameChar(c-0x4800))
+		case c == 0x4840:
+			out = append(out, '!')
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(utf16.Decode(out))
+}
+
+func nameChar(c uint16) uint16 {
+	switch {
+	case c < 10:
+		return '0' + c
+	case c < 36:
+		return 'A' + c - 10
+	case c < 62:
+		return 'a' + c - 36
+	case c == 62:
+		return '.'
+	}
+	return '_'
+}
@@ -0,0 +1,213 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const testSector = 512
+
+// encodeName compresses a stream name the way MSI does.
+func encodeName(s string) []uint16 {
+	index := func(c byte) int {
+		const chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz._"
+		return strings.IndexByte(chars, c)
+	}
+	var u []uint16
+	for i := 0; i < len(s); i++ {
+		c1 := index(s[i])
+		if c1 < 0 {
+			u = append(u, uint16(s[i]))
+			continue
+		}
+		if i+1 < len(s) {
+			if c2 := index(s[i+1]); c2 >= 0 {
+				u = append(u, uint16(0x3800+c1+c2<<6))
+				i++
+				continue
+			}
+		}
+		u = append(u, uint16(0x4800+c1))
+	}
+	return u
+}
+
+type testEntry struct {
+	name               []uint16
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               int
+}
+
+var (
+	cabContents     = append([]byte("MSCF"), bytes.Repeat([]byte("cabinet data "), 400)...)
+	summaryContents = bytes.Repeat([]byte("summary "), 20)
+	tableContents   = []byte("table rows")
+)
+
+// buildCompoundFile writes a version 3 compound file holding a large
+// stream in regular sectors and two small ones in the mini stream, one
+// of them in a storage.
+func buildCompoundFile(t *testing.T) []byte {
+	le := binary.LittleEndian
+	var sectors [][]byte
+	fat := make([]uint32, testSector/4)
+	for i := range fat {
+		fat[i] = noStream
+	}
+	// addChain stores b in consecutive sectors, returning the first.
+	addChain := func(b []byte, fat []uint32, unit int, into *[][]byte) uint32 {
+		first := uint32(len(*into))
+		for len(b) > 0 {
+			s := make([]byte, unit)
+			n := copy(s, b)
+			b = b[n:]
+			*into = append(*into, s)
+			i := uint32(len(*into) - 1)
+			fat[i] = i + 1
+			if len(b) == 0 {
+				fat[i] = endOfChain
+			}
+		}
+		return first
+	}
+
+	sectors = append(sectors, nil) // the FAT, filled in last
+	fat[0] = 0xfffffffd
+	cabStart := addChain(cabContents, fat, testSector, &sectors)
+
+	var mini [][]byte
+	miniFAT := make([]uint32, testSector/4)
+	for i := range miniFAT {
+		miniFAT[i] = noStream
+	}
+	summaryStart := addChain(summaryContents, miniFAT, 64, &mini)
+	tableStart := addChain(tableContents, miniFAT, 64, &mini)
+	miniFATStart := addChain(u32s(miniFAT), fat, testSector, &sectors)
+	var miniStream []byte
+	for _, s := range mini {
+		miniStream = append(miniStream, s...)
+	}
+	miniStreamStart := addChain(miniStream, fat, testSector, &sectors)
+
+	entries := []testEntry{
+		{name: utf16.Encode([]rune("Root Entry")), typ: typeRoot, left: noStream, right: noStream, child: 1, start: miniStreamStart, size: len(miniStream)},
+		{name: encodeName("Data1.cab"), typ: typeStream, left: 2, right: 3, child: noStream, start: cabStart, size: len(cabContents)},
+		{name: utf16.Encode([]rune("\x05SummaryInformation")), typ: typeStream, left: noStream, right: noStream, child: noStream, start: summaryStart, size: len(summaryContents)},
+		{name: utf16.Encode([]rune("storage")), typ: typeStorage, left: noStream, right: noStream, child: 4, start: 0, size: 0},
+		{name: append([]uint16{0x4840}, encodeName("File")...), typ: typeStream, left: noStream, right: noStream, child: noStream, start: tableStart, size: len(tableContents)},
+	}
+	var dir []byte
+	for _, e := range entries {
+		b := make([]byte, dirEntryLen)
+		for i, c := range e.name {
+			le.PutUint16(b[2*i:], c)
+		}
+		le.PutUint16(b[64:], uint16(2*len(e.name)+2))
+		b[66] = e.typ
+		le.PutUint32(b[68:], e.left)
+		le.PutUint32(b[72:], e.right)
+		le.PutUint32(b[76:], e.child)
+		le.PutUint32(b[116:], e.start)
+		le.PutUint64(b[120:], uint64(e.size))
+		dir = append(dir, b...)
+	}
+	dirStart := addChain(dir, fat, testSector, &sectors)
+	sectors[0] = u32s(fat)
+
+	hdr := make([]byte, headerLen)
+	copy(hdr, signature)
+	le.PutUint16(hdr[24:], 0x3e)
+	le.PutUint16(hdr[26:], 3)
+	le.PutUint16(hdr[28:], 0xfffe)
+	le.PutUint16(hdr[30:], 9)
+	le.PutUint16(hdr[32:], 6)
+	le.PutUint32(hdr[44:], 1) // FAT sectors
+	le.PutUint32(hdr[48:], dirStart)
+	le.PutUint32(hdr[56:], 4096)
+	le.PutUint32(hdr[60:], miniFATStart)
+	le.PutUint32(hdr[64:], 1)
+	le.PutUint32(hdr[68:], endOfChain)
+	for i := 0; i < headerDIFATs; i++ {
+		le.PutUint32(hdr[76+4*i:], noStream)
+	}
+	le.PutUint32(hdr[76:], 0)
+
+	out := hdr
+	for _, s := range sectors {
+		out = append(out, s...)
+	}
+	return out
+}
+
+func u32s(v []uint32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], x)
+	}
+	return b
+}
+
+func TestReader(t *testing.T) {
+	b := buildCompoundFile(t)
+	mr, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		data []byte
+	}{
+		{"\x05SummaryInformation", summaryContents},
+		{"Data1.cab", cabContents},
+		{"storage/!File", tableContents},
+	}
+	if len(mr.Streams) != len(want) {
+		t.Fatalf("got %d streams, want %d", len(mr.Streams), len(want))
+	}
+	for i, s := range mr.Streams {
+		if s.Name != want[i].name {
+			t.Errorf("stream %d is %q, want %q", i, s.Name, want[i].name)
+		}
+		sr, err := s.Open()
+		if err != nil {
+			t.Errorf("%s: %v", s.Name, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(sr)
+		if err != nil {
+			t.Errorf("%s: %v", s.Name, err)
+		}
+		if !bytes.Equal(got, want[i].data) {
+			t.Errorf("%s: contents differ", s.Name)
+		}
+	}
+
+	cabs, err := mr.Cabinets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cabs) != 1 || cabs[0].Name != "Data1.cab" {
+		t.Errorf("Cabinets() = %v", cabs)
+	}
+}
+
+func TestDecodeName(t *testing.T) {
+	for _, name := range []string{"Data1.cab", "a", "_Validation", "x y"} {
+		if got := decodeName(encodeName(name)); got != name {
+			t.Errorf("decodeName(encodeName(%q)) = %q", name, got)
+		}
+	}
+}
+
+func TestNotCompoundFile(t *testing.T) {
+	b := make([]byte, 1024)
+	if _, err := NewReader(bytes.NewReader(b), int64(len(b))); err != ErrFormat {
+		t.Errorf("got %v, want ErrFormat", err)
+	}
+}
@@ -0,0 +1,156 @@
+// +build go1.16
+
+package arkive
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// OverlayFS layers several file systems, such as the zip.Reader of a
+// base game, a patch and some DLC, into a single read-only fs.FS, the
+// last one on top. Files of upper layers shadow files with the same name
+// in lower layers, and directories present in several layers are
+// merged, so the result can be served without extracting it first.
+//
+// Layers may hide names of the layers below them with whiteout entries,
+// named like those of zip.Overlay: "dir/.wh.name" hides "dir/name" and
+// everything under it, and "dir/.wh..wh..opq" hides everything under
+// "dir/". A layer's whiteouts do not hide its own files, and whiteout
+// entries themselves are not visible.
+func OverlayFS(layers ...fs.FS) fs.FS {
+	return &overlayFS{layers: layers}
+}
+
+type overlayFS struct {
+	layers []fs.FS // bottom first
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if strings.HasPrefix(path.Base(name), zip.WhiteoutPrefix) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// Go down the layers until a file, or until one hides the name
+	// from those below it. Directories found on the way are merged.
+	var dirs []fs.FS // top first
+layers:
+	for i := len(o.layers) - 1; i >= 0; i-- {
+		layer := o.layers[i]
+		fi, err := fs.Stat(layer, name)
+		switch {
+		case err == nil && !fi.IsDir():
+			if len(dirs) > 0 {
+				break layers // shadowed by the directories above
+			}
+			return layer.Open(name)
+		case err == nil:
+			dirs = append(dirs, layer)
+			if exists(layer, path.Join(name, zip.WhiteoutOpaque)) {
+				break layers
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+		if hidesBelow(layer, name) {
+			break
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := dirs[0].Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayDir{File: f, name: name, layers: dirs}, nil
+}
+
+// hidesBelow reports whether layer has a whiteout for name or one of its
+// parents, or an opaque whiteout in one of its parents.
+func hidesBelow(layer fs.FS, name string) bool {
+	for p := name; p != "."; p = path.Dir(p) {
+		dir, base := path.Split(p)
+		if exists(layer, dir+zip.WhiteoutPrefix+base) {
+			return true
+		}
+		if exists(layer, path.Join(path.Dir(p), zip.WhiteoutOpaque)) {
+			return true
+		}
+	}
+	return false
+}
+
+func exists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
+}
+
+// overlayDir is a directory merged from several layers. Stat, Read and
+// Close go to the topmost one.
+type overlayDir struct {
+	fs.File
+	name    string
+	layers  []fs.FS // top first
+	entries []fs.DirEntry
+	read    bool
+}
+
+// ReadDir follows the contract of fs.ReadDirFile. Entries are read from
+// every layer on the first call.
+func (d *overlayDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		if err := d.readLayers(); err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+	rest := d.entries
+	if count > 0 && len(rest) > count {
+		rest = rest[:count]
+	}
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	d.entries = d.entries[len(rest):]
+	return rest, nil
+}
+
+func (d *overlayDir) readLayers() error {
+	seen := make(map[string]bool)
+	for _, layer := range d.layers {
+		entries, err := fs.ReadDir(layer, d.name)
+		if err != nil {
+			return err
+		}
+		var hidden []string
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasPrefix(name, zip.WhiteoutPrefix) {
+				if name != zip.WhiteoutOpaque {
+					hidden = append(hidden, strings.TrimPrefix(name, zip.WhiteoutPrefix))
+				}
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				d.entries = append(d.entries, e)
+			}
+		}
+		// Whiteouts only apply to lower layers.
+		for _, name := range hidden {
+			seen[name] = true
+		}
+	}
+	sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].Name() < d.entries[j].Name() })
+	return nil
+}
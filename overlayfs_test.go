@@ -0,0 +1,119 @@
+// +build go1.16
+
+package arkive
+
+import (
+	"bytes"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/itchio/arkive/zip"
+)
+
+func TestOverlayFS(t *testing.T) {
+	base := fstest.MapFS{
+		"game.exe":            {Data: []byte("v1")},
+		"data/level1.dat":     {Data: []byte("l1")},
+		"data/level2.dat":     {Data: []byte("l2")},
+		"data/old/removed":    {Data: []byte("old")},
+		"music/theme.ogg":     {Data: []byte("theme")},
+		"replaced/base-only":  {Data: []byte("base")},
+		"became-a-dir":        {Data: []byte("file")},
+		"readme.txt":          {Data: []byte("base readme")},
+		"deleted-then-back":   {Data: []byte("base")},
+		"opaque/base-only":    {Data: []byte("hidden")},
+		"opaque/shared":       {Data: []byte("hidden")},
+		"whited/dir/deep.txt": {Data: []byte("hidden")},
+	}
+
+	// The patch is a zip archive, to check a Reader works as a layer.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range map[string]string{
+		"game.exe":                "v2",
+		"data/level2.dat":         "l2 fixed",
+		"data/.wh.old":            "",
+		"music/.wh..wh..opq":      "",
+		"music/patched.ogg":       "patched",
+		"became-a-dir/inside.txt": "inside",
+		".wh.deleted-then-back":   "",
+		"deleted-then-back":       "patch",
+		".wh.whited":              "",
+	} {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dlc := fstest.MapFS{
+		"dlc/map.dat":         {Data: []byte("dlc")},
+		".wh.readme.txt":      {},
+		"opaque/.wh..wh..opq": {},
+		"opaque/shared":       {Data: []byte("dlc")},
+	}
+
+	fsys := OverlayFS(base, patch, dlc)
+	want := map[string]string{
+		"game.exe":                "v2",
+		"data/level1.dat":         "l1",
+		"data/level2.dat":         "l2 fixed",
+		"music/patched.ogg":       "patched",
+		"replaced/base-only":      "base",
+		"became-a-dir/inside.txt": "inside",
+		"deleted-then-back":       "patch",
+		"dlc/map.dat":             "dlc",
+		"opaque/shared":           "dlc",
+	}
+	var expected []string
+	for name, contents := range want {
+		expected = append(expected, name)
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Errorf("ReadFile(%s): %v", name, err)
+		} else if string(b) != contents {
+			t.Errorf("ReadFile(%s) = %q, want %q", name, b, contents)
+		}
+	}
+	for _, name := range []string{
+		"data/old/removed", "data/old", "music/theme.ogg", "readme.txt",
+		"opaque/base-only", "whited", "whited/dir/deep.txt", ".wh.whited", "data/.wh.old",
+	} {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			t.Errorf("%s is visible", name)
+		}
+	}
+
+	sort.Strings(expected)
+	var files []string
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("walked %v, want %v", files, expected)
+	}
+
+	if err := fstest.TestFS(fsys, expected...); err != nil {
+		t.Error(err)
+	}
+}
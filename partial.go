@@ -0,0 +1,83 @@
+package arkive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PartialSuffix is appended to the names of files being extracted, so
+// that a file only appears under its real name once it is complete.
+const PartialSuffix = ".arkive-part"
+
+// A PartialFile is a file being extracted. It is written to its name
+// with PartialSuffix appended, and renamed to its name by Commit, so an
+// interrupted extraction never leaves a truncated file that looks
+// complete to the program reading it, only partials for CleanPartials
+// to remove.
+type PartialFile struct {
+	*os.File
+	name string
+}
+
+// CreatePartial creates the partial file for name, truncating any left
+// by an earlier attempt.
+func CreatePartial(name string, perm os.FileMode) (*PartialFile, error) {
+	f, err := os.OpenFile(name+PartialSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &PartialFile{File: f, name: name}, nil
+}
+
+// Commit flushes the file to disk, closes it and renames it to its
+// final name, replacing any file there.
+func (p *PartialFile) Commit() error {
+	err := p.File.Sync()
+	if cerr := p.File.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(p.File.Name())
+		return err
+	}
+	return os.Rename(p.File.Name(), p.name)
+}
+
+// Abort closes and removes the partial file, for extractions that
+// failed or were cancelled.
+func (p *PartialFile) Abort() error {
+	p.File.Close()
+	return os.Remove(p.File.Name())
+}
+
+// CleanPartials removes the partial files left under dir by interrupted
+// extractions, and returns their paths. It keeps going when a file
+// cannot be removed, and returns the first error met.
+func CleanPartials(dir string) ([]string, error) {
+	var removed []string
+	var firstErr error
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return nil
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), PartialSuffix) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return nil
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	if err == nil {
+		err = firstErr
+	}
+	return removed, err
+}
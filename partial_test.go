@@ -0,0 +1,70 @@
+package arkive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPartialFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arkive-partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "game.exe")
+	p, err := CreatePartial(name, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Write([]byte("MZ")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("final file exists before Commit: %v", err)
+	}
+	if err := p.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != "MZ" {
+		t.Errorf("after Commit: %q, %v", b, err)
+	}
+	if _, err := os.Stat(name + PartialSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file left after Commit: %v", err)
+	}
+
+	p, err = CreatePartial(filepath.Join(dir, "aborted"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupted extractions leave partials behind.
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var orphans []string
+	for _, n := range []string{"a.pak", "data/b.pak"} {
+		p, err := CreatePartial(filepath.Join(dir, n), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Close()
+		orphans = append(orphans, filepath.Join(dir, n)+PartialSuffix)
+	}
+	removed, err := CleanPartials(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, orphans) {
+		t.Errorf("removed %q, want %q", removed, orphans)
+	}
+	if _, err := os.Stat(name); err != nil {
+		t.Errorf("complete file removed: %v", err)
+	}
+}
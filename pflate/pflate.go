@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"runtime"
 	"sync"
 
 	"github.com/klauspost/compress/flate"
@@ -49,6 +50,7 @@ type Writer struct {
 	dictFlatePool sync.Pool
 	dstPool       sync.Pool
 	wg            sync.WaitGroup
+	pool          *Pool
 }
 
 type result struct {
@@ -191,7 +193,7 @@ func (z *Writer) compressCurrent(flush bool) {
 	if len(c) > z.blockSize*2 {
 		c = c[:z.blockSize]
 		z.wg.Add(1)
-		go z.compressBlock(c, z.prevTail, r, false)
+		z.startBlock(c, z.prevTail, r, false)
 		z.prevTail = c[len(c)-tailSize:]
 		z.currentBuffer = z.currentBuffer[z.blockSize:]
 		z.compressCurrent(flush)
@@ -200,7 +202,7 @@ func (z *Writer) compressCurrent(flush bool) {
 	}
 
 	z.wg.Add(1)
-	go z.compressBlock(c, z.prevTail, r, z.closed)
+	z.startBlock(c, z.prevTail, r, z.closed)
 	if len(c) > tailSize {
 		z.prevTail = c[len(c)-tailSize:]
 	} else {
@@ -209,9 +211,13 @@ func (z *Writer) compressCurrent(flush bool) {
 	z.currentBuffer = z.dstPool.Get().([]byte)
 	z.currentBuffer = z.currentBuffer[:0]
 
-	// Wait if flushing
+	// Wait if flushing, or until the goroutine writing blocks gave up
+	// on an error, leaving this one unwritten.
 	if flush {
-		<-r.notifyWritten
+		select {
+		case <-r.notifyWritten:
+		case <-z.pushedErr:
+		}
 	}
 }
 
@@ -289,6 +295,16 @@ func (z *Writer) Write(p []byte) (int, error) {
 	return len(p), z.checkError()
 }
 
+// startBlock compresses a block on the Writer's pool if it has one, or
+// on a goroutine of its own.
+func (z *Writer) startBlock(p, prevTail []byte, r result, closed bool) {
+	if z.pool != nil {
+		z.pool.jobs <- func() { z.compressBlock(p, prevTail, r, closed) }
+		return
+	}
+	go z.compressBlock(p, prevTail, r, closed)
+}
+
 // Step 1: compresses buffer to buffer
 // Step 2: send writer to channel
 // Step 3: Close result channel to indicate we are done
@@ -373,3 +389,45 @@ func (z *Writer) Close() error {
 	close(z.results)
 	return nil
 }
+
+// A Pool compresses the blocks of any number of Writers on a fixed
+// number of goroutines, so that a process packaging many archives at
+// once bounds the CPU they use together instead of starting goroutines
+// for every block of every Writer.
+type Pool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+// NewPool starts a Pool of the given number of workers, or of
+// runtime.GOMAXPROCS(0) workers if it is not positive.
+func NewPool(workers int) *Pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &Pool{jobs: make(chan func())}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// Close stops the workers of the pool, once they are done with the
+// blocks they hold. The Writers using it must be closed first.
+func (p *Pool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// SetPool makes the Writer compress its blocks on p, or on goroutines
+// of its own if p is nil, which is the default. Writes wait for a worker
+// of the pool to be free. It must be called before the first Write.
+func (z *Writer) SetPool(p *Pool) {
+	z.pool = p
+}
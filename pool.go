@@ -0,0 +1,20 @@
+package arkive
+
+import "github.com/itchio/arkive/pflate"
+
+// A Pool owns the goroutines that compress blocks for any number of
+// zip Writers, so that a server packaging many archives at once bounds
+// the CPU they use together. Writers use it through the Pool field of
+// their zip.FlateSettings:
+//
+//	s := zip.DefaultCompressionSettings()
+//	s.Flate.Pool = pool
+//	w.SetCompressionSettings(s)
+type Pool = pflate.Pool
+
+// NewPool starts a Pool of the given number of workers, or of
+// runtime.GOMAXPROCS(0) workers if it is not positive. Close it once the
+// Writers using it are closed.
+func NewPool(workers int) *Pool {
+	return pflate.NewPool(workers)
+}
@@ -0,0 +1,231 @@
+package arkive
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// A SafetyPolicy limits what an archive from an untrusted source may
+// hold, the same way for every format: services configure it once, check
+// listings against it with Check, and read contents through LimitReader.
+// Zero fields mean no limit.
+type SafetyPolicy struct {
+	// MaxEntries is the largest number of entries an archive may have.
+	MaxEntries int
+
+	// MaxEntrySize is the largest uncompressed size of a single entry,
+	// in bytes.
+	MaxEntrySize int64
+
+	// MaxTotalSize is the largest uncompressed size of all entries
+	// together, in bytes.
+	MaxTotalSize int64
+
+	// MaxRatio is the largest ratio of uncompressed to compressed size
+	// of an entry, for formats that record both. Zip bombs rely on
+	// ratios in the thousands, whereas real data rarely goes past 100.
+	MaxRatio float64
+
+	// AllowUnsafePaths accepts entries whose names are absolute or
+	// climb out of the destination with "..", and symlinks pointing
+	// outside of the archive. They are refused by default.
+	AllowUnsafePaths bool
+
+	// StreamNames tells how to treat entry names with a colon.
+	StreamNames StreamNamePolicy
+}
+
+// A StreamNamePolicy tells how a SafetyPolicy treats entry names with a
+// colon, which Windows takes as naming an alternate data stream of a
+// file: extracting "notes.txt:payload" there writes into a hidden part
+// of notes.txt rather than to a file of its own. Colons are valid in
+// names on other systems, so they are kept by default.
+type StreamNamePolicy int
+
+const (
+	KeepStreamNames   StreamNamePolicy = iota // Name and Check leave them alone
+	RejectStreamNames                         // Check fails with a *SafetyError
+	StripStreamNames                          // Name drops what follows colons
+	RenameStreamNames                         // Name replaces colons with underscores
+	SkipStreamNames                           // Name tells to skip the entry
+)
+
+// HasStreamName reports whether name would designate an alternate data
+// stream on Windows.
+func HasStreamName(name string) bool {
+	return strings.IndexByte(name, ':') >= 0
+}
+
+// Name returns the name e should be extracted under, according to the
+// StreamNames policy, and false if it should be skipped instead.
+// Rewritten names that leave the destination are skipped too, unless
+// AllowUnsafePaths is set, though Check reports them first.
+func (p *SafetyPolicy) Name(e *Entry) (string, bool) {
+	if !HasStreamName(e.Name) {
+		return e.Name, true
+	}
+	var name string
+	switch p.StreamNames {
+	case StripStreamNames:
+		stripped, empty, safe := stripStreamNames(e.Name)
+		if empty || !safe && !p.AllowUnsafePaths {
+			return "", false
+		}
+		name = stripped
+	case RenameStreamNames:
+		name = strings.Replace(e.Name, ":", "_", -1)
+	case RejectStreamNames, SkipStreamNames:
+		return "", false
+	default:
+		return e.Name, true
+	}
+	if !p.AllowUnsafePaths && !safePath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// stripStreamNames drops what follows colons in each element of name.
+// It reports whether that leaves an element empty, and whether the
+// result is a safe path whose stripped elements are safe too: "..:x"
+// would otherwise become a dot-dot that was not there.
+func stripStreamNames(name string) (stripped string, empty, safe bool) {
+	safe = true
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		j := strings.IndexByte(elem, ':')
+		if j < 0 {
+			continue
+		}
+		elems[i] = elem[:j]
+		if elems[i] == "" {
+			empty = true
+		} else if elems[i] == "." || !safePath(elems[i]) {
+			safe = false
+		}
+	}
+	stripped = strings.Join(elems, "/")
+	return stripped, empty, safe && safePath(stripped)
+}
+
+// A SafetyError is returned when an archive breaks a SafetyPolicy.
+type SafetyError struct {
+	Name   string // entry at fault, empty for limits on the whole archive
+	Reason string
+}
+
+func (e *SafetyError) Error() string {
+	if e.Name == "" {
+		return "arkive: unsafe archive: " + e.Reason
+	}
+	return fmt.Sprintf("arkive: unsafe entry %s: %s", e.Name, e.Reason)
+}
+
+// Check checks the entries of l against the policy, as declared by the
+// archive. Since declared sizes can lie, contents should also be read
+// through LimitReader.
+func (p *SafetyPolicy) Check(l *Listing) error {
+	if p.MaxEntries > 0 && len(l.Entries) > p.MaxEntries {
+		return &SafetyError{Reason: fmt.Sprintf("more than %d entries", p.MaxEntries)}
+	}
+	var total int64
+	for _, e := range l.Entries {
+		if err := p.checkEntry(e); err != nil {
+			return err
+		}
+		total += e.Size
+		if p.MaxTotalSize > 0 && total > p.MaxTotalSize {
+			return &SafetyError{Reason: fmt.Sprintf("more than %d bytes in total", p.MaxTotalSize)}
+		}
+	}
+	return nil
+}
+
+func (p *SafetyPolicy) checkEntry(e *Entry) error {
+	if p.MaxEntrySize > 0 && e.Size > p.MaxEntrySize {
+		return &SafetyError{Name: e.Name, Reason: fmt.Sprintf("larger than %d bytes", p.MaxEntrySize)}
+	}
+	if p.MaxRatio > 0 && e.CompressedSize > 0 && float64(e.Size)/float64(e.CompressedSize) > p.MaxRatio {
+		return &SafetyError{Name: e.Name, Reason: fmt.Sprintf("compressed more than %g times", p.MaxRatio)}
+	}
+	if p.StreamNames == RejectStreamNames && HasStreamName(e.Name) {
+		return &SafetyError{Name: e.Name, Reason: "name designates an alternate data stream"}
+	}
+	if p.AllowUnsafePaths {
+		return nil
+	}
+	if !safePath(e.Name) {
+		return &SafetyError{Name: e.Name, Reason: "path leaves the destination"}
+	}
+	if p.StreamNames == StripStreamNames && HasStreamName(e.Name) {
+		if _, empty, safe := stripStreamNames(e.Name); !empty && !safe {
+			return &SafetyError{Name: e.Name, Reason: "path leaves the destination once stream names are stripped"}
+		}
+	}
+	if e.Symlink != "" && !safeLink(e.Name, e.Symlink) {
+		return &SafetyError{Name: e.Name, Reason: "symlink points outside of the archive"}
+	}
+	return nil
+}
+
+// safePath reports whether name, relative to a destination directory,
+// stays inside it. Backslashes count as separators, as they do when
+// extracting on Windows.
+func safePath(name string) bool {
+	name = strings.Replace(name, `\`, "/", -1)
+	if isAbs(name) || strings.IndexByte(name, 0) >= 0 {
+		return false
+	}
+	clean := path.Clean(name)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// safeLink reports whether a symlink named name pointing at target stays
+// inside the destination directory.
+func safeLink(name, target string) bool {
+	target = strings.Replace(target, `\`, "/", -1)
+	return !isAbs(target) && safePath(path.Join(path.Dir(name), target))
+}
+
+// isAbs reports whether the slash-separated name is absolute, on Unix or
+// on Windows, counting UNC paths and the \\?\ paths junctions point at.
+func isAbs(name string) bool {
+	return strings.HasPrefix(name, "/") || len(name) >= 2 && name[1] == ':'
+}
+
+// LimitReader returns a reader of the contents of e, read from r, that
+// fails with a *SafetyError once it yields more than e.Size bytes, as
+// declared by the archive, or more than MaxEntrySize if that is smaller.
+func (p *SafetyPolicy) LimitReader(e *Entry, r io.Reader) io.Reader {
+	max := p.MaxEntrySize
+	if max <= 0 || (e.Size >= 0 && e.Size < max) {
+		max = e.Size
+	}
+	return &limitReader{r: r, left: max, name: e.Name}
+}
+
+type limitReader struct {
+	r    io.Reader
+	left int64
+	name string
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, &SafetyError{Name: l.name, Reason: "contents larger than declared"}
+	}
+	// Read one byte past the limit to tell data that ends right at it
+	// from data that goes on.
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		n += int(l.left)
+		return n, &SafetyError{Name: l.name, Reason: "contents larger than declared"}
+	}
+	return n, err
+}
@@ -0,0 +1,135 @@
+package arkive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSafetyPolicyCheck(t *testing.T) {
+	b := testZip(t)
+	l, err := ListReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(SafetyPolicy).Check(l); err != nil {
+		t.Errorf("empty policy: %v", err)
+	}
+
+	tests := []struct {
+		p    SafetyPolicy
+		name string // of the entry at fault, "" for the archive
+	}{
+		{SafetyPolicy{MaxEntries: 2}, ""},
+		{SafetyPolicy{MaxEntrySize: 100}, "bin/game"},
+		{SafetyPolicy{MaxTotalSize: 500}, ""},
+		{SafetyPolicy{MaxRatio: 2}, "bin/game"},
+	}
+	for _, tt := range tests {
+		err := tt.p.Check(l)
+		se, ok := err.(*SafetyError)
+		if !ok || se.Name != tt.name {
+			t.Errorf("%+v: got %v, want a SafetyError for %q", tt.p, err, tt.name)
+		}
+	}
+}
+
+func TestSafetyPolicyPaths(t *testing.T) {
+	tests := []struct {
+		e    Entry
+		safe bool
+	}{
+		{Entry{Name: "a/b/c"}, true},
+		{Entry{Name: "a/../b"}, true},
+		{Entry{Name: "../b"}, false},
+		{Entry{Name: "a/../../b"}, false},
+		{Entry{Name: `a\..\..\b`}, false},
+		{Entry{Name: "/etc/passwd"}, false},
+		{Entry{Name: `C:\Windows`}, false},
+		{Entry{Name: "a/link", Symlink: "../b"}, true},
+		{Entry{Name: "a/link", Symlink: "../../b"}, false},
+		{Entry{Name: "a/link", Symlink: "/etc/passwd"}, false},
+		{Entry{Name: "a/junction", Symlink: `\\?\C:\Windows`}, false},
+		{Entry{Name: "a/junction", Symlink: `\\server\share`}, false},
+	}
+	for _, tt := range tests {
+		e := tt.e
+		l := &Listing{Entries: []*Entry{&e}}
+		err := new(SafetyPolicy).Check(l)
+		if safe := err == nil; safe != tt.safe {
+			t.Errorf("%s -> %q: got %v", e.Name, e.Symlink, err)
+		}
+		if err := (&SafetyPolicy{AllowUnsafePaths: true}).Check(l); err != nil {
+			t.Errorf("%s with AllowUnsafePaths: %v", e.Name, err)
+		}
+	}
+}
+
+func TestSafetyPolicyLimitReader(t *testing.T) {
+	var p SafetyPolicy
+	e := &Entry{Name: "liar", Size: 10}
+	got, err := ioutil.ReadAll(p.LimitReader(e, strings.NewReader(strings.Repeat("x", 10))))
+	if err != nil || len(got) != 10 {
+		t.Errorf("exact size: got %d bytes, %v", len(got), err)
+	}
+	got, err = ioutil.ReadAll(p.LimitReader(e, strings.NewReader(strings.Repeat("x", 1000))))
+	if _, ok := err.(*SafetyError); !ok || len(got) != 10 {
+		t.Errorf("larger than declared: got %d bytes, %v", len(got), err)
+	}
+	p.MaxEntrySize = 5
+	got, err = ioutil.ReadAll(p.LimitReader(e, strings.NewReader(strings.Repeat("x", 10))))
+	if _, ok := err.(*SafetyError); !ok || len(got) != 5 {
+		t.Errorf("larger than MaxEntrySize: got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestSafetyPolicyStreamNames(t *testing.T) {
+	e := &Entry{Name: "docs/notes.txt:payload"}
+	tests := []struct {
+		policy StreamNamePolicy
+		name   string
+		ok     bool
+	}{
+		{KeepStreamNames, "docs/notes.txt:payload", true},
+		{RejectStreamNames, "", false},
+		{StripStreamNames, "docs/notes.txt", true},
+		{RenameStreamNames, "docs/notes.txt_payload", true},
+		{SkipStreamNames, "", false},
+	}
+	for _, tt := range tests {
+		p := SafetyPolicy{StreamNames: tt.policy}
+		name, ok := p.Name(e)
+		if name != tt.name || ok != tt.ok {
+			t.Errorf("policy %d: got %q, %v; want %q, %v", tt.policy, name, ok, tt.name, tt.ok)
+		}
+		err := p.Check(&Listing{Entries: []*Entry{e}})
+		if (err != nil) != (tt.policy == RejectStreamNames) {
+			t.Errorf("policy %d: Check returned %v", tt.policy, err)
+		}
+	}
+
+	p := SafetyPolicy{StreamNames: StripStreamNames}
+	if _, ok := p.Name(&Entry{Name: "dir/:hidden"}); ok {
+		t.Error("stripping a whole element kept the entry")
+	}
+	if name, ok := p.Name(&Entry{Name: "plain.txt"}); name != "plain.txt" || !ok {
+		t.Errorf("plain name: got %q, %v", name, ok)
+	}
+
+	// Stripping must not turn an element into a dot-dot.
+	for _, name := range []string{"a/..:x/../../etc/passwd", "..:x/a", "a/b/.:x"} {
+		e := &Entry{Name: name}
+		if got, ok := p.Name(e); ok {
+			t.Errorf("%s: got %q, want the entry skipped", name, got)
+		}
+	}
+	evil := &Entry{Name: "a/..:x/../../etc/passwd"}
+	if err := p.Check(&Listing{Entries: []*Entry{evil}}); err == nil {
+		t.Errorf("%s: Check passed", evil.Name)
+	}
+	renamed := SafetyPolicy{StreamNames: RenameStreamNames}
+	if name, ok := renamed.Name(evil); !ok || name != "a/.._x/../../etc/passwd" {
+		t.Errorf("renamed: got %q, %v", name, ok)
+	}
+}
@@ -0,0 +1,29 @@
+package arkive
+
+import "errors"
+
+// ErrSecurityDescriptorUnsupported is returned by CaptureSecurityDescriptor
+// and ApplySecurityDescriptor on systems other than Windows.
+var ErrSecurityDescriptorUnsupported = errors.New("arkive: security descriptors are only supported on Windows")
+
+// Security descriptors cover the owner, group and discretionary ACL of
+// files. System ACLs (auditing) are left alone, since reading them
+// requires a privilege even elevated processes do not hold by default.
+
+// CaptureSecurityDescriptor returns the security descriptor of the file
+// at path in SDDL form, for zip.FileHeader.SetSecurityDescriptor.
+func CaptureSecurityDescriptor(path string) (string, error) {
+	return captureSecurityDescriptor(path)
+}
+
+// ApplySecurityDescriptor sets the owner, group and ACL of the file at
+// path from sddl, as recorded by zip.FileHeader.SetSecurityDescriptor.
+// Extractors should only call it when asked to: setting an owner other
+// than the current user requires running elevated, and fails otherwise.
+// It does nothing for an empty sddl.
+func ApplySecurityDescriptor(path string, sddl string) error {
+	if sddl == "" {
+		return nil
+	}
+	return applySecurityDescriptor(path, sddl)
+}
@@ -0,0 +1,11 @@
+// +build !windows
+
+package arkive
+
+func captureSecurityDescriptor(path string) (string, error) {
+	return "", ErrSecurityDescriptorUnsupported
+}
+
+func applySecurityDescriptor(path string, sddl string) error {
+	return ErrSecurityDescriptorUnsupported
+}
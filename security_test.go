@@ -0,0 +1,42 @@
+package arkive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSecurityDescriptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arkive-security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(p, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApplySecurityDescriptor(p, ""); err != nil {
+		t.Errorf("applying an empty descriptor: %v", err)
+	}
+	sddl, err := CaptureSecurityDescriptor(p)
+	if runtime.GOOS != "windows" {
+		if err != ErrSecurityDescriptorUnsupported {
+			t.Errorf("got %v, want ErrSecurityDescriptorUnsupported", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sddl == "" {
+		t.Fatal("got an empty descriptor")
+	}
+	// Applying a file's own descriptor needs no privilege.
+	if err := ApplySecurityDescriptor(p, sddl); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,77 @@
+package arkive
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetNamedSecurityInfoW                                = advapi32.NewProc("GetNamedSecurityInfoW")
+	procSetFileSecurityW                                     = advapi32.NewProc("SetFileSecurityW")
+	procConvertSecurityDescriptorToStringSecurityDescriptorW = advapi32.NewProc("ConvertSecurityDescriptorToStringSecurityDescriptorW")
+	procConvertStringSecurityDescriptorToSecurityDescriptorW = advapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procLocalFree                                            = kernel32.NewProc("LocalFree")
+)
+
+const (
+	seFileObject = 1
+	sddlRevision = 1
+
+	ownerSecurityInformation = 0x1
+	groupSecurityInformation = 0x2
+	daclSecurityInformation  = 0x4
+
+	securityInformation = ownerSecurityInformation | groupSecurityInformation | daclSecurityInformation
+)
+
+func captureSecurityDescriptor(path string) (string, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	var sd uintptr
+	r, _, _ := procGetNamedSecurityInfoW.Call(uintptr(unsafe.Pointer(p)), seFileObject, securityInformation,
+		0, 0, 0, 0, uintptr(unsafe.Pointer(&sd)))
+	if r != 0 {
+		return "", &os.PathError{Op: "GetNamedSecurityInfo", Path: path, Err: syscall.Errno(r)}
+	}
+	defer procLocalFree.Call(sd)
+
+	var s *uint16
+	var n uint32
+	r, _, e := procConvertSecurityDescriptorToStringSecurityDescriptorW.Call(sd, sddlRevision, securityInformation,
+		uintptr(unsafe.Pointer(&s)), uintptr(unsafe.Pointer(&n)))
+	if r == 0 {
+		return "", &os.PathError{Op: "ConvertSecurityDescriptorToStringSecurityDescriptor", Path: path, Err: e}
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(s)))
+	// n counts the terminating NUL.
+	return syscall.UTF16ToString((*[1 << 29]uint16)(unsafe.Pointer(s))[:n:n]), nil
+}
+
+func applySecurityDescriptor(path string, sddl string) error {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	s, err := syscall.UTF16PtrFromString(sddl)
+	if err != nil {
+		return err
+	}
+	var sd uintptr
+	r, _, e := procConvertStringSecurityDescriptorToSecurityDescriptorW.Call(uintptr(unsafe.Pointer(s)), sddlRevision,
+		uintptr(unsafe.Pointer(&sd)), 0)
+	if r == 0 {
+		return &os.PathError{Op: "ConvertStringSecurityDescriptorToSecurityDescriptor", Path: path, Err: e}
+	}
+	defer procLocalFree.Call(sd)
+	r, _, e = procSetFileSecurityW.Call(uintptr(unsafe.Pointer(p)), securityInformation, sd)
+	if r == 0 {
+		return &os.PathError{Op: "SetFileSecurity", Path: path, Err: e}
+	}
+	return nil
+}
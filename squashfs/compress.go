@@ -0,0 +1,92 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression IDs, as stored in the superblock.
+const (
+	GZIP = 1
+	LZMA = 2
+	LZO  = 3
+	XZ   = 4
+	LZ4  = 5
+	ZSTD = 6
+)
+
+// A Decompressor decompresses a single block. size is the largest the
+// decompressed block may be.
+type Decompressor func(src []byte, size int) ([]byte, error)
+
+var decompressors sync.Map // map[uint16]Decompressor
+
+func init() {
+	decompressors.Store(uint16(GZIP), Decompressor(decompressZlib))
+	decompressors.Store(uint16(ZSTD), Decompressor(decompressZstd))
+}
+
+// RegisterDecompressor registers a decompressor for a compression ID,
+// such as XZ, LZ4 or LZO, which are not built in. The built-in ones are
+// GZIP and ZSTD.
+func RegisterDecompressor(id uint16, dcomp Decompressor) {
+	if _, dup := decompressors.LoadOrStore(id, dcomp); dup {
+		panic("decompressor already registered")
+	}
+}
+
+func decompressor(id uint16) Decompressor {
+	d, ok := decompressors.Load(id)
+	if !ok {
+		return nil
+	}
+	return d.(Decompressor)
+}
+
+func compressionName(id uint16) string {
+	switch id {
+	case GZIP:
+		return "gzip"
+	case LZMA:
+		return "lzma"
+	case LZO:
+		return "lzo"
+	case XZ:
+		return "xz"
+	case LZ4:
+		return "lz4"
+	case ZSTD:
+		return "zstd"
+	}
+	return fmt.Sprintf("compression %d", id)
+}
+
+func decompressZlib(src []byte, size int) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func decompressZstd(src []byte, size int) ([]byte, error) {
+	zstdOnce.Do(func() {
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	if zstdErr != nil {
+		return nil, zstdErr
+	}
+	return zstdDecoder.DecodeAll(src, make([]byte, 0, size))
+}
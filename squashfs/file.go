@@ -0,0 +1,183 @@
+package squashfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// A File is a regular file opened from a Reader. Its ReadAt method is
+// safe for concurrent use; Read and Seek share a position and are not.
+type File struct {
+	sr     *Reader
+	in     *inode
+	name   string
+	blocks []int64 // position of each data block
+	pos    int64
+
+	mu     sync.Mutex
+	cached int // index of the block in cache, -1 for none, len(blocks) for the fragment
+	cache  []byte
+}
+
+func (sr *Reader) newFile(in *inode, name string) (*File, error) {
+	f := &File{
+		sr:     sr,
+		in:     in,
+		name:   name,
+		blocks: make([]int64, len(in.blockSizes)),
+		cached: -1,
+	}
+	pos := in.blocksStart
+	for i, size := range in.blockSizes {
+		f.blocks[i] = pos
+		pos += int64(size &^ uncompressed)
+	}
+	if pos > sr.size {
+		return nil, ErrCorrupt
+	}
+	return f, nil
+}
+
+// Stat returns information about the file.
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.in.fileInfo(f.name), nil
+}
+
+// Close does nothing; it is there for File to be an io.ReadCloser.
+func (f *File) Close() error {
+	return nil
+}
+
+// ReadAt reads the file contents at off, decompressing the blocks it
+// spans. The last block read is kept in memory.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("squashfs: negative offset")
+	}
+	bs := int64(f.sr.sb.blockSize)
+	n := 0
+	for len(p) > 0 {
+		if off >= f.in.size {
+			return n, io.EOF
+		}
+		m, err := f.readBlock(int(off/bs), p, off%bs)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// readBlock copies the contents of block i, from off, to p. Block
+// len(f.blocks) is the tail of the file, stored in a fragment.
+func (f *File) readBlock(i int, p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cached != i {
+		f.cached = -1
+		var err error
+		if i < len(f.blocks) {
+			f.cache, err = f.loadBlock(i)
+		} else {
+			f.cache, err = f.loadFragment()
+		}
+		if err != nil {
+			return 0, err
+		}
+		f.cached = i
+	}
+	if off >= int64(len(f.cache)) {
+		return 0, ErrCorrupt
+	}
+	return copy(p, f.cache[off:]), nil
+}
+
+// blockLen is the amount of file data in block i.
+func (f *File) blockLen(i int) int {
+	bs := int64(f.sr.sb.blockSize)
+	if rest := f.in.size - int64(i)*bs; rest < bs {
+		return int(rest)
+	}
+	return int(bs)
+}
+
+func (f *File) loadBlock(i int) ([]byte, error) {
+	size := f.in.blockSizes[i]
+	want := f.blockLen(i)
+	if size == 0 {
+		// A hole in a sparse file.
+		return make([]byte, want), nil
+	}
+	data, err := f.sr.readData(f.blocks[i], size)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != want {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+func (f *File) loadFragment() ([]byte, error) {
+	frag := f.sr.fragments[f.in.fragIndex]
+	data, err := f.sr.readData(int64(frag.start), frag.size)
+	if err != nil {
+		return nil, err
+	}
+	start := int64(f.in.fragOffset)
+	end := start + int64(f.blockLen(len(f.blocks)))
+	if end > int64(len(data)) {
+		return nil, ErrCorrupt
+	}
+	return data[start:end], nil
+}
+
+// readData reads the data block at pos, whose size on disk is given in
+// the format of inode block lists.
+func (sr *Reader) readData(pos int64, size uint32) ([]byte, error) {
+	n := int64(size &^ uncompressed)
+	if n > int64(sr.sb.blockSize) || pos+n > sr.size {
+		return nil, ErrCorrupt
+	}
+	raw := make([]byte, n)
+	if _, err := sr.r.ReadAt(raw, pos); err != nil {
+		return nil, sr.ioErr(err)
+	}
+	if size&uncompressed != 0 {
+		return raw, nil
+	}
+	return sr.dcomp(raw, int(sr.sb.blockSize))
+}
+
+// Read reads the file contents from the current position.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position for the next Read.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.in.size
+	default:
+		return 0, errors.New("squashfs: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("squashfs: negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,126 @@
+// +build go1.16
+
+package squashfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// FS returns the image as an fs.FS. Opening a name follows symlinks,
+// as os.DirFS does, and directories implement fs.ReadDirFile. The
+// returned FS also implements fs.StatFS and fs.ReadDirFS.
+func (sr *Reader) FS() fs.FS {
+	return readerFS{sr}
+}
+
+type readerFS struct {
+	sr *Reader
+}
+
+func (fsys readerFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	in, target, err := fsys.sr.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: notExist(err)}
+	}
+	base := path.Base(name)
+	switch {
+	case in.isRegular():
+		f, err := fsys.sr.newFile(in, base)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return f, nil
+	case in.isDir():
+		return &dirFile{sr: fsys.sr, in: in, name: base, path: target}, nil
+	}
+	return &specialFile{in: in, name: base}, nil
+}
+
+func (fsys readerFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	in, _, err := fsys.sr.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: notExist(err)}
+	}
+	return in.fileInfo(path.Base(name)), nil
+}
+
+func (fsys readerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := f.(*dirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return d.ReadDir(-1)
+}
+
+// dirFile is a directory opened through FS.
+type dirFile struct {
+	sr      *Reader
+	in      *inode
+	name    string
+	path    string // symlinks resolved, for errors
+	entries []dirEntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.in.fileInfo(d.name), nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+// ReadDir follows the contract of fs.ReadDirFile.
+func (d *dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.sr.readDir(d.in)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		d.entries = entries
+		d.read = true
+	}
+	rest := d.entries
+	if count > 0 && len(rest) > count {
+		rest = rest[:count]
+	}
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	list := make([]fs.DirEntry, 0, len(rest))
+	for _, e := range rest {
+		child, err := d.sr.readInode(e.ref)
+		if err != nil {
+			return list, &fs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		list = append(list, fs.FileInfoToDirEntry(child.fileInfo(e.name)))
+		d.entries = d.entries[1:]
+	}
+	return list, nil
+}
+
+// specialFile is a device, fifo or socket opened through FS, which has
+// no contents to read.
+type specialFile struct {
+	in   *inode
+	name string
+}
+
+func (f *specialFile) Stat() (fs.FileInfo, error) { return f.in.fileInfo(f.name), nil }
+func (f *specialFile) Close() error               { return nil }
+
+func (f *specialFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("squashfs: not a regular file")}
+}
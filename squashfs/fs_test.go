@@ -0,0 +1,27 @@
+// +build go1.16
+
+package squashfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	fsys := newTestReader(t).FS()
+	if err := fstest.TestFS(fsys, "big.bin", "hello.txt", "sparse", "sub/deep.txt"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.ReadFile(fsys, "link")
+	if err != nil || string(b) != string(deepContents) {
+		t.Errorf("ReadFile(link) = %q, %v", b, err)
+	}
+	if _, err := fsys.Open("/hello.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(/hello.txt) = %v, want fs.ErrInvalid", err)
+	}
+	if _, err := fsys.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(missing) = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,345 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Inode types. The extended variants add fields for large files, hard
+// links and extended attributes.
+const (
+	typeDir = iota + 1
+	typeFile
+	typeSymlink
+	typeBlockDev
+	typeCharDev
+	typeFifo
+	typeSocket
+	typeExtDir
+	typeExtFile
+	typeExtSymlink
+	typeExtBlockDev
+	typeExtCharDev
+	typeExtFifo
+	typeExtSocket
+)
+
+var errNoEntry = errors.New("squashfs: no such file or directory")
+
+type inode struct {
+	typ    uint16 // basic type, even for extended inodes
+	perm   uint16
+	uid    int
+	gid    int
+	mtime  uint32
+	number uint32
+
+	// directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32 // of the listing
+
+	// regular files
+	size        int64
+	blocksStart int64
+	blockSizes  []uint32
+	fragIndex   uint32
+	fragOffset  uint32
+
+	// symlinks
+	target string
+
+	// devices
+	rdev uint32
+}
+
+func (in *inode) isDir() bool     { return in.typ == typeDir }
+func (in *inode) isRegular() bool { return in.typ == typeFile }
+func (in *inode) isSymlink() bool { return in.typ == typeSymlink }
+
+// readInode reads the inode at ref, made of the position of its metadata
+// block within the inode table and its offset in that block.
+func (sr *Reader) readInode(ref uint64) (*inode, error) {
+	mr, err := sr.newMetaReader(int64(sr.sb.inodeTable+ref>>16), int(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	var buf [40]byte
+	if _, err := io.ReadFull(mr, buf[:16]); err != nil {
+		return nil, err
+	}
+	in := &inode{
+		typ:    le.Uint16(buf[0:]),
+		perm:   le.Uint16(buf[2:]),
+		uid:    sr.id(le.Uint16(buf[4:])),
+		gid:    sr.id(le.Uint16(buf[6:])),
+		mtime:  le.Uint32(buf[8:]),
+		number: le.Uint32(buf[12:]),
+	}
+
+	switch in.typ {
+	case typeDir:
+		if _, err := io.ReadFull(mr, buf[:16]); err != nil {
+			return nil, err
+		}
+		in.dirBlock = le.Uint32(buf[0:])
+		in.dirSize = uint32(le.Uint16(buf[8:]))
+		in.dirOffset = le.Uint16(buf[10:])
+	case typeExtDir:
+		// The directory index that follows only speeds up lookups in
+		// large directories, and is not used.
+		if _, err := io.ReadFull(mr, buf[:24]); err != nil {
+			return nil, err
+		}
+		in.dirSize = le.Uint32(buf[4:])
+		in.dirBlock = le.Uint32(buf[8:])
+		in.dirOffset = le.Uint16(buf[18:])
+	case typeFile:
+		if _, err := io.ReadFull(mr, buf[:16]); err != nil {
+			return nil, err
+		}
+		in.blocksStart = int64(le.Uint32(buf[0:]))
+		in.fragIndex = le.Uint32(buf[4:])
+		in.fragOffset = le.Uint32(buf[8:])
+		in.size = int64(le.Uint32(buf[12:]))
+	case typeExtFile:
+		if _, err := io.ReadFull(mr, buf[:40]); err != nil {
+			return nil, err
+		}
+		in.blocksStart = int64(le.Uint64(buf[0:]))
+		in.size = int64(le.Uint64(buf[8:]))
+		in.fragIndex = le.Uint32(buf[28:])
+		in.fragOffset = le.Uint32(buf[32:])
+	case typeSymlink, typeExtSymlink:
+		if _, err := io.ReadFull(mr, buf[:8]); err != nil {
+			return nil, err
+		}
+		n := le.Uint32(buf[4:])
+		if n > 4096 {
+			return nil, ErrCorrupt
+		}
+		target := make([]byte, n)
+		if _, err := io.ReadFull(mr, target); err != nil {
+			return nil, err
+		}
+		in.target = string(target)
+	case typeBlockDev, typeCharDev, typeExtBlockDev, typeExtCharDev:
+		if _, err := io.ReadFull(mr, buf[:8]); err != nil {
+			return nil, err
+		}
+		in.rdev = le.Uint32(buf[4:])
+	case typeFifo, typeSocket, typeExtFifo, typeExtSocket:
+	default:
+		return nil, ErrCorrupt
+	}
+	if in.typ >= typeExtDir {
+		in.typ -= typeExtDir - typeDir
+	}
+	if in.dirSize >= 3 {
+		// Stored sizes count the "." and ".." entries that are not.
+		in.dirSize -= 3
+	}
+
+	if in.isRegular() {
+		if in.size < 0 {
+			return nil, ErrCorrupt
+		}
+		bs := int64(sr.sb.blockSize)
+		n := in.size / bs
+		if in.fragIndex == noFragment {
+			if in.size%bs != 0 {
+				n++
+			}
+		} else if int(in.fragIndex) >= len(sr.fragments) {
+			return nil, ErrCorrupt
+		}
+		if n*4 > sr.size {
+			return nil, ErrCorrupt
+		}
+		b := make([]byte, 4*n)
+		if _, err := io.ReadFull(mr, b); err != nil {
+			return nil, err
+		}
+		in.blockSizes = make([]uint32, n)
+		for i := range in.blockSizes {
+			in.blockSizes[i] = le.Uint32(b[4*i:])
+		}
+	}
+	return in, nil
+}
+
+type dirEntry struct {
+	name string
+	ref  uint64
+}
+
+// readDir reads the listing of the directory in, which is sorted by name.
+func (sr *Reader) readDir(in *inode) ([]dirEntry, error) {
+	if in.dirSize == 0 {
+		return nil, nil
+	}
+	mr, err := sr.newMetaReader(int64(sr.sb.directoryTable)+int64(in.dirBlock), int(in.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, in.dirSize)
+	if _, err := io.ReadFull(mr, b); err != nil {
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	var entries []dirEntry
+	for len(b) > 0 {
+		if len(b) < 12 {
+			return nil, ErrCorrupt
+		}
+		count := int(le.Uint32(b[0:])) + 1
+		start := uint64(le.Uint32(b[4:]))
+		b = b[12:]
+		for i := 0; i < count; i++ {
+			if len(b) < 8 {
+				return nil, ErrCorrupt
+			}
+			offset := uint64(le.Uint16(b[0:]))
+			nameLen := int(le.Uint16(b[6:])) + 1
+			if len(b) < 8+nameLen {
+				return nil, ErrCorrupt
+			}
+			entries = append(entries, dirEntry{
+				name: string(b[8 : 8+nameLen]),
+				ref:  start<<16 | offset,
+			})
+			b = b[8+nameLen:]
+		}
+	}
+	return entries, nil
+}
+
+// findEntry looks name up in the directory in.
+func (sr *Reader) findEntry(in *inode, name string) (*inode, error) {
+	entries, err := sr.readDir(in)
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].name >= name })
+	if i == len(entries) || entries[i].name != name {
+		return nil, errNoEntry
+	}
+	return sr.readInode(entries[i].ref)
+}
+
+// walk calls fn for name and, if it is a directory, the files in it.
+// visited holds the listings of the directories walked so far: in an
+// intact image every directory has a single parent, so meeting one
+// again means the image is corrupt, and would loop forever.
+func (sr *Reader) walk(name string, in *inode, fi os.FileInfo, fn WalkFunc, visited map[uint64]bool) error {
+	if !in.isDir() {
+		return fn(name, fi, nil)
+	}
+	listing := uint64(in.dirBlock)<<16 | uint64(in.dirOffset)
+	if visited[listing] {
+		return ErrCorrupt
+	}
+	visited[listing] = true
+	entries, err := sr.readDir(in)
+	err1 := fn(name, fi, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, e := range entries {
+		child := path.Join(name, e.name)
+		cin, err := sr.readInode(e.ref)
+		if err != nil {
+			if err := fn(child, nil, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := sr.walk(child, cin, cin.fileInfo(e.name), fn, visited); err != nil {
+			if !cin.isDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// InodeInfo is what the Sys method of the os.FileInfo values returned
+// by a Reader holds.
+type InodeInfo struct {
+	Inode uint32
+	Uid   int // -1 if the image has no such id
+	Gid   int
+	Rdev  uint32 // for devices
+}
+
+type fileInfo struct {
+	name string
+	in   *inode
+}
+
+func (in *inode) fileInfo(name string) os.FileInfo {
+	return &fileInfo{name: name, in: in}
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+
+func (fi *fileInfo) Size() int64 {
+	switch {
+	case fi.in.isRegular():
+		return fi.in.size
+	case fi.in.isSymlink():
+		return int64(len(fi.in.target))
+	case fi.in.isDir():
+		return int64(fi.in.dirSize)
+	}
+	return 0
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	in := fi.in
+	mode := os.FileMode(in.perm & 0777)
+	if in.perm&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if in.perm&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if in.perm&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	switch in.typ {
+	case typeDir:
+		mode |= os.ModeDir
+	case typeSymlink:
+		mode |= os.ModeSymlink
+	case typeBlockDev:
+		mode |= os.ModeDevice
+	case typeCharDev:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case typeFifo:
+		mode |= os.ModeNamedPipe
+	case typeSocket:
+		mode |= os.ModeSocket
+	}
+	return mode
+}
+
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(int64(fi.in.mtime), 0) }
+func (fi *fileInfo) IsDir() bool        { return fi.in.isDir() }
+
+func (fi *fileInfo) Sys() interface{} {
+	return &InodeInfo{
+		Inode: fi.in.number,
+		Uid:   fi.in.uid,
+		Gid:   fi.in.gid,
+		Rdev:  fi.in.rdev,
+	}
+}
@@ -0,0 +1,525 @@
+// Package squashfs reads squashfs 4.0 file system images, such as the
+// payloads of AppImages.
+//
+// Images compressed with gzip or zstd are supported out of the box, and
+// xz ones once package github.com/itchio/arkive/methods/xz is imported;
+// decompressors for other methods can be added with RegisterDecompressor.
+// Files are looked up by slash-separated paths relative to the root of
+// the image, as with package zip. On Go 1.16 and later, Reader.FS
+// returns the image as an fs.FS.
+package squashfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrFormat is returned for images that are not squashfs 4.0.
+	ErrFormat = errors.New("squashfs: not a valid squashfs 4.0 image")
+	// ErrCorrupt is returned when the structures of an image are
+	// inconsistent.
+	ErrCorrupt = errors.New("squashfs: corrupt image")
+)
+
+const (
+	magic        = 0x73717368
+	superLen     = 96
+	metaMaxSize  = 8192
+	noFragment   = 0xffffffff
+	uncompressed = 1 << 24 // in data block sizes
+)
+
+// Superblock flags.
+const (
+	flagUncompressedInodes    = 0x0001
+	flagUncompressedData      = 0x0002
+	flagUncompressedFragments = 0x0008
+	flagUncompressedIDs       = 0x0800
+)
+
+type superblock struct {
+	inodeCount     uint32
+	modTime        uint32
+	blockSize      uint32
+	fragmentCount  uint32
+	compression    uint16
+	blockLog       uint16
+	flags          uint16
+	idCount        uint16
+	major, minor   uint16
+	rootInode      uint64
+	bytesUsed      uint64
+	idTable        uint64
+	xattrTable     uint64
+	inodeTable     uint64
+	directoryTable uint64
+	fragmentTable  uint64
+	exportTable    uint64
+}
+
+// A Reader serves content from a squashfs image. It is safe for
+// concurrent use.
+type Reader struct {
+	r     io.ReaderAt
+	size  int64
+	sb    superblock
+	dcomp Decompressor
+
+	ids       []uint32
+	fragments []fragment
+	root      *inode
+
+	mu        sync.Mutex
+	metaCache map[int64]metaBlock // by position, for table lookups
+}
+
+type fragment struct {
+	start uint64
+	size  uint32 // on disk, with the uncompressed bit
+}
+
+type metaBlock struct {
+	data []byte
+	next int64 // position of the following block
+}
+
+// A ReadCloser is a Reader that must be closed when no longer needed.
+type ReadCloser struct {
+	f *os.File
+	Reader
+}
+
+// OpenReader opens the squashfs image specified by name.
+func OpenReader(name string) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := new(ReadCloser)
+	if err := r.init(f, fi.Size()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f = f
+	return r, nil
+}
+
+// Close closes the image file.
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// NewReader returns a new Reader reading from r, which is assumed to
+// have the given size in bytes. The image may be preceded by other data,
+// as in AppImages, if r is a section starting at the superblock.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	sr := new(Reader)
+	if err := sr.init(r, size); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+func (sr *Reader) init(r io.ReaderAt, size int64) error {
+	sr.r = r
+	sr.size = size
+	sr.metaCache = make(map[int64]metaBlock)
+
+	var buf [superLen]byte
+	if _, err := r.ReadAt(buf[:], 0); err != nil {
+		if err == io.EOF {
+			return ErrFormat
+		}
+		return err
+	}
+	le := binary.LittleEndian
+	if le.Uint32(buf[0:]) != magic {
+		return ErrFormat
+	}
+	sb := &sr.sb
+	sb.inodeCount = le.Uint32(buf[4:])
+	sb.modTime = le.Uint32(buf[8:])
+	sb.blockSize = le.Uint32(buf[12:])
+	sb.fragmentCount = le.Uint32(buf[16:])
+	sb.compression = le.Uint16(buf[20:])
+	sb.blockLog = le.Uint16(buf[22:])
+	sb.flags = le.Uint16(buf[24:])
+	sb.idCount = le.Uint16(buf[26:])
+	sb.major = le.Uint16(buf[28:])
+	sb.minor = le.Uint16(buf[30:])
+	sb.rootInode = le.Uint64(buf[32:])
+	sb.bytesUsed = le.Uint64(buf[40:])
+	sb.idTable = le.Uint64(buf[48:])
+	sb.xattrTable = le.Uint64(buf[56:])
+	sb.inodeTable = le.Uint64(buf[64:])
+	sb.directoryTable = le.Uint64(buf[72:])
+	sb.fragmentTable = le.Uint64(buf[80:])
+	sb.exportTable = le.Uint64(buf[88:])
+	if sb.major != 4 || sb.minor != 0 {
+		return ErrFormat
+	}
+	if sb.blockSize < 4096 || sb.blockSize > 1<<20 || 1<<sb.blockLog != sb.blockSize {
+		return ErrCorrupt
+	}
+	if int64(sb.bytesUsed) > size {
+		return fmt.Errorf("squashfs: image is truncated (%d bytes, need %d)", size, sb.bytesUsed)
+	}
+
+	sr.dcomp = decompressor(sb.compression)
+	if sr.dcomp == nil {
+		return fmt.Errorf("squashfs: unsupported %s compression", compressionName(sb.compression))
+	}
+
+	var err error
+	if sr.ids, err = sr.readIDTable(); err != nil {
+		return err
+	}
+	if sr.fragments, err = sr.readFragmentTable(); err != nil {
+		return err
+	}
+	sr.root, err = sr.readInode(sb.rootInode)
+	if err != nil {
+		return err
+	}
+	if !sr.root.isDir() {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// ModTime returns the time the image was created.
+func (sr *Reader) ModTime() int64 {
+	return int64(sr.sb.modTime)
+}
+
+// BlockSize returns the size of data blocks in the image.
+func (sr *Reader) BlockSize() int {
+	return int(sr.sb.blockSize)
+}
+
+// readMetaBlock reads the metadata block at pos.
+func (sr *Reader) readMetaBlock(pos int64) (metaBlock, error) {
+	sr.mu.Lock()
+	mb, ok := sr.metaCache[pos]
+	sr.mu.Unlock()
+	if ok {
+		return mb, nil
+	}
+
+	var hdr [2]byte
+	if _, err := sr.r.ReadAt(hdr[:], pos); err != nil {
+		return mb, sr.ioErr(err)
+	}
+	h := binary.LittleEndian.Uint16(hdr[:])
+	size := int64(h & 0x7fff)
+	if size == 0 || size > metaMaxSize {
+		return mb, ErrCorrupt
+	}
+	raw := make([]byte, size)
+	if _, err := sr.r.ReadAt(raw, pos+2); err != nil {
+		return mb, sr.ioErr(err)
+	}
+	data := raw
+	if h&0x8000 == 0 {
+		var err error
+		if data, err = sr.dcomp(raw, metaMaxSize); err != nil {
+			return mb, err
+		}
+		if len(data) > metaMaxSize {
+			return mb, ErrCorrupt
+		}
+	}
+	mb = metaBlock{data: data, next: pos + 2 + size}
+
+	sr.mu.Lock()
+	sr.metaCache[pos] = mb
+	sr.mu.Unlock()
+	return mb, nil
+}
+
+func (sr *Reader) ioErr(err error) error {
+	if err == io.EOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+// A metaReader reads a stream of metadata blocks, starting at an offset
+// within the first one.
+type metaReader struct {
+	sr     *Reader
+	pos    int64 // position of the next block
+	buf    []byte
+	offset int // within buf
+}
+
+func (sr *Reader) newMetaReader(block int64, offset int) (*metaReader, error) {
+	mr := &metaReader{sr: sr, pos: block}
+	if err := mr.fill(); err != nil {
+		return nil, err
+	}
+	if offset > len(mr.buf) {
+		return nil, ErrCorrupt
+	}
+	mr.offset = offset
+	return mr, nil
+}
+
+func (mr *metaReader) fill() error {
+	mb, err := mr.sr.readMetaBlock(mr.pos)
+	if err != nil {
+		return err
+	}
+	mr.buf = mb.data
+	mr.offset = 0
+	mr.pos = mb.next
+	return nil
+}
+
+func (mr *metaReader) Read(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if mr.offset == len(mr.buf) {
+			if err := mr.fill(); err != nil {
+				return n, err
+			}
+		}
+		m := copy(p, mr.buf[mr.offset:])
+		mr.offset += m
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// readTable reads count entries of entrySize bytes from a table whose
+// metadata blocks are listed by the index at indexPos.
+func (sr *Reader) readTable(indexPos uint64, count, entrySize int) ([]byte, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	perBlock := metaMaxSize / entrySize
+	blocks := (count + perBlock - 1) / perBlock
+	index := make([]byte, 8*blocks)
+	if _, err := sr.r.ReadAt(index, int64(indexPos)); err != nil {
+		return nil, sr.ioErr(err)
+	}
+	out := make([]byte, 0, count*entrySize)
+	for i := 0; i < blocks; i++ {
+		mb, err := sr.readMetaBlock(int64(binary.LittleEndian.Uint64(index[8*i:])))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mb.data...)
+	}
+	if len(out) < count*entrySize {
+		return nil, ErrCorrupt
+	}
+	return out[:count*entrySize], nil
+}
+
+func (sr *Reader) readIDTable() ([]uint32, error) {
+	b, err := sr.readTable(sr.sb.idTable, int(sr.sb.idCount), 4)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint32, sr.sb.idCount)
+	for i := range ids {
+		ids[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return ids, nil
+}
+
+func (sr *Reader) readFragmentTable() ([]fragment, error) {
+	if sr.sb.fragmentCount == 0 || sr.sb.fragmentTable == ^uint64(0) {
+		return nil, nil
+	}
+	b, err := sr.readTable(sr.sb.fragmentTable, int(sr.sb.fragmentCount), 16)
+	if err != nil {
+		return nil, err
+	}
+	frags := make([]fragment, sr.sb.fragmentCount)
+	for i := range frags {
+		e := b[16*i:]
+		frags[i] = fragment{
+			start: binary.LittleEndian.Uint64(e),
+			size:  binary.LittleEndian.Uint32(e[8:]),
+		}
+	}
+	return frags, nil
+}
+
+func (sr *Reader) id(idx uint16) int {
+	if int(idx) >= len(sr.ids) {
+		return -1
+	}
+	return int(sr.ids[idx])
+}
+
+// lookup resolves name, a slash-separated path relative to the root,
+// following symlinks in its directories but not in its last element.
+func (sr *Reader) lookup(name string) (*inode, error) {
+	return sr.lookupDepth(name, 0)
+}
+
+// maxSymlinks bounds how many symlinks a lookup follows.
+const maxSymlinks = 40
+
+func (sr *Reader) lookupDepth(name string, depth int) (*inode, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	in := sr.root
+	if name == "" {
+		return in, nil
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if !in.isDir() {
+			return nil, errNotDir
+		}
+		child, err := sr.findEntry(in, part)
+		if err != nil {
+			return nil, err
+		}
+		if child.isSymlink() && i < len(parts)-1 {
+			if depth >= maxSymlinks {
+				return nil, errors.New("squashfs: too many levels of symbolic links")
+			}
+			target := child.target
+			if !strings.HasPrefix(target, "/") {
+				target = path.Join(strings.Join(parts[:i], "/"), target)
+			}
+			child, err = sr.lookupDepth(target, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		in = child
+	}
+	return in, nil
+}
+
+var errNotDir = errors.New("squashfs: not a directory")
+
+// Stat returns information about the named file, without following a
+// final symlink.
+func (sr *Reader) Stat(name string) (os.FileInfo, error) {
+	in, err := sr.lookup(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: notExist(err)}
+	}
+	return in.fileInfo(path.Base(path.Clean("/" + name))), nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (sr *Reader) ReadDir(name string) ([]os.FileInfo, error) {
+	in, err := sr.lookup(name)
+	if err == nil && !in.isDir() {
+		err = errNotDir
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: notExist(err)}
+	}
+	entries, err := sr.readDir(in)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	fis := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		child, err := sr.readInode(e.ref)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		fis = append(fis, child.fileInfo(e.name))
+	}
+	return fis, nil
+}
+
+// ReadLink returns the target of the named symlink.
+func (sr *Reader) ReadLink(name string) (string, error) {
+	in, err := sr.lookup(name)
+	if err == nil && !in.isSymlink() {
+		err = errors.New("squashfs: not a symlink")
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: notExist(err)}
+	}
+	return in.target, nil
+}
+
+// Open opens the named regular file for reading, following symlinks.
+func (sr *Reader) Open(name string) (*File, error) {
+	in, name, err := sr.resolve(name)
+	if err == nil && !in.isRegular() {
+		err = errors.New("squashfs: not a regular file")
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: notExist(err)}
+	}
+	return sr.newFile(in, path.Base(path.Clean("/"+name)))
+}
+
+// resolve looks name up, following symlinks, and returns its inode with
+// the name it was found under.
+func (sr *Reader) resolve(name string) (*inode, string, error) {
+	in, err := sr.lookup(name)
+	for depth := 0; err == nil && in.isSymlink(); depth++ {
+		if depth >= maxSymlinks {
+			err = errors.New("squashfs: too many levels of symbolic links")
+			break
+		}
+		target := in.target
+		if !strings.HasPrefix(target, "/") {
+			target = path.Join(path.Dir(path.Clean("/"+name)), target)
+		}
+		name = target
+		in, err = sr.lookup(name)
+	}
+	return in, name, err
+}
+
+// ReadFile returns the contents of the named file.
+func (sr *Reader) ReadFile(name string) ([]byte, error) {
+	f, err := sr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, f.in.size)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WalkFunc is called by Walk for every file, like filepath.WalkFunc.
+// Returning filepath.SkipDir from a directory skips its contents.
+type WalkFunc func(name string, fi os.FileInfo, err error) error
+
+// Walk calls fn for every file in the image, in lexical order, starting
+// with the root directory, named ".".
+func (sr *Reader) Walk(fn WalkFunc) error {
+	err := sr.walk(".", sr.root, sr.root.fileInfo("."), fn, make(map[uint64]bool))
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func notExist(err error) error {
+	if err == errNoEntry {
+		return os.ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,409 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func app16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func app32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func app64(b []byte, v uint64) []byte {
+	return app32(app32(b, uint32(v)), uint32(v>>32))
+}
+
+func zlibBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func bigContents() []byte {
+	b := make([]byte, 10000)
+	for i := range b {
+		b[i] = byte(i*7 + i/13)
+	}
+	return b
+}
+
+var (
+	helloContents = []byte("hello, squashfs\n")
+	deepContents  = []byte(strings.Repeat("0123456789abcdef", 256))
+)
+
+// buildImage writes a small gzip image, the way mksquashfs would lay it
+// out, holding:
+//
+//	big.bin      10000 bytes: a compressed block, a stored one, a fragment
+//	hello.txt    in the same fragment
+//	link         -> sub/deep.txt
+//	sparse       8192 zero bytes, all holes
+//	sub/deep.txt one compressed block, in an extended inode
+//
+// The root directory has an extended inode too.
+func buildImage(t *testing.T) []byte {
+	img := make([]byte, superLen)
+	big := bigContents()
+
+	bigStart := len(img)
+	b0 := zlibBytes(t, big[:4096])
+	img = append(img, b0...)
+	img = append(img, big[4096:8192]...)
+	deepStart := len(img)
+	d0 := zlibBytes(t, deepContents)
+	img = append(img, d0...)
+	fragStart := len(img)
+	fz := zlibBytes(t, append(append([]byte{}, helloContents...), big[8192:]...))
+	img = append(img, fz...)
+
+	var inodes []byte
+	header := func(typ, perm uint16, number uint32) uint64 {
+		ref := uint64(len(inodes))
+		inodes = app16(inodes, typ)
+		inodes = app16(inodes, perm)
+		inodes = app16(inodes, 0) // uid
+		inodes = app16(inodes, 1) // gid
+		inodes = app32(inodes, 1500000000)
+		inodes = app32(inodes, number)
+		return ref
+	}
+
+	helloRef := header(typeFile, 0644, 1)
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, 0) // fragment
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, uint32(len(helloContents)))
+
+	bigRef := header(typeFile, 0755, 2)
+	inodes = app32(inodes, uint32(bigStart))
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, uint32(len(helloContents)))
+	inodes = app32(inodes, uint32(len(big)))
+	inodes = app32(inodes, uint32(len(b0)))
+	inodes = app32(inodes, 4096|uncompressed)
+
+	deepRef := header(typeExtFile, 0600, 3)
+	inodes = app64(inodes, uint64(deepStart))
+	inodes = app64(inodes, uint64(len(deepContents)))
+	inodes = app64(inodes, 0) // sparse
+	inodes = app32(inodes, 1)
+	inodes = app32(inodes, noFragment)
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, 0xffffffff) // xattr
+	inodes = app32(inodes, uint32(len(d0)))
+
+	sparseRef := header(typeFile, 0644, 4)
+	inodes = app32(inodes, uint32(fragStart))
+	inodes = app32(inodes, noFragment)
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, 8192)
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, 0)
+
+	linkRef := header(typeSymlink, 0777, 5)
+	inodes = app32(inodes, 1)
+	inodes = app32(inodes, uint32(len("sub/deep.txt")))
+	inodes = append(inodes, "sub/deep.txt"...)
+
+	type entry struct {
+		name   string
+		ref    uint64
+		number uint32
+		typ    uint16
+	}
+	var dirs []byte
+	listing := func(entries []entry) (offset, size int) {
+		offset = len(dirs)
+		base := entries[0].number
+		dirs = app32(dirs, uint32(len(entries)-1))
+		dirs = app32(dirs, 0) // all inodes are in the first block
+		dirs = app32(dirs, base)
+		for _, e := range entries {
+			dirs = app16(dirs, uint16(e.ref))
+			dirs = app16(dirs, uint16(int16(e.number-base)))
+			dirs = app16(dirs, e.typ)
+			dirs = app16(dirs, uint16(len(e.name)-1))
+			dirs = append(dirs, e.name...)
+		}
+		return offset, len(dirs) - offset
+	}
+
+	subOff, subLen := listing([]entry{{"deep.txt", deepRef, 3, typeFile}})
+	subRef := header(typeDir, 0755, 6)
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, 2)
+	inodes = app16(inodes, uint16(subLen+3))
+	inodes = app16(inodes, uint16(subOff))
+	inodes = app32(inodes, 7)
+
+	rootOff, rootLen := listing([]entry{
+		{"big.bin", bigRef, 2, typeFile},
+		{"hello.txt", helloRef, 1, typeFile},
+		{"link", linkRef, 5, typeSymlink},
+		{"sparse", sparseRef, 4, typeFile},
+		{"sub", subRef, 6, typeDir},
+	})
+	rootRef := header(typeExtDir, 0755, 7)
+	inodes = app32(inodes, 3)
+	inodes = app32(inodes, uint32(rootLen+3))
+	inodes = app32(inodes, 0)
+	inodes = app32(inodes, 8) // parent
+	inodes = app16(inodes, 0) // index entries
+	inodes = app16(inodes, uint16(rootOff))
+	inodes = app32(inodes, 0xffffffff)
+
+	// The inode table is compressed, the rest of the metadata is not.
+	inodeTable := len(img)
+	zi := zlibBytes(t, inodes)
+	img = app16(img, uint16(len(zi)))
+	img = append(img, zi...)
+	meta := func(b []byte) int {
+		pos := len(img)
+		img = app16(img, uint16(len(b))|0x8000)
+		img = append(img, b...)
+		return pos
+	}
+	dirTable := meta(dirs)
+	fragMeta := meta(app32(app32(app64(nil, uint64(fragStart)), uint32(len(fz))), 0))
+	fragTable := len(img)
+	img = app64(img, uint64(fragMeta))
+	idMeta := meta(app32(app32(nil, 1000), 1001))
+	idTable := len(img)
+	img = app64(img, uint64(idMeta))
+
+	sb := app32(nil, magic)
+	sb = app32(sb, 7)
+	sb = app32(sb, 1500000000)
+	sb = app32(sb, 4096)
+	sb = app32(sb, 1) // fragments
+	sb = app16(sb, GZIP)
+	sb = app16(sb, 12)
+	sb = app16(sb, 0) // flags
+	sb = app16(sb, 2) // ids
+	sb = app16(sb, 4)
+	sb = app16(sb, 0)
+	sb = app64(sb, rootRef)
+	sb = app64(sb, uint64(len(img)))
+	sb = app64(sb, uint64(idTable))
+	sb = app64(sb, ^uint64(0)) // xattrs
+	sb = app64(sb, uint64(inodeTable))
+	sb = app64(sb, uint64(dirTable))
+	sb = app64(sb, uint64(fragTable))
+	sb = app64(sb, ^uint64(0)) // export
+	copy(img, sb)
+	return img
+}
+
+func newTestReader(t *testing.T) *Reader {
+	img := buildImage(t)
+	sr, err := NewReader(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sr
+}
+
+func TestReadDir(t *testing.T) {
+	sr := newTestReader(t)
+	fis, err := sr.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		mode os.FileMode
+		size int64
+	}{
+		{"big.bin", 0755, 10000},
+		{"hello.txt", 0644, int64(len(helloContents))},
+		{"link", os.ModeSymlink | 0777, int64(len("sub/deep.txt"))},
+		{"sparse", 0644, 8192},
+		{"sub", os.ModeDir | 0755, -1},
+	}
+	if len(fis) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(fis), len(want))
+	}
+	for i, fi := range fis {
+		w := want[i]
+		if fi.Name() != w.name || fi.Mode() != w.mode || (w.size >= 0 && fi.Size() != w.size) {
+			t.Errorf("entry %d = %s %v %d, want %s %v %d", i, fi.Name(), fi.Mode(), fi.Size(), w.name, w.mode, w.size)
+		}
+	}
+	info := fis[0].Sys().(*InodeInfo)
+	if info.Uid != 1000 || info.Gid != 1001 || info.Inode != 2 {
+		t.Errorf("Sys = %+v", info)
+	}
+	if got := fis[0].ModTime().Unix(); got != 1500000000 {
+		t.Errorf("ModTime = %d", got)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	sr := newTestReader(t)
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		{"hello.txt", helloContents},
+		{"/big.bin", bigContents()},
+		{"sub/deep.txt", deepContents},
+		{"link", deepContents},
+		{"sparse", make([]byte, 8192)},
+	}
+	for _, tt := range tests {
+		got, err := sr.ReadFile(tt.name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: contents differ", tt.name)
+		}
+	}
+
+	if _, err := sr.ReadFile("sub"); err == nil {
+		t.Error("reading a directory succeeded")
+	}
+	if _, err := sr.ReadFile("missing"); !os.IsNotExist(err) {
+		t.Errorf("reading a missing file: %v", err)
+	}
+}
+
+func TestFileReadAt(t *testing.T) {
+	sr := newTestReader(t)
+	f, err := sr.Open("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	big := bigContents()
+	for _, off := range []int64{0, 4000, 8000, 9990} {
+		p := make([]byte, 100)
+		n, err := f.ReadAt(p, off)
+		want := big[off:]
+		if len(want) > len(p) {
+			want = want[:len(p)]
+		}
+		if n != len(want) || !bytes.Equal(p[:n], want) {
+			t.Errorf("ReadAt(%d) = %d bytes, want %d", off, n, len(want))
+		}
+		if n < len(p) && err != io.EOF {
+			t.Errorf("short ReadAt(%d): %v", off, err)
+		}
+	}
+
+	if _, err := f.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest := make([]byte, 20)
+	n, _ := io.ReadFull(f, rest)
+	if !bytes.Equal(rest[:n], big[len(big)-10:]) {
+		t.Errorf("read %q after seeking to the end", rest[:n])
+	}
+}
+
+func TestReadLinkAndStat(t *testing.T) {
+	sr := newTestReader(t)
+	target, err := sr.ReadLink("link")
+	if err != nil || target != "sub/deep.txt" {
+		t.Errorf("ReadLink = %q, %v", target, err)
+	}
+	if _, err := sr.ReadLink("hello.txt"); err == nil {
+		t.Error("ReadLink of a regular file succeeded")
+	}
+	fi, err := sr.Stat("link")
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Stat(link) = %v, %v", fi, err)
+	}
+	fi, err = sr.Stat("sub/deep.txt")
+	if err != nil || fi.Name() != "deep.txt" || fi.Mode() != 0600 {
+		t.Errorf("Stat(sub/deep.txt) = %v, %v", fi, err)
+	}
+	if _, err := sr.Stat("hello.txt/x"); err == nil {
+		t.Error("Stat through a file succeeded")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	sr := newTestReader(t)
+	var names []string
+	err := sr.Walk(func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "big.bin", "hello.txt", "link", "sparse", "sub", "sub/deep.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("walked %q, want %q", names, want)
+	}
+
+	names = nil
+	sr.Walk(func(name string, fi os.FileInfo, err error) error {
+		names = append(names, name)
+		if fi.IsDir() && name != "." {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if names[len(names)-1] != "sub" {
+		t.Errorf("SkipDir did not skip: %q", names)
+	}
+}
+
+func TestWalkLoop(t *testing.T) {
+	// Point the "sub" entry of the root directory at the root itself.
+	img := buildImage(t)
+	i := bytes.Index(img, []byte("\x01\x00\x02\x00sub"))
+	if i < 0 {
+		t.Fatal("no entry for sub")
+	}
+	copy(img[i-4:], img[32:34]) // root inode reference, in the first block
+	sr, err := NewReader(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sr.Walk(func(name string, fi os.FileInfo, err error) error { return err })
+	if err != ErrCorrupt {
+		t.Errorf("got %v, want ErrCorrupt", err)
+	}
+}
+
+func TestNotSquashfs(t *testing.T) {
+	b := make([]byte, 4096)
+	if _, err := NewReader(bytes.NewReader(b), int64(len(b))); err != ErrFormat {
+		t.Errorf("got %v, want ErrFormat", err)
+	}
+	if _, err := NewReader(bytes.NewReader(b[:10]), 10); err != ErrFormat {
+		t.Errorf("short image: got %v, want ErrFormat", err)
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	img := buildImage(t)
+	binary.LittleEndian.PutUint16(img[20:], XZ)
+	_, err := NewReader(bytes.NewReader(img), int64(len(img)))
+	if err == nil || !strings.Contains(err.Error(), "xz") {
+		t.Errorf("got %v, want an error naming xz", err)
+	}
+}
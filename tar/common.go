@@ -21,8 +21,8 @@ import (
 )
 
 // BUG: Use of the Uid and Gid fields in Header could overflow on 32-bit
-// architectures. If a large value is encountered when decoding, the result
-// stored in Header will be the truncated version.
+// architectures. If a PAX record holds a value too large for an int,
+// Reader.Next returns ErrHeader rather than a truncated value.
 
 // Header type flags.
 const (
@@ -60,6 +60,20 @@ type Header struct {
 	AccessTime time.Time // access time
 	ChangeTime time.Time // status change time
 	Xattrs     map[string]string
+
+	// PAXRecords holds the PAX extended header records of the entry
+	// that no other field represents, such as "comment", "charset" or
+	// vendor keywords like "LIBARCHIVE.creationtime". The Writer writes
+	// them as is; records for fields of the Header, such as "path",
+	// are ignored in favor of the fields.
+	PAXRecords map[string]string
+}
+
+// A SparseEntry is a fragment of data in a sparse file: Length bytes
+// starting at Offset. The rest of the file, its holes, reads as zeros.
+type SparseEntry struct {
+	Offset int64
+	Length int64
 }
 
 // FileInfo returns an os.FileInfo for the Header.
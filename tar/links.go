@@ -0,0 +1,49 @@
+package tar
+
+import "os"
+
+// fileID identifies a file on the system, whatever its names.
+type fileID struct {
+	dev, ino uint64
+}
+
+// sysFileID, if non-nil, returns the identity of the file fi describes
+// and its number of hard links.
+var sysFileID func(fi os.FileInfo) (id fileID, nlink uint64, ok bool)
+
+// A LinkTracker turns headers for the second and later names of a
+// hard-linked file into TypeLink headers pointing at the first name, so
+// that its contents are only archived once. Where the system does not
+// report file identities, such as on Windows, every name is archived as
+// a regular file.
+//
+// The zero value is ready to use. A LinkTracker is meant to see every
+// file added to one archive, in order.
+type LinkTracker struct {
+	names map[fileID]string
+}
+
+// Track records that the file fi describes is archived under h.Name.
+// If it is a regular file already archived under another name, it
+// changes h into a hard link to that name and reports true, in which
+// case no contents must be written for h.
+func (t *LinkTracker) Track(h *Header, fi os.FileInfo) bool {
+	if h.Typeflag != TypeReg || sysFileID == nil {
+		return false
+	}
+	id, nlink, ok := sysFileID(fi)
+	if !ok || nlink < 2 {
+		return false
+	}
+	if name, seen := t.names[id]; seen {
+		h.Typeflag = TypeLink
+		h.Linkname = name
+		h.Size = 0
+		return true
+	}
+	if t.names == nil {
+		t.names = make(map[fileID]string)
+	}
+	t.names[id] = h.Name
+	return false
+}
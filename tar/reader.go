@@ -32,6 +32,8 @@ type Reader struct {
 	curr numBytesReader // reader for current file entry
 	blk  block          // buffer to use as temporary local storage
 
+	sparseMap []SparseEntry // data fragments of the current file, if sparse
+
 	// err is a persistent error.
 	// It is only the responsibility of every exported method of Reader to
 	// ensure that this error is sticky.
@@ -85,6 +87,7 @@ type sparseEntry struct {
 
 // Keywords for GNU sparse files in a PAX extended header
 const (
+	paxGNUSparse          = "GNU.sparse."
 	paxGNUSparseNumBlocks = "GNU.sparse.numblocks"
 	paxGNUSparseOffset    = "GNU.sparse.offset"
 	paxGNUSparseNumBytes  = "GNU.sparse.numbytes"
@@ -113,6 +116,7 @@ func (tr *Reader) Next() (*Header, error) {
 
 func (tr *Reader) next() (*Header, error) {
 	var extHdrs map[string]string
+	tr.sparseMap = nil
 
 	// Externally, Next iterates through the tar archive as if it is a series of
 	// files. Internally, the tar format often uses fake "files" to add meta
@@ -222,11 +226,25 @@ func (tr *Reader) handleSparseFile(hdr *Header, rawHdr *block, extHdrs map[strin
 	// If sp is non-nil, then this is a sparse file.
 	// Note that it is possible for len(sp) to be zero.
 	if sp != nil {
+		tr.sparseMap = make([]SparseEntry, 0, len(sp))
+		for _, e := range sp {
+			if e.numBytes > 0 {
+				tr.sparseMap = append(tr.sparseMap, SparseEntry{Offset: e.offset, Length: e.numBytes})
+			}
+		}
 		tr.curr, err = newSparseFileReader(tr.curr, sp, hdr.Size)
 	}
 	return err
 }
 
+// SparseMap returns the data fragments of the current file if it is a
+// sparse file, in any of the GNU formats, and nil otherwise. Reading the
+// file still yields its whole contents, with holes read as zeros;
+// SparseMap lets callers recreate the holes when extracting it.
+func (tr *Reader) SparseMap() []SparseEntry {
+	return tr.sparseMap
+}
+
 // checkForGNUSparsePAXHeaders checks the PAX headers for GNU sparse headers. If they are found, then
 // this function reads the sparse map and returns it. Unknown sparse formats are ignored, causing the file to
 // be treated as a regular file.
@@ -306,11 +324,11 @@ func mergePAX(hdr *Header, headers map[string]string) (err error) {
 		case paxGname:
 			hdr.Gname = v
 		case paxUid:
-			id64, err = strconv.ParseInt(v, 10, 64)
-			hdr.Uid = int(id64) // Integer overflow possible
+			id64, err = strconv.ParseInt(v, 10, 0) // Fails rather than overflow int
+			hdr.Uid = int(id64)
 		case paxGid:
-			id64, err = strconv.ParseInt(v, 10, 64)
-			hdr.Gid = int(id64) // Integer overflow possible
+			id64, err = strconv.ParseInt(v, 10, 0)
+			hdr.Gid = int(id64)
 		case paxAtime:
 			hdr.AccessTime, err = parsePAXTime(v)
 		case paxMtime:
@@ -320,11 +338,19 @@ func mergePAX(hdr *Header, headers map[string]string) (err error) {
 		case paxSize:
 			hdr.Size, err = strconv.ParseInt(v, 10, 64)
 		default:
-			if strings.HasPrefix(k, paxXattr) {
+			switch {
+			case strings.HasPrefix(k, paxXattr):
 				if hdr.Xattrs == nil {
 					hdr.Xattrs = make(map[string]string)
 				}
 				hdr.Xattrs[k[len(paxXattr):]] = v
+			case strings.HasPrefix(k, paxGNUSparse):
+				// Handled by handleSparseFile.
+			default:
+				if hdr.PAXRecords == nil {
+					hdr.PAXRecords = make(map[string]string)
+				}
+				hdr.PAXRecords[k] = v
 			}
 		}
 		if err != nil {
@@ -1037,7 +1037,18 @@ func TestMergePAX(t *testing.T) {
 			"SCHILY.xattr.key": "value",
 		},
 		want: &Header{
-			Xattrs: map[string]string{"key": "value"},
+			Xattrs:     map[string]string{"key": "value"},
+			PAXRecords: map[string]string{"missing": "missing"},
+		},
+		ok: true,
+	}, {
+		in: map[string]string{
+			"comment":           "hello",
+			"GNU.sparse.major":  "1",
+			"LIBARCHIVE.xattr.": "",
+		},
+		want: &Header{
+			PAXRecords: map[string]string{"comment": "hello", "LIBARCHIVE.xattr.": ""},
 		},
 		ok: true,
 	}}
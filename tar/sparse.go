@@ -0,0 +1,80 @@
+package tar
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// A SparseDest is a destination for CopySparse, such as *os.File.
+type SparseDest interface {
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// CopySparse extracts the current file, whose Header.Size is size, to
+// dst. Only its data fragments are written, so that its holes stay holes
+// on file systems that support them, and dst is then truncated to size,
+// which also creates a trailing hole. Files that are not sparse are
+// copied whole. It returns the number of bytes written.
+func (tr *Reader) CopySparse(dst SparseDest, size int64) (written int64, err error) {
+	fragments := tr.SparseMap()
+	if fragments == nil {
+		fragments = []SparseEntry{{Offset: 0, Length: size}}
+	}
+
+	var pos int64
+	buf := make([]byte, 32*1024)
+	for _, e := range fragments {
+		// Holes read as zeros: skip over them.
+		if _, err := io.CopyN(ioutil.Discard, tr, e.Offset-pos); err != nil {
+			return written, err
+		}
+		pos = e.Offset
+		for end := e.Offset + e.Length; pos < end; {
+			n := int64(len(buf))
+			if n > end-pos {
+				n = end - pos
+			}
+			m, err := io.ReadFull(tr, buf[:n])
+			if m > 0 {
+				if _, werr := dst.WriteAt(buf[:m], pos); werr != nil {
+					return written, werr
+				}
+				written += int64(m)
+				pos += int64(m)
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return written, err
+			}
+		}
+	}
+	return written, dst.Truncate(size)
+}
+
+// SparseMapOf returns the data fragments of the first size bytes of f,
+// found by seeking for holes where the operating system and file system
+// support it. Elsewhere, the whole file is returned as one fragment.
+// The result can be passed to Writer.WriteSparseHeader, after which the
+// file's contents can be copied to the Writer as usual.
+//
+// f's offset is reset to the start of the file.
+func SparseMapOf(f *os.File, size int64) ([]SparseEntry, error) {
+	sp, err := seekSparseMap(f, size)
+	if err == errNoSeekHole {
+		sp, err = []SparseEntry{{Offset: 0, Length: size}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+var errNoSeekHole = errors.New("archive/tar: SEEK_HOLE not supported")
@@ -0,0 +1,10 @@
+//go:build !linux && !freebsd && !solaris
+// +build !linux,!freebsd,!solaris
+
+package tar
+
+import "os"
+
+func seekSparseMap(f *os.File, size int64) ([]SparseEntry, error) {
+	return nil, errNoSeekHole
+}
@@ -0,0 +1,53 @@
+//go:build linux || freebsd || solaris
+// +build linux freebsd solaris
+
+package tar
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
+
+func seekSparseMap(f *os.File, size int64) ([]SparseEntry, error) {
+	var sp []SparseEntry
+	for pos := int64(0); pos < size; {
+		data, err := f.Seek(pos, seekData)
+		if isErrno(err, syscall.ENXIO) {
+			break // only a hole is left
+		}
+		if isErrno(err, syscall.EINVAL) {
+			return nil, errNoSeekHole
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data >= size {
+			break
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		sp = append(sp, SparseEntry{Offset: data, Length: hole - data})
+		pos = hole
+	}
+	if sp == nil {
+		sp = []SparseEntry{}
+	}
+	return sp, nil
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == errno
+}
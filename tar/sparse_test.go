@@ -0,0 +1,89 @@
+package tar
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSparseFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tar-sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A 4MiB file with data at 1MiB and at 3MiB, and holes elsewhere
+	// where the file system supports them.
+	const size = 4 << 20
+	src, err := os.Create(dir + "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	payload := bytes.Repeat([]byte("data"), 1024)
+	for _, off := range []int64{1 << 20, 3 << 20} {
+		if _, err := src.WriteAt(payload, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	sp, err := SparseMapOf(src, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored int64
+	for _, e := range sp {
+		stored += e.Length
+	}
+	t.Logf("sparse map %v (%d bytes of data)", sp, stored)
+
+	var buf bytes.Buffer
+	tw := NewWriter(&buf)
+	hdr := &Header{Name: "disk.img", Mode: 0644, Typeflag: TypeReg, Size: size, ModTime: time.Unix(1500000000, 0)}
+	if err := tw.WriteSparseHeader(hdr, sp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(tw, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewReader(&buf)
+	got, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := os.Create(dir + "/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	written, err := tr.CopySparse(dst, got.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != stored {
+		t.Errorf("wrote %d bytes, want %d", written, stored)
+	}
+
+	want, err := ioutil.ReadFile(dir + "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := ioutil.ReadFile(dir + "/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("extracted file differs from the original")
+	}
+}
@@ -106,6 +106,65 @@ func TestFileInfoHeaderSymlink(t *testing.T) {
 	}
 }
 
+func TestFileInfoHeaderDevice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("device numbers of /dev/null are only known on Linux")
+	}
+	fi, err := os.Stat("/dev/null")
+	if err != nil {
+		t.Skip(err)
+	}
+	h, err := FileInfoHeader(fi, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Typeflag != TypeChar || h.Devmajor != 1 || h.Devminor != 3 {
+		t.Errorf("got type %c, device %d:%d; want type %c, device 1:3", h.Typeflag, h.Devmajor, h.Devminor, TypeChar)
+	}
+}
+
+func TestLinkTracker(t *testing.T) {
+	if sysFileID == nil {
+		t.Skip("file identities not available")
+	}
+	tmpdir, err := ioutil.TempDir("", "TestLinkTracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	first := filepath.Join(tmpdir, "first")
+	if err := ioutil.WriteFile(first, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(first, filepath.Join(tmpdir, "second")); err != nil {
+		t.Skip(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "other"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var lt LinkTracker
+	want := map[string]string{"first": "", "second": "first", "other": ""}
+	for _, name := range []string{"first", "second", "other"} {
+		fi, err := os.Lstat(filepath.Join(tmpdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := FileInfoHeader(fi, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		linked := lt.Track(h, fi)
+		if linked != (want[name] != "") || h.Linkname != want[name] {
+			t.Errorf("%s: Track = %v, Linkname = %q; want link to %q", name, linked, h.Linkname, want[name])
+		}
+		if linked && (h.Typeflag != TypeLink || h.Size != 0) {
+			t.Errorf("%s: got type %c and size %d for a hard link", name, h.Typeflag, h.Size)
+		}
+	}
+}
+
 func TestRoundTrip(t *testing.T) {
 	data := []byte("some file contents")
 
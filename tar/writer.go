@@ -23,6 +23,7 @@ var (
 	ErrWriteTooLong    = errors.New("archive/tar: write too long")
 	ErrFieldTooLong    = errors.New("archive/tar: header field too long")
 	ErrWriteAfterClose = errors.New("archive/tar: write after close")
+	ErrWriteHole       = errors.New("archive/tar: non-zero data written in a sparse hole")
 	errInvalidHeader   = errors.New("archive/tar: header field too long or contains invalid values")
 )
 
@@ -40,11 +41,30 @@ type Writer struct {
 	preferPax  bool  // use PAX header instead of binary numeric header
 	hdrBuff    block // buffer to use in writeHeader when writing a regular header
 	paxHdrBuff block // buffer to use in writeHeader when writing a PAX header
+	subsecond  bool  // write times with sub-second precision, see SetSubsecondTimes
+
+	// State of the current entry, if written with WriteSparseHeader.
+	sparsing   bool
+	sparse     []SparseEntry // fragments not yet fully written
+	sparsePos  int64         // logical position in the file
+	sparseSize int64         // logical size of the file
 }
 
 // NewWriter creates a new Writer writing to w.
 func NewWriter(w io.Writer) *Writer { return &Writer{w: w} }
 
+// SetSubsecondTimes makes the Writer record times with sub-second
+// precision, in PAX records: ModTime when it is not a whole second, and
+// AccessTime and ChangeTime when they are set. By default, ModTime is
+// truncated to the second, as the ustar format stores it, and the other
+// times are dropped, which keeps archives of many small files compact.
+//
+// ModTime values the ustar format cannot hold at all, before 1970 or
+// after 2242, are always written as PAX records.
+func (tw *Writer) SetSubsecondTimes(enabled bool) {
+	tw.subsecond = enabled
+}
+
 // Flush finishes writing the current file (optional).
 func (tw *Writer) Flush() error {
 	if tw.nb > 0 {
@@ -77,15 +97,65 @@ var (
 // WriteHeader calls Flush if it is not the first header.
 // Calling after a Close will return ErrWriteAfterClose.
 func (tw *Writer) WriteHeader(hdr *Header) error {
-	return tw.writeHeader(hdr, true)
+	return tw.writeHeader(hdr, true, nil)
+}
+
+// WriteSparseHeader is like WriteHeader, but writes hdr as a sparse file,
+// in the GNU PAX 1.0 sparse format. hdr.Size is the logical size of the
+// file, and fragments lists where its data is, in increasing order; the
+// rest of the file is holes. The whole logical contents are then written
+// with Write: bytes in holes must be zero, and are not stored. A trailing
+// hole need not be written.
+func (tw *Writer) WriteSparseHeader(hdr *Header, fragments []SparseEntry) error {
+	var end int64
+	for _, e := range fragments {
+		if e.Offset < end || e.Length < 0 || e.Offset+e.Length > hdr.Size {
+			return errors.New("archive/tar: invalid sparse map")
+		}
+		end = e.Offset + e.Length
+	}
+
+	// The sparse map is stored at the start of the data, padded to a
+	// whole block, as decimal numbers on separate lines.
+	var m bytes.Buffer
+	fmt.Fprintf(&m, "%d\n", len(fragments))
+	var stored int64
+	for _, e := range fragments {
+		fmt.Fprintf(&m, "%d\n%d\n", e.Offset, e.Length)
+		stored += e.Length
+	}
+	m.Write(zeroBlock[:(blockSize-m.Len()%blockSize)%blockSize])
+
+	h := *hdr
+	dir, file := path.Split(hdr.Name)
+	h.Name = path.Join(dir, "GNUSparseFile.0", file)
+	h.Size = int64(m.Len()) + stored
+	records := map[string]string{
+		paxGNUSparseMajor:    "1",
+		paxGNUSparseMinor:    "0",
+		paxGNUSparseName:     hdr.Name,
+		paxGNUSparseRealSize: strconv.FormatInt(hdr.Size, 10),
+	}
+	if err := tw.writeHeader(&h, true, records); err != nil {
+		return err
+	}
+	if _, err := tw.Write(m.Bytes()); err != nil {
+		return err
+	}
+	tw.sparsing = true
+	tw.sparse = fragments
+	tw.sparsePos = 0
+	tw.sparseSize = hdr.Size
+	return nil
 }
 
 // WriteHeader writes hdr and prepares to accept the file's contents.
 // WriteHeader calls Flush if it is not the first header.
 // Calling after a Close will return ErrWriteAfterClose.
 // As this method is called internally by writePax header to allow it to
-// suppress writing the pax header.
-func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
+// suppress writing the pax header. Records in extra are added to the pax
+// header, if one is allowed.
+func (tw *Writer) writeHeader(hdr *Header, allowPax bool, extra map[string]string) error {
 	if tw.closed {
 		return ErrWriteAfterClose
 	}
@@ -95,14 +165,11 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	if tw.err != nil {
 		return tw.err
 	}
+	tw.sparsing = false
 
 	// a map to hold pax header records, if any are needed
 	paxHeaders := make(map[string]string)
 
-	// TODO(dsnet): we might want to use PAX headers for
-	// subsecond time resolution, but for now let's just capture
-	// too long fields or non ascii characters
-
 	// We need to select which scratch buffer to use carefully,
 	// since this method is called recursively to write PAX headers.
 	// If allowPax is true, this is the non-recursive call, and we will use hdrBuff.
@@ -165,7 +232,7 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	formatNumeric(v7.UID(), int64(hdr.Uid), paxUid)
 	formatNumeric(v7.GID(), int64(hdr.Gid), paxGid)
 	formatNumeric(v7.Size(), hdr.Size, paxSize)
-	// TODO(dsnet): Consider using PAX for finer time granularity.
+	// Finer or out of range times are written as PAX records below.
 	formatNumeric(v7.ModTime(), modTime, paxNone)
 	v7.TypeFlag()[0] = hdr.Typeflag
 	formatString(v7.LinkName(), hdr.Linkname, paxLinkpath)
@@ -238,6 +305,28 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 		for k, v := range hdr.Xattrs {
 			paxHeaders[paxXattr+k] = v
 		}
+		for k, v := range hdr.PAXRecords {
+			if !isHeaderPAXKey(k) {
+				paxHeaders[k] = v
+			}
+		}
+		for k, v := range extra {
+			paxHeaders[k] = v
+		}
+		if hdr.ModTime.Unix() != modTime && !hdr.ModTime.IsZero() {
+			paxHeaders[paxMtime] = formatPAXTime(hdr.ModTime)
+		}
+		if tw.subsecond {
+			if hdr.ModTime.Nanosecond() != 0 {
+				paxHeaders[paxMtime] = formatPAXTime(hdr.ModTime)
+			}
+			if !hdr.AccessTime.IsZero() {
+				paxHeaders[paxAtime] = formatPAXTime(hdr.AccessTime)
+			}
+			if !hdr.ChangeTime.IsZero() {
+				paxHeaders[paxCtime] = formatPAXTime(hdr.ChangeTime)
+			}
+		}
 	}
 
 	if len(paxHeaders) > 0 {
@@ -312,7 +401,7 @@ func (tw *Writer) writePAXHeader(hdr *Header, paxHeaders map[string]string) erro
 	}
 
 	ext.Size = int64(len(buf.Bytes()))
-	if err := tw.writeHeader(ext, false); err != nil {
+	if err := tw.writeHeader(ext, false, nil); err != nil {
 		return err
 	}
 	if _, err := tw.Write(buf.Bytes()); err != nil {
@@ -332,6 +421,13 @@ func (tw *Writer) Write(b []byte) (n int, err error) {
 		err = ErrWriteAfterClose
 		return
 	}
+	if tw.sparsing {
+		return tw.writeSparse(b)
+	}
+	return tw.write(b)
+}
+
+func (tw *Writer) write(b []byte) (n int, err error) {
 	overwrite := false
 	if int64(len(b)) > tw.nb {
 		b = b[0:tw.nb]
@@ -347,6 +443,62 @@ func (tw *Writer) Write(b []byte) (n int, err error) {
 	return
 }
 
+// writeSparse writes the logical contents of a sparse file, storing the
+// bytes that fall in its data fragments.
+func (tw *Writer) writeSparse(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		if tw.sparsePos >= tw.sparseSize {
+			return n, ErrWriteTooLong
+		}
+		for len(tw.sparse) > 0 && tw.sparse[0].Offset+tw.sparse[0].Length <= tw.sparsePos {
+			tw.sparse = tw.sparse[1:]
+		}
+		inData := len(tw.sparse) > 0 && tw.sparse[0].Offset <= tw.sparsePos
+		var chunk int64
+		switch {
+		case inData:
+			chunk = tw.sparse[0].Offset + tw.sparse[0].Length - tw.sparsePos
+		case len(tw.sparse) > 0:
+			chunk = tw.sparse[0].Offset - tw.sparsePos
+		default:
+			chunk = tw.sparseSize - tw.sparsePos
+		}
+		if chunk > int64(len(b)) {
+			chunk = int64(len(b))
+		}
+
+		if inData {
+			m, err := tw.write(b[:chunk])
+			n += m
+			tw.sparsePos += int64(m)
+			if err != nil {
+				return n, err
+			}
+		} else {
+			for _, c := range b[:chunk] {
+				if c != 0 {
+					return n, ErrWriteHole
+				}
+			}
+			n += int(chunk)
+			tw.sparsePos += chunk
+		}
+		b = b[chunk:]
+	}
+	return n, nil
+}
+
+// isHeaderPAXKey reports whether PAX records for key are generated from
+// Header fields, or by WriteSparseHeader.
+func isHeaderPAXKey(key string) bool {
+	switch key {
+	case paxPath, paxLinkpath, paxUname, paxGname, paxUid, paxGid,
+		paxSize, paxMtime, paxAtime, paxCtime:
+		return true
+	}
+	return strings.HasPrefix(key, paxXattr) || strings.HasPrefix(key, paxGNUSparse)
+}
+
 // Close closes the tar archive, flushing any unwritten
 // data to the underlying writer.
 func (tw *Writer) Close() error {
@@ -645,3 +645,130 @@ func TestIssue12594(t *testing.T) {
 		}
 	}
 }
+
+func TestPaxRecordsAndTimes(t *testing.T) {
+	hdr := &Header{
+		Name:       strings.Repeat("long/", 30) + "file.txt",
+		Mode:       0644,
+		Uid:        1 << 30,
+		Gid:        1000,
+		Typeflag:   TypeReg,
+		ModTime:    time.Unix(1500000000, 123456789),
+		AccessTime: time.Unix(1500000001, 5),
+		ChangeTime: time.Unix(1500000002, 500000000),
+		Xattrs:     map[string]string{"user.key": "value"},
+		PAXRecords: map[string]string{"comment": "built by CI", "path": "ignored"},
+	}
+	old := &Header{
+		Name:     "old.txt",
+		Mode:     0644,
+		Typeflag: TypeReg,
+		ModTime:  time.Unix(-1000000000, 0),
+	}
+
+	var buf bytes.Buffer
+	tw := NewWriter(&buf)
+	tw.SetSubsecondTimes(true)
+	for _, h := range []*Header{hdr, old} {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewReader(&buf)
+	got, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *hdr
+	want.PAXRecords = map[string]string{"comment": "built by CI"}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("got header\n%+v\nwant\n%+v", *got, want)
+	}
+	got, err = tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ModTime.Equal(old.ModTime) {
+		t.Errorf("pre-1970 ModTime: got %v, want %v", got.ModTime, old.ModTime)
+	}
+}
+
+func TestSparseRoundTrip(t *testing.T) {
+	fragments := []SparseEntry{{Offset: 1000, Length: 10}, {Offset: 5000, Length: 100}}
+	data := make([]byte, 20000)
+	for _, e := range fragments {
+		for i := e.Offset; i < e.Offset+e.Length; i++ {
+			data[i] = byte('a' + i%26)
+		}
+	}
+	hdr := &Header{
+		Name:     "dir/sparse.img",
+		Mode:     0644,
+		Typeflag: TypeReg,
+		Size:     int64(len(data)),
+		ModTime:  time.Unix(1500000000, 0),
+	}
+
+	var buf bytes.Buffer
+	tw := NewWriter(&buf)
+	if err := tw.WriteSparseHeader(hdr, fragments); err != nil {
+		t.Fatal(err)
+	}
+	// Write in odd-sized pieces, leaving out the trailing hole.
+	for b := data[:5100]; len(b) > 0; {
+		n := 333
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := tw.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if err := tw.WriteHeader(&Header{Name: "next", Mode: 0644, Typeflag: TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= len(data) {
+		t.Errorf("archive is %d bytes, holes were stored", buf.Len())
+	}
+
+	tr := NewReader(bytes.NewReader(buf.Bytes()))
+	got, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != hdr.Name || got.Size != hdr.Size {
+		t.Errorf("got %s of %d bytes, want %s of %d bytes", got.Name, got.Size, hdr.Name, hdr.Size)
+	}
+	if sp := tr.SparseMap(); !reflect.DeepEqual(sp, fragments) {
+		t.Errorf("got sparse map %v, want %v", sp, fragments)
+	}
+	contents, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, data) {
+		t.Errorf("contents differ")
+	}
+	if _, err := tr.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if sp := tr.SparseMap(); sp != nil {
+		t.Errorf("regular file: got sparse map %v", sp)
+	}
+
+	tw = NewWriter(ioutil.Discard)
+	if err := tw.WriteSparseHeader(hdr, fragments); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte{1}); err != ErrWriteHole {
+		t.Errorf("writing to a hole: got error %v, want ErrWriteHole", err)
+	}
+}
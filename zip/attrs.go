@@ -0,0 +1,103 @@
+package zip
+
+import "fmt"
+
+// CreatorOS identifies the host system an entry was created on, which
+// determines how its external attributes are to be interpreted. It is
+// stored in the upper byte of FileHeader.CreatorVersion.
+type CreatorOS uint8
+
+// Host systems defined in section 4.4.2.2 of the zip spec. Note that
+// Mode decodes FAT attributes for CreatorMVS, which archive/zip has
+// always mistaken for NTFS.
+const (
+	CreatorMSDOS     CreatorOS = 0
+	CreatorAmiga     CreatorOS = 1
+	CreatorOpenVMS   CreatorOS = 2
+	CreatorUnix      CreatorOS = 3
+	CreatorVMCMS     CreatorOS = 4
+	CreatorAtariST   CreatorOS = 5
+	CreatorOS2       CreatorOS = 6
+	CreatorMacintosh CreatorOS = 7
+	CreatorZSystem   CreatorOS = 8
+	CreatorCPM       CreatorOS = 9
+	CreatorNTFS      CreatorOS = 10
+	CreatorMVS       CreatorOS = 11
+	CreatorVSE       CreatorOS = 12
+	CreatorAcornRISC CreatorOS = 13
+	CreatorVFAT      CreatorOS = 14
+	CreatorAltMVS    CreatorOS = 15
+	CreatorBeOS      CreatorOS = 16
+	CreatorTandem    CreatorOS = 17
+	CreatorOS400     CreatorOS = 18
+	CreatorOSX       CreatorOS = 19
+)
+
+var creatorOSNames = [...]string{
+	"MS-DOS", "Amiga", "OpenVMS", "Unix", "VM/CMS", "Atari ST", "OS/2",
+	"Macintosh", "Z-System", "CP/M", "NTFS", "MVS", "VSE", "Acorn RISC",
+	"VFAT", "alternate MVS", "BeOS", "Tandem", "OS/400", "OS X",
+}
+
+func (c CreatorOS) String() string {
+	if int(c) < len(creatorOSNames) {
+		return creatorOSNames[c]
+	}
+	return fmt.Sprintf("CreatorOS(%d)", uint8(c))
+}
+
+// CreatorOS returns the host system the entry was created on.
+func (h *FileHeader) CreatorOS() CreatorOS {
+	return CreatorOS(h.CreatorVersion >> 8)
+}
+
+// SetCreatorOS sets the host system the entry was created on, keeping
+// the zip specification version in the lower byte of CreatorVersion.
+// ExternalAttrs is left untouched.
+func (h *FileHeader) SetCreatorOS(c CreatorOS) {
+	h.CreatorVersion = h.CreatorVersion&0xff | uint16(c)<<8
+}
+
+// MSDOSAttributes are the FAT file attributes stored in the lowest
+// byte of FileHeader.ExternalAttrs.
+type MSDOSAttributes uint8
+
+const (
+	MSDOSReadOnly  MSDOSAttributes = msdosReadOnly
+	MSDOSHidden    MSDOSAttributes = 0x02
+	MSDOSSystem    MSDOSAttributes = 0x04
+	MSDOSVolume    MSDOSAttributes = 0x08
+	MSDOSDirectory MSDOSAttributes = msdosDir
+	MSDOSArchive   MSDOSAttributes = 0x20
+)
+
+// MSDOSAttributes returns the FAT attributes of the entry. Most tools
+// store them whatever the host system, Unix ones included.
+func (h *FileHeader) MSDOSAttributes() MSDOSAttributes {
+	return MSDOSAttributes(h.ExternalAttrs)
+}
+
+// SetMSDOSAttributes replaces the FAT attributes of the entry, keeping
+// the rest of ExternalAttrs.
+func (h *FileHeader) SetMSDOSAttributes(a MSDOSAttributes) {
+	h.ExternalAttrs = h.ExternalAttrs&^0xff | uint32(a)
+}
+
+// UnixMode returns the raw Unix st_mode of the entry, including its
+// file type bits, and whether the entry has one: only entries created
+// on Unix or OS X do.
+func (h *FileHeader) UnixMode() (mode uint32, ok bool) {
+	switch h.CreatorOS() {
+	case CreatorUnix, CreatorOSX:
+		return h.ExternalAttrs >> 16, true
+	}
+	return 0, false
+}
+
+// SetUnixMode stores mode as the raw Unix st_mode of the entry and marks
+// it as created on Unix. Unlike SetMode, it leaves the FAT attributes
+// alone.
+func (h *FileHeader) SetUnixMode(mode uint32) {
+	h.SetCreatorOS(CreatorUnix)
+	h.ExternalAttrs = h.ExternalAttrs&0xffff | (mode&0xffff)<<16
+}
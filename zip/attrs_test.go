@@ -0,0 +1,47 @@
+package zip
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExternalAttrs(t *testing.T) {
+	var h FileHeader
+	h.CreatorVersion = zipVersion20
+	h.SetMSDOSAttributes(MSDOSHidden | MSDOSArchive)
+	if got := h.CreatorOS(); got != CreatorMSDOS {
+		t.Errorf("CreatorOS() = %v, want %v", got, CreatorMSDOS)
+	}
+	if _, ok := h.UnixMode(); ok {
+		t.Errorf("UnixMode() reported a mode for an MS-DOS entry")
+	}
+
+	h.SetUnixMode(s_IFREG | 0755)
+	if got := h.CreatorOS(); got != CreatorUnix {
+		t.Errorf("CreatorOS() = %v, want %v", got, CreatorUnix)
+	}
+	if got := h.CreatorVersion & 0xff; got != zipVersion20 {
+		t.Errorf("SetUnixMode changed the spec version to %d", got)
+	}
+	if mode, ok := h.UnixMode(); !ok || mode != s_IFREG|0755 {
+		t.Errorf("UnixMode() = %o, %v", mode, ok)
+	}
+	if got := h.MSDOSAttributes(); got != MSDOSHidden|MSDOSArchive {
+		t.Errorf("SetUnixMode changed FAT attributes to %#x", got)
+	}
+	if got := h.Mode(); got != 0755 {
+		t.Errorf("Mode() = %v, want %v", got, os.FileMode(0755))
+	}
+
+	h.SetMode(os.ModeDir | 0555)
+	if got := h.MSDOSAttributes(); got != MSDOSDirectory|MSDOSReadOnly {
+		t.Errorf("after SetMode, MSDOSAttributes() = %#x", got)
+	}
+
+	if got := CreatorOSX.String(); got != "OS X" {
+		t.Errorf("CreatorOSX.String() = %q", got)
+	}
+	if got := CreatorOS(42).String(); got != "CreatorOS(42)" {
+		t.Errorf("CreatorOS(42).String() = %q", got)
+	}
+}
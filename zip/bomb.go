@@ -0,0 +1,61 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+)
+
+// A DecompressionLimitError is returned by entry readers when
+// decompressing yields more than ReaderOptions.MaxEntrySize or
+// MaxTotalSize allow.
+type DecompressionLimitError struct {
+	Name  string // entry being read
+	Entry bool   // whether MaxEntrySize was hit, rather than MaxTotalSize
+	Max   int64
+}
+
+func (e *DecompressionLimitError) Error() string {
+	if e.Entry {
+		return fmt.Sprintf("zip: %s decompresses to more than %d bytes", e.Name, e.Max)
+	}
+	return fmt.Sprintf("zip: reading %s: archive decompresses to more than %d bytes", e.Name, e.Max)
+}
+
+// limitedDecompressor sits between an entry's decompressor and its
+// checksumReader, and counts what comes out against the Reader's
+// limits, whatever the entry declares its size to be.
+type limitedDecompressor struct {
+	rc   io.ReadCloser
+	z    *Reader
+	name string
+	n    int64 // decompressed so far
+	err  error // sticky
+}
+
+func (l *limitedDecompressor) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	n, err := l.rc.Read(p)
+	opts := &l.z.opts
+	if max := opts.MaxEntrySize; max > 0 && l.n+int64(n) > max {
+		n = int(max - l.n)
+		l.err = &DecompressionLimitError{Name: l.name, Entry: true, Max: max}
+		err = l.err
+	}
+	l.n += int64(n)
+	if max := opts.MaxTotalSize; max > 0 {
+		z := l.z
+		z.decompressedMu.Lock()
+		if left := max - z.decompressed; int64(n) > left {
+			n = int(left)
+			l.err = &DecompressionLimitError{Name: l.name, Max: max}
+			err = l.err
+		}
+		z.decompressed += int64(n)
+		z.decompressedMu.Unlock()
+	}
+	return n, err
+}
+
+func (l *limitedDecompressor) Close() error { return l.rc.Close() }
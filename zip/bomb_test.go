@@ -0,0 +1,67 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecompressionLimits(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, e := range []struct {
+		name string
+		size int
+	}{{"a", 10000}, {"b", 5000}} {
+		fw, err := w.CreateHeader(&FileHeader{Name: e.name, Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(make([]byte, e.size))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts  ReaderOptions
+		fails string // entry expected to fail, if any
+		entry bool
+	}{
+		{ReaderOptions{}, "", false},
+		{ReaderOptions{MaxEntrySize: 10000, MaxTotalSize: 15000}, "", false},
+		{ReaderOptions{MaxEntrySize: 9999}, "a", true},
+		{ReaderOptions{MaxTotalSize: 12000}, "b", false},
+	}
+	for i, tt := range tests {
+		r, err := NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range r.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if f.Name != tt.fails {
+				if err != nil {
+					t.Errorf("#%d: reading %s: %v", i, f.Name, err)
+				}
+				continue
+			}
+			le, ok := err.(*DecompressionLimitError)
+			if !ok {
+				t.Errorf("#%d: reading %s: got %v, want a *DecompressionLimitError", i, f.Name, err)
+				continue
+			}
+			if le.Name != f.Name || le.Entry != tt.entry {
+				t.Errorf("#%d: got %+v", i, le)
+			}
+			if len(b) > 10000 {
+				t.Errorf("#%d: read %d bytes past the limit", i, len(b))
+			}
+		}
+	}
+}
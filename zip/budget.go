@@ -0,0 +1,104 @@
+package zip
+
+import (
+	"time"
+
+	"github.com/itchio/kompress/flate"
+)
+
+// budgetLevels are the flate levels a time budget steps down through,
+// before switching to Store.
+var budgetLevels = []int{flate.BestCompression, 6, 3, flate.BestSpeed}
+
+// SetTimeBudget makes the Writer aim to finish compressing totalBytes of
+// uncompressed data within d of this call, so packaging always fits in
+// CI time limits. Whenever an entry is created, the throughput measured
+// since the last adjustment is used to project when the remaining bytes
+// will be done; if that is past the budget, Deflate entries created from
+// then on use the next faster flate level, and eventually Store.
+//
+// The Writer's compression settings are left as they were; the budget
+// only affects the settings used for new entries.
+func (w *Writer) SetTimeBudget(d time.Duration, totalBytes int64) {
+	w.budget = newTimeBudget(d, totalBytes, w.compressionSettings.Flate.Level, time.Now)
+}
+
+type timeBudget struct {
+	now      func() time.Time
+	deadline time.Time
+	total    int64
+	done     int64
+
+	level int
+	store bool
+
+	// throughput since the level last changed
+	rungStart time.Time
+	rungBytes int64
+}
+
+func newTimeBudget(d time.Duration, total int64, level int, now func() time.Time) *timeBudget {
+	start := now()
+	if level == flate.DefaultCompression {
+		level = 6
+	}
+	return &timeBudget{
+		now:       now,
+		deadline:  start.Add(d),
+		total:     total,
+		level:     level,
+		rungStart: start,
+	}
+}
+
+// apply adjusts the method and settings of a new entry to the budget.
+func (b *timeBudget) apply(fh *FileHeader, s CompressionSettings) CompressionSettings {
+	if fh.Method != Deflate {
+		return s
+	}
+	b.adjust()
+	if b.store {
+		fh.Method = Store
+		return s
+	}
+	s.Flate.Level = b.level
+	return s
+}
+
+// adjust steps down the compression level if the remaining bytes are
+// projected to take longer than the time left.
+func (b *timeBudget) adjust() {
+	if b.store || b.rungBytes == 0 {
+		return
+	}
+	now := b.now()
+	elapsed := now.Sub(b.rungStart)
+	if elapsed <= 0 {
+		return
+	}
+	remaining := b.total - b.done
+	if remaining < 0 {
+		remaining = 0
+	}
+	projected := time.Duration(float64(remaining) / float64(b.rungBytes) * float64(elapsed))
+	if !now.Add(projected).After(b.deadline) {
+		return
+	}
+
+	b.store = true
+	for _, l := range budgetLevels {
+		if l < b.level && l > flate.NoCompression {
+			b.level = l
+			b.store = false
+			break
+		}
+	}
+	b.rungStart = now
+	b.rungBytes = 0
+}
+
+// add records that n uncompressed bytes were written.
+func (b *timeBudget) add(n int64) {
+	b.done += n
+	b.rungBytes += n
+}
@@ -0,0 +1,81 @@
+package zip
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func TestWriterTimeBudget(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	// 10 entries of 100 bytes are due in 20s, but each takes 5s.
+	w.budget = newTimeBudget(20*time.Second, 1000, w.compressionSettings.Flate.Level, clock.Now)
+
+	var levels []int
+	var methods []uint16
+	for i := 0; i < 6; i++ {
+		fh := &FileHeader{Name: "f", Method: Deflate}
+		fh.Name += string(rune('a' + i))
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		levels = append(levels, w.budget.level)
+		methods = append(methods, fh.Method)
+		if _, err := fw.Write(bytes.Repeat([]byte{'x'}, 100)); err != nil {
+			t.Fatal(err)
+		}
+		clock.t = clock.t.Add(5 * time.Second)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantLevels := []int{6, 3, 1, 1, 1, 1}
+	wantMethods := []uint16{Deflate, Deflate, Deflate, Store, Store, Store}
+	for i := range levels {
+		if levels[i] != wantLevels[i] || methods[i] != wantMethods[i] {
+			t.Errorf("entry %d: got level %d method %d, want level %d method %d",
+				i, levels[i], methods[i], wantLevels[i], wantMethods[i])
+		}
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File {
+		if err := readAllFile(f); err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+		}
+	}
+}
+
+func TestWriterTimeBudgetOnTrack(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	w := NewWriter(new(bytes.Buffer))
+	w.budget = newTimeBudget(time.Minute, 1000, w.compressionSettings.Flate.Level, clock.Now)
+	for i := 0; i < 10; i++ {
+		fh := &FileHeader{Name: string(rune('a' + i)), Method: Deflate}
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fh.Method != Deflate || w.budget.level != 6 {
+			t.Fatalf("entry %d: degraded to level %d method %d", i, w.budget.level, fh.Method)
+		}
+		fw.Write(bytes.Repeat([]byte{'x'}, 100))
+		clock.t = clock.t.Add(time.Second)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package zip
+
+import (
+	"container/list"
+	"io/ioutil"
+	"sync"
+)
+
+// An EntryCache keeps the decompressed contents of recently read
+// entries in memory, up to a total size, evicting the least recently
+// used ones first. It is meant for services that repeatedly read the
+// same small entries, such as manifests or icons, out of big archives.
+// An EntryCache is safe for concurrent use.
+type EntryCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List // of *cacheEntry, most recently used first
+	items map[cacheKey]*list.Element
+}
+
+// cacheKey includes the CRC-32 so that an archive replaced under the
+// same name does not serve stale contents for entries that changed.
+type cacheKey struct {
+	archive string
+	name    string
+	crc32   uint32
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	data []byte
+}
+
+// NewEntryCache returns a cache holding at most maxBytes of entry contents.
+func NewEntryCache(maxBytes int64) *EntryCache {
+	return &EntryCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// ReadFile returns the decompressed contents of f, which belongs to the
+// archive identified by archive, reading and caching them on a miss.
+// Entries larger than the cache are read but not cached.
+//
+// The returned slice is shared with other callers and must not be modified.
+func (c *EntryCache) ReadFile(archive string, f *File) ([]byte, error) {
+	key := cacheKey{archive: archive, name: f.Name, crc32: f.CRC32}
+	if data, ok := c.get(key); ok {
+		return data, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, data)
+	return data, nil
+}
+
+// Size returns the total size of the cached contents.
+func (c *EntryCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Purge empties the cache.
+func (c *EntryCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[cacheKey]*list.Element)
+	c.size = 0
+}
+
+func (c *EntryCache) get(key cacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).data, true
+}
+
+func (c *EntryCache) put(key cacheKey, data []byte) {
+	n := int64(len(data))
+	if n > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		// Another reader got there first.
+		return
+	}
+	for c.size+n > c.maxBytes {
+		el := c.lru.Back()
+		e := el.Value.(*cacheEntry)
+		c.lru.Remove(el)
+		delete(c.items, e.key)
+		c.size -= int64(len(e.data))
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, data: data})
+	c.size += n
+}
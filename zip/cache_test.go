@@ -0,0 +1,66 @@
+package zip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEntryCache(t *testing.T) {
+	contents := map[string]string{
+		"a": strings.Repeat("a", 40),
+		"b": strings.Repeat("b", 40),
+		"c": strings.Repeat("c", 40),
+		"d": strings.Repeat("d", 200),
+	}
+	raw := buildRepairTestZip(t, contents, []string{"a", "b", "c", "d"})
+	r, err := NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c, d := r.File[0], r.File[1], r.File[2], r.File[3]
+
+	cache := NewEntryCache(100)
+	read := func(f *File) []byte {
+		data, err := cache.ReadFile("test.zip", f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents[f.Name] {
+			t.Fatalf("%s: got %q", f.Name, data)
+		}
+		return data
+	}
+	cached := func(f *File) bool {
+		_, ok := cache.get(cacheKey{"test.zip", f.Name, f.CRC32})
+		return ok
+	}
+
+	read(a)
+	read(b)
+	read(a) // a is now the most recently used
+	read(c) // evicts b
+	if !cached(a) || cached(b) || !cached(c) {
+		t.Errorf("expected b to be evicted")
+	}
+	if got := cache.Size(); got != 80 {
+		t.Errorf("Size() = %d, want 80", got)
+	}
+
+	read(d) // too large to cache
+	if cached(d) || cache.Size() != 80 {
+		t.Errorf("expected d not to be cached")
+	}
+
+	// An entry with different contents under the same name misses.
+	a2 := *a
+	a2.CRC32++
+	if _, ok := cache.get(cacheKey{"test.zip", a2.Name, a2.CRC32}); ok {
+		t.Errorf("expected a miss for a changed entry")
+	}
+
+	cache.Purge()
+	if cached(a) || cache.Size() != 0 {
+		t.Errorf("expected an empty cache after Purge")
+	}
+}
@@ -0,0 +1,221 @@
+package zip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A PartOpener creates the part of a split archive with the given
+// index, starting from 0.
+type PartOpener func(index int) (io.WriteCloser, error)
+
+// A ChunkedWriter splits everything written to it into parts of a fixed
+// size, the last one possibly being smaller, for object store multipart
+// uploads or media with a file size limit such as FAT32. Pass it to
+// NewWriter to split an archive.
+type ChunkedWriter struct {
+	partSize int64
+	open     PartOpener
+
+	part    io.WriteCloser
+	parts   []Part
+	written int64 // to the current part
+	closed  bool
+}
+
+// A Part is a piece of a split archive.
+type Part struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"` // in the whole archive
+	Size   int64 `json:"size"`
+}
+
+// NewChunkedWriter returns a ChunkedWriter creating parts of partSize
+// bytes with open. Parts are only created once there is data for them.
+// partSize must be positive.
+func NewChunkedWriter(partSize int64, open PartOpener) (*ChunkedWriter, error) {
+	if partSize <= 0 {
+		return nil, fmt.Errorf("zip: invalid part size %d", partSize)
+	}
+	return &ChunkedWriter{partSize: partSize, open: open}, nil
+}
+
+func (c *ChunkedWriter) Write(p []byte) (int, error) {
+	if c.closed {
+		return 0, errors.New("zip: write to closed ChunkedWriter")
+	}
+	n := 0
+	for len(p) > 0 {
+		if c.part == nil || c.written == c.partSize {
+			if err := c.nextPart(); err != nil {
+				return n, err
+			}
+		}
+		chunk := p
+		if room := c.partSize - c.written; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		m, err := c.part.Write(chunk)
+		n += m
+		c.written += int64(m)
+		c.parts[len(c.parts)-1].Size += int64(m)
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (c *ChunkedWriter) nextPart() error {
+	var offset int64
+	if c.part != nil {
+		if err := c.part.Close(); err != nil {
+			return err
+		}
+		last := c.parts[len(c.parts)-1]
+		offset = last.Offset + last.Size
+	}
+	index := len(c.parts)
+	part, err := c.open(index)
+	if err != nil {
+		return fmt.Errorf("zip: opening part %d: %v", index, err)
+	}
+	c.part = part
+	c.written = 0
+	c.parts = append(c.parts, Part{Index: index, Offset: offset})
+	return nil
+}
+
+// Close closes the last part. It does not close the zip Writer.
+func (c *ChunkedWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.part == nil {
+		return nil
+	}
+	return c.part.Close()
+}
+
+// Parts returns the parts written so far.
+func (c *ChunkedWriter) Parts() []Part {
+	return append([]Part(nil), c.parts...)
+}
+
+// A PartsManifest describes how an archive was split, and which parts
+// each entry can be found in, so that a single entry can be fetched
+// without downloading the whole archive.
+type PartsManifest struct {
+	PartSize int64       `json:"partSize"`
+	Parts    []Part      `json:"parts"`
+	Entries  []EntrySpan `json:"entries"`
+}
+
+// An EntrySpan tells where an entry's local header, data and data
+// descriptor lie in a split archive.
+type EntrySpan struct {
+	Name      string `json:"name"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+	FirstPart int    `json:"firstPart"`
+	LastPart  int    `json:"lastPart"`
+}
+
+// Manifest returns the manifest of the archive written by w to c. w must
+// be closed, and c must have received all of w's output: either w was
+// created on c directly, or w.SetOffset accounts for what was written
+// to c first.
+func (c *ChunkedWriter) Manifest(w *Writer) (*PartsManifest, error) {
+	if !w.closed {
+		return nil, errors.New("zip: Manifest called before the Writer was closed")
+	}
+	dir := make([]*header, len(w.dir))
+	copy(dir, w.dir)
+	sort.Slice(dir, func(i, j int) bool { return dir[i].offset < dir[j].offset })
+
+	m := &PartsManifest{PartSize: c.partSize, Parts: c.Parts()}
+	for i, h := range dir {
+		end := w.dirOffset
+		if i+1 < len(dir) {
+			end = int64(dir[i+1].offset)
+		}
+		span := EntrySpan{
+			Name:   h.Name,
+			Offset: int64(h.offset),
+			Size:   end - int64(h.offset),
+		}
+		span.FirstPart = int(span.Offset / c.partSize)
+		span.LastPart = span.FirstPart
+		if span.Size > 0 {
+			span.LastPart = int((span.Offset + span.Size - 1) / c.partSize)
+		}
+		m.Entries = append(m.Entries, span)
+	}
+	return m, nil
+}
+
+// Encode writes the manifest to out as JSON.
+func (m *PartsManifest) Encode(out io.Writer) error {
+	return json.NewEncoder(out).Encode(m)
+}
+
+// JoinParts returns an io.ReaderAt over the concatenation of parts,
+// which have the given sizes, along with its total size. The result
+// can be passed to NewReader to read a split archive.
+func JoinParts(parts []io.ReaderAt, sizes []int64) (io.ReaderAt, int64, error) {
+	if len(parts) != len(sizes) {
+		return nil, 0, errors.New("zip: JoinParts needs one size per part")
+	}
+	j := &joinedParts{parts: parts}
+	var total int64
+	for _, s := range sizes {
+		j.offsets = append(j.offsets, total)
+		total += s
+	}
+	j.size = total
+	return j, total, nil
+}
+
+type joinedParts struct {
+	parts   []io.ReaderAt
+	offsets []int64 // start of each part
+	size    int64
+}
+
+func (j *joinedParts) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("zip: negative offset")
+	}
+	n := 0
+	for len(p) > 0 {
+		if off >= j.size {
+			return n, io.EOF
+		}
+		// Find the last part starting at or before off.
+		i := sort.Search(len(j.offsets), func(i int) bool { return j.offsets[i] > off }) - 1
+		partEnd := j.size
+		if i+1 < len(j.offsets) {
+			partEnd = j.offsets[i+1]
+		}
+		chunk := p
+		if room := partEnd - off; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		m, err := j.parts[i].ReadAt(chunk, off-j.offsets[i])
+		n += m
+		off += int64(m)
+		p = p[m:]
+		if err != nil && !(err == io.EOF && m == len(chunk)) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
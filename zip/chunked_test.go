@@ -0,0 +1,115 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestChunkedWriter(t *testing.T) {
+	const partSize = 100
+	var parts []*bufferCloser
+	cw, err := NewChunkedWriter(partSize, func(index int) (io.WriteCloser, error) {
+		if index != len(parts) {
+			t.Fatalf("opened part %d after %d parts", index, len(parts))
+		}
+		p := new(bufferCloser)
+		parts = append(parts, p)
+		return p, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{
+		"a.txt": "small",
+		"b.bin": strings.Repeat("0123456789", 30),
+		"c.txt": "also small",
+	}
+	names := []string{"a.txt", "b.bin", "c.txt"}
+	w := NewWriter(cw)
+	for _, name := range names {
+		fw, err := w.CreateHeader(&FileHeader{Name: name, Method: Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, contents[name])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	readers := make([]io.ReaderAt, len(parts))
+	sizes := make([]int64, len(parts))
+	for i, p := range parts {
+		if !p.closed {
+			t.Errorf("part %d was not closed", i)
+		}
+		if i < len(parts)-1 && p.Len() != partSize {
+			t.Errorf("part %d has %d bytes, want %d", i, p.Len(), partSize)
+		}
+		readers[i] = bytes.NewReader(p.Bytes())
+		sizes[i] = int64(p.Len())
+		total += sizes[i]
+	}
+
+	m, err := cw.Manifest(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Parts) != len(parts) || len(m.Entries) != len(names) {
+		t.Fatalf("got manifest %+v", m)
+	}
+	b := m.Entries[1]
+	if b.Name != "b.bin" || b.FirstPart != 0 || b.LastPart < 3 {
+		t.Errorf("got span %+v for b.bin", b)
+	}
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded PartsManifest
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Entries[1] != b {
+		t.Errorf("manifest does not round-trip through JSON: %v", err)
+	}
+
+	ra, size, err := JoinParts(readers, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != total {
+		t.Errorf("JoinParts size = %d, want %d", size, total)
+	}
+	r, err := NewReader(ra, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File {
+		testReadFile(t, f, &WriteTest{Name: f.Name, Data: []byte(contents[f.Name]), Mode: 0666})
+	}
+}
+
+func TestChunkedWriterBadPartSize(t *testing.T) {
+	open := func(int) (io.WriteCloser, error) { return new(bufferCloser), nil }
+	for _, size := range []int64{0, -1} {
+		if _, err := NewChunkedWriter(size, open); err == nil {
+			t.Errorf("part size %d accepted", size)
+		}
+	}
+}
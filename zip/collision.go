@@ -0,0 +1,116 @@
+package zip
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A CollisionPolicy decides what a Writer does when an entry's name
+// collides with the name of an entry added earlier.
+type CollisionPolicy int
+
+const (
+	// AllowCollisions writes colliding entries as-is. This is the default.
+	AllowCollisions CollisionPolicy = iota
+	// RejectCollisions makes CreateHeader return a *NameCollisionError.
+	RejectCollisions
+	// RenameCollisions appends a counter to the base name of the
+	// colliding entry, so "Readme.txt" becomes "Readme (2).txt".
+	RenameCollisions
+)
+
+// CollisionSettings controls which entry names a Writer considers
+// identical. Names that differ only by Unicode normalization (NFC vs NFD)
+// or by case extract to the same file on macOS and Windows, silently
+// producing fewer files than were added.
+type CollisionSettings struct {
+	// Normalization treats names as equal when their NFC forms are equal.
+	Normalization bool
+	// CaseFolding treats names as equal when their case-folded forms are equal.
+	CaseFolding bool
+	// Policy decides what happens on collision.
+	Policy CollisionPolicy
+}
+
+// NameCollisionError is returned by CreateHeader when RejectCollisions
+// is in effect and an entry name collides with an earlier one, and when
+// opening an archive with duplicate names under RejectDuplicates.
+type NameCollisionError struct {
+	Name     string // name of the entry being added
+	Existing string // name of the entry added earlier
+}
+
+func (e *NameCollisionError) Error() string {
+	if e.Name == e.Existing {
+		return fmt.Sprintf("zip: duplicate entry name %q", e.Name)
+	}
+	return fmt.Sprintf("zip: entry name %q collides with %q", e.Name, e.Existing)
+}
+
+// SetCollisionSettings enables duplicate entry name detection for all
+// entries created afterwards. Exact duplicates are always detected
+// once the policy is not AllowCollisions.
+func (w *Writer) SetCollisionSettings(s CollisionSettings) {
+	w.collisions = s
+	w.names = nil
+	if s.Policy == AllowCollisions {
+		return
+	}
+	w.names = make(map[string]string)
+	if s.CaseFolding {
+		w.caser = cases.Fold()
+	}
+}
+
+func (w *Writer) collisionKey(name string) string {
+	key := strings.TrimSuffix(name, "/")
+	if w.collisions.Normalization {
+		key = norm.NFC.String(key)
+	}
+	if w.collisions.CaseFolding {
+		key = w.caser.String(key)
+	}
+	return key
+}
+
+// checkCollision applies the collision policy to fh, possibly renaming it,
+// and records its name.
+func (w *Writer) checkCollision(fh *FileHeader) error {
+	if w.names == nil {
+		return nil
+	}
+	key := w.collisionKey(fh.Name)
+	if existing, ok := w.names[key]; ok {
+		switch w.collisions.Policy {
+		case RejectCollisions:
+			return &NameCollisionError{Name: fh.Name, Existing: existing}
+		case RenameCollisions:
+			fh.Name, key = w.renameCollision(fh.Name)
+		}
+	}
+	w.names[key] = fh.Name
+	return nil
+}
+
+// forgetCollision undoes checkCollision for an entry that was refused
+// before being written, so that it can be retried.
+func (w *Writer) forgetCollision(fh *FileHeader) {
+	if w.names == nil {
+		return
+	}
+	key := w.collisionKey(fh.Name)
+	if w.names[key] == fh.Name {
+		delete(w.names, key)
+	}
+}
+
+func (w *Writer) renameCollision(name string) (string, string) {
+	candidate := uniqueName(name, func(candidate string) bool {
+		_, taken := w.names[w.collisionKey(candidate)]
+		return taken
+	})
+	return candidate, w.collisionKey(candidate)
+}
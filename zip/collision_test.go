@@ -0,0 +1,98 @@
+package zip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterCollisions(t *testing.T) {
+	nfc := "caf\u00e9.txt"
+	nfd := "cafe\u0301.txt"
+
+	tests := []struct {
+		settings CollisionSettings
+		names    []string
+		want     []string // nil when the last name must be rejected
+	}{
+		{
+			settings: CollisionSettings{},
+			names:    []string{nfc, nfd, "a.txt", "a.txt"},
+			want:     []string{nfc, nfd, "a.txt", "a.txt"},
+		},
+		{
+			settings: CollisionSettings{Policy: RejectCollisions},
+			names:    []string{"a.txt", "a.txt"},
+		},
+		{
+			settings: CollisionSettings{Normalization: true, Policy: RejectCollisions},
+			names:    []string{nfc, nfd},
+		},
+		{
+			settings: CollisionSettings{Normalization: true, Policy: RejectCollisions},
+			names:    []string{"README", "readme"},
+			want:     []string{"README", "readme"},
+		},
+		{
+			settings: CollisionSettings{CaseFolding: true, Policy: RejectCollisions},
+			names:    []string{"Data/", "data/"},
+		},
+		{
+			settings: CollisionSettings{Normalization: true, CaseFolding: true, Policy: RenameCollisions},
+			names:    []string{"README.md", "readme.md", "Readme.md", nfc, "CAFÉ.txt", "dir/.config", "dir/.CONFIG", "Assets/", "assets/"},
+			want:     []string{"README.md", "readme (2).md", "Readme (3).md", nfc, "CAFÉ (2).txt", "dir/.config", "dir/.CONFIG (2)", "Assets/", "assets (2)/"},
+		},
+	}
+
+	for i, tt := range tests {
+		w := NewWriter(new(bytes.Buffer))
+		w.SetCollisionSettings(tt.settings)
+		var got []string
+		var err error
+		for _, name := range tt.names {
+			fh := &FileHeader{Name: name}
+			if _, err = w.CreateHeader(fh); err != nil {
+				break
+			}
+			got = append(got, fh.Name)
+		}
+		if tt.want == nil {
+			if _, ok := err.(*NameCollisionError); !ok {
+				t.Errorf("#%d: got error %v, want *NameCollisionError", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected error %v", i, err)
+			continue
+		}
+		for j := range tt.want {
+			if got[j] != tt.want[j] {
+				t.Errorf("#%d: entry %d named %q, want %q", i, j, got[j], tt.want[j])
+			}
+		}
+	}
+}
+
+func TestWriterCollisionsForgetRefused(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetCollisionSettings(CollisionSettings{Policy: RejectCollisions})
+	if _, err := w.CreateHeader(&FileHeader{Name: "a.txt", Method: 0xbeef}); err != ErrAlgorithm {
+		t.Fatalf("unknown method: got %v, want ErrAlgorithm", err)
+	}
+	if _, err := w.CreateHeader(&FileHeader{Name: "b.txt", Extra: make([]byte, 1<<16)}); err == nil {
+		t.Fatal("oversized extra: got no error")
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := w.CreateHeader(&FileHeader{Name: name}); err != nil {
+			t.Errorf("%s: retrying a refused entry: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := mustNewReader(t, buf.Bytes())
+	if len(r.File) != 2 {
+		t.Errorf("got %d entries, want 2", len(r.File))
+	}
+}
@@ -0,0 +1,248 @@
+package zip
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// DiffKind tells how a path differs between an archive and a directory.
+type DiffKind int
+
+const (
+	// DiffMissing paths are in the archive but not in the directory.
+	DiffMissing DiffKind = iota
+	// DiffType paths have a different type, for example a file in the
+	// archive and a directory on disk.
+	DiffType
+	// DiffSize files have a different size.
+	DiffSize
+	// DiffContents files have the same size but a different CRC-32,
+	// or symlinks have a different target.
+	DiffContents
+	// DiffMode paths have different permission bits.
+	DiffMode
+	// DiffExtra paths are in the directory but not in the archive.
+	DiffExtra
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffMissing:
+		return "missing"
+	case DiffType:
+		return "type"
+	case DiffSize:
+		return "size"
+	case DiffContents:
+		return "contents"
+	case DiffMode:
+		return "mode"
+	case DiffExtra:
+		return "extra"
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// A Difference is a single mismatch found by CompareWithDir.
+type Difference struct {
+	Name   string // slash-separated, relative to the directory
+	Kind   DiffKind
+	Detail string
+}
+
+func (d Difference) String() string {
+	if d.Detail == "" {
+		return fmt.Sprintf("%s: %s", d.Name, d.Kind)
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Name, d.Kind, d.Detail)
+}
+
+// A CompareReport lists the differences found by CompareWithDir, sorted
+// by name.
+type CompareReport struct {
+	Differences []Difference
+}
+
+// OK reports whether no differences were found.
+func (r *CompareReport) OK() bool {
+	return len(r.Differences) == 0
+}
+
+// CompareOptions controls what CompareWithDir checks.
+type CompareOptions struct {
+	// Contents compares the CRC-32 of files on disk with the archive's,
+	// which means reading every file. Otherwise only sizes are compared.
+	Contents bool
+	// Modes compares permission bits of entries that have Unix modes.
+	// It is ignored on Windows.
+	Modes bool
+	// Extra reports paths present in the directory but not in the
+	// archive.
+	Extra bool
+	// Skip, if non-nil, excludes matching names on both sides.
+	Skip *NameFilter
+}
+
+// CompareWithDir checks whether dir matches the contents of the archive,
+// as it would after a clean extraction, and reports the differences.
+// It is the core of "repair install" features: only the entries
+// reported missing or different need to be extracted again.
+//
+// Entries whose names are absolute or escape dir are ignored, since no
+// sane extractor would have written them.
+func CompareWithDir(r *Reader, dir string, opts CompareOptions) (*CompareReport, error) {
+	report := new(CompareReport)
+	diff := func(name string, kind DiffKind, format string, args ...interface{}) {
+		report.Differences = append(report.Differences, Difference{
+			Name:   name,
+			Kind:   kind,
+			Detail: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Every name the archive accounts for, including implicit parents.
+	known := make(map[string]bool)
+	for _, f := range r.File {
+		name := strings.TrimSuffix(f.Name, "/")
+		if !isLocalName(name) || opts.Skip != nil && opts.Skip.Match(f.Name) {
+			continue
+		}
+		for p := name; p != "." && !known[p]; p = path.Dir(p) {
+			known[p] = true
+		}
+
+		fi, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			diff(name, DiffMissing, "")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		want := f.Mode()
+		if want.Type() != fi.Mode().Type() {
+			diff(name, DiffType, "want %s, have %s", typeName(want), typeName(fi.Mode()))
+			continue
+		}
+		if opts.Modes && runtime.GOOS != "windows" {
+			if _, ok := f.UnixMode(); ok && want.Perm() != fi.Mode().Perm() {
+				diff(name, DiffMode, "want %v, have %v", want.Perm(), fi.Mode().Perm())
+			}
+		}
+
+		switch {
+		case want&os.ModeSymlink != 0:
+			if err := compareSymlink(f, filepath.Join(dir, filepath.FromSlash(name)), name, diff); err != nil {
+				return nil, err
+			}
+		case want.IsRegular():
+			if uint64(fi.Size()) != f.UncompressedSize64 {
+				diff(name, DiffSize, "want %d bytes, have %d", f.UncompressedSize64, fi.Size())
+				continue
+			}
+			if opts.Contents {
+				sum, err := crc32File(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil {
+					return nil, err
+				}
+				if sum != f.CRC32 {
+					diff(name, DiffContents, "want CRC-32 %08x, have %08x", f.CRC32, sum)
+				}
+			}
+		}
+	}
+
+	if opts.Extra {
+		err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			skipped := opts.Skip != nil && opts.Skip.Match(name)
+			if !known[name] && !skipped {
+				diff(name, DiffExtra, "")
+			}
+			if fi.IsDir() && (!known[name] || skipped) {
+				// Don't report everything under an extra directory.
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(report.Differences, func(i, j int) bool {
+		return report.Differences[i].Name < report.Differences[j].Name
+	})
+	return report, nil
+}
+
+// isLocalName reports whether name is a relative, slash-separated path
+// that stays within its root.
+func isLocalName(name string) bool {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, `\`) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	clean := path.Clean(name)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+func typeName(m os.FileMode) string {
+	switch {
+	case m.IsDir():
+		return "directory"
+	case m&os.ModeSymlink != 0:
+		return "symlink"
+	case m.IsRegular():
+		return "file"
+	}
+	return m.Type().String()
+}
+
+func compareSymlink(f *File, p, name string, diff func(string, DiffKind, string, ...interface{})) error {
+	have, err := os.Readlink(p)
+	if err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	want, err := ioutil.ReadAll(io.LimitReader(rc, 64*1024))
+	if err != nil {
+		return err
+	}
+	if string(want) != have {
+		diff(name, DiffContents, "want link to %q, have %q", want, have)
+	}
+	return nil
+}
+
+func crc32File(p string) (uint32, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
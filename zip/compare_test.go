@@ -0,0 +1,96 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestCompareWithDir(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	add := func(name string, mode os.FileMode, body string) {
+		fh := &FileHeader{Name: name, Method: Deflate}
+		fh.SetMode(mode)
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, body)
+	}
+	add("bin/", os.ModeDir|0755, "")
+	add("bin/game", 0755, "#!/bin/sh\necho game\n")
+	add("data/level.dat", 0644, "level data")
+	add("data/same-size.dat", 0644, "aaaa")
+	add("readme.txt", 0644, "readme")
+	add("../escape.txt", 0644, "ignored")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReaderBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "arkive-compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, mode os.FileMode, body string) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(body), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("bin/game", 0644, "#!/bin/sh\necho game\n") // lost its execute bit
+	write("data/level.dat", 0644, "truncated")
+	write("data/same-size.dat", 0644, "bbbb")
+	write("saves/slot1.sav", 0644, "progress")
+	write("saves/slot2.sav", 0644, "progress")
+
+	report, err := CompareWithDir(r, dir, CompareOptions{Contents: true, Modes: true, Extra: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range report.Differences {
+		got = append(got, d.Name+" "+d.Kind.String())
+	}
+	want := []string{
+		"bin/game mode",
+		"data/level.dat size",
+		"data/same-size.dat contents",
+		"readme.txt missing",
+		"saves extra",
+	}
+	if runtime.GOOS == "windows" {
+		want = want[1:]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got differences %q, want %q", got, want)
+	}
+
+	skip, err := NewNameFilter("saves", "readme.txt", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = CompareWithDir(r, dir, CompareOptions{Extra: true, Skip: skip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("expected no differences, got %v", report.Differences)
+	}
+}
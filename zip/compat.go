@@ -0,0 +1,88 @@
+package zip
+
+import "fmt"
+
+// Compatibility restricts the features a Writer may use, so that its
+// archives can be read by old or minimal unzip implementations, such as
+// those of some console SDKs. The zero value allows everything.
+type Compatibility struct {
+	// NoZip64 forbids Zip64 records: entries, their offsets and the
+	// central directory must stay under 4GiB, and the archive under
+	// 65535 entries.
+	NoZip64 bool
+
+	// NoUTF8 forbids the UTF-8 flag: names and comments must be plain
+	// ASCII, unless FileHeader.NonUTF8 says they are in another encoding.
+	NoUTF8 bool
+
+	// NoExtra forbids extra fields: modification times are only
+	// stored in the MS-DOS fields, and headers with Extra set are
+	// refused.
+	NoExtra bool
+
+	// Methods, if non-nil, lists the only compression methods allowed.
+	Methods []uint16
+}
+
+// CompatLegacy allows what PKZIP 2.04g reads, the baseline nearly every
+// unzip implementation supports: Store and Deflate, without Zip64,
+// UTF-8 names or extra fields.
+var CompatLegacy = Compatibility{
+	NoZip64: true,
+	NoUTF8:  true,
+	NoExtra: true,
+	Methods: []uint16{Store, Deflate},
+}
+
+// A CompatibilityError is returned when an entry, or the archive, would
+// need a feature the Writer's Compatibility forbids.
+type CompatibilityError struct {
+	Name    string // entry, or "" for the archive as a whole
+	Feature string // such as "Zip64"
+}
+
+func (e *CompatibilityError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("zip: archive needs %s, which the compatibility settings forbid", e.Feature)
+	}
+	return fmt.Sprintf("zip: %s needs %s, which the compatibility settings forbid", e.Name, e.Feature)
+}
+
+// SetCompatibility restricts the features used by entries created
+// afterwards, and by the central directory. Creating an entry that
+// needs a forbidden feature fails with a *CompatibilityError, leaving
+// the archive as it was. An entry found to need Zip64 only as its data
+// is written fails its Write, or the next call to CreateHeader or Close;
+// the archive is then unusable.
+func (w *Writer) SetCompatibility(c Compatibility) {
+	w.compat = c
+}
+
+// checkHeader is called before fh is written at offset, once the Writer
+// has set its flags and extra fields.
+func (c *Compatibility) checkHeader(fh *FileHeader, offset int64) error {
+	feature := ""
+	switch {
+	case c.Methods != nil && !containsMethod(c.Methods, fh.Method):
+		feature = "the " + MethodName(fh.Method) + " method"
+	case c.NoUTF8 && fh.Flags&0x800 != 0:
+		feature = "a UTF-8 name"
+	case c.NoExtra && len(fh.Extra) > 0:
+		feature = "extra fields"
+	case c.NoZip64 && (fh.isZip64() || offset >= uint32max):
+		feature = "Zip64"
+	}
+	if feature != "" {
+		return &CompatibilityError{Name: fh.Name, Feature: feature}
+	}
+	return nil
+}
+
+func containsMethod(methods []uint16, method uint16) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
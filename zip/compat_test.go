@@ -0,0 +1,85 @@
+package zip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompatLegacy(t *testing.T) {
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	zw.SetCompatibility(CompatLegacy)
+
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	w, err := zw.CreateHeader(&FileHeader{Name: "ok.txt", Method: Deflate, Modified: mtime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("fine"))
+
+	refused := []struct {
+		fh      *FileHeader
+		raw     bool
+		feature string
+	}{
+		{fh: &FileHeader{Name: "zstd.bin", Method: 93}, feature: "Zstandard"},
+		{fh: &FileHeader{Name: "café.txt"}, feature: "UTF-8"},
+		{fh: &FileHeader{Name: "extra.txt", Extra: []byte{0x99, 0x99, 0, 0}}, feature: "extra fields"},
+		{fh: &FileHeader{Name: "huge.bin", CompressedSize64: 5 << 30, UncompressedSize64: 5 << 30}, raw: true, feature: "Zip64"},
+	}
+	for _, r := range refused {
+		var err error
+		if r.raw {
+			_, err = zw.CreateRaw(r.fh)
+		} else {
+			_, err = zw.CreateHeader(r.fh)
+		}
+		ce, ok := err.(*CompatibilityError)
+		if !ok || ce.Name != r.fh.Name || !strings.Contains(ce.Feature, r.feature) {
+			t.Errorf("%s: got %v, want a CompatibilityError about %s", r.fh.Name, err, r.feature)
+		}
+	}
+
+	// Names in a legacy encoding are fine when flagged as such.
+	if _, err := zw.CreateHeader(&FileHeader{Name: "caf\x82.txt", NonUTF8: true}); err != nil {
+		t.Errorf("NonUTF8 name: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("got %d entries, want 2", len(zr.File))
+	}
+	f := zr.File[0]
+	if len(f.Extra) != 0 {
+		t.Errorf("extra fields written: %x", f.Extra)
+	}
+	if f.Flags&0x800 != 0 {
+		t.Error("UTF-8 flag set")
+	}
+	if got := f.Modified; got.Year() != 2001 || got.Second() != 6 {
+		t.Errorf("Modified = %v", got)
+	}
+}
+
+func TestCompatMethods(t *testing.T) {
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	zw.SetCompatibility(Compatibility{Methods: []uint16{Store}})
+	if _, err := zw.CreateHeader(&FileHeader{Name: "a", Method: Store}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Create("b"); err == nil {
+		t.Error("Deflate allowed")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
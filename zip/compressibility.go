@@ -0,0 +1,47 @@
+package zip
+
+import (
+	"github.com/klauspost/compress"
+)
+
+// Thresholds for EstimateCompressibility.
+const (
+	// Samples scoring below IncompressibleThreshold are very unlikely
+	// to shrink with Deflate: typically media, archives, or data that
+	// is already compressed or encrypted.
+	IncompressibleThreshold = 0.1
+
+	// Samples scoring above HighlyCompressibleThreshold typically
+	// deflate to less than half their size: text, source code,
+	// uncompressed bitmaps, sparse binaries.
+	HighlyCompressibleThreshold = 0.5
+)
+
+// compressibilitySampleSize is how much of a sample
+// EstimateCompressibility looks at.
+const compressibilitySampleSize = 64 << 10
+
+// EstimateCompressibility returns a score between 0 and 1 telling how
+// well sample is likely to compress, from its byte distribution and how
+// predictable each byte is from the previous one. It is much cheaper
+// than actually compressing, and only looks at the first 64KiB of
+// sample. Samples shorter than 16 bytes score 0.
+//
+// See IncompressibleThreshold and HighlyCompressibleThreshold for how
+// to interpret the score.
+func EstimateCompressibility(sample []byte) float64 {
+	if len(sample) > compressibilitySampleSize {
+		sample = sample[:compressibilitySampleSize]
+	}
+	return compress.Estimate(sample)
+}
+
+// SuggestMethod returns Store if sample scores below
+// IncompressibleThreshold, and Deflate otherwise. Callers typically
+// pass the first bytes of an entry's contents.
+func SuggestMethod(sample []byte) uint16 {
+	if EstimateCompressibility(sample) < IncompressibleThreshold {
+		return Store
+	}
+	return Deflate
+}
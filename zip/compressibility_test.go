@@ -0,0 +1,43 @@
+package zip
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEstimateCompressibility(t *testing.T) {
+	random := make([]byte, 32<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 1000))
+	zeros := make([]byte, 32<<10)
+
+	tests := []struct {
+		name   string
+		sample []byte
+		method uint16
+		min    float64
+		max    float64
+	}{
+		{"random", random, Store, 0, IncompressibleThreshold},
+		{"text", text, Deflate, HighlyCompressibleThreshold, 1},
+		{"zeros", zeros, Deflate, HighlyCompressibleThreshold, 1},
+		{"tiny", []byte("abc"), Store, 0, 0},
+	}
+	for _, tt := range tests {
+		score := EstimateCompressibility(tt.sample)
+		if score < tt.min || score > tt.max {
+			t.Errorf("%s: score %.3f, want in [%.1f, %.1f]", tt.name, score, tt.min, tt.max)
+		}
+		if m := SuggestMethod(tt.sample); m != tt.method {
+			t.Errorf("%s: SuggestMethod = %d, want %d", tt.name, m, tt.method)
+		}
+	}
+
+	// Only the start of long samples is looked at.
+	long := append(append([]byte{}, text[:compressibilitySampleSize/2]...), bytes.Repeat(random, 8)...)
+	if a, b := EstimateCompressibility(long), EstimateCompressibility(long[:compressibilitySampleSize]); a != b {
+		t.Errorf("long sample: score %.3f, want %.3f", a, b)
+	}
+}
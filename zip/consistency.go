@@ -0,0 +1,178 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+)
+
+// A HeaderMismatch is a field whose value in an entry's local header
+// disagrees with its central directory record.
+type HeaderMismatch struct {
+	Name    string // entry name, from the central directory
+	Field   string // "signature", "name", "flags", "method", "crc32", "compressed size" or "uncompressed size"
+	Central string
+	Local   string
+}
+
+func (m HeaderMismatch) String() string {
+	return fmt.Sprintf("%s: %s is %s in the central directory but %s in the local header", m.Name, m.Field, m.Central, m.Local)
+}
+
+// A ConsistencyReport lists the mismatches found by CheckConsistency,
+// in central directory order.
+type ConsistencyReport struct {
+	Mismatches []HeaderMismatch
+}
+
+// OK reports whether every local header agreed with the central
+// directory.
+func (r *ConsistencyReport) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// CheckConsistency cross-checks every entry's local header against its
+// central directory record: name, flags, method, CRC-32 and sizes.
+// For entries with a data descriptor, the CRC-32 and sizes are read
+// from the descriptor instead, as the local header usually leaves them
+// zero. Mismatches are a common symptom of corrupted archives, and of
+// malicious ones that show different contents to tools reading the
+// central directory and tools streaming local headers.
+//
+// Names of entries that are not UTF-8 are not compared, since the
+// Reader may have converted them to UTF-8. Returned errors are I/O
+// errors; a local header that cannot be found is reported as a mismatch.
+func (z *Reader) CheckConsistency() (*ConsistencyReport, error) {
+	report := &ConsistencyReport{}
+	for _, f := range z.File {
+		mismatches, err := checkLocalHeader(f)
+		if err != nil {
+			return report, fmt.Errorf("zip: checking %s: %v", f.Name, err)
+		}
+		report.Mismatches = append(report.Mismatches, mismatches...)
+	}
+	return report, nil
+}
+
+func checkLocalHeader(f *File) ([]HeaderMismatch, error) {
+	var ms []HeaderMismatch
+	mismatch := func(field string, central, local interface{}) {
+		ms = append(ms, HeaderMismatch{
+			Name:    f.Name,
+			Field:   field,
+			Central: fmt.Sprint(central),
+			Local:   fmt.Sprint(local),
+		})
+	}
+
+	if f.headerOffset < 0 || f.headerOffset+fileHeaderLen > f.zipsize {
+		mismatch("signature", "a local header", "past the end of the archive")
+		return ms, nil
+	}
+	var buf [fileHeaderLen]byte
+	if _, err := f.zipr.ReadAt(buf[:], f.headerOffset); err != nil {
+		return nil, err
+	}
+	b := readBuf(buf[:])
+	if sig := b.uint32(); sig != fileHeaderSignature {
+		mismatch("signature", fmt.Sprintf("%#08x", fileHeaderSignature), fmt.Sprintf("%#08x", sig))
+		return ms, nil
+	}
+	b.uint16() // reader version
+	flags := b.uint16()
+	method := b.uint16()
+	b.uint32() // modification time and date
+	crc := b.uint32()
+	csize := uint64(b.uint32())
+	usize := uint64(b.uint32())
+	nameLen := int64(b.uint16())
+	extraLen := int64(b.uint16())
+	bodyOffset := f.headerOffset + fileHeaderLen + nameLen + extraLen
+	if bodyOffset > f.zipsize {
+		mismatch("name", f.Name, "past the end of the archive")
+		return ms, nil
+	}
+	rest := make([]byte, nameLen+extraLen)
+	if _, err := f.zipr.ReadAt(rest, f.headerOffset+fileHeaderLen); err != nil {
+		return nil, err
+	}
+	name, extra := string(rest[:nameLen]), rest[nameLen:]
+
+	if name != f.Name && !f.NonUTF8 {
+		mismatch("name", fmt.Sprintf("%q", f.Name), fmt.Sprintf("%q", name))
+	}
+	if flags != f.Flags {
+		mismatch("flags", fmt.Sprintf("%#04x", f.Flags), fmt.Sprintf("%#04x", flags))
+	}
+	if method != f.Method {
+		mismatch("method", f.Method, method)
+	}
+
+	zip64 := false
+	if csize == uint32max || usize == uint32max {
+		if data, ok := findExtra(extra, zip64ExtraID); ok {
+			zip64 = true
+			// The local zip64 record holds both sizes, in this order.
+			eb := readBuf(data)
+			if usize == uint32max && len(eb) >= 8 {
+				usize = eb.uint64()
+			}
+			if csize == uint32max && len(eb) >= 8 {
+				csize = eb.uint64()
+			}
+		}
+	}
+
+	if f.hasDataDescriptor() {
+		var err error
+		crc, csize, usize, err = readDescriptorFields(f, bodyOffset, zip64)
+		if err == io.ErrUnexpectedEOF {
+			mismatch("crc32", "a data descriptor", "past the end of the archive")
+			return ms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if crc != f.CRC32 {
+		mismatch("crc32", fmt.Sprintf("%#08x", f.CRC32), fmt.Sprintf("%#08x", crc))
+	}
+	if csize != f.CompressedSize64 {
+		mismatch("compressed size", f.CompressedSize64, csize)
+	}
+	if usize != f.UncompressedSize64 {
+		mismatch("uncompressed size", f.UncompressedSize64, usize)
+	}
+	return ms, nil
+}
+
+// readDescriptorFields reads the data descriptor following an entry's
+// data, located using the central directory's compressed size. The
+// descriptor signature is optional, and sizes are 8 bytes long in
+// zip64 entries.
+func readDescriptorFields(f *File, bodyOffset int64, zip64 bool) (crc uint32, csize, usize uint64, err error) {
+	var buf [24]byte
+	n := 16
+	if zip64 {
+		n = 24
+	}
+	off := bodyOffset + int64(f.CompressedSize64)
+	if off+int64(n) > f.zipsize {
+		// The signature may be missing, making the descriptor shorter.
+		n -= 4
+		if off+int64(n) > f.zipsize {
+			return 0, 0, 0, io.ErrUnexpectedEOF
+		}
+	}
+	if _, err := f.zipr.ReadAt(buf[:n], off); err != nil {
+		return 0, 0, 0, err
+	}
+	b := readBuf(buf[:n])
+	if sig := readBuf(buf[:4]); sig.uint32() == dataDescriptorSignature {
+		b.uint32()
+	}
+	crc = b.uint32()
+	if zip64 {
+		return crc, b.uint64(), b.uint64(), nil
+	}
+	return crc, uint64(b.uint32()), uint64(b.uint32()), nil
+}
@@ -0,0 +1,63 @@
+package zip
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	contents := map[string]string{
+		"a.txt": strings.Repeat("alpha ", 100),
+		"b.txt": strings.Repeat("bravo ", 100),
+		"c.txt": strings.Repeat("charlie ", 100),
+	}
+	b := buildRepairTestZip(t, contents, names)
+	r, err := NewReaderBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := r.CheckConsistency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("untouched archive: got mismatches %v", report.Mismatches)
+	}
+
+	// Tamper with local headers and descriptors only, so the central
+	// directory still parses the same.
+	offset := func(name string) int64 {
+		for _, f := range r.File {
+			if f.Name == name {
+				return f.headerOffset
+			}
+		}
+		t.Fatalf("no entry %s", name)
+		return 0
+	}
+	a := r.File[0]
+	descriptor := offset("a.txt") + fileHeaderLen + int64(len("a.txt")) + int64(a.CompressedSize64)
+	binary.LittleEndian.PutUint32(b[descriptor+4:], 0xdeadbeef)
+	binary.LittleEndian.PutUint16(b[offset("b.txt")+8:], Store)
+	copy(b[offset("c.txt")+fileHeaderLen:], "x")
+
+	report, err = r.CheckConsistency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range report.Mismatches {
+		got = append(got, m.Name+" "+m.Field+" "+m.Local)
+	}
+	want := []string{
+		"a.txt crc32 0xdeadbeef",
+		"b.txt method 0",
+		`c.txt name "x.txt"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got mismatches\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
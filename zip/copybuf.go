@@ -0,0 +1,48 @@
+package zip
+
+import "sync"
+
+// copyBufferSize is the size of the buffers entries are copied with by
+// ReadFrom and WriteTo, larger than io.Copy's 32KiB to make fewer,
+// bigger reads from files. ReaderOptions.CopyBufferSize overrides it
+// for WriteTo.
+const copyBufferSize = 256 << 10
+
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// copyBufferPools holds a sync.Pool of buffers per size other than
+// copyBufferSize.
+var copyBufferPools sync.Map // map[int]*sync.Pool
+
+// getCopyBuffer returns a pooled buffer of size bytes, or of
+// copyBufferSize if size is zero, to give back with putCopyBuffer.
+func getCopyBuffer(size int) *[]byte {
+	if size <= 0 || size == copyBufferSize {
+		return copyBufferPool.Get().(*[]byte)
+	}
+	pi, ok := copyBufferPools.Load(size)
+	if !ok {
+		pi, _ = copyBufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, size)
+				return &b
+			},
+		})
+	}
+	return pi.(*sync.Pool).Get().(*[]byte)
+}
+
+func putCopyBuffer(bp *[]byte) {
+	if len(*bp) == copyBufferSize {
+		copyBufferPool.Put(bp)
+		return
+	}
+	if pi, ok := copyBufferPools.Load(len(*bp)); ok {
+		pi.(*sync.Pool).Put(bp)
+	}
+}
@@ -0,0 +1,76 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// chunkRecorder records the size of each write.
+type chunkRecorder struct {
+	bytes.Buffer
+	sizes []int
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	c.sizes = append(c.sizes, len(p))
+	return c.Buffer.Write(p)
+}
+
+func TestReaderBufferSizes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 300000)
+	rng.Read(data)
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range []*FileHeader{
+		{Name: "deflated", Method: Deflate},
+		{Name: "stored", Method: Store},
+	} {
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ra := &recordingReaderAt{r: bytes.NewReader(buf.Bytes())}
+	z, err := NewReaderWithOptions(ra, int64(buf.Len()), ReaderOptions{
+		CopyBufferSize: 10000,
+		ReadBufferSize: 64 << 10,
+		LowMemory:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range z.File {
+		ra.sizes = nil
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(chunkRecorder)
+		if _, err := io.Copy(out, rc); err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		rc.Close()
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%s: contents differ", f.Name)
+		}
+		for _, n := range out.sizes {
+			if n > 10000 {
+				t.Errorf("%s: wrote %d bytes at once, more than CopyBufferSize", f.Name, n)
+				break
+			}
+		}
+		// The local header is read first, then the data.
+		if n := len(ra.sizes); n < 2 || ra.sizes[1] != 64<<10 {
+			t.Errorf("%s: reads of %v, want reads of 64KiB", f.Name, ra.sizes)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package zip
+
+import (
+	"io"
+	"sync"
+)
+
+// A DecompressionLimiter bounds how many entries are decompressed at
+// the same time, by any number of Readers sharing it, so that an
+// application extracting archives in the background leaves CPU to the
+// rest of it. Entries take one of its slots for each Read of their
+// reader, which includes reading the compressed data it needs, and give
+// it back before Read returns: open readers that are not read from hold
+// none, and readers going at once take turns. Stored entries, which
+// need no CPU to speak of, are not limited.
+//
+// Limiters only govern the goroutine reading from an entry. Verifier
+// has its own Workers option.
+type DecompressionLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+// NewDecompressionLimiter returns a DecompressionLimiter letting n
+// entries be decompressed at once, at least one.
+func NewDecompressionLimiter(n int) *DecompressionLimiter {
+	l := &DecompressionLimiter{}
+	l.cond = sync.NewCond(&l.mu)
+	l.SetLimit(n)
+	return l
+}
+
+// SetLimit changes how many entries may be decompressed at once, at
+// least one, for example to let extraction use more CPU while the
+// application is idle. Entries already being decompressed beyond the
+// new limit finish their Read.
+func (l *DecompressionLimiter) SetLimit(n int) {
+	if n < 1 {
+		n = 1
+	}
+	l.mu.Lock()
+	l.limit = n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// Limit returns how many entries may be decompressed at once.
+func (l *DecompressionLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *DecompressionLimiter) acquire() {
+	l.mu.Lock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+}
+
+func (l *DecompressionLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+var (
+	defaultLimiterMu sync.RWMutex
+	defaultLimiter   *DecompressionLimiter
+)
+
+// SetDefaultDecompressionLimiter sets the DecompressionLimiter of
+// Readers whose options have none, including those made with NewReader
+// and OpenReader, to bound decompression across a whole program. A nil
+// l, the default, leaves them unlimited. It applies to entries opened
+// afterwards.
+func SetDefaultDecompressionLimiter(l *DecompressionLimiter) {
+	defaultLimiterMu.Lock()
+	defaultLimiter = l
+	defaultLimiterMu.Unlock()
+}
+
+// decompressionLimiter returns the limiter entries of z are
+// decompressed under, if any.
+func (z *Reader) decompressionLimiter() *DecompressionLimiter {
+	if l := z.opts.DecompressionLimiter; l != nil {
+		return l
+	}
+	defaultLimiterMu.RLock()
+	defer defaultLimiterMu.RUnlock()
+	return defaultLimiter
+}
+
+// throttledDecompressor holds a slot of its limiter while reading from
+// an entry's decompressor.
+type throttledDecompressor struct {
+	rc io.ReadCloser
+	l  *DecompressionLimiter
+}
+
+func (t *throttledDecompressor) Read(p []byte) (int, error) {
+	t.l.acquire()
+	defer t.l.release()
+	return t.rc.Read(p)
+}
+
+func (t *throttledDecompressor) Close() error { return t.rc.Close() }
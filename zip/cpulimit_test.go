@@ -0,0 +1,137 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyProbe wraps decompressors to record how many of them are
+// read from at once.
+type concurrencyProbe struct {
+	mu          sync.Mutex
+	active, max int
+}
+
+func (p *concurrencyProbe) decompressor(method uint16) Decompressor {
+	dcomp := decompressor(method)
+	return func(r io.Reader, f *File) io.ReadCloser {
+		return &probedReader{rc: dcomp(r, f), p: p}
+	}
+}
+
+type probedReader struct {
+	rc io.ReadCloser
+	p  *concurrencyProbe
+}
+
+func (r *probedReader) Read(b []byte) (int, error) {
+	r.p.mu.Lock()
+	r.p.active++
+	if r.p.active > r.p.max {
+		r.p.max = r.p.active
+	}
+	r.p.mu.Unlock()
+	time.Sleep(100 * time.Microsecond)
+	n, err := r.rc.Read(b)
+	r.p.mu.Lock()
+	r.p.active--
+	r.p.mu.Unlock()
+	return n, err
+}
+
+func (r *probedReader) Close() error { return r.rc.Close() }
+
+func buildLimiterTestZip(t *testing.T, n int) []byte {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for i := 0; i < n; i++ {
+		fw, err := w.Create(strings.Repeat("x", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, strings.Repeat("some text to deflate ", 20000))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readConcurrently reads every entry of z on a goroutine of its own,
+// and returns the most that were decompressing at once.
+func readConcurrently(t *testing.T, z *Reader) int {
+	p := &concurrencyProbe{}
+	z.RegisterDecompressor(Deflate, p.decompressor(Deflate))
+	var wg sync.WaitGroup
+	for _, f := range z.File {
+		wg.Add(1)
+		go func(f *File) {
+			defer wg.Done()
+			rc, err := f.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer rc.Close()
+			if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+				t.Error(err)
+			}
+		}(f)
+	}
+	wg.Wait()
+	return p.max
+}
+
+func TestDecompressionLimiter(t *testing.T) {
+	b := buildLimiterTestZip(t, 6)
+	l := NewDecompressionLimiter(2)
+	z, err := NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{DecompressionLimiter: l})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := readConcurrently(t, z); max > 2 {
+		t.Errorf("%d entries decompressed at once, limit 2", max)
+	}
+
+	l.SetLimit(0)
+	if l.Limit() != 1 {
+		t.Errorf("Limit() = %d after SetLimit(0), want 1", l.Limit())
+	}
+	if max := readConcurrently(t, z); max != 1 {
+		t.Errorf("%d entries decompressed at once, limit 1", max)
+	}
+}
+
+func TestDefaultDecompressionLimiter(t *testing.T) {
+	b := buildLimiterTestZip(t, 4)
+	SetDefaultDecompressionLimiter(NewDecompressionLimiter(1))
+	defer SetDefaultDecompressionLimiter(nil)
+	if max := readConcurrently(t, mustNewReader(t, b)); max != 1 {
+		t.Errorf("%d entries decompressed at once, default limit 1", max)
+	}
+}
+
+func TestDecompressionLimiterOpenReaders(t *testing.T) {
+	// Open readers that are not read from hold no slot.
+	b := buildLimiterTestZip(t, 2)
+	z, err := NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{DecompressionLimiter: NewDecompressionLimiter(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := z.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if _, err := first.Read(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, z.File[1]); len(got) != 20000*21 {
+		t.Errorf("read %d bytes", len(got))
+	}
+}
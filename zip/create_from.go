@@ -0,0 +1,178 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// createFromChunkSize is the size of the reads CreateFromReaderAt
+// issues concurrently for entries that are not compressed by blocks.
+const createFromChunkSize = 1 << 20
+
+// readerAtSeeker is what CreateFrom needs of sources to reuse payloads.
+type readerAtSeeker interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// CreateFrom adds an entry named name to the archive, with the contents
+// read from r until EOF, and returns once they are written. If fi is
+// non-nil, the entry gets its mode and modification time, and CreateFrom
+// fails if r does not yield exactly fi.Size() bytes, which catches files
+// changing while they are archived. Directories are added with
+// CreateDir, ignoring r. Regular files are compressed with Deflate.
+//
+// Errors mention the entry's name.
+func (w *Writer) CreateFrom(name string, r io.Reader, fi os.FileInfo) error {
+	if fi != nil && fi.IsDir() {
+		return w.CreateDir(name, fi)
+	}
+	if rs, ok := r.(readerAtSeeker); ok && w.payloads != nil && fi != nil && fi.Mode().IsRegular() {
+		// Payloads are read from where r is, and r left at the end
+		// of the file as if it had been copied.
+		off, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("zip: adding %s: %v", name, err)
+		}
+		reused, err := w.reusePayload(name, rs, off, fi)
+		if err == nil && reused {
+			_, err = rs.Seek(off+fi.Size(), io.SeekStart)
+		}
+		if reused || err != nil {
+			return err
+		}
+	}
+	fw, err := w.createFrom(name, fi)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(fw, r)
+	if err != nil {
+		return fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	return checkCreateFromSize(name, n, fi)
+}
+
+// CreateFromReaderAt is like CreateFrom, but reads the source with n
+// goroutines, ahead of and concurrently with compression. This helps
+// when reads have high latency, as on network filesystems, and keeps
+// fast disks and every compressing goroutine busy for large files. fi
+// is required, since its size tells what to read.
+//
+// Deflate entries are read in chunks of the Writer's flate block size,
+// so that each one is handed to a compressing goroutine as a block of
+// its own as soon as it is read; if n is less than 1, as many are read
+// ahead as blocks may be compressed at once. Other entries are read in
+// chunks of 1MiB, one at a time if n is less than 1.
+func (w *Writer) CreateFromReaderAt(name string, r io.ReaderAt, fi os.FileInfo, n int) error {
+	if fi.IsDir() {
+		return w.CreateDir(name, fi)
+	}
+	if w.payloads != nil && fi.Mode().IsRegular() {
+		if reused, err := w.reusePayload(name, r, 0, fi); reused || err != nil {
+			return err
+		}
+	}
+	fw, err := w.createFrom(name, fi)
+	if err != nil {
+		return err
+	}
+	chunkSize := uint64(createFromChunkSize)
+	if fs := w.compressionSettings.Flate; w.last.header.Method == Deflate && fs.BlockSize > 0 {
+		chunkSize = uint64(fs.BlockSize)
+		if n < 1 {
+			n = fs.Blocks
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	written, err := copyReaderAt(fw, r, fi.Size(), chunkSize, n)
+	if err != nil {
+		return fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	return checkCreateFromSize(name, written, fi)
+}
+
+func (w *Writer) createFrom(name string, fi os.FileInfo) (io.Writer, error) {
+	fh := &FileHeader{Name: name}
+	if fi != nil {
+		var err error
+		fh, err = FileInfoHeader(fi)
+		if err != nil {
+			return nil, err
+		}
+		fh.Name = name
+	} else {
+		fh.SetMode(0644)
+	}
+	if fh.Mode().IsRegular() {
+		fh.Method = Deflate
+	}
+	fw, err := w.CreateHeader(fh)
+	if err != nil {
+		return nil, fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	return fw, nil
+}
+
+// copyReaderAt writes the first size bytes of r to dst, reading up to n
+// chunks of chunkSize bytes at once, and returns how many it wrote.
+func copyReaderAt(dst io.Writer, r io.ReaderAt, size int64, chunkSize uint64, n int) (int64, error) {
+	type chunk struct {
+		data []byte
+		err  error
+	}
+	pending := make(chan chan chunk, n)
+	done := make(chan struct{})
+	// Don't return while reads are still using r.
+	var reads sync.WaitGroup
+	defer reads.Wait()
+	defer close(done)
+	reads.Add(1)
+	go func() {
+		defer reads.Done()
+		defer close(pending)
+		for off := int64(0); off < size; off += int64(chunkSize) {
+			ch := make(chan chunk, 1)
+			select {
+			case pending <- ch:
+			case <-done:
+				return
+			}
+			reads.Add(1)
+			go func(off int64) {
+				defer reads.Done()
+				buf := make([]byte, min64(chunkSize, uint64(size-off)))
+				m, err := r.ReadAt(buf, off)
+				if err == io.EOF && m == len(buf) {
+					err = nil
+				}
+				ch <- chunk{data: buf[:m], err: err}
+			}(off)
+		}
+	}()
+
+	var written int64
+	for ch := range pending {
+		c := <-ch
+		if c.err != nil {
+			return written, c.err
+		}
+		if _, err := dst.Write(c.data); err != nil {
+			return written, err
+		}
+		written += int64(len(c.data))
+	}
+	return written, nil
+}
+
+func checkCreateFromSize(name string, n int64, fi os.FileInfo) error {
+	if fi != nil && fi.Mode().IsRegular() && n != fi.Size() {
+		return fmt.Errorf("zip: adding %s: read %d bytes, expected %d", name, n, fi.Size())
+	}
+	return nil
+}
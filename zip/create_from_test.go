@@ -0,0 +1,189 @@
+package zip
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreateFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-create-from")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	small := []byte("hello, world\n")
+	large := bytes.Repeat([]byte("0123456789abcdef"), (3*createFromChunkSize+12345)/16)
+	write := func(name string, data []byte, mode os.FileMode) (*os.File, os.FileInfo) {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, data, mode); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f, fi
+	}
+	sf, sfi := write("small", small, 0755)
+	defer sf.Close()
+	lf, lfi := write("large", large, 0644)
+	defer lf.Close()
+	dfi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err := w.CreateFrom("dir/", nil, dfi); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.CreateFrom("dir/small", sf, sfi); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.CreateFrom("dir/piped", strings.NewReader("from a pipe"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 1, 4} {
+		if err := w.CreateFromReaderAt(fmt.Sprintf("dir/large%d", n), lf, lfi, n); err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+	}
+
+	// A source shorter than its FileInfo says must be reported.
+	err = w.CreateFrom("dir/short", bytes.NewReader(small[:3]), sfi)
+	if err == nil || !strings.Contains(err.Error(), "dir/short") {
+		t.Errorf("short source: got error %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"dir/":       nil,
+		"dir/small":  small,
+		"dir/piped":  []byte("from a pipe"),
+		"dir/large0": large,
+		"dir/large1": large,
+		"dir/large4": large,
+	}
+	for _, f := range r.File {
+		body, ok := want[f.Name]
+		if !ok {
+			continue
+		}
+		delete(want, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if !bytes.Equal(got, body) {
+			t.Errorf("%s: got %d bytes, want %d", f.Name, len(got), len(body))
+		}
+		switch f.Name {
+		case "dir/":
+			if !f.Mode().IsDir() {
+				t.Errorf("%s: mode %v, want a directory", f.Name, f.Mode())
+			}
+		case "dir/small":
+			if f.Mode().Perm() != sfi.Mode().Perm() {
+				t.Errorf("%s: mode %v, want %v", f.Name, f.Mode(), sfi.Mode())
+			}
+			if f.Method != Deflate {
+				t.Errorf("%s: method %d, want Deflate", f.Name, f.Method)
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("%s is missing", name)
+	}
+}
+
+// recordingReaderAt records the sizes of the reads made from it.
+type recordingReaderAt struct {
+	r     *bytes.Reader
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	r.sizes = append(r.sizes, len(p))
+	r.mu.Unlock()
+	return r.r.ReadAt(p, off)
+}
+
+func TestCreateFromReaderAtBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-create-from")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 200000)
+	p := filepath.Join(dir, "large")
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	s := DefaultCompressionSettings()
+	s.Flate.BlockSize = 100000
+	if err := w.SetCompressionSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	ra := &recordingReaderAt{r: bytes.NewReader(data)}
+	if err := w.CreateFromReaderAt("large", ra, fi, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (len(data) + s.Flate.BlockSize - 1) / s.Flate.BlockSize; len(ra.sizes) != want {
+		t.Errorf("%d reads, want %d", len(ra.sizes), want)
+	}
+	for _, n := range ra.sizes {
+		if n > s.Flate.BlockSize {
+			t.Errorf("read %d bytes, more than a block", n)
+		}
+	}
+	f := mustNewReader(t, buf.Bytes()).File[0]
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("contents differ")
+	}
+}
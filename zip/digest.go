@@ -0,0 +1,75 @@
+package zip
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// digestPrefix introduces the directory digest at the end of the
+// archive comment, followed by 64 hexadecimal digits.
+const digestPrefix = "arkive-digest sha256:"
+
+// ErrNoDigest is returned by ReadDirectoryDigest for archives written
+// without a directory digest.
+var ErrNoDigest = errors.New("zip: no directory digest")
+
+// SetDirectoryDigest makes Close record a SHA-256 digest of the central
+// directory, which covers every name, size, CRC-32 and offset, so that
+// synchronization tools can tell an archive has not changed by reading
+// its last few hundred bytes (see ReadDirectoryDigest).
+//
+// The digest is appended to the archive comment, on a line of its own,
+// where every reader can skip it. Readers of this package remove it
+// from Reader.Comment.
+func (w *Writer) SetDirectoryDigest(enabled bool) {
+	w.digest = enabled
+}
+
+// digestComment returns the comment to write for a central directory
+// with the given SHA-256 sum.
+func (w *Writer) digestComment(sum []byte) (string, error) {
+	comment := w.comment
+	if comment != "" {
+		comment += "\n"
+	}
+	comment += digestPrefix + hex.EncodeToString(sum)
+	if len(comment) > uint16max {
+		return "", errors.New("zip: comment too long for the directory digest")
+	}
+	return comment, nil
+}
+
+// splitDigest separates the directory digest from the rest of an
+// archive comment. The digest is nil if there is none.
+func splitDigest(comment string) (string, []byte) {
+	i := strings.LastIndex(comment, digestPrefix)
+	if i < 0 || (i > 0 && comment[i-1] != '\n') {
+		return comment, nil
+	}
+	sum, err := hex.DecodeString(comment[i+len(digestPrefix):])
+	if err != nil || len(sum) != 32 {
+		return comment, nil
+	}
+	if i > 0 {
+		i-- // the line break
+	}
+	return comment[:i], sum
+}
+
+// ReadDirectoryDigest returns the central directory digest recorded by a
+// Writer with SetDirectoryDigest in the archive of the given size in r.
+// It only reads the end of the archive. It returns ErrNoDigest if there
+// is none.
+func ReadDirectoryDigest(r io.ReaderAt, size int64) ([]byte, error) {
+	d, err := readDirectoryEnd(r, size)
+	if err != nil {
+		return nil, err
+	}
+	_, sum := splitDigest(d.comment)
+	if sum == nil {
+		return nil, ErrNoDigest
+	}
+	return sum, nil
+}
@@ -0,0 +1,51 @@
+package zip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDirectoryDigest(t *testing.T) {
+	build := func(digest bool, contents string, comment string) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetDirectoryDigest(digest)
+		w.SetComment(comment)
+		fw, err := w.Create("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(contents))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	read := func(b []byte) ([]byte, error) {
+		return ReadDirectoryDigest(bytes.NewReader(b), int64(len(b)))
+	}
+
+	a := build(true, "hello", "")
+	da, err := read(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mustNewReader(t, a)
+	if len(r.File) != 1 || r.File[0].Name != "a.txt" {
+		t.Fatalf("archive with a digest reads as %d entries", len(r.File))
+	}
+
+	withComment := build(true, "hello", "a comment")
+	if d, err := read(withComment); err != nil || !bytes.Equal(d, da) {
+		t.Errorf("comment changed the digest: %x, %v", d, err)
+	}
+	if c := mustNewReader(t, withComment).Comment; c != "a comment" {
+		t.Errorf("Comment = %q, want the digest removed", c)
+	}
+	if d, err := read(build(true, "hellO", "")); err != nil || bytes.Equal(d, da) {
+		t.Errorf("contents did not change the digest: %x, %v", d, err)
+	}
+	if _, err := read(build(false, "hello", "not "+digestPrefix+"really")); err != ErrNoDigest {
+		t.Errorf("no digest: got %v, want ErrNoDigest", err)
+	}
+}
@@ -0,0 +1,123 @@
+package zip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/itchio/kompress/flate"
+)
+
+// A compressed central directory is stored in a private record, where
+// the central directory would start: the signature, the CRC-32 and
+// size of the directory records, the size of the deflated data, and the
+// deflated data. The end of central directory records describe the
+// whole record as the directory.
+const (
+	compressedDirectorySignature = 0x0b064b50 // "PK\x06\x0b"
+	compressedDirectoryLen       = 24         // up to the deflated data
+)
+
+// SetDirectoryCompression makes Close deflate the central directory,
+// which mostly repeats names and shrinks several times, for archives
+// with millions of entries whose directory would otherwise take
+// hundreds of megabytes.
+//
+// Archives written this way can only be read by this package: other
+// tools find no central directory. When disabled, which is the
+// default, a standard central directory is written.
+func (w *Writer) SetDirectoryCompression(enabled bool) {
+	w.compressDirectory = enabled
+}
+
+// directoryCompressor deflates the central directory into memory, as
+// its compressed size must be written before it.
+type directoryCompressor struct {
+	buf  bytes.Buffer
+	fw   *flate.Writer
+	crc  hash.Hash32
+	size uint64
+}
+
+func newDirectoryCompressor() *directoryCompressor {
+	dc := &directoryCompressor{crc: crc32.NewIEEE()}
+	dc.fw, _ = flate.NewWriter(&dc.buf, flate.BestCompression)
+	return dc
+}
+
+func (dc *directoryCompressor) Write(p []byte) (int, error) {
+	dc.crc.Write(p)
+	dc.size += uint64(len(p))
+	return dc.fw.Write(p)
+}
+
+// writeRecord writes the record holding the compressed directory to w.
+func (dc *directoryCompressor) writeRecord(w io.Writer) error {
+	if err := dc.fw.Close(); err != nil {
+		return err
+	}
+	var buf [compressedDirectoryLen]byte
+	b := writeBuf(buf[:])
+	b.uint32(compressedDirectorySignature)
+	b.uint32(dc.crc.Sum32())
+	b.uint64(dc.size)
+	b.uint64(uint64(dc.buf.Len()))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	_, err := dc.buf.WriteTo(w)
+	return err
+}
+
+// maxDirectoryHeaderLen is the largest a central directory record can
+// be, with the longest name, extra field and comment.
+const maxDirectoryHeaderLen = directoryHeaderLen + 3*0xffff
+
+// readCompressedDirectory returns a reader of the decompressed central
+// directory if buf starts with a compressed directory record, and buf
+// itself otherwise. The record must not declare more data than the
+// given number of directory records can take.
+func readCompressedDirectory(buf *bufio.Reader, records uint64) (rd *bufio.Reader, compressed bool, err error) {
+	peek, err := buf.Peek(4)
+	if err != nil || binary.LittleEndian.Uint32(peek) != compressedDirectorySignature {
+		// Let readDirectoryHeader report the problem, if any.
+		return buf, false, nil
+	}
+	var hdr [compressedDirectoryLen]byte
+	if _, err := io.ReadFull(buf, hdr[:]); err != nil {
+		return nil, false, err
+	}
+	b := readBuf(hdr[4:])
+	dr := &directoryChecker{crc: b.uint32(), size: b.uint64(), hash: crc32.NewIEEE()}
+	if dr.size > records*maxDirectoryHeaderLen {
+		return nil, false, ErrFormat
+	}
+	dr.r = flate.NewReader(io.LimitReader(buf, int64(b.uint64())))
+	return bufio.NewReader(dr), true, nil
+}
+
+// directoryChecker checks the size and CRC-32 of a decompressed central
+// directory once it is read to the end.
+type directoryChecker struct {
+	r    io.Reader
+	hash hash.Hash32
+	n    uint64
+	crc  uint32
+	size uint64
+}
+
+func (dr *directoryChecker) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	dr.hash.Write(p[:n])
+	dr.n += uint64(n)
+	if dr.n > dr.size {
+		return n, ErrFormat
+	}
+	if err == io.EOF && (dr.n != dr.size || dr.hash.Sum32() != dr.crc) {
+		err = ErrChecksum
+	}
+	return n, err
+}
@@ -0,0 +1,111 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestDirectoryCompression(t *testing.T) {
+	build := func(compress bool) []byte {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		w.SetDirectoryCompression(compress)
+		w.SetDirectoryDigest(true)
+		w.SetComment("hello")
+		for i := 0; i < 2000; i++ {
+			fw, err := w.CreateHeader(&FileHeader{Name: fmt.Sprintf("assets/textures/level%02d/tile%04d.png", i/100, i), Method: Store})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprint(fw, i)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	plain := build(false)
+	compressed := build(true)
+	plainEnd, err := readDirectoryEnd(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := readDirectoryEnd(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.directorySize*4 > plainEnd.directorySize {
+		t.Errorf("compressed directory takes %d bytes, uncompressed %d", end.directorySize, plainEnd.directorySize)
+	}
+
+	pr := mustNewReader(t, plain)
+	r := mustNewReader(t, compressed)
+	if len(r.File) != len(pr.File) || r.Comment != "hello" {
+		t.Fatalf("got %d entries and comment %q", len(r.File), r.Comment)
+	}
+	for i, f := range r.File {
+		if f.Name != pr.File[i].Name || f.headerOffset != pr.File[i].headerOffset {
+			t.Fatalf("entry %d: got %s at %d, want %s at %d", i, f.Name, f.headerOffset, pr.File[i].Name, pr.File[i].headerOffset)
+		}
+	}
+	if got := string(readFile(t, r.File[1234])); got != "1234" {
+		t.Errorf("read %q", got)
+	}
+
+	// The digest covers the directory records, however they are stored.
+	d1, err := ReadDirectoryDigest(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := ReadDirectoryDigest(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d1, d2) {
+		t.Error("digests differ")
+	}
+
+	// Corrupting the recorded CRC-32 is caught.
+	bad := append([]byte{}, compressed...)
+	bad[end.directoryOffset+4] ^= 0xff
+	if _, err := NewReader(bytes.NewReader(bad), int64(len(bad))); err == nil {
+		t.Error("corrupt directory accepted")
+	}
+}
+
+func TestCompressedDirectoryLimits(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.SetDirectoryCompression(true)
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	end, err := readDirectoryEnd(bytes.NewReader(good), int64(len(good)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A size more than the records can take is rejected up front.
+	bad := append([]byte{}, good...)
+	binary.LittleEndian.PutUint64(bad[end.directoryOffset+8:], 1<<40)
+	if _, err := NewReader(bytes.NewReader(bad), int64(len(bad))); err != ErrFormat {
+		t.Errorf("huge directory size: got %v, want %v", err, ErrFormat)
+	}
+
+	// Records past the count of the end record are not read.
+	bad = append([]byte{}, good...)
+	eocd := bad[len(bad)-directoryEndLen:]
+	binary.LittleEndian.PutUint16(eocd[8:], 2)
+	binary.LittleEndian.PutUint16(eocd[10:], 2)
+	if _, err := NewReader(bytes.NewReader(bad), int64(len(bad))); err != ErrFormat {
+		t.Errorf("extra records: got %v, want %v", err, ErrFormat)
+	}
+}
@@ -0,0 +1,126 @@
+package zip
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// A DuplicatePolicy decides what a Reader does with entries whose names
+// are the same as those of other entries, as buggy exporters write. It
+// is applied to Reader.File as the archive is opened, so Lookup,
+// SelectFiles, listings and extraction all see the same entries.
+type DuplicatePolicy int
+
+const (
+	// KeepDuplicates keeps every entry. Lookup returns the first of
+	// those with a given name. This is the default.
+	KeepDuplicates DuplicatePolicy = iota
+	// FirstDuplicate keeps only the first entry with a given name, in
+	// central directory order.
+	FirstDuplicate
+	// LastDuplicate keeps only the last entry with a given name, which
+	// is what extracting every entry in order leaves on disk.
+	LastDuplicate
+	// RenameDuplicates keeps every entry, appending a counter to the
+	// base name of all but the first with a given name, so the second
+	// "Readme.txt" becomes "Readme (2).txt", like RenameCollisions.
+	RenameDuplicates
+	// RejectDuplicates makes opening the archive fail with a
+	// *NameCollisionError.
+	RejectDuplicates
+)
+
+// applyDuplicatePolicy filters or renames the entries of z.File with
+// the same names according to z.opts.Duplicates.
+func (z *Reader) applyDuplicatePolicy() error {
+	policy := z.opts.Duplicates
+	if policy == KeepDuplicates {
+		return nil
+	}
+	count := make(map[string]int, len(z.File))
+	dup := false
+	for _, f := range z.File {
+		count[f.Name]++
+		if count[f.Name] > 1 {
+			if policy == RejectDuplicates {
+				return &NameCollisionError{Name: f.Name, Existing: f.Name}
+			}
+			dup = true
+		}
+	}
+	if !dup {
+		return nil
+	}
+
+	files := z.File[:0]
+	seen := make(map[string]bool, len(count))
+	for _, f := range z.File {
+		switch policy {
+		case FirstDuplicate:
+			if seen[f.Name] {
+				continue
+			}
+		case LastDuplicate:
+			if count[f.Name]--; count[f.Name] > 0 {
+				continue
+			}
+		case RenameDuplicates:
+			if seen[f.Name] {
+				// count holds every original name, so a new name never
+				// takes that of a later entry.
+				f.Name = uniqueName(f.Name, func(name string) bool {
+					_, taken := count[name]
+					return taken
+				})
+				count[f.Name] = 1
+			}
+		}
+		seen[f.Name] = true
+		files = append(files, f)
+	}
+	for i := len(files); i < len(z.File); i++ {
+		z.File[i] = nil
+	}
+	z.File = files
+	return nil
+}
+
+// uniqueName appends a counter to the base name of name, keeping its
+// extension and trailing slash, until taken reports it is free.
+func uniqueName(name string, taken func(string) bool) string {
+	dir := ""
+	if strings.HasSuffix(name, "/") {
+		dir = "/"
+		name = strings.TrimSuffix(name, "/")
+	}
+	ext := path.Ext(name)
+	if ext == name || strings.HasSuffix(name, "/"+ext) {
+		// dotfiles like ".config" have no extension to preserve
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s%s", stem, i, ext, dir)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// Lookup returns the entry with the given name. If several entries
+// have it, which the Reader's DuplicatePolicy may allow, the first one
+// is returned. Names are indexed on the first call, so renaming or
+// adding entries to z.File afterwards is not seen.
+func (z *Reader) Lookup(name string) (*File, bool) {
+	z.lookupOnce.Do(func() {
+		z.byName = make(map[string]*File, len(z.File))
+		for _, f := range z.File {
+			if _, ok := z.byName[f.Name]; !ok {
+				z.byName[f.Name] = f
+			}
+		}
+	})
+	f, ok := z.byName[name]
+	return f, ok
+}
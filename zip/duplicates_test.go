@@ -0,0 +1,83 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDuplicatePolicy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, e := range []struct{ name, body string }{
+		{"a.txt", "1"},
+		{"b.txt", "2"},
+		{"a.txt", "3"},
+		{"a (2).txt", "4"},
+		{"a.txt", "5"},
+	} {
+		fw, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(e.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy DuplicatePolicy
+		names  []string
+		bodies string
+		lookup string // contents of a.txt through Lookup
+	}{
+		{KeepDuplicates, []string{"a.txt", "b.txt", "a.txt", "a (2).txt", "a.txt"}, "12345", "1"},
+		{FirstDuplicate, []string{"a.txt", "b.txt", "a (2).txt"}, "124", "1"},
+		{LastDuplicate, []string{"b.txt", "a (2).txt", "a.txt"}, "245", "5"},
+		{RenameDuplicates, []string{"a.txt", "b.txt", "a (3).txt", "a (2).txt", "a (4).txt"}, "12345", "1"},
+	}
+	for _, tt := range tests {
+		r, err := NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ReaderOptions{Duplicates: tt.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		var bodies []byte
+		for _, f := range r.File {
+			names = append(names, f.Name)
+			bodies = append(bodies, readFile(t, f)...)
+		}
+		if !reflect.DeepEqual(names, tt.names) || string(bodies) != tt.bodies {
+			t.Errorf("policy %d: got %q with %q, want %q with %q", tt.policy, names, bodies, tt.names, tt.bodies)
+		}
+		f, ok := r.Lookup("a.txt")
+		if !ok {
+			t.Errorf("policy %d: a.txt not found", tt.policy)
+		} else if got := string(readFile(t, f)); got != tt.lookup {
+			t.Errorf("policy %d: Lookup got %q, want %q", tt.policy, got, tt.lookup)
+		}
+		if _, ok := r.Lookup("c.txt"); ok {
+			t.Errorf("policy %d: found c.txt", tt.policy)
+		}
+	}
+
+	_, err := NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ReaderOptions{Duplicates: RejectDuplicates})
+	if ce, ok := err.(*NameCollisionError); !ok || ce.Name != "a.txt" {
+		t.Errorf("RejectDuplicates: got %v", err)
+	}
+}
+
+func readFile(t *testing.T, f *File) []byte {
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
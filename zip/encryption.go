@@ -0,0 +1,139 @@
+package zip
+
+import "fmt"
+
+// An EncryptionFeature is a kind of encryption an archive may use.
+type EncryptionFeature int
+
+const (
+	// TraditionalEncryption is the original PKWARE stream cipher,
+	// also known as ZipCrypto (general purpose flag bit 0).
+	TraditionalEncryption EncryptionFeature = iota + 1
+	// StrongEncryption is PKWARE's strong encryption of entry data
+	// (general purpose flag bit 6).
+	StrongEncryption
+	// AESEncryption is WinZip's AE-1 and AE-2 encryption (method 99).
+	AESEncryption
+	// CentralDirectoryEncryption is PKWARE's encryption of the central
+	// directory, which hides the names and sizes of entries.
+	CentralDirectoryEncryption
+	// EnvelopeEncryption is this package's encryption of entries with
+	// keys of their own, read with an EnvelopeReader.
+	EnvelopeEncryption
+)
+
+func (f EncryptionFeature) String() string {
+	switch f {
+	case TraditionalEncryption:
+		return "traditional encryption"
+	case StrongEncryption:
+		return "strong encryption"
+	case AESEncryption:
+		return "AES encryption"
+	case CentralDirectoryEncryption:
+		return "central directory encryption"
+	case EnvelopeEncryption:
+		return "envelope encryption"
+	}
+	return fmt.Sprintf("encryption feature %d", int(f))
+}
+
+// An EncryptionError is returned when reading data encrypted in a way
+// this package does not support, or without the password it needs.
+type EncryptionError struct {
+	Name    string // entry at fault, empty for the central directory
+	Feature EncryptionFeature
+	AlgID   uint16 // algorithm of strong encryption, if known
+}
+
+func (e *EncryptionError) Error() string {
+	what := e.Feature.String()
+	if e.AlgID != 0 {
+		what += " with " + algName(e.AlgID)
+	}
+	if e.Name == "" {
+		return "zip: archive uses unsupported " + what
+	}
+	return fmt.Sprintf("zip: %s: unsupported %s", e.Name, what)
+}
+
+// Strong encryption algorithm IDs, see APPNOTE.TXT 7.2.3.2.
+const (
+	algDES      = 0x6601
+	algRC2Old   = 0x6602
+	alg3DES168  = 0x6603
+	alg3DES112  = 0x6609
+	algAES128   = 0x660e
+	algAES192   = 0x660f
+	algAES256   = 0x6610
+	algRC2      = 0x6702
+	algRC4      = 0x6801
+	algBlowfish = 0x6720
+	algTwofish  = 0x6721
+
+	zipVersion62 = 62 // 6.2 (central directory encryption)
+
+	// directory64EndV2Len is the length of the fields version 2 of the
+	// zip64 end of central directory record adds to version 1.
+	directory64EndV2Len = 28
+)
+
+func algName(id uint16) string {
+	switch id {
+	case algDES:
+		return "DES"
+	case algRC2Old, algRC2:
+		return "RC2"
+	case alg3DES168:
+		return "3DES-168"
+	case alg3DES112:
+		return "3DES-112"
+	case algAES128:
+		return "AES-128"
+	case algAES192:
+		return "AES-192"
+	case algAES256:
+		return "AES-256"
+	case algRC4:
+		return "RC4"
+	case algBlowfish:
+		return "Blowfish"
+	case algTwofish:
+		return "Twofish"
+	}
+	return fmt.Sprintf("algorithm %#04x", id)
+}
+
+// directoryEncryption holds the fields of version 2 of the zip64 end of
+// central directory record, which describe how the central directory is
+// compressed and encrypted.
+type directoryEncryption struct {
+	method uint16
+	csize  uint64 // compressed size, before encryption
+	usize  uint64
+	algID  uint16
+	bitLen uint16
+}
+
+// directoryEncryptionError returns the error archives whose directory
+// end d says the central directory is encrypted fail with. Decrypting
+// it is not supported: the key derivation of strong encryption could
+// not be checked against archives written by PKZIP.
+func directoryEncryptionError(d *directoryEnd) error {
+	return &EncryptionError{Feature: CentralDirectoryEncryption, AlgID: d.encryption.algID}
+}
+
+// encryptionFeature returns the encryption used by f, if any.
+func (f *File) encryptionFeature() EncryptionFeature {
+	switch {
+	case f.Flags&0x1 == 0:
+		return 0
+	case f.Flags&0x40 != 0:
+		return StrongEncryption
+	case f.Method == AES:
+		return AESEncryption
+	case hasExtra(f.Extra, EnvelopeExtraID):
+		return EnvelopeEncryption
+	}
+	return TraditionalEncryption
+}
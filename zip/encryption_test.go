@@ -0,0 +1,117 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// encryptDirectory rewrites the archive b, which must have no comment
+// and no zip64 records, with the records that say its central directory
+// is deflated and encrypted with AES-128, as PKZIP writes them. The
+// directory itself is only scrambled.
+func encryptDirectory(b []byte, records int) []byte {
+	end := len(b) - directoryEndLen
+	dirOffset := int(binary.LittleEndian.Uint32(b[end+16:]))
+	dir := b[dirOffset:end]
+
+	out := append([]byte(nil), b[:dirOffset]...)
+	for _, c := range dir {
+		out = append(out, ^c)
+	}
+
+	dir64 := len(out)
+	rec := make([]byte, directory64EndLen+directory64EndV2Len+directory64LocLen+directoryEndLen)
+	wb := writeBuf(rec)
+	wb.uint32(directory64EndSignature)
+	wb.uint64(directory64EndLen - 12 + directory64EndV2Len)
+	wb.uint16(zipVersion62)
+	wb.uint16(zipVersion62)
+	wb.uint32(0)
+	wb.uint32(0)
+	wb.uint64(uint64(records))
+	wb.uint64(uint64(records))
+	wb.uint64(uint64(dir64 - dirOffset))
+	wb.uint64(uint64(dirOffset))
+	wb.uint16(Deflate)
+	wb.uint64(uint64(len(dir)))
+	wb.uint64(uint64(len(dir)))
+	wb.uint16(algAES128)
+	wb.uint16(128)
+	wb.uint16(0x0001) // password key
+	wb.uint16(0)      // hash ID
+	wb.uint16(0)      // hash length
+	wb.uint32(directory64LocSignature)
+	wb.uint32(0)
+	wb.uint64(uint64(dir64))
+	wb.uint32(1)
+	wb.uint32(directoryEndSignature)
+	wb.uint16(0)
+	wb.uint16(0)
+	wb.uint16(uint16max)
+	wb.uint16(uint16max)
+	wb.uint32(uint32max)
+	wb.uint32(uint32max)
+	wb.uint16(0)
+	return append(out, rec...)
+}
+
+func TestEncryptedDirectory(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, name := range []string{"secret/plans.txt", "secret/names.txt"} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("contents of " + name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := encryptDirectory(buf.Bytes(), 2)
+
+	_, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if e, ok := err.(*EncryptionError); !ok || e.Feature != CentralDirectoryEncryption || e.AlgID != algAES128 {
+		t.Fatalf("got %v, want an *EncryptionError", err)
+	}
+	if want := "zip: archive uses unsupported central directory encryption with AES-128"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
+
+func TestEncryptedEntries(t *testing.T) {
+	tests := []struct {
+		flags   uint16
+		method  uint16
+		feature EncryptionFeature
+	}{
+		{0x1, Deflate, TraditionalEncryption},
+		{0x41, Deflate, StrongEncryption},
+		{0x1, 99, AESEncryption},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		fh := &FileHeader{Name: "a", Method: tt.method, Flags: tt.flags, CompressedSize64: 4}
+		fw, err := w.CreateRaw(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("junk"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f := mustNewReader(t, buf.Bytes()).File[0]
+		_, err = f.Open()
+		if e, ok := err.(*EncryptionError); !ok || e.Feature != tt.feature || e.Name != "a" {
+			t.Errorf("%v: got %v", tt.feature, err)
+		}
+		if r, err := f.OpenRaw(); err != nil {
+			t.Errorf("%v: OpenRaw: %v", tt.feature, err)
+		} else if raw, _ := ioutil.ReadAll(r); string(raw) != "junk" {
+			t.Errorf("%v: raw contents = %q", tt.feature, raw)
+		}
+	}
+}
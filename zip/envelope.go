@@ -0,0 +1,554 @@
+package zip
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// Envelope encryption encrypts each entry with a random key of its own,
+// and stores that key wrapped for each recipient allowed to read the
+// entry in a key manifest, a JSON entry of the archive. Recipients may
+// differ between entries, so that parts of an archive can be granted to
+// some readers only.
+//
+// Entry data is compressed, then split into chunks of envelopeChunkSize
+// sealed with AES-256-GCM. Chunk nonces hold their index and whether
+// they are the last, so chunks cannot be reordered or dropped. The last
+// chunk is always shorter than envelopeChunkSize, and may be empty.
+// Encrypted entries have general purpose flag bit 0 set, so other tools
+// do not take them for plain ones, and an envelopeExtraID extra field.
+// Their CRC-32 and uncompressed size are those of the plain contents.
+
+// EnvelopeExtraID is the extra field ID marking entries encrypted by an
+// EnvelopeWriter. It sits in the range reserved for third-party
+// vendors, next to MetadataExtraID.
+const EnvelopeExtraID uint16 = 0x6b65 // "ek"
+
+// KeyManifestName is the name of the entry holding the wrapped keys of
+// the entries of an archive written by an EnvelopeWriter.
+const KeyManifestName = ".arkive-keys.json"
+
+const (
+	envelopeVersion   = 1
+	envelopeChunkSize = 64 << 10
+	envelopeKeySize   = 32 // AES-256
+	envelopeOverhead  = 16 // GCM tag
+)
+
+var (
+	// ErrNoKeyManifest is returned by NewEnvelopeReader for archives
+	// without a key manifest.
+	ErrNoKeyManifest = errors.New("zip: archive has no key manifest")
+
+	errEnvelopeAuth = errors.New("zip: envelope encrypted data failed authentication")
+)
+
+// A KeyGrantError is returned when opening an entry encrypted for other
+// recipients than the key of an EnvelopeReader.
+type KeyGrantError struct {
+	Name  string
+	KeyID string
+}
+
+func (e *KeyGrantError) Error() string {
+	return fmt.Sprintf("zip: %s is not encrypted for key %q", e.Name, e.KeyID)
+}
+
+// A KeyWrapper encrypts the keys of entries for a recipient.
+type KeyWrapper interface {
+	// KeyID names the recipient in the key manifest.
+	KeyID() string
+	WrapKey(key []byte) ([]byte, error)
+}
+
+// A KeyUnwrapper decrypts the keys of entries wrapped for a recipient.
+type KeyUnwrapper interface {
+	KeyID() string
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// A MasterKey wraps keys with AES-GCM under a symmetric key.
+type MasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewMasterKey returns a MasterKey named id, for an AES key of 16, 24
+// or 32 bytes.
+func NewMasterKey(id string, key []byte) (*MasterKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &MasterKey{id: id, aead: aead}, nil
+}
+
+func (m *MasterKey) KeyID() string { return m.id }
+
+// WrapKey returns key sealed under a random nonce, which it starts with.
+func (m *MasterKey) WrapKey(key []byte) ([]byte, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return m.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (m *MasterKey) UnwrapKey(wrapped []byte) ([]byte, error) {
+	n := m.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errEnvelopeAuth
+	}
+	key, err := m.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+	if err != nil {
+		return nil, errEnvelopeAuth
+	}
+	return key, nil
+}
+
+// rsaLabel is the OAEP label of keys wrapped for RSA recipients.
+var rsaLabel = []byte("arkive envelope key")
+
+// An RSARecipient wraps keys with RSA-OAEP and SHA-256 for the holder
+// of the private key matching its public key.
+type RSARecipient struct {
+	id  string
+	pub *rsa.PublicKey
+}
+
+// NewRSARecipient returns an RSARecipient named id.
+func NewRSARecipient(id string, pub *rsa.PublicKey) *RSARecipient {
+	return &RSARecipient{id: id, pub: pub}
+}
+
+func (r *RSARecipient) KeyID() string { return r.id }
+
+func (r *RSARecipient) WrapKey(key []byte) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, r.pub, key, rsaLabel)
+}
+
+// An RSAKey unwraps keys wrapped for an RSARecipient with the same ID
+// and its public key.
+type RSAKey struct {
+	id   string
+	priv *rsa.PrivateKey
+}
+
+// NewRSAKey returns an RSAKey named id.
+func NewRSAKey(id string, priv *rsa.PrivateKey) *RSAKey {
+	return &RSAKey{id: id, priv: priv}
+}
+
+func (k *RSAKey) KeyID() string { return k.id }
+
+func (k *RSAKey) UnwrapKey(wrapped []byte) ([]byte, error) {
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, k.priv, wrapped, rsaLabel)
+	if err != nil {
+		return nil, errEnvelopeAuth
+	}
+	return key, nil
+}
+
+// keyManifest is the JSON of the KeyManifestName entry: for each
+// encrypted entry, its key wrapped for each recipient.
+type keyManifest struct {
+	Version int                          `json:"version"`
+	Entries map[string]map[string][]byte `json:"entries"`
+}
+
+// An EnvelopeWriter adds entries encrypted with keys of their own to a
+// Writer, and records their keys, wrapped for their recipients, in a
+// key manifest written by Close. Each entry is compressed and encrypted
+// in memory, then written once closed; entries added to the Writer
+// directly in the meantime come before it.
+type EnvelopeWriter struct {
+	w          *Writer
+	recipients []KeyWrapper
+	manifest   keyManifest
+	last       *envelopeEntry
+	closed     bool
+}
+
+// NewEnvelopeWriter returns an EnvelopeWriter adding entries to w,
+// readable by recipients unless CreateHeader is given others.
+func NewEnvelopeWriter(w *Writer, recipients ...KeyWrapper) *EnvelopeWriter {
+	return &EnvelopeWriter{
+		w:          w,
+		recipients: recipients,
+		manifest:   keyManifest{Version: envelopeVersion, Entries: make(map[string]map[string][]byte)},
+	}
+}
+
+// Create adds an encrypted entry named name, compressed with Deflate,
+// for the default recipients. Like CreateHeader, it holds the whole
+// encrypted entry in memory until it is written.
+func (ew *EnvelopeWriter) Create(name string) (io.WriteCloser, error) {
+	return ew.CreateHeader(&FileHeader{Name: name, Method: Deflate})
+}
+
+// CreateHeader adds an encrypted entry described by fh, readable by
+// recipients, or by the EnvelopeWriter's if none is given. The entry is
+// written to the Writer when the returned WriteCloser is closed, or
+// when the next entry is created; until then, all of its compressed
+// and encrypted contents are held in memory.
+//
+// The CRC-32 of the entry is recorded as zero, as it would tell about
+// the plain contents: GCM authenticates them instead.
+func (ew *EnvelopeWriter) CreateHeader(fh *FileHeader, recipients ...KeyWrapper) (io.WriteCloser, error) {
+	if ew.closed {
+		return nil, errors.New("zip: create in closed EnvelopeWriter")
+	}
+	if err := ew.closeLast(); err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		recipients = ew.recipients
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("zip: envelope entry has no recipients")
+	}
+	if _, dup := ew.manifest.Entries[fh.Name]; dup || fh.Name == KeyManifestName {
+		return nil, &NameCollisionError{Name: fh.Name, Existing: fh.Name}
+	}
+	w := ew.w
+	comp := w.compressor(fh.Method)
+	if comp == nil {
+		return nil, unsupportedMethod(fh.Method, fh.Name)
+	}
+
+	key := make([]byte, envelopeKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped := make(map[string][]byte, len(recipients))
+	for _, r := range recipients {
+		wk, err := r.WrapKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("zip: wrapping the key of %s for %s: %v", fh.Name, r.KeyID(), err)
+		}
+		wrapped[r.KeyID()] = wk
+	}
+
+	w.applyExecutablePatterns(fh)
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
+	fh.ReaderVersion = zipVersion20
+	fh.Flags = fh.Flags&^0x8 | 0x1 // sizes are known when the header is written; encrypted
+	fh.Extra = appendExtra(removeExtra(fh.Extra, EnvelopeExtraID), EnvelopeExtraID, []byte{envelopeVersion})
+	w.encodeModified(fh)
+
+	e := &envelopeEntry{ew: ew, fh: fh, wrapped: wrapped}
+	var err error
+	if e.enc, err = newEnvelopeSealer(&e.buf, key); err != nil {
+		return nil, err
+	}
+	if e.comp, err = comp(w.compressionSettings, e.enc); err != nil {
+		return nil, err
+	}
+	ew.last = e
+	return e, nil
+}
+
+func (ew *EnvelopeWriter) closeLast() error {
+	if ew.last == nil || ew.last.closed {
+		return nil
+	}
+	return ew.last.Close()
+}
+
+// Close writes the last entry and the key manifest. It does not close
+// the Writer.
+func (ew *EnvelopeWriter) Close() error {
+	if ew.closed {
+		return errors.New("zip: EnvelopeWriter closed twice")
+	}
+	if err := ew.closeLast(); err != nil {
+		return err
+	}
+	ew.closed = true
+	data, err := json.Marshal(&ew.manifest)
+	if err != nil {
+		return err
+	}
+	fw, err := ew.w.CreateHeader(&FileHeader{Name: KeyManifestName, Method: Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// envelopeEntry compresses and encrypts an entry into memory.
+type envelopeEntry struct {
+	ew      *EnvelopeWriter
+	fh      *FileHeader
+	comp    io.WriteCloser
+	enc     *envelopeSealer
+	buf     bytes.Buffer
+	n       uint64
+	wrapped map[string][]byte
+	closed  bool
+}
+
+func (e *envelopeEntry) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("zip: write to closed file")
+	}
+	n, err := e.comp.Write(p)
+	e.n += uint64(n)
+	return n, err
+}
+
+func (e *envelopeEntry) Close() error {
+	if e.closed {
+		return errors.New("zip: file closed twice")
+	}
+	e.closed = true
+	if err := e.comp.Close(); err != nil {
+		return err
+	}
+	if err := e.enc.Close(); err != nil {
+		return err
+	}
+	e.fh.CRC32 = 0
+	e.fh.CompressedSize64 = uint64(e.buf.Len())
+	e.fh.UncompressedSize64 = e.n
+	fw, err := e.ew.w.CreateRaw(e.fh)
+	if err != nil {
+		return err
+	}
+	if _, err := e.buf.WriteTo(fw); err != nil {
+		return err
+	}
+	e.ew.manifest.Entries[e.fh.Name] = e.wrapped
+	return nil
+}
+
+// envelopeNonce returns the nonce of chunk i.
+func envelopeNonce(nonce []byte, i uint64, last bool) []byte {
+	binary.BigEndian.PutUint64(nonce, i)
+	binary.BigEndian.PutUint32(nonce[8:], 0)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newEnvelopeAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelopeSealer encrypts what is written to it into w, by chunks.
+type envelopeSealer struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	chunk []byte // plain data of the current chunk
+	out   []byte
+	index uint64
+}
+
+func newEnvelopeSealer(w io.Writer, key []byte) (*envelopeSealer, error) {
+	aead, err := newEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &envelopeSealer{
+		w:     w,
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+		chunk: make([]byte, 0, envelopeChunkSize),
+	}, nil
+}
+
+func (s *envelopeSealer) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(s.chunk) == envelopeChunkSize {
+			// More data follows, so this chunk is not the last.
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(s.chunk[len(s.chunk):envelopeChunkSize], p)
+		s.chunk = s.chunk[:len(s.chunk)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (s *envelopeSealer) seal(last bool) error {
+	s.out = s.aead.Seal(s.out[:0], envelopeNonce(s.nonce, s.index, last), s.chunk, nil)
+	s.index++
+	s.chunk = s.chunk[:0]
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+// Close seals the last chunk, which must be shorter than a full one.
+func (s *envelopeSealer) Close() error {
+	if len(s.chunk) == envelopeChunkSize {
+		if err := s.seal(false); err != nil {
+			return err
+		}
+	}
+	return s.seal(true)
+}
+
+// envelopeOpener decrypts the chunks read from r.
+type envelopeOpener struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	in    []byte
+	plain []byte // decrypted, not yet read
+	index uint64
+	done  bool
+	err   error
+}
+
+func (o *envelopeOpener) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.err != nil {
+			return 0, o.err
+		}
+		if o.done {
+			// Anything after the last chunk was appended.
+			if n, _ := o.r.Read(o.in[:1]); n > 0 {
+				o.err = errEnvelopeAuth
+			} else {
+				o.err = io.EOF
+			}
+			continue
+		}
+		n, err := io.ReadFull(o.r, o.in)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		if err != nil {
+			o.err = err
+			continue
+		}
+		last := n < len(o.in)
+		plain, err := o.aead.Open(o.in[:0], envelopeNonce(o.nonce, o.index, last), o.in[:n], nil)
+		if err != nil {
+			o.err = errEnvelopeAuth
+			continue
+		}
+		o.index++
+		o.plain = plain
+		o.done = last
+	}
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+// An EnvelopeReader opens the entries of an archive written by an
+// EnvelopeWriter that are encrypted for its key.
+type EnvelopeReader struct {
+	z        *Reader
+	key      KeyUnwrapper
+	manifest keyManifest
+}
+
+// NewEnvelopeReader reads the key manifest of z, to open its entries
+// encrypted for key. It fails with ErrNoKeyManifest if z has none.
+func NewEnvelopeReader(z *Reader, key KeyUnwrapper) (*EnvelopeReader, error) {
+	f, ok := z.Lookup(KeyManifestName)
+	if !ok {
+		return nil, ErrNoKeyManifest
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	er := &EnvelopeReader{z: z, key: key}
+	if err := json.Unmarshal(data, &er.manifest); err != nil {
+		return nil, fmt.Errorf("zip: reading the key manifest: %v", err)
+	}
+	if er.manifest.Version != envelopeVersion {
+		return nil, fmt.Errorf("zip: unsupported key manifest version %d", er.manifest.Version)
+	}
+	return er, nil
+}
+
+// Encrypted reports whether f is encrypted by an EnvelopeWriter.
+func Encrypted(f *File) bool {
+	return f.encryptionFeature() == EnvelopeEncryption
+}
+
+// Granted reports whether f is readable with the EnvelopeReader's key:
+// it is not encrypted, or its key is wrapped for it.
+func (er *EnvelopeReader) Granted(f *File) bool {
+	if !Encrypted(f) {
+		return true
+	}
+	_, ok := er.manifest.Entries[f.Name][er.key.KeyID()]
+	return ok
+}
+
+// Open returns a ReadCloser for the contents of f, decrypting them if
+// f is encrypted. Entries encrypted for other recipients fail with a
+// *KeyGrantError. Like File.Open, the size of the contents is
+// verified; data that was tampered with fails to decrypt.
+func (er *EnvelopeReader) Open(f *File) (io.ReadCloser, error) {
+	if !Encrypted(f) {
+		return f.Open()
+	}
+	wrapped, ok := er.manifest.Entries[f.Name][er.key.KeyID()]
+	if !ok {
+		return nil, &KeyGrantError{Name: f.Name, KeyID: er.key.KeyID()}
+	}
+	key, err := er.key.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("zip: unwrapping the key of %s: %v", f.Name, err)
+	}
+	aead, err := newEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	dcomp := er.z.decompressor(f.Method)
+	if dcomp == nil {
+		return nil, unsupportedMethod(f.Method, f.Name)
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	o := &envelopeOpener{
+		r:     raw,
+		aead:  aead,
+		nonce: make([]byte, aead.NonceSize()),
+		in:    make([]byte, envelopeChunkSize+envelopeOverhead),
+	}
+	// Without a CRC-32 to compare with, checksumReader only checks
+	// the size.
+	fc := *f
+	fc.CRC32 = 0
+	return &checksumReader{rc: dcomp(o, &fc), hash: crc32.NewIEEE(), f: &fc}, nil
+}
@@ -0,0 +1,163 @@
+package zip
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	master, err := NewMasterKey("ops", bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partner := NewRSAKey("partner", priv)
+
+	contents := map[string]string{
+		"public.txt":  "not encrypted",
+		"shared.txt":  "for everyone",
+		"secret.bin":  strings.Repeat("only ops ", 20000), // several chunks
+		"empty.txt":   "",
+		"exact.bin":   strings.Repeat("x", envelopeChunkSize),
+		"partner.txt": "for the partner",
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fw, err := w.Create("public.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, contents["public.txt"])
+
+	ew := NewEnvelopeWriter(w, master)
+	for _, e := range []struct {
+		name       string
+		recipients []KeyWrapper
+	}{
+		{"shared.txt", []KeyWrapper{master, NewRSARecipient("partner", &priv.PublicKey)}},
+		{"secret.bin", nil},
+		{"empty.txt", nil},
+		{"exact.bin", nil},
+		{"partner.txt", []KeyWrapper{NewRSARecipient("partner", &priv.PublicKey)}},
+	} {
+		ec, err := ew.CreateHeader(&FileHeader{Name: e.name, Method: Deflate}, e.recipients...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(ec, contents[e.name])
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("only ops")) {
+		t.Fatal("plain contents found in the archive")
+	}
+
+	z := mustNewReader(t, buf.Bytes())
+	for _, f := range z.File {
+		if Encrypted(f) {
+			if _, err := f.Open(); err == nil {
+				t.Errorf("%s: opened without decrypting", f.Name)
+			}
+			if f.CRC32 != 0 {
+				t.Errorf("%s: CRC-32 of the plain contents recorded", f.Name)
+			}
+		}
+	}
+
+	for _, key := range []KeyUnwrapper{master, partner} {
+		er, err := NewEnvelopeReader(z, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range z.File {
+			if f.Name == KeyManifestName {
+				continue
+			}
+			granted := key == master && f.Name != "partner.txt" ||
+				key == partner && (f.Name == "shared.txt" || f.Name == "partner.txt" || f.Name == "public.txt")
+			if got := er.Granted(f); got != granted {
+				t.Errorf("%s: %s: Granted = %v, want %v", key.KeyID(), f.Name, got, granted)
+			}
+			rc, err := er.Open(f)
+			if !granted {
+				if _, ok := err.(*KeyGrantError); !ok {
+					t.Errorf("%s: %s: got %v, want a *KeyGrantError", key.KeyID(), f.Name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %s: %v", key.KeyID(), f.Name, err)
+			}
+			got, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", key.KeyID(), f.Name, err)
+			}
+			if string(got) != contents[f.Name] {
+				t.Errorf("%s: %s: got %d bytes, want %d", key.KeyID(), f.Name, len(got), len(contents[f.Name]))
+			}
+		}
+	}
+}
+
+func TestEnvelopeTampering(t *testing.T) {
+	master, err := NewMasterKey("ops", bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	ew := NewEnvelopeWriter(w, master)
+	ec, err := ew.CreateHeader(&FileHeader{Name: "secret", Method: Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(ec, "attack at dawn")
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	z := mustNewReader(t, b)
+	offset, err := z.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[offset] ^= 1
+	er, err := NewEnvelopeReader(z, master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := er.Open(z.File[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(rc); err != errEnvelopeAuth {
+		t.Errorf("got %v, want %v", err, errEnvelopeAuth)
+	}
+
+	wrong, _ := NewMasterKey("ops", bytes.Repeat([]byte{8}, 32))
+	er, err = NewEnvelopeReader(z, wrong)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := er.Open(z.File[0]); err == nil {
+		t.Error("opened with the wrong master key")
+	}
+}
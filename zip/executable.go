@@ -0,0 +1,70 @@
+package zip
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// IsExecutable reports whether any execute bit is set in the entry's mode.
+// Entries created on MS-DOS or Windows never have one, since those
+// systems do not record it.
+func (h *FileHeader) IsExecutable() bool {
+	return h.Mode()&0111 != 0
+}
+
+// SetExecutable sets or clears the entry's execute bits, keeping the
+// rest of its mode. Execute permission is granted to whoever may read
+// the entry, like chmod +x does. Since only Unix attributes can hold
+// execute bits, headers from other systems are converted to Unix
+// attributes first.
+func (h *FileHeader) SetExecutable(executable bool) {
+	mode := h.Mode()
+	if executable {
+		mode |= (mode & 0444) >> 2
+	} else {
+		mode &^= 0111
+	}
+	h.SetMode(mode)
+}
+
+// MarkExecutable makes the Writer set execute bits on every entry
+// created afterwards whose name matches one of patterns, using the
+// syntax of path.Match. Patterns containing a slash are matched against
+// the full entry name, others against its base name, so "*.sh" matches
+// "bin/run.sh" and "bin/*" matches everything directly under "bin/".
+//
+// This lets archives created on Windows, where file modes carry no
+// execute bit, still launch on Linux and macOS.
+func (w *Writer) MarkExecutable(patterns ...string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return err
+		}
+	}
+	w.executablePatterns = append(w.executablePatterns, patterns...)
+	return nil
+}
+
+func (w *Writer) applyExecutablePatterns(fh *FileHeader) {
+	if len(w.executablePatterns) == 0 || fh.Mode()&(os.ModeDir|os.ModeSymlink) != 0 {
+		return
+	}
+	if matchesAny(w.executablePatterns, fh.Name) {
+		fh.SetExecutable(true)
+	}
+}
+
+func matchesAny(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, p := range patterns {
+		subject := base
+		if strings.Contains(p, "/") {
+			subject = name
+		}
+		if ok, _ := path.Match(p, subject); ok {
+			return true
+		}
+	}
+	return false
+}
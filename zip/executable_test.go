@@ -0,0 +1,83 @@
+package zip
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSetExecutable(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		exec bool
+		want os.FileMode
+	}{
+		{0644, true, 0755},
+		{0600, true, 0700},
+		{0755, false, 0644},
+		{0444 | os.ModeSetuid, true, 0555 | os.ModeSetuid},
+	}
+	for _, tt := range tests {
+		fh := new(FileHeader)
+		fh.SetMode(tt.mode)
+		fh.SetExecutable(tt.exec)
+		if got := fh.Mode(); got != tt.want {
+			t.Errorf("SetExecutable(%v) on %v: got %v, want %v", tt.exec, tt.mode, got, tt.want)
+		}
+		if fh.IsExecutable() != (tt.want&0111 != 0) {
+			t.Errorf("IsExecutable() disagrees with mode %v", tt.want)
+		}
+	}
+
+	// MS-DOS attributes carry no execute bit; setting one converts them.
+	fh := &FileHeader{CreatorVersion: creatorNTFS << 8, ExternalAttrs: msdosReadOnly}
+	if fh.IsExecutable() {
+		t.Error("NTFS entry reported as executable")
+	}
+	fh.SetExecutable(true)
+	if got := fh.Mode(); got != 0555 {
+		t.Errorf("converted NTFS entry mode = %v, want %v", got, os.FileMode(0555))
+	}
+}
+
+func TestWriterMarkExecutable(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err := w.MarkExecutable("["); err == nil {
+		t.Error("MarkExecutable accepted a malformed pattern")
+	}
+	if err := w.MarkExecutable("*.sh", "bin/*"); err != nil {
+		t.Fatal(err)
+	}
+	entries := []struct {
+		name string
+		mode os.FileMode
+		exec bool
+	}{
+		{"start.sh", 0644, true},
+		{"tools/build.sh", 0644, true},
+		{"bin/game", 0644, true},
+		{"bin/", os.ModeDir | 0755, true}, // directories keep their mode
+		{"lib/bin/helper", 0644, false},
+		{"readme.txt", 0644, false},
+	}
+	for _, e := range entries {
+		fh := &FileHeader{Name: e.name}
+		fh.SetMode(e.mode)
+		if _, err := w.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range r.File {
+		if got := f.IsExecutable(); got != entries[i].exec {
+			t.Errorf("%s: IsExecutable() = %v, want %v", f.Name, got, entries[i].exec)
+		}
+	}
+}
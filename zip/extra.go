@@ -0,0 +1,217 @@
+package zip
+
+import (
+	"errors"
+	"sort"
+)
+
+// MetadataExtraID is the extra field ID used by SetMetadata to store
+// application-specific key/value pairs. It sits in the range reserved
+// for third-party vendors and is not known to be used by other tools.
+const MetadataExtraID uint16 = 0x6b61 // "ak"
+
+var errMetadataTooLong = errors.New("zip: metadata does not fit in an extra field")
+
+// extraField is a single record of a FileHeader's Extra.
+type extraField struct {
+	id   uint16
+	data []byte
+}
+
+// parseExtra splits extra into its records. Trailing bytes that do not
+// form a complete record are ignored, like readDirectoryHeader does.
+func parseExtra(extra []byte) []extraField {
+	var fields []extraField
+	for b := readBuf(extra); len(b) >= 4; {
+		id := b.uint16()
+		size := int(b.uint16())
+		if len(b) < size {
+			break
+		}
+		fields = append(fields, extraField{id: id, data: b.sub(size)})
+	}
+	return fields
+}
+
+// findExtra returns the data of the first extra record with the given ID.
+func findExtra(extra []byte, id uint16) ([]byte, bool) {
+	for _, f := range parseExtra(extra) {
+		if f.id == id {
+			return f.data, true
+		}
+	}
+	return nil, false
+}
+
+// removeExtra returns a copy of extra without records with the given ID.
+func removeExtra(extra []byte, id uint16) []byte {
+	var out []byte
+	for _, f := range parseExtra(extra) {
+		if f.id != id {
+			out = appendExtra(out, f.id, f.data)
+		}
+	}
+	return out
+}
+
+// appendExtra appends a record to extra.
+func appendExtra(extra []byte, id uint16, data []byte) []byte {
+	var hdr [4]byte
+	b := writeBuf(hdr[:])
+	b.uint16(id)
+	b.uint16(uint16(len(data)))
+	extra = append(extra, hdr[:]...)
+	return append(extra, data...)
+}
+
+// SetMetadata stores md in the header's Extra, replacing any metadata
+// set earlier, so tools can tag entries (for example "platform" →
+// "linux-x86_64") without abusing comments. Keys are stored in sorted
+// order so that identical metadata always encodes identically.
+// A nil or empty md removes the metadata.
+func (h *FileHeader) SetMetadata(md map[string]string) error {
+	extra := removeExtra(h.Extra, MetadataExtraID)
+	if len(md) == 0 {
+		h.Extra = extra
+		return nil
+	}
+
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var data []byte
+	for _, k := range keys {
+		v := md[k]
+		if len(k) > uint16max || len(v) > uint16max {
+			return errMetadataTooLong
+		}
+		var lbuf [2]byte
+		b := writeBuf(lbuf[:])
+		b.uint16(uint16(len(k)))
+		data = append(data, lbuf[:]...)
+		data = append(data, k...)
+		b = writeBuf(lbuf[:])
+		b.uint16(uint16(len(v)))
+		data = append(data, lbuf[:]...)
+		data = append(data, v...)
+	}
+	if len(data) > uint16max || len(extra)+4+len(data) > uint16max {
+		return errMetadataTooLong
+	}
+	h.Extra = appendExtra(extra, MetadataExtraID, data)
+	return nil
+}
+
+// Metadata returns the key/value pairs stored with SetMetadata.
+// It returns a nil map if the header has none, and ErrFormat if
+// the metadata field is malformed.
+func (h *FileHeader) Metadata() (map[string]string, error) {
+	data, ok := findExtra(h.Extra, MetadataExtraID)
+	if !ok {
+		return nil, nil
+	}
+	md := make(map[string]string)
+	b := readBuf(data)
+	for len(b) > 0 {
+		var kv [2]string
+		for i := range kv {
+			if len(b) < 2 {
+				return nil, ErrFormat
+			}
+			n := int(b.uint16())
+			if len(b) < n {
+				return nil, ErrFormat
+			}
+			kv[i] = string(b.sub(n))
+		}
+		md[kv[0]] = kv[1]
+	}
+	return md, nil
+}
+
+// An ExtraField is a single record of a FileHeader's Extra.
+type ExtraField struct {
+	ID   uint16
+	Data []byte
+}
+
+// ExtraFields returns the records of the header's Extra, in order.
+// Trailing bytes that do not form a complete record are left out. Data
+// shares memory with Extra.
+func (h *FileHeader) ExtraFields() []ExtraField {
+	var fields []ExtraField
+	for _, f := range parseExtra(h.Extra) {
+		fields = append(fields, ExtraField{ID: f.id, Data: f.data})
+	}
+	return fields
+}
+
+// Extra field IDs tied to how an entry's data is stored, as opposed to
+// describing the file it came from.
+const (
+	strongEncryptionExtraID = 0x0017 // PKWARE strong encryption header
+	aesExtraID              = 0x9901 // WinZip AES encryption
+)
+
+// clonedExtra reports whether CloneMetadataFrom may copy extra fields
+// with the given ID verbatim. Zip64 fields and the padding of
+// RenameEntries depend on the layout of the archive, timestamps are
+// written again from Modified by the Writer, and encryption fields
+// only describe the data they were written with.
+func clonedExtra(id uint16) bool {
+	switch id {
+	case zip64ExtraID, extTimeExtraID, ntfsExtraID, paddingExtraID,
+		strongEncryptionExtraID, aesExtraID:
+		return false
+	}
+	return true
+}
+
+// CloneMetadataFrom copies what describes the file behind other to h,
+// for tools that repack, merge or convert archives: its modification
+// time, comment and attributes, and its extra fields for which
+// fieldFilter returns true, or all of them if fieldFilter is nil.
+//
+// Extra fields that the Writer regenerates or that would be wrong for
+// h are never copied: Zip64 fields, as the Writer adds them when sizes
+// or offsets call for it, extended and NTFS timestamps, as it writes
+// them from Modified, and encryption fields, as they belong to the
+// data they were written with. Fields of h with the same IDs as copied
+// ones are replaced; others are kept. The name, sizes, method and
+// CRC-32 of h are left alone.
+func (h *FileHeader) CloneMetadataFrom(other *FileHeader, fieldFilter func(id uint16) bool) error {
+	var copied []extraField
+	ids := make(map[uint16]bool)
+	for _, f := range parseExtra(other.Extra) {
+		if !clonedExtra(f.id) || (fieldFilter != nil && !fieldFilter(f.id)) {
+			continue
+		}
+		copied = append(copied, f)
+		ids[f.id] = true
+	}
+
+	var extra []byte
+	for _, f := range parseExtra(h.Extra) {
+		if !ids[f.id] {
+			extra = appendExtra(extra, f.id, f.data)
+		}
+	}
+	for _, f := range copied {
+		extra = appendExtra(extra, f.id, f.data)
+	}
+	if len(extra) > uint16max {
+		return errLongExtra
+	}
+
+	h.Extra = extra
+	h.Modified = other.Modified
+	h.ModifiedTime = other.ModifiedTime
+	h.ModifiedDate = other.ModifiedDate
+	h.Comment = other.Comment
+	h.CreatorVersion = other.CreatorVersion
+	h.ExternalAttrs = other.ExternalAttrs
+	return nil
+}
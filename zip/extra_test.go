@@ -0,0 +1,130 @@
+package zip
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	md := map[string]string{
+		"platform":   "linux-x86_64",
+		"executable": "true",
+		"empty":      "",
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fh := &FileHeader{Name: "game", Modified: time.Now()}
+	if err := fh.SetMetadata(map[string]string{"stale": "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fh.SetMetadata(md); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CreateHeader(fh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CreateHeader(&FileHeader{Name: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.File[0].Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, md) {
+		t.Errorf("Metadata() = %v, want %v", got, md)
+	}
+	if _, ok := findExtra(r.File[0].Extra, extTimeExtraID); !ok {
+		t.Error("extended timestamp lost next to metadata")
+	}
+	if got, err := r.File[1].Metadata(); got != nil || err != nil {
+		t.Errorf("Metadata() on plain entry = %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestMetadataRemoveAndErrors(t *testing.T) {
+	fh := &FileHeader{Extra: appendExtra(nil, 0xcafe, []byte("keep"))}
+	if err := fh.SetMetadata(map[string]string{"k": "v"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fh.SetMetadata(nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := appendExtra(nil, 0xcafe, []byte("keep")); !bytes.Equal(fh.Extra, want) {
+		t.Errorf("Extra = %x, want %x", fh.Extra, want)
+	}
+
+	if err := fh.SetMetadata(map[string]string{"k": strings.Repeat("x", 70000)}); err != errMetadataTooLong {
+		t.Errorf("SetMetadata with huge value = %v, want errMetadataTooLong", err)
+	}
+
+	fh.Extra = appendExtra(nil, MetadataExtraID, []byte{5, 0, 'a'})
+	if _, err := fh.Metadata(); err != ErrFormat {
+		t.Errorf("Metadata() on malformed field = %v, want ErrFormat", err)
+	}
+}
+
+func TestCloneMetadataFrom(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fh := &FileHeader{Name: "a.sh", Method: Deflate, Comment: "run me"}
+	fh.SetMode(0755)
+	fh.Modified = time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := fh.SetMetadata(map[string]string{"platform": "linux"}); err != nil {
+		t.Fatal(err)
+	}
+	fh.Extra = appendExtra(fh.Extra, 0x7777, []byte("other"))
+	fh.Extra = appendExtra(fh.Extra, aesExtraID, make([]byte, 7))
+	if _, err := w.CreateHeader(fh); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src := &mustNewReader(t, buf.Bytes()).File[0].FileHeader
+
+	dst := &FileHeader{Name: "b.sh"}
+	dst.Extra = appendExtra(nil, MetadataExtraID, []byte("stale"))
+	dst.Extra = appendExtra(dst.Extra, 0x1234, []byte("kept"))
+	if err := dst.CloneMetadataFrom(src, func(id uint16) bool { return id != 0x7777 }); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint16
+	for _, f := range dst.ExtraFields() {
+		ids = append(ids, f.ID)
+	}
+	if want := []uint16{0x1234, MetadataExtraID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("extra field IDs = %#x, want %#x", ids, want)
+	}
+	if md, _ := dst.Metadata(); md["platform"] != "linux" {
+		t.Errorf("metadata = %v", md)
+	}
+	if dst.Name != "b.sh" || dst.Comment != "run me" || dst.Mode() != 0755 || !dst.Modified.Equal(fh.Modified) {
+		t.Errorf("got %s %q %v %v", dst.Name, dst.Comment, dst.Mode(), dst.Modified)
+	}
+
+	// The timestamp is written again from Modified.
+	buf.Reset()
+	w = NewWriter(buf)
+	if _, err := w.CreateHeader(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustNewReader(t, buf.Bytes()).File[0].Modified; !got.Equal(fh.Modified) {
+		t.Errorf("rewritten Modified = %v, want %v", got, fh.Modified)
+	}
+}
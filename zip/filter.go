@@ -0,0 +1,86 @@
+package zip
+
+import (
+	"path"
+	"strings"
+)
+
+// JunkPatterns match files that platforms leave behind in archives and
+// that are never wanted on extraction: macOS resource forks and Finder
+// metadata, Windows thumbnail caches and folder settings, and debug
+// symbols.
+var JunkPatterns = []string{
+	"__MACOSX",
+	".DS_Store",
+	"._*",
+	"Thumbs.db",
+	"desktop.ini",
+	"*.pdb",
+}
+
+// A NameFilter matches entry names against a list of patterns, using
+// the syntax of path.Match. Patterns containing a slash are matched
+// against the full entry name. Others are matched against every
+// component of the name, so that "__MACOSX" matches everything under
+// a "__MACOSX/" directory, wherever it is.
+type NameFilter struct {
+	patterns []string
+}
+
+// NewNameFilter returns a NameFilter matching patterns.
+func NewNameFilter(patterns ...string) (*NameFilter, error) {
+	f := new(NameFilter)
+	if err := f.Add(patterns...); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// JunkFilter returns a NameFilter matching JunkPatterns, which callers
+// can extend with Add.
+func JunkFilter() *NameFilter {
+	return &NameFilter{patterns: append([]string(nil), JunkPatterns...)}
+}
+
+// Add adds patterns to the filter.
+func (f *NameFilter) Add(patterns ...string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return err
+		}
+	}
+	f.patterns = append(f.patterns, patterns...)
+	return nil
+}
+
+// Match reports whether name matches any of the filter's patterns.
+func (f *NameFilter) Match(name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	components := strings.Split(name, "/")
+	for _, p := range f.patterns {
+		if strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+			continue
+		}
+		for _, c := range components {
+			if ok, _ := path.Match(p, c); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterFiles returns the files of the archive whose names do not
+// match skip, in archive order.
+func (z *Reader) FilterFiles(skip *NameFilter) []*File {
+	files := make([]*File, 0, len(z.File))
+	for _, f := range z.File {
+		if !skip.Match(f.Name) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
@@ -0,0 +1,35 @@
+package zip
+
+import "testing"
+
+func TestJunkFilter(t *testing.T) {
+	f := JunkFilter()
+	if err := f.Add("docs/*.tmp"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"game/data.pak", false},
+		{"__MACOSX/", true},
+		{"__MACOSX/game/._data.pak", true},
+		{"game/.DS_Store", true},
+		{"game/._icon.png", true},
+		{"Thumbs.db", true},
+		{"art/desktop.ini", true},
+		{"bin/game.pdb", true},
+		{"bin/game.exe", false},
+		{"docs/notes.tmp", true},
+		{"other/notes.tmp", false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(tt.name); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := NewNameFilter("[unterminated"); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
@@ -0,0 +1,87 @@
+// +build go1.16
+
+package zip
+
+import (
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Open opens the named file of the archive, so that a Reader is an
+// fs.FS. Names are slash-separated and unrooted, following the rules of
+// fs.ValidPath, and directories that are only implied by the names of
+// other entries can be opened too. Directories implement
+// fs.ReadDirFile. Entries whose names are not valid paths, such as
+// "../x", cannot be opened, and only the first of several entries with
+// the same name can.
+func (z *Reader) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	n, ok := z.fsTree()[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.dir {
+		return &fsDir{n: n}, nil
+	}
+	rc, err := n.file.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{ReadCloser: rc, n: n}, nil
+}
+
+func (n *fsNode) info() fs.FileInfo {
+	if n.file == nil {
+		return fsDirInfo{n.name}
+	}
+	return n.file.FileInfo()
+}
+
+// fsDirInfo describes directories without an entry of their own.
+type fsDirInfo struct{ name string }
+
+func (fi fsDirInfo) Name() string       { return fi.name }
+func (fi fsDirInfo) Size() int64        { return 0 }
+func (fi fsDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (fi fsDirInfo) ModTime() time.Time { return time.Time{} }
+func (fi fsDirInfo) IsDir() bool        { return true }
+func (fi fsDirInfo) Sys() interface{}   { return nil }
+
+type fsFile struct {
+	io.ReadCloser
+	n *fsNode
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.n.info(), nil }
+
+type fsDir struct {
+	n      *fsNode
+	offset int // children read so far
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.n.info(), nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.n.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir follows the contract of fs.ReadDirFile.
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.n.children[d.offset:]
+	if count > 0 && len(rest) > count {
+		rest = rest[:count]
+	}
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	entries := make([]fs.DirEntry, len(rest))
+	for i, c := range rest {
+		entries[i] = fs.FileInfoToDirEntry(c.info())
+	}
+	d.offset += len(rest)
+	return entries, nil
+}
@@ -0,0 +1,42 @@
+// +build go1.16
+
+package zip
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReaderFS(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, name := range []string{"a.txt", "dir/", "dir/b.txt", "implied/sub/c.txt", "../escape.txt", "a.txt"} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("contents of " + name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := mustNewReader(t, buf.Bytes())
+
+	if err := fstest.TestFS(r, "a.txt", "dir/b.txt", "implied/sub/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.ReadFile(r, "a.txt")
+	if err != nil || string(b) != "contents of a.txt" {
+		t.Errorf("ReadFile(a.txt) = %q, %v", b, err)
+	}
+	if _, err := r.Open("../escape.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(../escape.txt) = %v, want fs.ErrInvalid", err)
+	}
+	fi, err := fs.Stat(r, "implied")
+	if err != nil || !fi.IsDir() {
+		t.Errorf("Stat(implied) = %v, %v", fi, err)
+	}
+}
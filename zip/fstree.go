@@ -0,0 +1,82 @@
+package zip
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// An fsNode is a file or directory of the tree that Reader.Open serves:
+// an entry of the archive, or a directory only implied by the names of
+// other entries.
+type fsNode struct {
+	name     string // base name, "." for the root
+	file     *File  // nil for implied directories
+	dir      bool
+	children []*fsNode // sorted by name, for directories
+}
+
+// fsTree returns the nodes of the archive by path. It is built on the
+// first call, like the index of Lookup. Entries whose names are not
+// valid fs.FS paths once their trailing slash is removed, such as
+// "../x" or "/x", are left out, and so are duplicates after the first.
+func (z *Reader) fsTree() map[string]*fsNode {
+	z.fsOnce.Do(func() {
+		nodes := map[string]*fsNode{".": {name: ".", dir: true}}
+		var dirNode func(name string) *fsNode
+		dirNode = func(name string) *fsNode {
+			if n, ok := nodes[name]; ok {
+				if !n.dir {
+					return nil
+				}
+				return n
+			}
+			parent := dirNode(path.Dir(name))
+			if parent == nil {
+				return nil
+			}
+			n := &fsNode{name: path.Base(name), dir: true}
+			nodes[name] = n
+			parent.children = append(parent.children, n)
+			return n
+		}
+
+		for _, f := range z.File {
+			name := strings.TrimSuffix(f.Name, "/")
+			if !validFSName(name) {
+				continue
+			}
+			isDir := strings.HasSuffix(f.Name, "/") || f.Mode().IsDir()
+			if n, ok := nodes[name]; ok {
+				if n.file == nil && isDir {
+					n.file = f
+				}
+				continue
+			}
+			parent := dirNode(path.Dir(name))
+			if parent == nil {
+				continue
+			}
+			n := &fsNode{name: path.Base(name), file: f, dir: isDir}
+			nodes[name] = n
+			parent.children = append(parent.children, n)
+		}
+
+		for _, n := range nodes {
+			sort.Slice(n.children, func(i, j int) bool { return n.children[i].name < n.children[j].name })
+		}
+		z.fsNodes = nodes
+	})
+	return z.fsNodes
+}
+
+// validFSName reports whether name is a valid fs.FS path other than ".",
+// as fs.ValidPath would.
+func validFSName(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package zip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// The functions in this file parse or decompress a single structure
+// from a byte slice, so that fuzzers and security tests can exercise
+// the decoding logic without crafting whole archives. Their
+// allocations are bounded by the size of their input, or by an
+// explicit limit.
+
+// ErrLimit is returned by DecompressLimited when the decompressed data
+// is larger than the given limit.
+var ErrLimit = errors.New("zip: decompressed data exceeds limit")
+
+// ParseDirectoryRecord decodes a single central directory record at
+// the start of b, including its extra fields, the way NewReader does.
+// Name and Comment are not converted from legacy encodings, since that
+// is decided for the whole archive at once.
+func ParseDirectoryRecord(b []byte) (*FileHeader, error) {
+	f := new(File)
+	if err := readDirectoryHeader(f, bytes.NewReader(b)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &f.FileHeader, nil
+}
+
+// DecompressLimited decompresses data compressed with the given method,
+// using the decompressors registered at the package level. It returns
+// ErrLimit as soon as more than limit bytes come out, so compression
+// bombs cannot exhaust memory.
+func DecompressLimited(method uint16, compressed []byte, limit int64) ([]byte, error) {
+	dcomp := decompressor(method)
+	if dcomp == nil {
+		return nil, ErrAlgorithm
+	}
+	f := &File{FileHeader: FileHeader{Method: method}}
+	rc := dcomp(bytes.NewReader(compressed), f)
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, ErrLimit
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+//go:build gofuzz
+// +build gofuzz
+
+package zip
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Entry points for go-fuzz (github.com/dvyukov/go-fuzz). Build with
+// go-fuzz-build, then pick one with -func. They return 1 for inputs
+// that parsed, to make the fuzzer prioritize them.
+
+// fuzzLimit bounds how much data a fuzz input may decompress to.
+const fuzzLimit = 1 << 20
+
+// Fuzz parses data as a whole archive and reads every entry.
+func Fuzz(data []byte) int {
+	r, err := NewReaderBytes(data)
+	if err != nil {
+		return 0
+	}
+	for _, f := range r.File {
+		f.Mode()
+		f.Metadata()
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(rc, fuzzLimit))
+		rc.Close()
+	}
+	return 1
+}
+
+// FuzzDirectoryRecord parses data as a central directory record.
+func FuzzDirectoryRecord(data []byte) int {
+	fh, err := ParseDirectoryRecord(data)
+	if err != nil {
+		return 0
+	}
+	fh.Mode()
+	fh.Metadata()
+	return 1
+}
+
+// FuzzInflate decompresses data as a DEFLATE stream.
+func FuzzInflate(data []byte) int {
+	if _, err := DecompressLimited(Deflate, data, fuzzLimit); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,58 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/itchio/kompress/flate"
+)
+
+func TestParseDirectoryRecord(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/zip64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReaderBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := readDirectoryEnd(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := ParseDirectoryRecord(b[end.directoryOffset:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := r.File[0]
+	if fh.Name != want.Name || fh.UncompressedSize64 != want.UncompressedSize64 || !fh.Modified.Equal(want.Modified) {
+		t.Errorf("got %+v, want %+v", fh, want.FileHeader)
+	}
+
+	if _, err := ParseDirectoryRecord(b[end.directoryOffset : end.directoryOffset+directoryHeaderLen]); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated record: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDecompressLimited(t *testing.T) {
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(make([]byte, 1<<20))
+	fw.Close()
+
+	got, err := DecompressLimited(Deflate, buf.Bytes(), 1<<20)
+	if err != nil || len(got) != 1<<20 {
+		t.Errorf("got %d bytes, %v", len(got), err)
+	}
+	if _, err := DecompressLimited(Deflate, buf.Bytes(), 1<<20-1); err != ErrLimit {
+		t.Errorf("got %v, want ErrLimit", err)
+	}
+	if _, err := DecompressLimited(0xbeef, buf.Bytes(), 1<<20); err != ErrAlgorithm {
+		t.Errorf("got %v, want ErrAlgorithm", err)
+	}
+}
@@ -0,0 +1,340 @@
+package zip
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	// ErrIndexFormat is returned when an index cannot be decoded.
+	ErrIndexFormat = errors.New("zip: not a valid index")
+	// ErrStaleIndex is returned when an index was written for a
+	// different version of the archive.
+	ErrStaleIndex = errors.New("zip: index does not match archive")
+	// ErrIndexOptions is returned when an index was written by a
+	// Reader whose options gave it different entries.
+	ErrIndexOptions = errors.New("zip: index was written with different reader options")
+)
+
+const (
+	indexMagic   = "AKZI"
+	indexVersion = 2
+)
+
+// indexOptions are the ReaderOptions that decide the entries of a
+// Reader, which an index records: its entries were read with them, and
+// are only right for Readers using the same.
+type indexOptions struct {
+	quirks      Quirks
+	names       NamePolicy
+	duplicates  DuplicatePolicy
+	fastListing bool
+	location    string
+}
+
+func indexOptionsOf(opts ReaderOptions) indexOptions {
+	o := indexOptions{
+		quirks:      opts.Quirks,
+		names:       opts.Names,
+		duplicates:  opts.Duplicates,
+		fastListing: opts.FastListing,
+	}
+	if opts.Location != nil {
+		o.location = opts.Location.String()
+	}
+	return o
+}
+
+// WriteIndex writes a compact binary index of the archive to w: its
+// entry table along with the offset of each entry's data. Archives
+// opened with NewReaderWithIndex skip parsing the central directory
+// and local headers entirely, which matters for cold-start latency
+// when serving many large archives.
+//
+// WriteIndex reads the local header of every entry to find where its
+// data starts. The index records the options of z that decide its
+// entries, such as Names and Duplicates: it can only be read with the
+// same.
+func (z *Reader) WriteIndex(w io.Writer) error {
+	end, err := readDirectoryEnd(z.r, z.size)
+	if err != nil {
+		return err
+	}
+	e := new(indexEncoder)
+	e.buf = append(e.buf, indexMagic...)
+	e.uint8(indexVersion)
+	o := indexOptionsOf(z.opts)
+	e.uint32(uint32(o.quirks))
+	e.uint8(uint8(o.names))
+	e.uint8(uint8(o.duplicates))
+	e.bool(o.fastListing)
+	e.string(o.location)
+	e.uint64(uint64(z.size))
+	e.uint64(end.directoryOffset)
+	e.uint64(end.directoryRecords)
+	e.string(z.Comment)
+	e.uint64(uint64(len(z.File)))
+	for _, f := range z.File {
+		bodyOffset, err := f.findBodyOffset()
+		if err != nil {
+			return err
+		}
+		modified, err := f.Modified.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.string(f.Name)
+		e.string(f.NameRaw)
+		e.string(f.NameUnicode)
+		e.string(f.Comment)
+		e.string(string(f.Extra))
+		e.string(string(modified))
+		e.bool(f.NonUTF8)
+		e.uint16(f.CreatorVersion)
+		e.uint16(f.ReaderVersion)
+		e.uint16(f.Flags)
+		e.uint16(f.Method)
+		e.uint16(f.ModifiedTime)
+		e.uint16(f.ModifiedDate)
+		e.uint32(f.CRC32)
+		e.uint64(f.CompressedSize64)
+		e.uint64(f.UncompressedSize64)
+		e.uint32(f.ExternalAttrs)
+		e.uint64(uint64(f.headerOffset))
+		e.uint64(uint64(bodyOffset))
+	}
+	_, err = w.Write(e.buf)
+	return err
+}
+
+// NewReaderWithIndex returns a new Reader reading from r, which is
+// assumed to have the given size in bytes, using an index written by
+// WriteIndex instead of the archive's central directory. It returns
+// ErrStaleIndex if the index was written for a different archive, and
+// ErrIndexOptions if it was written by a Reader with options.
+func NewReaderWithIndex(r io.ReaderAt, size int64, index io.Reader) (*Reader, error) {
+	return NewReaderWithIndexOptions(r, size, index, ReaderOptions{})
+}
+
+// NewReaderWithIndexOptions is like NewReaderWithIndex, with the given
+// options. It returns ErrIndexOptions if the index was written by a
+// Reader whose options gave it different entries.
+func NewReaderWithIndexOptions(r io.ReaderAt, size int64, index io.Reader, opts ReaderOptions) (*Reader, error) {
+	zr := &Reader{opts: opts}
+	if err := zr.initWithIndex(r, size, index); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// OpenReaderWithIndex opens the Zip file specified by name like
+// OpenReader, using an index written by WriteIndex.
+func OpenReaderWithIndex(name string, index io.Reader) (*ReadCloser, error) {
+	return OpenReaderWithIndexOptions(name, index, ReaderOptions{})
+}
+
+// OpenReaderWithIndexOptions is like OpenReaderWithIndex, with the
+// given options.
+func OpenReaderWithIndexOptions(name string, index io.Reader, opts ReaderOptions) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := new(ReadCloser)
+	r.opts = opts
+	if err := r.initWithIndex(f, fi.Size(), index); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f = f
+	return r, nil
+}
+
+func (z *Reader) initWithIndex(r io.ReaderAt, size int64, index io.Reader) error {
+	data, err := ioutil.ReadAll(index)
+	if err != nil {
+		return err
+	}
+	d := &indexDecoder{buf: data}
+	if string(d.bytes(len(indexMagic))) != indexMagic || d.uint8() != indexVersion {
+		return ErrIndexFormat
+	}
+	var o indexOptions
+	o.quirks = Quirks(d.uint32())
+	o.names = NamePolicy(d.uint8())
+	o.duplicates = DuplicatePolicy(d.uint8())
+	o.fastListing = d.bool()
+	o.location = d.string()
+	indexSize := int64(d.uint64())
+	directoryOffset := d.uint64()
+	directoryRecords := d.uint64()
+	if d.err != nil {
+		return ErrIndexFormat
+	}
+	if o != indexOptionsOf(z.opts) {
+		return ErrIndexOptions
+	}
+
+	// Checking the end of central directory record is cheap, and
+	// catches most archives that changed since the index was written.
+	if indexSize != size {
+		return ErrStaleIndex
+	}
+	end, err := readDirectoryEnd(r, size)
+	if err != nil {
+		return err
+	}
+	if end.directoryOffset != directoryOffset || end.directoryRecords != directoryRecords {
+		return ErrStaleIndex
+	}
+
+	z.r = r
+	z.size = size
+	z.Comment = d.string()
+	n := d.uint64()
+	if d.err != nil || n > uint64(size)/fileHeaderLen {
+		return ErrIndexFormat
+	}
+	z.File = make([]*File, 0, n)
+	for i := uint64(0); i < n; i++ {
+		f := &File{zip: z, zipr: r, zipsize: size}
+		f.Name = d.string()
+		f.NameRaw = d.string()
+		f.NameUnicode = d.string()
+		f.Comment = d.string()
+		f.Extra = []byte(d.string())
+		modified := d.string()
+		f.NonUTF8 = d.bool()
+		f.CreatorVersion = d.uint16()
+		f.ReaderVersion = d.uint16()
+		f.Flags = d.uint16()
+		f.Method = d.uint16()
+		f.ModifiedTime = d.uint16()
+		f.ModifiedDate = d.uint16()
+		f.CRC32 = d.uint32()
+		f.CompressedSize64 = d.uint64()
+		f.UncompressedSize64 = d.uint64()
+		f.ExternalAttrs = d.uint32()
+		f.headerOffset = int64(d.uint64())
+		f.bodyOffset = int64(d.uint64())
+		if d.err != nil {
+			return ErrIndexFormat
+		}
+		if err := f.Modified.UnmarshalBinary([]byte(modified)); err != nil {
+			return ErrIndexFormat
+		}
+		f.CompressedSize = uint32(min64(f.CompressedSize64, uint32max))
+		f.UncompressedSize = uint32(min64(f.UncompressedSize64, uint32max))
+		z.File = append(z.File, f)
+	}
+	if len(d.buf) != 0 {
+		return ErrIndexFormat
+	}
+	return nil
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type indexEncoder struct {
+	buf []byte
+}
+
+func (e *indexEncoder) uint8(v uint8) { e.buf = append(e.buf, v) }
+
+func (e *indexEncoder) bool(v bool) {
+	var b uint8
+	if v {
+		b = 1
+	}
+	e.uint8(b)
+}
+
+func (e *indexEncoder) uint16(v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *indexEncoder) uint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *indexEncoder) uint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+// string writes s prefixed with its 32-bit length.
+func (e *indexEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// indexDecoder reads values written by indexEncoder. Reading past the
+// end sets err and returns zero values, so callers only need to check
+// err once after a batch of reads.
+type indexDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *indexDecoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.buf) {
+		d.err = ErrIndexFormat
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *indexDecoder) uint8() uint8 {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *indexDecoder) bool() bool { return d.uint8() != 0 }
+
+func (d *indexDecoder) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *indexDecoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *indexDecoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *indexDecoder) string() string {
+	n := d.uint32()
+	return string(d.bytes(int(n)))
+}
@@ -0,0 +1,125 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	contents := map[string]string{
+		"a.txt":     strings.Repeat("alpha ", 100),
+		"dir/b.txt": "bravo",
+	}
+	raw := buildRepairTestZip(t, contents, []string{"a.txt", "dir/b.txt"})
+	r, err := NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index bytes.Buffer
+	if err := r.WriteIndex(&index); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading through the index must not touch the central directory,
+	// so clobber it: only the end record is still checked.
+	end, err := readDirectoryEnd(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clobbered := append([]byte{}, raw...)
+	for i := uint64(0); i < end.directorySize; i++ {
+		clobbered[end.directoryOffset+i] = 0
+	}
+
+	ir, err := NewReaderWithIndex(bytes.NewReader(clobbered), int64(len(clobbered)), bytes.NewReader(index.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ir.File) != len(r.File) {
+		t.Fatalf("got %d files, want %d", len(ir.File), len(r.File))
+	}
+	for i, f := range ir.File {
+		want := r.File[i]
+		if f.Name != want.Name || f.CRC32 != want.CRC32 || f.CompressedSize64 != want.CompressedSize64 ||
+			!f.Modified.Equal(want.Modified) || !reflect.DeepEqual(f.Extra, want.Extra) {
+			t.Errorf("file %d: got %+v, want %+v", i, f.FileHeader, want.FileHeader)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != contents[f.Name] {
+			t.Errorf("%s: got %q", f.Name, b)
+		}
+	}
+
+	other := buildRepairTestZip(t, contents, []string{"dir/b.txt"})
+	if _, err := NewReaderWithIndex(bytes.NewReader(other), int64(len(other)), bytes.NewReader(index.Bytes())); err != ErrStaleIndex {
+		t.Errorf("opening another archive: got %v, want ErrStaleIndex", err)
+	}
+	truncated := index.Bytes()[:index.Len()-3]
+	if _, err := NewReaderWithIndex(bytes.NewReader(raw), int64(len(raw)), bytes.NewReader(truncated)); err != ErrIndexFormat {
+		t.Errorf("truncated index: got %v, want ErrIndexFormat", err)
+	}
+}
+
+func TestIndexOptions(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range []*FileHeader{
+		{Name: "a.txt", Extra: unicodePathExtra("a.txt", "b.txt")},
+		{Name: "b.txt"},
+	} {
+		if _, err := w.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+	opts := ReaderOptions{Names: UnicodePathNames, Duplicates: RenameDuplicates}
+	r, err := NewReaderWithOptions(bytes.NewReader(raw), int64(len(raw)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index bytes.Buffer
+	if err := r.WriteIndex(&index); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReaderWithIndex(bytes.NewReader(raw), int64(len(raw)), bytes.NewReader(index.Bytes())); err != ErrIndexOptions {
+		t.Errorf("without options: got %v, want ErrIndexOptions", err)
+	}
+	other := opts
+	other.Duplicates = FirstDuplicate
+	if _, err := NewReaderWithIndexOptions(bytes.NewReader(raw), int64(len(raw)), bytes.NewReader(index.Bytes()), other); err != ErrIndexOptions {
+		t.Errorf("other duplicate policy: got %v, want ErrIndexOptions", err)
+	}
+
+	ir, err := NewReaderWithIndexOptions(bytes.NewReader(raw), int64(len(raw)), bytes.NewReader(index.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ir.File) != len(r.File) {
+		t.Fatalf("got %d files, want %d", len(ir.File), len(r.File))
+	}
+	for i, f := range ir.File {
+		want := r.File[i]
+		if f.Name != want.Name || f.NameRaw != want.NameRaw || f.NameUnicode != want.NameUnicode {
+			t.Errorf("file %d: got names %q, %q, %q, want %q, %q, %q", i,
+				f.Name, f.NameRaw, f.NameUnicode, want.Name, want.NameRaw, want.NameUnicode)
+		}
+	}
+	if ir.File[0].Name != "b.txt" || ir.File[1].Name != "b (2).txt" {
+		t.Errorf("got names %q and %q", ir.File[0].Name, ir.File[1].Name)
+	}
+}
@@ -0,0 +1,133 @@
+package zip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// An EntryIterator reads the central directory of an archive one record
+// at a time, so that listing or extracting archives with millions of
+// entries does not need all of their headers in memory at once, as
+// Reader.File does.
+//
+// The Files it returns can be opened like those of a Reader. Their
+// names are not converted from legacy encodings, since that is decided
+// for the whole archive at once, and QuirkBrokenZip64 cannot infer
+// values from neighbouring entries: such entries are reported as
+// ErrFormat.
+type EntryIterator struct {
+	z   *Reader
+	end *directoryEnd
+	buf *bufio.Reader
+	n   uint64 // records read so far
+	err error  // sticky error
+
+	// compressed is set for compressed central directories, whose
+	// record count is exact: the iterator stops there, instead of at
+	// the first bad record.
+	compressed bool
+
+	// inferLater is set when Reader.init collects the entries, and
+	// infers what QuirkBrokenZip64 allows once they are all read.
+	inferLater bool
+}
+
+// NewEntryIterator returns an EntryIterator over the entries of r, which
+// is assumed to have the given size in bytes.
+func NewEntryIterator(r io.ReaderAt, size int64, opts ReaderOptions) (*EntryIterator, error) {
+	z := &Reader{opts: opts}
+	return z.iterate(r, size)
+}
+
+// iterate sets up z to read from r, and returns an iterator over its
+// central directory.
+func (z *Reader) iterate(r io.ReaderAt, size int64) (*EntryIterator, error) {
+	end, err := readDirectoryEnd(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return z.iterateEnd(r, size, end)
+}
+
+// iterateEnd is like iterate, with the end of central directory record
+// of r already read.
+func (z *Reader) iterateEnd(r io.ReaderAt, size int64, end *directoryEnd) (*EntryIterator, error) {
+	if end.directoryRecords > uint64(size)/fileHeaderLen {
+		return nil, fmt.Errorf("archive/zip: TOC declares impossible %d files in %d byte zip", end.directoryRecords, size)
+	}
+
+	z.r = r
+	z.size = size
+	z.Comment, _ = splitDigest(end.comment)
+	if end.encryption != nil {
+		return nil, directoryEncryptionError(end)
+	}
+	rs := io.NewSectionReader(r, 0, size)
+	if _, err := rs.Seek(int64(end.directoryOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := bufio.NewReader(rs)
+	if z.opts.Quirks&QuirkArchiveExtraData != 0 {
+		if err := skipArchiveExtraData(buf); err != nil {
+			return nil, err
+		}
+	}
+	buf, compressed, err := readCompressedDirectory(buf, end.directoryRecords)
+	if err != nil {
+		return nil, err
+	}
+	return &EntryIterator{z: z, end: end, buf: buf, compressed: compressed}, nil
+}
+
+// Comment returns the archive comment.
+func (it *EntryIterator) Comment() string {
+	return it.z.Comment
+}
+
+// Next returns the next entry of the central directory. It returns
+// io.EOF after the last one.
+func (it *EntryIterator) Next() (*File, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.compressed && it.n == it.end.directoryRecords {
+		// Only the end of the stream, where its size and CRC-32
+		// are checked, may follow the last record.
+		err := io.EOF
+		if _, rerr := it.buf.ReadByte(); rerr == nil {
+			err = ErrFormat
+		} else if rerr != io.EOF {
+			err = rerr
+		}
+		it.err = err
+		return nil, err
+	}
+	z := it.z
+	f := &File{zip: z, zipr: z.r, zipsize: z.size}
+	err := readDirectoryHeader(f, it.buf)
+	if err == ErrFormat || err == io.ErrUnexpectedEOF {
+		// The count of files inside a zip is truncated to fit in a
+		// uint16. Gloss over this by reading headers until we
+		// encounter a bad one, and then only report an ErrFormat
+		// or UnexpectedEOF if the file count modulo 65536 is
+		// incorrect.
+		if uint16(it.n) == uint16(it.end.directoryRecords) {
+			err = io.EOF
+		}
+		it.err = err
+		return nil, err
+	}
+	if err != nil {
+		it.err = err
+		return nil, err
+	}
+	f.headerOffset += int64(it.end.startSkipLen)
+	z.applyQuirks(f)
+	if f.missing&(missingCSize|missingOffset) != 0 && !it.inferLater {
+		it.err = ErrFormat
+		return nil, ErrFormat
+	}
+	it.n++
+	return f, nil
+}
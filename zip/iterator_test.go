@@ -0,0 +1,64 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEntryIterator(t *testing.T) {
+	b := manyEntriesZip(t, 70000) // more than fits in the 16-bit count
+	it, err := NewEntryIterator(bytes.NewReader(b), int64(len(b)), ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		f, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := r.File[n]; f.Name != want.Name || f.headerOffset != want.headerOffset || !f.Modified.Equal(want.Modified) {
+			t.Fatalf("entry %d: got %q at %d, want %q at %d", n, f.Name, f.headerOffset, want.Name, want.headerOffset)
+		}
+		if n == 0 {
+			if err := readAllFile(f); err != nil {
+				t.Error(err)
+			}
+		}
+		n++
+	}
+	if n != len(r.File) {
+		t.Errorf("got %d entries, want %d", n, len(r.File))
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("Next after the end: %v", err)
+	}
+}
+
+func TestEntryIteratorTruncated(t *testing.T) {
+	b := manyEntriesZip(t, 3)
+	// Claim one more entry than the directory holds.
+	eocd := b[len(b)-directoryEndLen:]
+	eocd[8]++
+	eocd[10]++
+	it, err := NewEntryIterator(bytes.NewReader(b), int64(len(b)), ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := it.Next(); err == nil || err == io.EOF {
+		t.Errorf("got %v, want an error for the missing entry", err)
+	}
+}
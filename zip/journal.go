@@ -0,0 +1,260 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// journalSuffix is appended to the name of a zip file to get the name of
+// the journal of its in-place updates.
+const journalSuffix = ".arkive-journal"
+
+// A journal starts with journalMagic and the original size of the
+// archive, followed by records holding the original contents of the
+// ranges about to be overwritten: offset, length and CRC-32 of the
+// contents, then the contents. A record at offset journalCommitted
+// marks the update as complete.
+var journalMagic = []byte("arkive journal\x00\x01")
+
+const (
+	journalHeaderLen = 16 + 8
+	journalRecordLen = 8 + 4 + 4
+	journalCommitted = ^uint64(0)
+
+	// journalMinSave is the least saved at once, so that sequential
+	// writes, like those of a central directory, only sync the journal
+	// once in a while.
+	journalMinSave = 1 << 20
+)
+
+// A journal is a ReadWriterAt that saves the original contents of the
+// archive to the journal file before each write, so that they can be
+// restored if the update does not complete.
+type journal struct {
+	rw    ReadWriterAt
+	f     *os.File
+	size  int64      // original size of the archive
+	saved [][2]int64 // ranges already in the journal
+}
+
+func beginJournal(name string, rw ReadWriterAt, size int64) (*journal, error) {
+	f, err := os.OpenFile(name+journalSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return nil, ErrJournalExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, journalHeaderLen)
+	copy(hdr, journalMagic)
+	binary.LittleEndian.PutUint64(hdr[16:], uint64(size))
+	if _, err = f.Write(hdr); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	// Make the journal's directory entry durable too. Not every
+	// platform can sync directories, so this is best effort.
+	if d, err := os.Open(filepath.Dir(name)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return &journal{rw: rw, f: f, size: size}, nil
+}
+
+func (j *journal) ReadAt(p []byte, off int64) (int, error) {
+	return j.rw.ReadAt(p, off)
+}
+
+func (j *journal) WriteAt(p []byte, off int64) (int, error) {
+	if err := j.save(off, off+int64(len(p))); err != nil {
+		return 0, err
+	}
+	return j.rw.WriteAt(p, off)
+}
+
+// save records the original contents of the range [start, end) in the
+// journal, and syncs it. Ranges past the original end of the archive are
+// not saved, since restoring truncates the archive anyway.
+func (j *journal) save(start, end int64) error {
+	for _, r := range j.saved {
+		if r[0] <= start && end <= r[1] {
+			return nil
+		}
+	}
+	if end-start < journalMinSave {
+		end = start + journalMinSave
+	}
+	if end > j.size {
+		end = j.size
+	}
+	if start >= end {
+		return nil
+	}
+	rec := make([]byte, journalRecordLen+int(end-start))
+	data := rec[journalRecordLen:]
+	if _, err := j.rw.ReadAt(data, start); err != nil {
+		return err
+	}
+	b := writeBuf(rec)
+	b.uint64(uint64(start))
+	b.uint32(uint32(len(data)))
+	b.uint32(crc32.ChecksumIEEE(data))
+	if _, err := j.f.Write(rec); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.saved = append(j.saved, [2]int64{start, end})
+	return nil
+}
+
+// commit marks the update as complete and removes the journal. The
+// archive must have been synced first.
+func (j *journal) commit() error {
+	rec := make([]byte, journalRecordLen)
+	b := writeBuf(rec)
+	b.uint64(journalCommitted)
+	_, err := j.f.Write(rec)
+	if err == nil {
+		err = j.f.Sync()
+	}
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(j.f.Name())
+}
+
+// ErrJournalExists is returned by in-place updates of a zip file, such
+// as RenameEntriesInFile, when the file already has a journal: another
+// update is in progress, or one was interrupted and RecoverFile must be
+// called first.
+var ErrJournalExists = errors.New("zip: file has an update journal, an update is in progress or needs recovery")
+
+// RecoverFile restores the zip file specified by name as it was before
+// an in-place update, such as RenameEntriesInFile, that was interrupted
+// by a crash, and removes the update's journal. It does nothing if there
+// is no journal, or if the update completed.
+//
+// Nothing tells an interrupted update from one in progress, which
+// RecoverFile would undo and corrupt: it must only be called when no
+// process is updating the file, such as when the application that
+// updates it starts.
+func RecoverFile(name string) error {
+	jname := name + journalSuffix
+	if _, err := os.Stat(jname); os.IsNotExist(err) {
+		return nil
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = rollback(f, jname)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rollback restores f from the journal named jname, unless the journal
+// says the update completed, then removes the journal.
+func rollback(f *os.File, jname string) error {
+	jb, err := ioutil.ReadFile(jname)
+	if err != nil {
+		return err
+	}
+	if len(jb) < journalHeaderLen || !bytes.HasPrefix(jb, journalMagic) {
+		// The header is synced before the archive is first
+		// written to, so the archive is untouched.
+		return os.Remove(jname)
+	}
+	b := readBuf(jb[16:])
+	size := int64(b.uint64())
+
+	type record struct {
+		off  int64
+		data []byte
+	}
+	var records []record
+	for len(b) >= journalRecordLen {
+		off := b.uint64()
+		n := b.uint32()
+		sum := b.uint32()
+		if off == journalCommitted {
+			return os.Remove(jname)
+		}
+		if uint64(len(b)) < uint64(n) {
+			break
+		}
+		data := b.sub(int(n))
+		if crc32.ChecksumIEEE(data) != sum {
+			// A torn record: the write it was saved for never
+			// happened.
+			break
+		}
+		records = append(records, record{int64(off), data})
+	}
+
+	// Restore the oldest contents last, in case ranges overlap.
+	for i := len(records) - 1; i >= 0; i-- {
+		if _, err := f.WriteAt(records[i].data, records[i].off); err != nil {
+			return err
+		}
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return os.Remove(jname)
+}
+
+// updateFile runs update on the zip file specified by name through a
+// journal, then truncates the file to the size update returns. If update
+// fails, the file is restored as it was; if the process dies instead,
+// RecoverFile restores it. Updates fail with ErrJournalExists while
+// there is a journal, rather than racing with another update.
+func updateFile(name string, update func(rw ReadWriterAt, size int64) (int64, error)) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	j, err := beginJournal(name, f, fi.Size())
+	if err != nil {
+		return err
+	}
+	size, err := update(j, fi.Size())
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		j.f.Close()
+		rollback(f, j.f.Name())
+		return err
+	}
+	if err := j.commit(); err != nil {
+		return err
+	}
+	return f.Close()
+}
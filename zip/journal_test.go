@@ -0,0 +1,123 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeJournalTestZip(t *testing.T) (name string, original []byte, cleanup func()) {
+	dir, err := ioutil.TempDir("", "zip-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{"a.txt": "alpha", "b.txt": "bravo"}
+	original = buildRepairTestZip(t, contents, []string{"a.txt", "b.txt"})
+	name = filepath.Join(dir, "test.zip")
+	if err := ioutil.WriteFile(name, original, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return name, original, func() { os.RemoveAll(dir) }
+}
+
+func TestRenameEntriesInFileJournal(t *testing.T) {
+	name, _, cleanup := writeJournalTestZip(t)
+	defer cleanup()
+
+	if err := RenameEntriesInFile(name, map[string]string{"a.txt": "a-much-longer-name.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name + journalSuffix); !os.IsNotExist(err) {
+		t.Errorf("journal left behind: %v", err)
+	}
+	r, err := OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.File[0].Name != "a-much-longer-name.txt" {
+		t.Errorf("got name %q", r.File[0].Name)
+	}
+
+	// A failed update leaves the file as it was.
+	before, _ := ioutil.ReadFile(name)
+	if err := RenameEntriesInFile(name, map[string]string{"nope": "x"}); err == nil {
+		t.Error("renaming a missing entry succeeded")
+	}
+	if after, _ := ioutil.ReadFile(name); !bytes.Equal(before, after) {
+		t.Error("failed update modified the file")
+	}
+}
+
+func TestRecoverFile(t *testing.T) {
+	name, original, cleanup := writeJournalTestZip(t)
+	defer cleanup()
+
+	// Start an update and crash halfway: the central directory is
+	// clobbered and the file extended, and the journal never committed.
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := beginJournal(name, f, int64(len(original)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := readDirectoryEnd(f, int64(len(original)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := bytes.Repeat([]byte{0xaa}, 100)
+	if _, err := j.WriteAt(garbage, int64(end.directoryOffset)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.WriteAt(garbage, int64(len(original))-10); err != nil {
+		t.Fatal(err)
+	}
+	// And the next record was torn.
+	j.f.Write([]byte{1, 2, 3})
+	j.f.Close()
+	f.Close()
+
+	// Opening the file leaves it alone, and updates wait for recovery.
+	r, err := OpenReader(name)
+	if err == nil {
+		r.Close()
+	}
+	if _, err := os.Stat(name + journalSuffix); err != nil {
+		t.Fatalf("opening the file removed the journal: %v", err)
+	}
+	if err := RenameEntriesInFile(name, map[string]string{"a.txt": "c.txt"}); err != ErrJournalExists {
+		t.Fatalf("updating with a journal: err = %v, want ErrJournalExists", err)
+	}
+
+	if err := RecoverFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, original) {
+		t.Error("file not restored")
+	}
+	if _, err := os.Stat(name + journalSuffix); !os.IsNotExist(err) {
+		t.Errorf("journal left behind: %v", err)
+	}
+
+	// A committed journal is only removed.
+	f, _ = os.OpenFile(name, os.O_RDWR, 0)
+	j, err = beginJournal(name, f, int64(len(original)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.WriteAt([]byte("changed"), 0)
+	if err := j.commit(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := RecoverFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(name); !bytes.HasPrefix(got, []byte("changed")) {
+		t.Error("committed update rolled back")
+	}
+}
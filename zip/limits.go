@@ -0,0 +1,212 @@
+package zip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SizeLimits caps how large an archive being written may grow, for
+// example to honor upload caps.
+type SizeLimits struct {
+	// MaxArchiveSize is the largest the archive may get, in bytes,
+	// central directory included. Zero means no limit.
+	MaxArchiveSize int64
+
+	// MaxEntrySize is the largest uncompressed size of a single entry,
+	// in bytes. Zero means no limit.
+	MaxEntrySize int64
+
+	// OnExceeded, if non-nil, is called when a limit is about to be
+	// exceeded. If it returns true, the limit is lifted: for the rest
+	// of the entry for MaxEntrySize, for the rest of the archive for
+	// MaxArchiveSize. Otherwise the entry is dropped, as described in
+	// SetSizeLimits. It may be called from a compressing goroutine.
+	OnExceeded func(err *LimitError) bool
+}
+
+// A LimitError is returned when an entry is dropped for exceeding one of
+// the Writer's SizeLimits.
+type LimitError struct {
+	Name  string // entry being written
+	Entry bool   // whether MaxEntrySize was hit, rather than MaxArchiveSize
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Entry {
+		return fmt.Sprintf("zip: %s is larger than %d bytes", e.Name, e.Max)
+	}
+	return fmt.Sprintf("zip: adding %s would make the archive larger than %d bytes", e.Name, e.Max)
+}
+
+// SetSizeLimits makes the Writer enforce limits on the entries created
+// afterwards. When an entry would exceed a limit, it is dropped: writes
+// to it and creating it fail with a *LimitError, and it is left out of
+// the central directory. The Writer stays usable, so smaller entries may
+// still be added, and Close writes a valid archive holding every
+// complete entry within MaxArchiveSize.
+//
+// Compressed data may be buffered, so an entry can hit MaxArchiveSize
+// only once it is finished. The *LimitError naming it is then returned
+// by the next call to CreateHeader, which must be retried, or by Close,
+// which still writes the archive.
+//
+// If the underlying writer can seek and truncate, as *os.File can, the
+// data already written for a dropped entry is truncated away. Otherwise
+// it stays in the archive as unreferenced bytes.
+func (w *Writer) SetSizeLimits(l SizeLimits) {
+	w.limits = &sizeLimiter{SizeLimits: l, w: w}
+	for _, h := range w.dir {
+		w.limits.dirSize += directoryRecordSize(h.FileHeader)
+	}
+}
+
+type sizeLimiter struct {
+	SizeLimits
+	w *Writer
+
+	// dirSize is the central directory space used by w.dir.
+	dirSize int64
+
+	// Compressors may write from other goroutines.
+	mu  sync.Mutex
+	err *LimitError
+}
+
+// directoryRecordSize is the space h takes in the central directory,
+// counting a zip64 extra it may need.
+func directoryRecordSize(h *FileHeader) int64 {
+	return directoryHeaderLen + int64(len(h.Name)+len(h.Extra)+len(h.Comment)) + 28
+}
+
+// reserve is the space needed to finish the archive once the entry
+// being written is complete.
+func (l *sizeLimiter) reserve() int64 {
+	return dataDescriptor64Len + l.dirSize +
+		directory64EndLen + directory64LocLen + directoryEndLen + int64(len(l.w.comment))
+}
+
+// exceeded reports whether a limit of max is exceeded by size, giving
+// OnExceeded a chance to lift it.
+func (l *sizeLimiter) exceeded(max, size int64, name string, entry bool) *LimitError {
+	if max <= 0 || size <= max {
+		return nil
+	}
+	err := &LimitError{Name: name, Entry: entry, Max: max}
+	if l.OnExceeded != nil && l.OnExceeded(err) {
+		if entry {
+			return nil
+		}
+		l.MaxArchiveSize = 0
+		return nil
+	}
+	return err
+}
+
+// checkHeader is called before h is written. For raw entries, it also
+// checks their data, whose size is known. If h is then written, added
+// must be called.
+func (l *sizeLimiter) checkHeader(h *FileHeader, raw bool) error {
+	if raw {
+		if err := l.exceeded(l.MaxEntrySize, int64(h.UncompressedSize64), h.Name, true); err != nil {
+			return err
+		}
+	}
+	size := l.w.cw.count + fileHeaderLen + int64(len(h.Name)+len(h.Extra)) +
+		l.reserve() + directoryRecordSize(h)
+	if raw {
+		size += int64(h.CompressedSize64)
+	}
+	if err := l.exceeded(l.MaxArchiveSize, size, h.Name, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// added accounts for the directory record of h, once its header is
+// written.
+func (l *sizeLimiter) added(h *FileHeader) {
+	l.dirSize += directoryRecordSize(h)
+}
+
+// failed returns the error that stopped the current entry, if any.
+func (l *sizeLimiter) failed() *LimitError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// drop removes the entry being written from the archive, after it
+// exceeded a limit.
+func (l *sizeLimiter) drop(fw *fileWriter, err *LimitError) {
+	w := l.w
+	fw.closed = true
+	fw.dropped = err
+	l.mu.Lock()
+	l.err = err
+	l.mu.Unlock()
+	if fw.comp != nil {
+		// Stop the compressor; what it still writes is refused.
+		fw.comp.Close()
+	}
+	l.dirSize -= directoryRecordSize(fw.header.FileHeader)
+	if n := len(w.dir); n > 0 && w.dir[n-1] == fw.header {
+		w.dir = w.dir[:n-1]
+	}
+	l.mu.Lock()
+	l.err = nil
+	l.mu.Unlock()
+	w.truncate(int64(fw.header.offset))
+}
+
+// truncate tries to cut the archive back to offset, if the underlying
+// writer allows it.
+func (w *Writer) truncate(offset int64) {
+	type truncater interface {
+		io.Seeker
+		Truncate(size int64) error
+	}
+	t, ok := w.dest.(truncater)
+	if !ok || w.tee != nil {
+		// Tees have been given the data already.
+		return
+	}
+	if err := w.cw.w.(*bufio.Writer).Flush(); err != nil {
+		return
+	}
+	pos, err := t.Seek(offset-w.cw.count, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	if err := t.Truncate(pos); err != nil {
+		// Keep writing where the data ended.
+		t.Seek(w.cw.count-offset, io.SeekCurrent)
+		return
+	}
+	w.stats.addOut(offset - w.cw.count)
+	w.cw.count = offset
+}
+
+// limitedWriter sits between an entry's compressor and the archive,
+// and refuses writes that would exceed MaxArchiveSize.
+type limitedWriter struct {
+	l    *sizeLimiter
+	name string
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	l := lw.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+	size := l.w.cw.count + int64(len(p)) + l.reserve()
+	if err := l.exceeded(l.MaxArchiveSize, size, lw.name, false); err != nil {
+		l.err = err
+		return 0, err
+	}
+	return l.w.cw.Write(p)
+}
@@ -0,0 +1,176 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestSizeLimitsEntry(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.SetSizeLimits(SizeLimits{MaxEntrySize: 100})
+
+	fw, err := w.Create("small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(make([]byte, 100))
+	fw, err = w.Create("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(make([]byte, 60))
+	_, err = fw.Write(make([]byte, 60))
+	if le, ok := err.(*LimitError); !ok || !le.Entry || le.Name != "big" {
+		t.Fatalf("writing past MaxEntrySize: got error %v", err)
+	}
+	if _, err := fw.Write([]byte{0}); err == nil {
+		t.Errorf("write after drop: got error %v", err)
+	}
+	if _, err := w.Create("after"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReaderBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "small" || names[1] != "after" {
+		t.Errorf("got entries %q, want [small after]", names)
+	}
+}
+
+func TestSizeLimitsArchive(t *testing.T) {
+	f, err := ioutil.TempFile("", "zip-limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	const max = 64 << 10
+	w := NewWriter(f)
+	w.SetSizeLimits(SizeLimits{MaxArchiveSize: max})
+
+	// Random data does not compress, so each entry takes ~16KiB.
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 16<<10)
+	var added []string
+	var limitErr *LimitError
+	for i := 0; limitErr == nil && i < 10; i++ {
+		name := string('a' + rune(i))
+		fw, err := w.Create(name)
+		if le, ok := err.(*LimitError); ok {
+			limitErr = le
+			if le.Name != name {
+				// The previous entry hit the limit once flushed.
+				added = added[:len(added)-1]
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng.Read(data)
+		if _, err := fw.Write(data); err != nil {
+			limitErr = err.(*LimitError)
+			break
+		}
+		added = append(added, name)
+	}
+	err = w.Close()
+	if le, ok := err.(*LimitError); ok {
+		// The last entry hit the limit once flushed.
+		limitErr = le
+		added = added[:len(added)-1]
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if limitErr == nil || limitErr.Entry || limitErr.Max != max {
+		t.Fatalf("got limit error %v", limitErr)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > max {
+		t.Errorf("archive is %d bytes, limit was %d", fi.Size(), max)
+	}
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != len(added) || len(added) < 2 {
+		t.Fatalf("got %d entries, want %d", len(r.File), len(added))
+	}
+	for _, zf := range r.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			t.Errorf("%s: %v", zf.Name, err)
+		}
+		rc.Close()
+	}
+	// The dropped entry was truncated away.
+	last := r.File[len(r.File)-1]
+	if end := last.headerOffset + fileHeaderLen + 1 + int64(last.CompressedSize64) + dataDescriptorLen; end != w.dirOffset {
+		t.Errorf("central directory at %d, want %d", w.dirOffset, end)
+	}
+}
+
+func TestSizeLimitsOnExceeded(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	var calls []*LimitError
+	w.SetSizeLimits(SizeLimits{
+		MaxEntrySize: 10,
+		OnExceeded: func(err *LimitError) bool {
+			calls = append(calls, err)
+			return true
+		},
+	})
+	fw, err := w.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := fw.Write(make([]byte, 8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0].Name != "a" {
+		t.Errorf("OnExceeded called with %v, want once for a", calls)
+	}
+}
+
+func TestSizeLimitsFailedCreate(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+	w.SetSizeLimits(SizeLimits{MaxArchiveSize: 1 << 20})
+	if _, err := w.Create("a"); err != nil {
+		t.Fatal(err)
+	}
+	dirSize := w.limits.dirSize
+	if _, err := w.CreateHeader(&FileHeader{Name: "b", Method: 0xfff1}); err == nil {
+		t.Fatal("unsupported method accepted")
+	}
+	if w.limits.dirSize != dirSize {
+		t.Errorf("failed entry takes %d bytes of directory", w.limits.dirSize-dirSize)
+	}
+}
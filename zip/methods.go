@@ -0,0 +1,134 @@
+package zip
+
+import (
+	"fmt"
+	"sort"
+)
+
+// methodNames are the names of the compression methods defined by
+// APPNOTE.TXT, section 4.4.5, and of the ones in common use.
+var methodNames = map[uint16]string{
+	Store:          "Store",
+	Shrink:         "Shrink",
+	Reduce1:        "Reduce-1",
+	Reduce2:        "Reduce-2",
+	Reduce3:        "Reduce-3",
+	Reduce4:        "Reduce-4",
+	Implode:        "Implode",
+	Deflate:        "Deflate",
+	Deflate64:      "Deflate64",
+	DCLImplode:     "PKWARE DCL Implode",
+	BZIP2:          "BZIP2",
+	LZMA:           "LZMA",
+	IBMCMPSC:       "IBM z/OS CMPSC",
+	IBMTERSE:       "IBM TERSE",
+	IBMLZ77:        "IBM LZ77",
+	ZstdDeprecated: "Zstandard (deprecated ID)",
+	Zstd:           "Zstandard",
+	MP3:            "MP3",
+	XZ:             "XZ",
+	JPEG:           "JPEG",
+	WavPack:        "WavPack",
+	PPMd:           "PPMd",
+	AES:            "AE-x encryption",
+}
+
+// MethodName returns the usual name of a compression method, such as
+// "Deflate" for 8, or "method N" for unknown ones. The method need not
+// be registered.
+func MethodName(method uint16) string {
+	if name, ok := methodNames[method]; ok {
+		return name
+	}
+	return fmt.Sprintf("method %d", method)
+}
+
+// An UnsupportedMethodError is returned when reading data compressed
+// with a method that has no decompressor registered, so that programs
+// can tell users which one, as in "this archive uses PPMd compression".
+type UnsupportedMethodError struct {
+	Method uint16
+	Name   string // as returned by MethodName
+	Entry  string // name of the entry, empty for the central directory
+}
+
+func unsupportedMethod(method uint16, entry string) *UnsupportedMethodError {
+	return &UnsupportedMethodError{Method: method, Name: MethodName(method), Entry: entry}
+}
+
+func (e *UnsupportedMethodError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("zip: unsupported compression method %s", e.Name)
+	}
+	return fmt.Sprintf("zip: %s uses unsupported compression method %s", e.Entry, e.Name)
+}
+
+// Is reports whether target is ErrAlgorithm.
+func (e *UnsupportedMethodError) Is(target error) bool {
+	return target == ErrAlgorithm
+}
+
+// A MethodInfo describes a registered compression method.
+type MethodInfo struct {
+	ID   uint16
+	Name string // as returned by MethodName
+
+	Read  bool // a decompressor is registered
+	Write bool // a compressor is registered
+}
+
+// RegisteredMethods returns the methods that have a package-level
+// compressor or decompressor registered, sorted by ID. Methods
+// registered on a single Reader or Writer are not included.
+func RegisteredMethods() []MethodInfo {
+	byID := make(map[uint16]*MethodInfo)
+	info := func(k interface{}) *MethodInfo {
+		id := k.(uint16)
+		if byID[id] == nil {
+			byID[id] = &MethodInfo{ID: id, Name: MethodName(id)}
+		}
+		return byID[id]
+	}
+	decompressors.Range(func(k, v interface{}) bool {
+		info(k).Read = true
+		return true
+	})
+	compressors.Range(func(k, v interface{}) bool {
+		info(k).Write = true
+		return true
+	})
+
+	methods := make([]MethodInfo, 0, len(byID))
+	for _, m := range byID {
+		methods = append(methods, *m)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].ID < methods[j].ID })
+	return methods
+}
+
+// KnownMethods returns every method MethodName knows a name for, plus
+// any other one registered, sorted by ID, with what the package-level
+// registrations can do with each: a capability matrix for tools listing
+// which methods the current build reads and writes.
+func KnownMethods() []MethodInfo {
+	registered := RegisteredMethods()
+	methods := make([]MethodInfo, 0, len(methodNames)+len(registered))
+	for id, name := range methodNames {
+		read, write := SupportsMethod(id)
+		methods = append(methods, MethodInfo{ID: id, Name: name, Read: read, Write: write})
+	}
+	for _, m := range registered {
+		if _, ok := methodNames[m.ID]; !ok {
+			methods = append(methods, m)
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].ID < methods[j].ID })
+	return methods
+}
+
+// SupportsMethod reports whether entries compressed with method can be
+// read and written with the package-level registrations, so tools can
+// tell users up front which archives the current build handles.
+func SupportsMethod(method uint16) (read, write bool) {
+	return decompressor(method) != nil, compressor(method) != nil
+}
@@ -0,0 +1,80 @@
+package zip
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestRegisteredMethods(t *testing.T) {
+	const method = 0xfff0
+	if read, write := SupportsMethod(method); read || write {
+		t.Fatalf("method %d: supported before registration", method)
+	}
+
+	RegisterDecompressor(method, func(r io.Reader, f *File) io.ReadCloser { return ioutil.NopCloser(r) })
+	defer UnregisterDecompressor(method)
+
+	want := []MethodInfo{
+		{ID: Store, Name: "Store", Read: true, Write: true},
+		{ID: Deflate, Name: "Deflate", Read: true, Write: true},
+		{ID: method, Name: "method 65520", Read: true},
+	}
+	if got := RegisteredMethods(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RegisteredMethods() = %+v, want %+v", got, want)
+	}
+	if read, write := SupportsMethod(method); !read || write {
+		t.Errorf("SupportsMethod(%d) = %v, %v, want true, false", method, read, write)
+	}
+
+	UnregisterDecompressor(method)
+	if read, _ := SupportsMethod(method); read {
+		t.Errorf("method %d: still readable after UnregisterDecompressor", method)
+	}
+	if got := MethodName(93); got != "Zstandard" {
+		t.Errorf("MethodName(93) = %q", got)
+	}
+}
+
+func TestKnownMethods(t *testing.T) {
+	const method = 0xfff1
+	RegisterCompressor(method, func(s CompressionSettings, w io.Writer) (io.WriteCloser, error) { return &nopCloser{w}, nil })
+	defer UnregisterCompressor(method)
+
+	methods := KnownMethods()
+	if len(methods) != len(methodNames)+1 {
+		t.Fatalf("got %d methods, want %d", len(methods), len(methodNames)+1)
+	}
+	byID := make(map[uint16]MethodInfo)
+	for i, m := range methods {
+		if i > 0 && m.ID <= methods[i-1].ID {
+			t.Errorf("methods not sorted: %d after %d", m.ID, methods[i-1].ID)
+		}
+		byID[m.ID] = m
+	}
+	for _, want := range []MethodInfo{
+		{ID: Deflate, Name: "Deflate", Read: true, Write: true},
+		{ID: Deflate64, Name: "Deflate64"},
+		{ID: PPMd, Name: "PPMd"},
+		{ID: AES, Name: "AE-x encryption"},
+		{ID: method, Name: "method 65521", Write: true},
+	} {
+		if got := byID[want.ID]; got != want {
+			t.Errorf("method %d: got %+v, want %+v", want.ID, got, want)
+		}
+	}
+}
+
+func TestUnsupportedMethodError(t *testing.T) {
+	err := unsupportedMethod(PPMd, "music.ogg")
+	if err.Name != "PPMd" {
+		t.Errorf("Name = %q, want PPMd", err.Name)
+	}
+	if want := "zip: music.ogg uses unsupported compression method PPMd"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !err.Is(ErrAlgorithm) {
+		t.Error("not ErrAlgorithm")
+	}
+}
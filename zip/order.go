@@ -0,0 +1,96 @@
+package zip
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// An EntryOrder reports whether the entry described by a should be placed
+// before the one described by b.
+//
+// Orders are used both to arrange entries before they are written
+// (see SortHeaders) and to sort the central directory independently
+// of the data (see Writer.SetDirectoryOrder). Putting small, critical
+// files at the front of an archive lets launchers read them while
+// the rest of it is still downloading.
+type EntryOrder func(a, b *FileHeader) bool
+
+// DirectoriesFirst places directory entries before everything else.
+func DirectoriesFirst(a, b *FileHeader) bool {
+	return isDirName(a.Name) && !isDirName(b.Name)
+}
+
+// SmallestFirst places entries with a smaller uncompressed size first.
+// It relies on UncompressedSize64 being set, as FileInfoHeader does.
+func SmallestFirst(a, b *FileHeader) bool {
+	return a.UncompressedSize64 < b.UncompressedSize64
+}
+
+// ByName places entries in lexical order of their names.
+func ByName(a, b *FileHeader) bool {
+	return a.Name < b.Name
+}
+
+// PatternOrder returns an order that places entries whose base name
+// matches patterns[0] first, then those matching patterns[1], and so on.
+// Entries that match no pattern come last. Patterns use the syntax
+// of path.Match.
+func PatternOrder(patterns ...string) EntryOrder {
+	rank := func(fh *FileHeader) int {
+		base := path.Base(fh.Name)
+		for i, p := range patterns {
+			if ok, _ := path.Match(p, base); ok {
+				return i
+			}
+		}
+		return len(patterns)
+	}
+	return func(a, b *FileHeader) bool {
+		return rank(a) < rank(b)
+	}
+}
+
+// Then returns an order that uses o, and falls back to next for entries
+// that o considers equivalent.
+func (o EntryOrder) Then(next EntryOrder) EntryOrder {
+	return func(a, b *FileHeader) bool {
+		switch {
+		case o(a, b):
+			return true
+		case o(b, a):
+			return false
+		}
+		return next(a, b)
+	}
+}
+
+// SortHeaders sorts fhs in place according to order. The sort is stable,
+// so entries that order considers equivalent keep their relative position.
+func SortHeaders(fhs []*FileHeader, order EntryOrder) {
+	sort.SliceStable(fhs, func(i, j int) bool {
+		return order(fhs[i], fhs[j])
+	})
+}
+
+// SetDirectoryOrder makes Close sort the central directory according to
+// order, instead of listing entries in the order they were created.
+// It does not move entry data: the order of calls to Create and
+// CreateHeader still decides where each entry lands in the archive.
+// Passing nil restores the default.
+func (w *Writer) SetDirectoryOrder(order EntryOrder) {
+	w.dirOrder = order
+}
+
+func (w *Writer) sortDirectory() {
+	if w.dirOrder == nil {
+		return
+	}
+	sort.SliceStable(w.dir, func(i, j int) bool {
+		return w.dirOrder(w.dir[i].FileHeader, w.dir[j].FileHeader)
+	})
+}
+
+func isDirName(name string) bool {
+	return strings.HasSuffix(name, "/")
+}
@@ -0,0 +1,60 @@
+package zip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSortHeaders(t *testing.T) {
+	fhs := []*FileHeader{
+		{Name: "data/level1.pak", UncompressedSize64: 1 << 30},
+		{Name: "data/", UncompressedSize64: 0},
+		{Name: "game.json", UncompressedSize64: 200},
+		{Name: "icon.png", UncompressedSize64: 4000},
+		{Name: "readme.txt", UncompressedSize64: 100},
+	}
+	SortHeaders(fhs, EntryOrder(DirectoriesFirst).Then(PatternOrder("*.json", "*.png")).Then(SmallestFirst))
+
+	want := []string{"data/", "game.json", "icon.png", "readme.txt", "data/level1.pak"}
+	for i, fh := range fhs {
+		if fh.Name != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, fh.Name, want[i])
+		}
+	}
+}
+
+func TestWriterDirectoryOrder(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.SetDirectoryOrder(ByName)
+	names := []string{"c.txt", "a.txt", "b.txt"}
+	for _, name := range names {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "b.txt", "c.txt"}
+	for i, f := range r.File {
+		if f.Name != want[i] {
+			t.Errorf("directory entry %d = %q, want %q", i, f.Name, want[i])
+		}
+		testReadFile(t, f, &WriteTest{Name: want[i], Data: []byte(want[i]), Mode: 0666})
+	}
+
+	// Data keeps creation order: c.txt was written first.
+	if r.File[2].headerOffset != 0 {
+		t.Errorf("c.txt local header at %d, want 0", r.File[2].headerOffset)
+	}
+}
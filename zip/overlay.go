@@ -0,0 +1,93 @@
+package zip
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Whiteout entries, in the style of union filesystems, let a layer of
+// an Overlay delete entries from the layers below it. An entry named
+// "dir/.wh.name" hides "dir/name" and, if it is a directory, everything
+// under it. An entry named "dir/.wh..wh..opq" hides everything under
+// "dir/" from lower layers.
+const (
+	WhiteoutPrefix = ".wh."
+	WhiteoutOpaque = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
+// An Overlay is a read-only view of several archives layered on top of
+// each other, such as a base game, a patch and some DLC. Entries from
+// later layers shadow entries with the same name in earlier layers, so
+// the merged tree can be served without extracting it first.
+type Overlay struct {
+	files map[string]*File
+}
+
+// NewOverlay layers readers in order, the last one on top.
+func NewOverlay(layers ...*Reader) *Overlay {
+	o := &Overlay{files: make(map[string]*File)}
+	for _, r := range layers {
+		// Apply the whiteouts of a layer before its entries, so that
+		// a layer can replace a directory it also whites out.
+		for _, f := range r.File {
+			dir, base := path.Split(strings.TrimSuffix(f.Name, "/"))
+			switch {
+			case base == WhiteoutOpaque:
+				o.removeUnder(dir)
+			case strings.HasPrefix(base, WhiteoutPrefix):
+				name := dir + strings.TrimPrefix(base, WhiteoutPrefix)
+				delete(o.files, name)
+				delete(o.files, name+"/")
+				o.removeUnder(name + "/")
+			}
+		}
+		for _, f := range r.File {
+			if !isWhiteout(f.Name) {
+				o.files[f.Name] = f
+			}
+		}
+	}
+	return o
+}
+
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(name), WhiteoutPrefix)
+}
+
+func (o *Overlay) removeUnder(dir string) {
+	for name := range o.files {
+		if strings.HasPrefix(name, dir) && name != dir {
+			delete(o.files, name)
+		}
+	}
+}
+
+// Lookup returns the topmost entry with the given name.
+func (o *Overlay) Lookup(name string) (*File, bool) {
+	f, ok := o.files[name]
+	return f, ok
+}
+
+// Open returns a ReadCloser that provides access to the contents of the
+// topmost entry with the given name. It returns an *os.PathError
+// wrapping os.ErrNotExist if no layer has a visible entry of that name.
+func (o *Overlay) Open(name string) (io.ReadCloser, error) {
+	f, ok := o.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return f.Open()
+}
+
+// Files returns the visible entries of the overlay, sorted by name.
+func (o *Overlay) Files() []*File {
+	files := make([]*File, 0, len(o.files))
+	for _, f := range o.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
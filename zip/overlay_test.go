@@ -0,0 +1,85 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func buildOverlayLayer(t *testing.T, contents map[string]string) *Reader {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for name, body := range contents {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestOverlay(t *testing.T) {
+	base := buildOverlayLayer(t, map[string]string{
+		"game.exe":        "v1",
+		"data/":           "",
+		"data/level1.dat": "level1",
+		"data/level2.dat": "level2",
+		"music/":          "",
+		"music/theme.ogg": "theme",
+		"levels/":         "",
+		"levels/a.lvl":    "a",
+		"readme.txt":      "readme",
+	})
+	patch := buildOverlayLayer(t, map[string]string{
+		"game.exe":           "v2",
+		".wh.readme.txt":     "",
+		"music/.wh..wh..opq": "",
+		"music/remix.ogg":    "remix",
+		".wh.levels":         "",
+	})
+	dlc := buildOverlayLayer(t, map[string]string{
+		"data/level3.dat": "level3",
+	})
+	o := NewOverlay(base, patch, dlc)
+
+	var names []string
+	for _, f := range o.Files() {
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"data/", "data/level1.dat", "data/level2.dat", "data/level3.dat",
+		"game.exe", "music/", "music/remix.ogg",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got files %q, want %q", names, want)
+	}
+
+	rc, err := o.Open("game.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "v2" {
+		t.Errorf("game.exe = %q, want the patched version", b)
+	}
+
+	if _, err := o.Open("readme.txt"); !os.IsNotExist(err) {
+		t.Errorf("opening a whited-out file: got %v, want not exist", err)
+	}
+}
@@ -0,0 +1,202 @@
+package zip
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// A ParallelWriter lets several goroutines add entries to a Writer at
+// once, so packaging loops can be parallelized naively. Each entry is
+// compressed into memory by the goroutine writing it, and written to
+// the archive, in the order entries were created, once it and every
+// entry created before it are closed. The archive is the same whatever
+// order entries are finished in.
+//
+// Entries are held in memory, compressed, until they are written, so
+// very large ones are better added with the Writer itself. Time budgets
+// set with SetTimeBudget do not apply to them. The Writer must not be
+// used directly while the ParallelWriter is.
+type ParallelWriter struct {
+	w *Writer
+
+	mu      sync.Mutex
+	pending []*parallelEntry // created, not written yet, in order
+	err     error            // sticky, from writing to w
+}
+
+// NewParallelWriter returns a ParallelWriter adding entries to w.
+func NewParallelWriter(w *Writer) *ParallelWriter {
+	return &ParallelWriter{w: w}
+}
+
+// Create adds a file to the archive using the provided name, like
+// Writer.Create.
+func (pw *ParallelWriter) Create(name string) (io.WriteCloser, error) {
+	return pw.CreateHeader(&FileHeader{Name: name, Method: Deflate})
+}
+
+// CreateHeader adds a file to the archive using the provided
+// FileHeader, like Writer.CreateHeader, and returns a WriteCloser for
+// its contents. Its Close method finishes the entry; entries created
+// afterwards are held until it is called.
+//
+// The Writer's collision settings, compatibility and size limits are
+// checked here, and MaxEntrySize by writes, so that the call adding an
+// offending entry fails. Only MaxArchiveSize and Zip64 offsets depend
+// on the entries before it: those fail once the entry is written.
+func (pw *ParallelWriter) CreateHeader(fh *FileHeader) (io.WriteCloser, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.err != nil {
+		return nil, pw.err
+	}
+	w := pw.w
+	if w.closed {
+		return nil, errors.New("zip: create in closed writer")
+	}
+	w.applyExecutablePatterns(fh)
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
+	fh.ReaderVersion = zipVersion20
+	fh.Flags &^= 0x8 // sizes are known when the header is written
+	setUTF8Flag(fh)
+	w.encodeModified(fh)
+
+	if err := w.checkCollision(fh); err != nil {
+		return nil, err
+	}
+	if err := w.compat.checkHeader(fh, w.cw.count); err != nil {
+		w.forgetCollision(fh)
+		return nil, err
+	}
+	if w.limits != nil {
+		if err := w.limits.checkHeader(fh, false); err != nil {
+			w.forgetCollision(fh)
+			return nil, err
+		}
+	}
+	comp := w.compressor(fh.Method)
+	if comp == nil {
+		w.forgetCollision(fh)
+		return nil, ErrAlgorithm
+	}
+	e := &parallelEntry{pw: pw, fh: fh, crc: crc32.NewIEEE(), limits: w.limits}
+	var err error
+	e.comp, err = comp(w.compressionSettings, &e.buf)
+	if err != nil {
+		w.forgetCollision(fh)
+		return nil, err
+	}
+	pw.pending = append(pw.pending, e)
+	return e, nil
+}
+
+// Close closes the Writer, once every entry created is closed.
+func (pw *ParallelWriter) Close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(pw.pending) > 0 {
+		return errors.New("zip: closing with entries still being written")
+	}
+	return pw.w.Close()
+}
+
+// flush writes the entries at the front of the queue that are done.
+func (pw *ParallelWriter) flush() error {
+	for len(pw.pending) > 0 && pw.pending[0].done {
+		e := pw.pending[0]
+		pw.pending[0] = nil
+		pw.pending = pw.pending[1:]
+		if pw.err != nil {
+			continue
+		}
+		// The name was recorded by CreateHeader: let CreateRaw record
+		// it again rather than find it taken.
+		pw.w.forgetCollision(e.fh)
+		fw, err := pw.w.CreateRaw(e.fh)
+		if err == nil {
+			_, err = e.buf.WriteTo(fw)
+		}
+		pw.err = err
+	}
+	return pw.err
+}
+
+// A parallelEntry is an entry of a ParallelWriter being compressed.
+type parallelEntry struct {
+	pw     *ParallelWriter
+	fh     *FileHeader
+	buf    bytes.Buffer
+	comp   io.WriteCloser
+	crc    hash.Hash32
+	n      uint64
+	closed bool
+	done   bool // guarded by pw.mu
+
+	limits         *sizeLimiter
+	entryUnlimited bool        // MaxEntrySize was lifted for this entry
+	dropped        *LimitError // why the entry was dropped, if it was
+}
+
+func (e *parallelEntry) Write(p []byte) (int, error) {
+	if e.dropped != nil {
+		return 0, e.dropped
+	}
+	if e.closed {
+		return 0, errors.New("zip: write to closed file")
+	}
+	if l := e.limits; l != nil && !e.entryUnlimited {
+		max := l.MaxEntrySize
+		size := int64(e.n) + int64(len(p))
+		if err := l.exceeded(max, size, e.fh.Name, true); err != nil {
+			e.dropped = err
+			return 0, err
+		}
+		e.entryUnlimited = max > 0 && size > max
+	}
+	e.crc.Write(p)
+	e.n += uint64(len(p))
+	return e.comp.Write(p)
+}
+
+func (e *parallelEntry) Close() error {
+	if e.closed {
+		return errors.New("zip: file closed twice")
+	}
+	e.closed = true
+	err := e.comp.Close()
+	if e.dropped != nil {
+		err = e.dropped
+	}
+	e.fh.CRC32 = e.crc.Sum32()
+	e.fh.CompressedSize64 = uint64(e.buf.Len())
+	e.fh.UncompressedSize64 = e.n
+
+	pw := e.pw
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	e.done = true
+	if err != nil {
+		// Leave the entry out, like a Writer does with entries that
+		// exceed its limits, and let the others through.
+		e.buf.Reset()
+		pw.w.forgetCollision(e.fh)
+		for i, p := range pw.pending {
+			if p == e {
+				pw.pending = append(pw.pending[:i], pw.pending[i+1:]...)
+				break
+			}
+		}
+		if ferr := pw.flush(); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	return pw.flush()
+}
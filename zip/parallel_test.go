@@ -0,0 +1,147 @@
+package zip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParallelWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	pw := NewParallelWriter(NewWriter(buf))
+
+	const n = 32
+	body := func(i int) string { return strings.Repeat(fmt.Sprintf("entry %d ", i), 100*i) }
+	writers := make([]io.WriteCloser, n)
+	for i := range writers {
+		fw, err := pw.Create(fmt.Sprintf("%02d.txt", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers[i] = fw
+	}
+	// Finish entries from many goroutines, the last ones first.
+	var wg sync.WaitGroup
+	for i := n - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := writers[i].Write([]byte(body(i))); err != nil {
+				t.Error(err)
+			}
+			if err := writers[i].Close(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewReader(t, buf.Bytes())
+	if len(r.File) != n {
+		t.Fatalf("got %d entries, want %d", len(r.File), n)
+	}
+	for i, f := range r.File {
+		if want := fmt.Sprintf("%02d.txt", i); f.Name != want {
+			t.Errorf("entry %d is %s, want %s", i, f.Name, want)
+		}
+		if got := string(readFile(t, f)); got != body(i) {
+			t.Errorf("%s: read %d bytes, want %d", f.Name, len(got), len(body(i)))
+		}
+	}
+}
+
+func TestParallelWriterConcurrentCreate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	pw := NewParallelWriter(NewWriter(buf))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				fw, err := pw.Create(fmt.Sprintf("g%d/%d", g, i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				fmt.Fprintf(fw, "%d-%d", g, i)
+				if err := fw.Close(); err != nil {
+					t.Error(err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	fw, err := pw.Create("unfinished")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Close(); err == nil {
+		t.Error("Close succeeded with an entry still open")
+	}
+	fw.Close()
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewReader(t, buf.Bytes())
+	if len(r.File) != 81 {
+		t.Fatalf("got %d entries, want 81", len(r.File))
+	}
+	for _, f := range r.File[:80] {
+		var g, i int
+		fmt.Sscanf(f.Name, "g%d/%d", &g, &i)
+		if got, want := string(readFile(t, f)), fmt.Sprintf("%d-%d", g, i); got != want {
+			t.Errorf("%s: read %q, want %q", f.Name, got, want)
+		}
+	}
+}
+
+func TestParallelWriterChecks(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.SetCollisionSettings(CollisionSettings{Policy: RejectCollisions})
+	w.SetSizeLimits(SizeLimits{MaxEntrySize: 10})
+	pw := NewParallelWriter(w)
+
+	a, err := pw.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pw.Create("a"); err == nil {
+		t.Fatal("colliding name accepted")
+	} else if _, ok := err.(*NameCollisionError); !ok {
+		t.Fatalf("got %v, want a *NameCollisionError", err)
+	}
+	big, err := pw.Create("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := big.Write(make([]byte, 11)); err == nil {
+		t.Fatal("oversized entry accepted")
+	} else if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("got %v, want a *LimitError", err)
+	}
+	if _, ok := big.Close().(*LimitError); !ok {
+		t.Error("closing the oversized entry did not report it")
+	}
+	io.WriteString(a, "hello")
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewReader(t, buf.Bytes())
+	if len(r.File) != 1 || r.File[0].Name != "a" || string(readFile(t, r.File[0])) != "hello" {
+		t.Errorf("got %d entries", len(r.File))
+	}
+}
@@ -0,0 +1,154 @@
+package zip
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// A PayloadKey identifies the contents of a file by their size and
+// CRC-32, which take one pass over the file to compute, much less than
+// compressing it.
+type PayloadKey struct {
+	Size  uint64
+	CRC32 uint32
+}
+
+// A PayloadCache finds compressed payloads with known contents, such as
+// the entries of the archives of earlier builds, for a Writer to copy
+// rather than compress files again. See Writer.SetPayloadCache.
+type PayloadCache interface {
+	// Lookup returns an entry whose contents match key, or nil.
+	Lookup(key PayloadKey) *File
+}
+
+// A PayloadIndex is a PayloadCache over the entries of existing
+// archives.
+type PayloadIndex struct {
+	files map[PayloadKey]*File
+}
+
+// NewPayloadIndex indexes the regular, unencrypted entries of readers.
+// When several have the same contents, the smallest is kept. The
+// readers must stay open as long as the index is used.
+func NewPayloadIndex(readers ...*Reader) *PayloadIndex {
+	p := &PayloadIndex{files: make(map[PayloadKey]*File)}
+	for _, z := range readers {
+		for _, f := range z.File {
+			if !f.Mode().IsRegular() || f.encryptionFeature() != 0 {
+				continue
+			}
+			key := PayloadKey{Size: f.UncompressedSize64, CRC32: f.CRC32}
+			if old := p.files[key]; old == nil || f.CompressedSize64 < old.CompressedSize64 {
+				p.files[key] = f
+			}
+		}
+	}
+	return p
+}
+
+// Lookup returns the indexed entry whose contents match key, or nil.
+func (p *PayloadIndex) Lookup(key PayloadKey) *File {
+	return p.files[key]
+}
+
+// SetPayloadCache makes CreateFromReaderAt, and CreateFrom when its
+// source is an io.ReaderAt and io.Seeker such as an *os.File, look up the size and
+// CRC-32 of regular files in c before compressing them. When c has a
+// Deflate entry with the same contents, its compressed data is copied
+// as is, which makes packaging builds that mostly did not change much
+// faster. A nil cache turns lookups off.
+//
+// Two files of the same size may have the same CRC-32, by chance in
+// large builds or on purpose, so the Writer checks that entries found
+// in c decompress to the file before copying them. That is still much
+// cheaper than compressing the file again.
+func (w *Writer) SetPayloadCache(c PayloadCache) {
+	w.payloads = c
+}
+
+// reusePayload adds the regular file of the given size read from r,
+// starting at off, as a copy of the payload of a cached entry with the
+// same contents, and reports whether it found one.
+func (w *Writer) reusePayload(name string, r io.ReaderAt, off int64, fi os.FileInfo) (bool, error) {
+	size := fi.Size()
+	hash := crc32.NewIEEE()
+	bp := getCopyBuffer(0)
+	n, err := io.CopyBuffer(hash, io.NewSectionReader(r, off, size), *bp)
+	putCopyBuffer(bp)
+	if err != nil {
+		return false, fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	if err := checkCreateFromSize(name, n, fi); err != nil {
+		return false, err
+	}
+	f := w.payloads.Lookup(PayloadKey{Size: uint64(size), CRC32: hash.Sum32()})
+	if f == nil || f.Method != Deflate || f.UncompressedSize64 != uint64(size) ||
+		f.CRC32 != hash.Sum32() || f.encryptionFeature() != 0 {
+		return false, nil
+	}
+	if same, err := sameContents(f, io.NewSectionReader(r, off, size)); err != nil {
+		return false, fmt.Errorf("zip: adding %s: %v", name, err)
+	} else if !same {
+		return false, nil
+	}
+
+	fh, err := FileInfoHeader(fi)
+	if err != nil {
+		return false, err
+	}
+	fh.Name = name
+	fh.Method = f.Method
+	w.applyExecutablePatterns(fh)
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
+	fh.ReaderVersion = zipVersion20
+	w.encodeModified(fh)
+	fh.CRC32 = f.CRC32
+	fh.CompressedSize64 = f.CompressedSize64
+	fh.UncompressedSize64 = f.UncompressedSize64
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return false, fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	fw, err := w.CreateRaw(fh)
+	if err != nil {
+		return false, fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	if _, err := io.Copy(fw, raw); err != nil {
+		return false, fmt.Errorf("zip: adding %s: %v", name, err)
+	}
+	return true, nil
+}
+
+// sameContents reports whether f decompresses to what r holds. Errors
+// reading f, such as a corrupt cached archive, count as a mismatch;
+// errors reading r are returned.
+func sameContents(f *File, r io.Reader) (bool, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return false, nil
+	}
+	defer rc.Close()
+	bp, cp := getCopyBuffer(0), getCopyBuffer(0)
+	defer putCopyBuffer(bp)
+	defer putCopyBuffer(cp)
+	for {
+		n, err := io.ReadFull(r, *bp)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, err
+		}
+		m, cerr := io.ReadFull(rc, (*cp)[:n])
+		if cerr != nil || m != n || !bytes.Equal((*bp)[:n], (*cp)[:m]) {
+			return false, nil
+		}
+		if n < len(*bp) {
+			// Both must end here, checksum included.
+			var b [1]byte
+			_, cerr := io.ReadFull(rc, b[:])
+			return cerr == io.EOF, nil
+		}
+	}
+}
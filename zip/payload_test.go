@@ -0,0 +1,218 @@
+package zip
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayloadCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, contents string) (*os.File, os.FileInfo) {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f, fi
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	words := strings.Fields("the quick brown fox jumps over a lazy dog while game data stays unchanged")
+	var sb strings.Builder
+	for sb.Len() < 100000 {
+		sb.WriteString(words[rng.Intn(len(words))] + " ")
+	}
+	unchanged := sb.String()
+	oldBuf := new(bytes.Buffer)
+	w := NewWriter(oldBuf)
+	for name, contents := range map[string]string{"data.pak": unchanged, "game.exe": "version 1"} {
+		f, fi := write(name, contents)
+		if err := w.CreateFrom(name, f, fi); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	old := mustNewReader(t, oldBuf.Bytes())
+
+	newBuf := new(bytes.Buffer)
+	w = NewWriter(newBuf)
+	s := DefaultCompressionSettings()
+	s.Flate.Level = 1 // so that recompressed data differs
+	if err := w.SetCompressionSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	w.SetPayloadCache(NewPayloadIndex(old))
+	f, fi := write("data.pak", unchanged)
+	if err := w.CreateFromReaderAt("assets/data.pak", f, fi, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	f, fi = write("game.exe", "version 2")
+	if err := w.CreateFrom("game.exe", f, fi); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z := mustNewReader(t, newBuf.Bytes())
+	oldData, _ := old.Lookup("data.pak")
+	for _, f := range z.File {
+		want := unchanged
+		if f.Name == "game.exe" {
+			want = "version 2"
+		}
+		if got := string(readFile(t, f)); got != want {
+			t.Errorf("%s: got %d bytes of contents, want %d", f.Name, len(got), len(want))
+		}
+		if f.Mode().Perm() != 0644 {
+			t.Errorf("%s: mode %v", f.Name, f.Mode())
+		}
+	}
+	if reused := z.File[0]; reused.CompressedSize64 != oldData.CompressedSize64 {
+		t.Errorf("%s: compressed to %d bytes, want the %d of the cached payload",
+			reused.Name, reused.CompressedSize64, oldData.CompressedSize64)
+	}
+}
+
+// forgeCRC32 replaces the last 4 bytes of b so that its CRC-32 is want.
+// CRC-32 is affine in its input, so this solves a linear system.
+func forgeCRC32(b []byte, want uint32) {
+	tail := b[len(b)-4:]
+	for i := range tail {
+		tail[i] = 0
+	}
+	base := crc32.ChecksumIEEE(b)
+	var cols [32]uint32
+	for k := range cols {
+		tail[k/8] = 1 << uint(k%8)
+		cols[k] = crc32.ChecksumIEEE(b) ^ base
+		tail[k/8] = 0
+	}
+	// Gauss-Jordan elimination over GF(2), tracking which input bits
+	// make up each column.
+	var combo [32]uint32
+	for k := range combo {
+		combo[k] = 1 << uint(k)
+	}
+	for bit := uint(0); bit < 32; bit++ {
+		p := int(bit)
+		for p < 32 && cols[p]&(1<<bit) == 0 {
+			p++
+		}
+		cols[bit], cols[p] = cols[p], cols[bit]
+		combo[bit], combo[p] = combo[p], combo[bit]
+		for k := range cols {
+			if k != int(bit) && cols[k]&(1<<bit) != 0 {
+				cols[k] ^= cols[bit]
+				combo[k] ^= combo[bit]
+			}
+		}
+	}
+	var x uint32
+	target := want ^ base
+	for bit := uint(0); bit < 32; bit++ {
+		if target&(1<<bit) != 0 {
+			x ^= combo[bit]
+		}
+	}
+	for k := uint(0); k < 32; k++ {
+		if x&(1<<k) != 0 {
+			tail[k/8] |= 1 << (k % 8)
+		}
+	}
+}
+
+// sizeFileInfo is the FileInfo of a regular file of the given size.
+type sizeFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi sizeFileInfo) Name() string       { return fi.name }
+func (fi sizeFileInfo) Size() int64        { return fi.size }
+func (fi sizeFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi sizeFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi sizeFileInfo) IsDir() bool        { return false }
+func (fi sizeFileInfo) Sys() interface{}   { return nil }
+
+func TestPayloadCacheCollision(t *testing.T) {
+	original := []byte(strings.Repeat("original payload ", 1000))
+	oldBuf := new(bytes.Buffer)
+	w := NewWriter(oldBuf)
+	fw, err := w.Create("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(original)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	old := mustNewReader(t, oldBuf.Bytes())
+
+	// Same size and CRC-32, different contents.
+	forged := []byte(strings.Repeat("replaced payload ", 1000))
+	forgeCRC32(forged, crc32.ChecksumIEEE(original))
+	if crc32.ChecksumIEEE(forged) != crc32.ChecksumIEEE(original) {
+		t.Fatal("could not forge the CRC-32")
+	}
+
+	newBuf := new(bytes.Buffer)
+	w = NewWriter(newBuf)
+	s := DefaultCompressionSettings()
+	s.Flate.Level = 1
+	if err := w.SetCompressionSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	w.SetPayloadCache(NewPayloadIndex(old))
+	// Sources positioned past their start are read from there.
+	for _, src := range []struct {
+		name string
+		data []byte
+	}{{"forged.bin", forged}, {"same.bin", original}} {
+		r := bytes.NewReader(append([]byte("junk"), src.data...))
+		r.Seek(4, io.SeekStart)
+		if err := w.CreateFrom(src.name, r, sizeFileInfo{src.name, int64(len(src.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if r.Len() != 0 {
+			t.Errorf("%s: %d bytes of the source left", src.name, r.Len())
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z := mustNewReader(t, newBuf.Bytes())
+	if got := readFile(t, z.File[0]); !bytes.Equal(got, forged) {
+		t.Error("colliding payload reused")
+	}
+	if got := readFile(t, z.File[1]); !bytes.Equal(got, original) {
+		t.Error("same.bin has the wrong contents")
+	}
+	if z.File[1].CompressedSize64 != old.File[0].CompressedSize64 {
+		t.Error("same.bin was not reused")
+	}
+}
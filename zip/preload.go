@@ -0,0 +1,114 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+)
+
+// A preloadedFile holds the contents of an entry read ahead by Preload.
+type preloadedFile struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// Preload starts reading the first n entries of the archive, in central
+// directory order, into memory in the background, so that opening them
+// right afterwards does not wait for decompression. UIs showing a
+// just-downloaded archive typically need its manifests, icons and
+// metadata files at once.
+//
+// Open returns preloaded contents the first time an entry is opened,
+// waiting for them if needed, then releases them: later opens read the
+// archive again. Entries that fail to preload are opened as usual, so
+// errors are reported by Open.
+func (z *Reader) Preload(n int) {
+	z.PreloadFunc(n, nil)
+}
+
+// PreloadFunc is like Preload for the first n entries for which match
+// returns true, such as the ones most likely needed first. A nil match
+// selects every entry.
+func (z *Reader) PreloadFunc(n int, match func(f *File) bool) {
+	var files []*File
+	for _, f := range z.File {
+		if len(files) == n {
+			break
+		}
+		if match != nil && !match(f) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	z.preloadMu.Lock()
+	if z.preloaded == nil {
+		z.preloaded = make(map[*File]*preloadedFile)
+	}
+	jobs := make(map[*File]*preloadedFile)
+	for _, f := range files {
+		if _, ok := z.preloaded[f]; ok {
+			continue
+		}
+		p := &preloadedFile{done: make(chan struct{})}
+		z.preloaded[f] = p
+		jobs[f] = p
+	}
+	z.preloadMu.Unlock()
+
+	type job struct {
+		f *File
+		p *preloadedFile
+	}
+	work := make(chan job, len(jobs))
+	for _, f := range files {
+		if p, ok := jobs[f]; ok {
+			work <- job{f, p}
+		}
+	}
+	close(work)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range work {
+				j.p.load(j.f)
+			}
+		}()
+	}
+}
+
+func (p *preloadedFile) load(f *File) {
+	defer close(p.done)
+
+	rc, err := f.OpenWithDecompressor(nil)
+	if err != nil {
+		p.err = err
+		return
+	}
+	defer rc.Close()
+	p.data, p.err = ioutil.ReadAll(rc)
+}
+
+// takePreloaded returns a reader of the preloaded contents of f, and
+// forgets them, or nil if f was not preloaded successfully.
+func (z *Reader) takePreloaded(f *File) io.ReadCloser {
+	z.preloadMu.Lock()
+	p, ok := z.preloaded[f]
+	if ok {
+		delete(z.preloaded, f)
+	}
+	z.preloadMu.Unlock()
+	if !ok {
+		return nil
+	}
+	<-p.done
+	if p.err != nil {
+		return nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(p.data))
+}
@@ -0,0 +1,66 @@
+package zip
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPreload(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for i := 0; i < 8; i++ {
+		fw, err := w.CreateHeader(&FileHeader{Name: fmt.Sprintf("%d.txt", i), Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(fw, strings.Repeat(fmt.Sprint(i), 1000))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(r *Reader) {
+		for i, f := range r.File {
+			// Twice, since the second open no longer has preloaded
+			// contents.
+			for j := 0; j < 2; j++ {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := strings.Repeat(fmt.Sprint(i), 1000); string(b) != want {
+					t.Errorf("%s: read %q", f.Name, b)
+				}
+			}
+		}
+	}
+
+	r := mustNewReader(t, buf.Bytes())
+	r.Preload(3)
+	if len(r.preloaded) != 3 {
+		t.Errorf("preloading %d entries, want 3", len(r.preloaded))
+	}
+	check(r)
+	if len(r.preloaded) != 0 {
+		t.Errorf("%d preloaded entries left after opening them", len(r.preloaded))
+	}
+
+	r = mustNewReader(t, buf.Bytes())
+	r.PreloadFunc(2, func(f *File) bool { return f.Name >= "5" })
+	r.preloadMu.Lock()
+	_, ok6 := r.preloaded[r.File[6]]
+	_, ok7 := r.preloaded[r.File[7]]
+	r.preloadMu.Unlock()
+	if len(r.preloaded) != 2 || !ok6 || ok7 {
+		t.Errorf("preloading wrong entries")
+	}
+	check(r)
+}
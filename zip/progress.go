@@ -0,0 +1,151 @@
+package zip
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ErrAborted is returned by reads blocked on an Availability
+// that was aborted without a more specific error.
+var ErrAborted = errors.New("zip: download aborted")
+
+// A Progress reports which parts of an archive have been downloaded.
+// Wait blocks until the n bytes starting at off can be read, and
+// returns a non-nil error if they never will be.
+type Progress interface {
+	Wait(off, n int64) error
+}
+
+// Availability is a Progress fed by the downloader: it calls
+// MarkAvailable as byte ranges land on disk, and Abort if the
+// download fails. Ranges do not need to be contiguous, so a downloader
+// may fetch the central directory at the end of the archive first,
+// then stream the rest from the front.
+//
+// An Availability is safe for concurrent use.
+type Availability struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ranges []byteRange // sorted by off, non-overlapping, non-adjacent
+	err    error
+}
+
+type byteRange struct {
+	off, end int64
+}
+
+// NewAvailability returns an Availability with no bytes available.
+func NewAvailability() *Availability {
+	a := &Availability{}
+	a.cond = sync.NewCond(&a.mu)
+	return a
+}
+
+// MarkAvailable records that the n bytes starting at off can be read,
+// and wakes up any reads waiting on them.
+func (a *Availability) MarkAvailable(off, n int64) {
+	if n <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	nr := byteRange{off, off + n}
+	// find the first range that ends at or after the new one's start
+	i := sort.Search(len(a.ranges), func(i int) bool { return a.ranges[i].end >= nr.off })
+	j := i
+	for j < len(a.ranges) && a.ranges[j].off <= nr.end {
+		if a.ranges[j].off < nr.off {
+			nr.off = a.ranges[j].off
+		}
+		if a.ranges[j].end > nr.end {
+			nr.end = a.ranges[j].end
+		}
+		j++
+	}
+	ranges := append([]byteRange{}, a.ranges[:i]...)
+	ranges = append(ranges, nr)
+	a.ranges = append(ranges, a.ranges[j:]...)
+	a.cond.Broadcast()
+}
+
+// Available returns the number of contiguous bytes available from
+// the start of the archive.
+func (a *Availability) Available() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.ranges) == 0 || a.ranges[0].off > 0 {
+		return 0
+	}
+	return a.ranges[0].end
+}
+
+// Abort makes all current and future waits fail with err,
+// or ErrAborted if err is nil.
+func (a *Availability) Abort(err error) {
+	if err == nil {
+		err = ErrAborted
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+	a.cond.Broadcast()
+}
+
+// Wait blocks until the n bytes starting at off are available.
+func (a *Availability) Wait(off, n int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for {
+		if a.err != nil {
+			return a.err
+		}
+		if a.covers(off, off+n) {
+			return nil
+		}
+		a.cond.Wait()
+	}
+}
+
+func (a *Availability) covers(off, end int64) bool {
+	i := sort.Search(len(a.ranges), func(i int) bool { return a.ranges[i].end > off })
+	return i < len(a.ranges) && a.ranges[i].off <= off && a.ranges[i].end >= end
+}
+
+// progressReaderAt blocks reads until Progress says the range is there.
+type progressReaderAt struct {
+	r    io.ReaderAt
+	p    Progress
+	size int64
+}
+
+func (pr *progressReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n := int64(len(b))
+	if off+n > pr.size {
+		n = pr.size - off
+	}
+	if n > 0 {
+		if err := pr.p.Wait(off, n); err != nil {
+			return 0, err
+		}
+	}
+	return pr.r.ReadAt(b, off)
+}
+
+// NewProgressReader returns a Reader for an archive that is still being
+// downloaded into r. size is the final size of the archive. All reads,
+// including the central directory lookup done by NewProgressReader itself
+// and reads from opened files, block until p reports that the bytes
+// they need are available, so entries at the front of the archive can
+// be extracted before the download finishes.
+//
+// NewProgressReader needs the central directory and the last 65KiB of
+// the archive (where the end record is searched for) before it returns:
+// downloaders should fetch the tail of the archive first.
+func NewProgressReader(r io.ReaderAt, size int64, p Progress) (*Reader, error) {
+	return NewReader(&progressReaderAt{r: r, p: p, size: size}, size)
+}
@@ -0,0 +1,118 @@
+package zip
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestAvailability(t *testing.T) {
+	a := NewAvailability()
+	a.MarkAvailable(10, 10)
+	a.MarkAvailable(40, 10)
+	a.MarkAvailable(0, 5)
+	if got := a.Available(); got != 5 {
+		t.Errorf("Available() = %d, want 5", got)
+	}
+	a.MarkAvailable(5, 5)
+	if got := a.Available(); got != 20 {
+		t.Errorf("Available() = %d, want 20", got)
+	}
+	a.MarkAvailable(15, 30)
+	if got := a.Available(); got != 50 {
+		t.Errorf("Available() = %d, want 50", got)
+	}
+	if len(a.ranges) != 1 {
+		t.Errorf("got %d ranges, want 1", len(a.ranges))
+	}
+
+	done := make(chan error)
+	go func() { done <- a.Wait(45, 10) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned early with %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	a.MarkAvailable(50, 5)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { done <- a.Wait(100, 1) }()
+	a.Abort(nil)
+	if err := <-done; err != ErrAborted {
+		t.Fatalf("Wait after Abort = %v, want ErrAborted", err)
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	small := []byte("launcher configuration")
+	big := make([]byte, 200*1024)
+	rand.Read(big)
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{{"config.json", small}, {"assets.pak", big}} {
+		fw, err := w.CreateHeader(&FileHeader{Name: e.name, Method: Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	size := int64(len(b))
+
+	a := NewAvailability()
+	a.MarkAvailable(size-70*1024, 70*1024) // tail first
+	a.MarkAvailable(0, 1024)               // then the front
+
+	r, err := NewProgressReader(bytes.NewReader(b), size, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := r.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, small) {
+		t.Fatalf("got %q, want %q", got, small)
+	}
+
+	done := make(chan error)
+	go func() {
+		rc, err := r.File[1].Open()
+		if err != nil {
+			done <- err
+			return
+		}
+		got, err := ioutil.ReadAll(rc)
+		if err == nil && !bytes.Equal(got, big) {
+			err = errors.New("contents mismatch")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("read of incomplete entry returned early with %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	a.MarkAvailable(0, size)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
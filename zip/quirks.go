@@ -0,0 +1,399 @@
+package zip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Quirks selects workarounds for archives written by misbehaving
+// producers. None of them are needed for spec-compliant archives.
+type Quirks uint32
+
+const (
+	// QuirkIgnoreDataDescriptor skips data descriptors entirely and
+	// checks contents against the central directory CRC-32 only.
+	// Descriptors are normally found with or without their signature,
+	// and with 32- or 64-bit sizes, but some streaming producers fill
+	// them with garbage.
+	QuirkIgnoreDataDescriptor Quirks = 1 << iota
+
+	// QuirkFixReaderVersion raises the version needed to extract of
+	// entries to what their method and size actually require. Old Java
+	// versions wrote 20 for Zip64 entries, which makes copies of them
+	// (see Writer.Copy) unreadable by strict tools.
+	QuirkFixReaderVersion
+
+	// QuirkMacDirectories appends a slash to the names of entries
+	// whose Unix mode says they are directories. Some macOS tools
+	// write directory entries without the trailing slash.
+	QuirkMacDirectories
+
+	// QuirkArchiveExtraData skips an archive extra data record found
+	// where the central directory should start. PKZIP writes one,
+	// along with an archive decryption header, when it encrypts the
+	// central directory, and some producers point the end of central
+	// directory record at it rather than past it.
+	QuirkArchiveExtraData
+
+	// QuirkBrokenZip64 recovers entries whose sizes or local header
+	// offset are saturated at 0xFFFFFFFF in the central directory
+	// without a valid Zip64 extra field to give the real values, as
+	// some producers write entries over 4GiB. The missing values are
+	// inferred from the local headers, data descriptors and the offset
+	// of the next header, assuming entries are laid out in central
+	// directory order. Every guess is checked against the signatures
+	// and names found there; when none fits, NewReader still fails.
+	// Uncompressed sizes that cannot be inferred are not checked when
+	// reading, only the CRC-32 is.
+	QuirkBrokenZip64
+
+	// AllQuirks enables every workaround.
+	AllQuirks = QuirkIgnoreDataDescriptor | QuirkFixReaderVersion | QuirkMacDirectories | QuirkArchiveExtraData | QuirkBrokenZip64
+)
+
+const (
+	archiveExtraDataSignature = 0x08064b50
+	archiveExtraDataLen       = 8 // signature, length of the data that follows
+)
+
+// ReaderOptions configures how a Reader parses an archive.
+type ReaderOptions struct {
+	Quirks Quirks
+
+	// StallTimeout, if non-zero, makes entry readers fail with a
+	// *TimeoutError when reading from the archive yields nothing for
+	// that long, so that extraction over a flaky network ReaderAt fails
+	// fast instead of hanging. Time spent decompressing does not count.
+	StallTimeout time.Duration
+
+	// FastListing skips decoding extra fields and timestamps when
+	// reading the central directory, for listing archives with many
+	// entries as fast as possible. Only names, sizes, offsets and the
+	// raw fields of FileHeader are filled in: Modified is left zero,
+	// but ModifiedTime and ModifiedDate are set. Zip64 extra fields are
+	// still decoded when the sizes or offset need them.
+	FastListing bool
+
+	// Location is the time zone MS-DOS times are interpreted in, for
+	// entries without an extended, NTFS or Unix timestamp, which are
+	// exact and preferred when present; Modified is then converted to
+	// Location. MS-DOS times have no time zone: most tools write local
+	// time, so time.Local matches archives made on the same machine,
+	// and time.UTC those made by build systems. If nil, MS-DOS times are
+	// taken as UTC and exact timestamps keep an offset estimated from
+	// the MS-DOS time, as archive/zip does.
+	Location *time.Location
+
+	// MaxEntrySize and MaxTotalSize, if non-zero, make entry readers
+	// fail with a *DecompressionLimitError once they decompress more
+	// than that many bytes for one entry, or for all entries read
+	// from the Reader together, counting entries read more than once
+	// every time. What comes out of the decompressor is counted,
+	// rather than the declared sizes, so decompression bombs are
+	// stopped even when read directly with File.Open.
+	MaxEntrySize int64
+	MaxTotalSize int64
+
+	// Duplicates decides what happens to entries with the same names.
+	Duplicates DuplicatePolicy
+
+	// Names decides which of the names an entry may have is used.
+	Names NamePolicy
+
+	// CopyBufferSize is the size of the buffer io.Copy copies entries
+	// out with, through their WriteTo method. Defaults to 256KiB:
+	// memory-constrained devices may shrink it, servers raise it to
+	// make fewer, larger writes.
+	CopyBufferSize int
+
+	// ReadBufferSize, if non-zero, is how much compressed data entry
+	// readers read from the archive at once. By default decompressors
+	// buffer reads themselves, 4KiB at a time for Deflate; larger
+	// reads suit network ReaderAts and slow disks.
+	ReadBufferSize int
+
+	// LowMemory asks decompressors to use less memory at the expense
+	// of speed, for those that can: the zstd decoder of methods/zstd
+	// allocates its buffers as it needs them rather than up front.
+	// Decompressors get the options with File.ReaderOptions.
+	LowMemory bool
+
+	// DecompressionLimiter, if non-nil, bounds how many entries are
+	// decompressed at once, together with the other Readers sharing
+	// it. If nil, the one set with SetDefaultDecompressionLimiter is
+	// used, if any.
+	DecompressionLimiter *DecompressionLimiter
+}
+
+// NewReaderWithOptions is like NewReader, with the given options.
+func NewReaderWithOptions(r io.ReaderAt, size int64, opts ReaderOptions) (*Reader, error) {
+	zr := &Reader{opts: opts}
+	if err := zr.init(r, size); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// OpenReaderWithOptions is like OpenReader, with the given options.
+func OpenReaderWithOptions(name string, opts ReaderOptions) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := new(ReadCloser)
+	r.opts = opts
+	if err := r.init(f, fi.Size()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f = f
+	return r, nil
+}
+
+// skipArchiveExtraData skips the archive extra data record at the
+// start of buf, if any.
+func skipArchiveExtraData(buf *bufio.Reader) error {
+	peek, err := buf.Peek(archiveExtraDataLen)
+	if err != nil {
+		// Too short to hold the record, let readDirectoryHeader
+		// report the problem.
+		return nil
+	}
+	b := readBuf(peek)
+	if b.uint32() != archiveExtraDataSignature {
+		return nil
+	}
+	n := int64(b.uint32())
+	_, err = buf.Discard(archiveExtraDataLen)
+	if err == nil {
+		_, err = io.CopyN(ioutil.Discard, buf, n)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// applyQuirks fixes up a File read from the central directory.
+func (z *Reader) applyQuirks(f *File) {
+	q := z.opts.Quirks
+	if q&QuirkMacDirectories != 0 && !strings.HasSuffix(f.Name, "/") && f.Mode().IsDir() {
+		f.Name += "/"
+	}
+	if q&QuirkFixReaderVersion != 0 {
+		if v := minReaderVersion(&f.FileHeader); f.ReaderVersion&0xff < v {
+			f.ReaderVersion = f.ReaderVersion&0xff00 | v
+		}
+	}
+}
+
+// minReaderVersion returns the version needed to extract fh,
+// following section 4.4.3.2 of the zip spec.
+func minReaderVersion(fh *FileHeader) uint16 {
+	v := uint16(10) // 1.0, stored
+	switch {
+	case fh.Method == LZMA:
+		v = 63
+	case fh.Method == Deflate || strings.HasSuffix(fh.Name, "/"):
+		v = zipVersion20
+	}
+	if v < zipVersion45 && (fh.isZip64() || hasExtra(fh.Extra, zip64ExtraID)) {
+		v = zipVersion45
+	}
+	return v
+}
+
+func hasExtra(extra []byte, id uint16) bool {
+	_, ok := findExtra(extra, id)
+	return ok
+}
+
+// Values readDirectoryHeader could not find, with QuirkBrokenZip64.
+const (
+	missingCSize = 1 << iota
+	missingUSize
+	missingOffset
+)
+
+// inferBrokenZip64 fills in the values missing from the files of z,
+// as described for QuirkBrokenZip64. Each file's header offset follows
+// from where the previous one ends, and its compressed size from where
+// the next one, or the central directory, starts.
+func (z *Reader) inferBrokenZip64(end *directoryEnd) error {
+	for i, f := range z.File {
+		if f.missing&missingOffset != 0 {
+			start := int64(end.startSkipLen)
+			descriptor := false
+			if i > 0 {
+				prev := z.File[i-1]
+				if prev.missing&(missingOffset|missingCSize) != 0 {
+					return ErrFormat
+				}
+				bodyOffset, err := prev.findBodyOffset()
+				if err != nil {
+					return err
+				}
+				start = prev.headerOffset + bodyOffset + int64(prev.CompressedSize64)
+				descriptor = prev.hasDataDescriptor()
+			}
+			if err := f.findLocalHeader(start, descriptor); err != nil {
+				return err
+			}
+		}
+		if f.missing&missingCSize != 0 {
+			next := int64(end.directoryOffset)
+			if i+1 < len(z.File) {
+				if z.File[i+1].missing&missingOffset != 0 {
+					return ErrFormat
+				}
+				next = z.File[i+1].headerOffset
+			}
+			if err := f.inferCompressedSize(next); err != nil {
+				return err
+			}
+		}
+		if f.missing&missingUSize != 0 && f.Method == Store {
+			f.UncompressedSize64 = f.CompressedSize64
+			f.missing &^= missingUSize
+		}
+	}
+	return nil
+}
+
+// findLocalHeader sets the header offset of f to that of its local
+// header, found at start or, if the previous entry has a data
+// descriptor, past it.
+func (f *File) findLocalHeader(start int64, descriptor bool) error {
+	skips := []int64{0}
+	if descriptor {
+		skips = []int64{dataDescriptorLen, dataDescriptor64Len, dataDescriptorLen - 4, dataDescriptor64Len - 4}
+	}
+	for _, skip := range skips {
+		var buf [fileHeaderLen]byte
+		if _, err := f.zipr.ReadAt(buf[:], start+skip); err != nil {
+			continue
+		}
+		b := readBuf(buf[:])
+		if b.uint32() != fileHeaderSignature {
+			continue
+		}
+		b = b[22:]
+		name := make([]byte, b.uint16())
+		if _, err := f.zipr.ReadAt(name, start+skip+fileHeaderLen); err != nil {
+			continue
+		}
+		if string(name) == f.Name {
+			f.headerOffset = start + skip
+			f.missing &^= missingOffset
+			return nil
+		}
+	}
+	return ErrFormat
+}
+
+// inferCompressedSize sets the compressed size of f, and its
+// uncompressed size if missing and known, given the offset of what
+// follows it. It prefers the Zip64 extra of the local header, then
+// the data descriptor, then the space left until next.
+func (f *File) inferCompressedSize(next int64) error {
+	bodyOffset, err := f.findBodyOffset()
+	if err != nil {
+		return err
+	}
+	body := f.headerOffset + bodyOffset
+	if usize, csize, ok := f.localZip64Sizes(); ok && body+int64(csize) <= next {
+		f.CompressedSize64 = csize
+		if f.missing&missingUSize != 0 {
+			f.UncompressedSize64 = usize
+			f.missing &^= missingUSize
+		}
+		f.missing &^= missingCSize
+		return nil
+	}
+	if !f.hasDataDescriptor() {
+		if next < body {
+			return ErrFormat
+		}
+		f.CompressedSize64 = uint64(next - body)
+		f.missing &^= missingCSize
+		return nil
+	}
+
+	var sig, crc [4]byte
+	binary.LittleEndian.PutUint32(sig[:], dataDescriptorSignature)
+	binary.LittleEndian.PutUint32(crc[:], f.CRC32)
+	candidates := []struct {
+		len    int64
+		prefix []byte
+	}{
+		{dataDescriptor64Len, append(sig[:], crc[:]...)},
+		{dataDescriptorLen, append(sig[:], crc[:]...)},
+		{dataDescriptor64Len - 4, crc[:]},
+		{dataDescriptorLen - 4, crc[:]},
+	}
+	for _, c := range candidates {
+		start := next - c.len
+		if start < body {
+			continue
+		}
+		buf := make([]byte, c.len)
+		if _, err := f.zipr.ReadAt(buf, start); err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(buf, c.prefix) {
+			continue
+		}
+		csize := uint64(start - body)
+		b := readBuf(buf[len(c.prefix):])
+		if c.len-int64(len(c.prefix)) == 16 {
+			// 64-bit sizes, which must agree with the layout.
+			if b.uint64() != csize {
+				continue
+			}
+			if f.missing&missingUSize != 0 {
+				f.UncompressedSize64 = b.uint64()
+				f.missing &^= missingUSize
+			}
+		} else if size := b.uint32(); size != uint32(csize) && size != ^uint32(0) {
+			continue
+		}
+		f.CompressedSize64 = csize
+		f.missing &^= missingCSize
+		return nil
+	}
+	return ErrFormat
+}
+
+// localZip64Sizes returns the sizes from the Zip64 extra field of the
+// local header of f, if it has a complete one.
+func (f *File) localZip64Sizes() (usize, csize uint64, ok bool) {
+	var buf [fileHeaderLen]byte
+	if _, err := f.zipr.ReadAt(buf[:], f.headerOffset); err != nil {
+		return 0, 0, false
+	}
+	b := readBuf(buf[26:])
+	nameLen := int64(b.uint16())
+	extra := make([]byte, b.uint16())
+	if _, err := f.zipr.ReadAt(extra, f.headerOffset+fileHeaderLen+nameLen); err != nil {
+		return 0, 0, false
+	}
+	field, found := findExtra(extra, zip64ExtraID)
+	if !found || len(field) < 16 {
+		return 0, 0, false
+	}
+	b = readBuf(field)
+	usize = b.uint64()
+	csize = b.uint64()
+	return usize, csize, true
+}
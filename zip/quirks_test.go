@@ -0,0 +1,232 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func buildQuirksTestZip(t *testing.T, fhs ...*FileHeader) []byte {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range fhs {
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fh.Mode().IsRegular() {
+			if _, err := fw.Write([]byte("hello, quirks")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readWithQuirks(t *testing.T, b []byte, q Quirks) (*Reader, error) {
+	t.Helper()
+	return NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{Quirks: q})
+}
+
+func readAllFile(f *File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = ioutil.ReadAll(rc)
+	return err
+}
+
+func TestQuirkIgnoreDataDescriptor(t *testing.T) {
+	b := buildQuirksTestZip(t, &FileHeader{Name: "a.txt", Method: Deflate})
+	r, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+	off, err := f.DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clobber the CRC-32 of the data descriptor, after its signature.
+	binary.LittleEndian.PutUint32(b[off+int64(f.CompressedSize64)+4:], 0xdeadbeef)
+
+	if err := readAllFile(f); err != ErrChecksum {
+		t.Errorf("without quirk: got %v, want ErrChecksum", err)
+	}
+	r, err = readWithQuirks(t, b, QuirkIgnoreDataDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := readAllFile(r.File[0]); err != nil {
+		t.Errorf("with quirk: %v", err)
+	}
+}
+
+func TestQuirkFixReaderVersion(t *testing.T) {
+	b := buildQuirksTestZip(t, &FileHeader{Name: "a.txt", Method: Deflate})
+	end, err := readDirectoryEnd(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint16(b[end.directoryOffset+6:], 10)
+
+	for _, tc := range []struct {
+		quirks Quirks
+		want   uint16
+	}{
+		{0, 10},
+		{QuirkFixReaderVersion, zipVersion20},
+	} {
+		r, err := readWithQuirks(t, b, tc.quirks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.File[0].ReaderVersion; got != tc.want {
+			t.Errorf("quirks %b: got ReaderVersion %d, want %d", tc.quirks, got, tc.want)
+		}
+	}
+}
+
+func TestQuirkMacDirectories(t *testing.T) {
+	dir := &FileHeader{Name: "dir"}
+	dir.SetMode(os.ModeDir | 0755)
+	b := buildQuirksTestZip(t, dir, &FileHeader{Name: "dir/a.txt"})
+
+	for _, tc := range []struct {
+		quirks Quirks
+		want   string
+	}{
+		{0, "dir"},
+		{QuirkMacDirectories, "dir/"},
+	} {
+		r, err := readWithQuirks(t, b, tc.quirks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.File[0].Name; got != tc.want {
+			t.Errorf("quirks %b: got name %q, want %q", tc.quirks, got, tc.want)
+		}
+		if got := r.File[1].Name; got != "dir/a.txt" {
+			t.Errorf("quirks %b: file renamed to %q", tc.quirks, got)
+		}
+	}
+}
+
+func TestQuirkArchiveExtraData(t *testing.T) {
+	b := buildQuirksTestZip(t, &FileHeader{Name: "a.txt", Method: Deflate})
+	end, err := readDirectoryEnd(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert an archive extra data record before the central directory,
+	// and count it in the directory size like PKZIP does.
+	record := make([]byte, archiveExtraDataLen+5)
+	binary.LittleEndian.PutUint32(record, archiveExtraDataSignature)
+	binary.LittleEndian.PutUint32(record[4:], 5)
+	var patched []byte
+	patched = append(patched, b[:end.directoryOffset]...)
+	patched = append(patched, record...)
+	patched = append(patched, b[end.directoryOffset:]...)
+	eocd := patched[len(patched)-directoryEndLen:]
+	binary.LittleEndian.PutUint32(eocd[12:], uint32(end.directorySize)+uint32(len(record)))
+
+	if _, err := readWithQuirks(t, patched, 0); err == nil {
+		t.Errorf("without quirk: expected an error")
+	}
+	r, err := readWithQuirks(t, patched, QuirkArchiveExtraData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != 1 || r.File[0].Name != "a.txt" {
+		t.Fatalf("with quirk: got %d files", len(r.File))
+	}
+	if err := readAllFile(r.File[0]); err != nil {
+		t.Errorf("with quirk: %v", err)
+	}
+}
+
+func TestQuirkBrokenZip64(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	contents := []string{"first entry", strings.Repeat("deflated ", 100), "stored raw", "last"}
+	for i, s := range contents[:2] {
+		fw, err := w.CreateHeader(&FileHeader{Name: fmt.Sprintf("%d.txt", i), Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(s))
+	}
+	fw, err := w.CreateRaw(&FileHeader{
+		Name:               "2.txt",
+		CRC32:              crc32.ChecksumIEEE([]byte(contents[2])),
+		CompressedSize64:   uint64(len(contents[2])),
+		UncompressedSize64: uint64(len(contents[2])),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(contents[2]))
+	fw, err = w.CreateHeader(&FileHeader{Name: "3.txt", Method: Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(contents[3]))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// Saturate sizes and offsets in the central directory, the way
+	// broken producers do for entries over 4GiB, without Zip64 extras.
+	end, err := readDirectoryEnd(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	rec := b[end.directoryOffset:]
+	for i := range contents {
+		if i > 0 {
+			le.PutUint32(rec[20:], ^uint32(0)) // compressed size
+			le.PutUint32(rec[24:], ^uint32(0)) // uncompressed size
+		}
+		if i == 1 {
+			le.PutUint32(rec[42:], ^uint32(0)) // local header offset
+		}
+		n := directoryHeaderLen + int(le.Uint16(rec[28:])) + int(le.Uint16(rec[30:])) + int(le.Uint16(rec[32:]))
+		rec = rec[n:]
+	}
+
+	if _, err := readWithQuirks(t, b, 0); err != ErrFormat {
+		t.Errorf("without quirk: got %v, want ErrFormat", err)
+	}
+	r, err := readWithQuirks(t, b, QuirkBrokenZip64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != contents[i] {
+			t.Errorf("%s: got %q, %v", f.Name, got, err)
+		}
+		if f.Method == Store && f.UncompressedSize64 != uint64(len(contents[i])) {
+			t.Errorf("%s: UncompressedSize64 = %d", f.Name, f.UncompressedSize64)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package zip
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// A RangeFunc fetches length bytes starting at offset from a remote
+// object, typically with an HTTP range request against an object store
+// such as S3 or GCS.
+type RangeFunc func(offset, length int64) (io.ReadCloser, error)
+
+// RangeReaderOptions configures a RangeReaderAt.
+type RangeReaderOptions struct {
+	// BlockSize is the granularity of fetches and of the cache.
+	// Defaults to 256KiB.
+	BlockSize int64
+	// MaxBlocks is the number of blocks kept in memory. Defaults to 256.
+	MaxBlocks int
+	// Concurrency is the number of fetches Prefetch runs in parallel.
+	// Defaults to 4.
+	Concurrency int
+	// MaxRun is the largest number of blocks fetched with a single
+	// request. Defaults to 16.
+	MaxRun int
+}
+
+// A RangeReaderAt implements io.ReaderAt over a RangeFunc, so archives
+// stored in cloud buckets can be opened with NewReader without
+// downloading them. Reads are served from a cache of fixed-size blocks;
+// adjacent missing blocks are fetched with a single request, and
+// concurrent reads of a block wait for the same fetch.
+// A RangeReaderAt is safe for concurrent use.
+type RangeReaderAt struct {
+	fetch RangeFunc
+	size  int64
+	opts  RangeReaderOptions
+	sem   chan struct{} // bounds prefetches
+
+	mu     sync.Mutex
+	blocks map[int64]*list.Element // of *rangeBlock, by index
+	lru    *list.List              // most recently used first
+}
+
+type rangeBlock struct {
+	index int64
+	done  chan struct{} // closed once data or err is set
+	data  []byte
+	err   error
+}
+
+// NewRangeReaderAt returns a RangeReaderAt over an object of the given
+// size, fetched with fetch.
+func NewRangeReaderAt(size int64, fetch RangeFunc, opts RangeReaderOptions) *RangeReaderAt {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 256 * 1024
+	}
+	if opts.MaxBlocks <= 0 {
+		opts.MaxBlocks = 256
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.MaxRun <= 0 {
+		opts.MaxRun = 16
+	}
+	return &RangeReaderAt{
+		fetch:  fetch,
+		size:   size,
+		opts:   opts,
+		sem:    make(chan struct{}, opts.Concurrency),
+		blocks: make(map[int64]*list.Element),
+		lru:    list.New(),
+	}
+}
+
+// Size returns the size of the object.
+func (r *RangeReaderAt) Size() int64 { return r.size }
+
+// ReadAt implements io.ReaderAt.
+func (r *RangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("zip: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	var err error
+	if rem := r.size - off; int64(len(p)) > rem {
+		p = p[:rem]
+		err = io.EOF
+	}
+	if len(p) == 0 {
+		return 0, err
+	}
+
+	bs := r.opts.BlockSize
+	blocks, runs := r.acquire(off/bs, (off+int64(len(p))-1)/bs)
+	for _, run := range runs {
+		go r.fetchRun(run)
+	}
+
+	n := 0
+	for _, b := range blocks {
+		<-b.done
+		if b.err != nil {
+			return n, b.err
+		}
+		start := off + int64(n) - b.index*bs
+		n += copy(p[n:], b.data[start:])
+	}
+	return n, err
+}
+
+// Prefetch starts fetching the given range in the background, unless
+// it is already cached. At most Concurrency prefetches run at once.
+func (r *RangeReaderAt) Prefetch(off, n int64) {
+	if off < 0 {
+		n += off
+		off = 0
+	}
+	if end := r.size; off+n > end {
+		n = end - off
+	}
+	if n <= 0 {
+		return
+	}
+	bs := r.opts.BlockSize
+	_, runs := r.acquire(off/bs, (off+n-1)/bs)
+	for _, run := range runs {
+		run := run
+		go func() {
+			r.sem <- struct{}{}
+			defer func() { <-r.sem }()
+			r.fetchRun(run)
+		}()
+	}
+}
+
+// PrefetchDirectory fetches the central directory of the archive, in
+// parallel when it spans several runs of blocks, and waits for it, so
+// that NewReader runs from memory.
+func (r *RangeReaderAt) PrefetchDirectory() error {
+	end, err := readDirectoryEnd(r, r.size)
+	if err != nil {
+		return err
+	}
+	r.Prefetch(int64(end.directoryOffset), int64(end.directorySize))
+	// Wait by reading it back, which also surfaces fetch errors.
+	_, err = io.Copy(ioutil.Discard, io.NewSectionReader(r, int64(end.directoryOffset), int64(end.directorySize)))
+	return err
+}
+
+// PrefetchFiles starts fetching the local headers and compressed data
+// of files, which must come from a Reader reading from r.
+func (r *RangeReaderAt) PrefetchFiles(files ...*File) {
+	for _, f := range files {
+		// The local header is usually as long as the directory one.
+		n := fileHeaderLen + int64(len(f.Name)+len(f.Extra)) + int64(f.CompressedSize64) + dataDescriptor64Len
+		r.Prefetch(f.headerOffset, n)
+	}
+}
+
+// acquire returns the blocks first through last, registering missing
+// ones, and the runs of missing blocks to fetch.
+func (r *RangeReaderAt) acquire(first, last int64) ([]*rangeBlock, [][]*rangeBlock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blocks := make([]*rangeBlock, 0, last-first+1)
+	var runs [][]*rangeBlock
+	var run []*rangeBlock
+	for i := first; i <= last; i++ {
+		if el, ok := r.blocks[i]; ok {
+			r.lru.MoveToFront(el)
+			blocks = append(blocks, el.Value.(*rangeBlock))
+			if run != nil {
+				runs, run = append(runs, run), nil
+			}
+			continue
+		}
+		b := &rangeBlock{index: i, done: make(chan struct{})}
+		r.blocks[i] = r.lru.PushFront(b)
+		blocks = append(blocks, b)
+		run = append(run, b)
+		if len(run) == r.opts.MaxRun {
+			runs, run = append(runs, run), nil
+		}
+	}
+	if run != nil {
+		runs = append(runs, run)
+	}
+	r.evict()
+	return blocks, runs
+}
+
+// evict drops the least recently used completed blocks past MaxBlocks.
+func (r *RangeReaderAt) evict() {
+	for el := r.lru.Back(); el != nil && r.lru.Len() > r.opts.MaxBlocks; {
+		prev := el.Prev()
+		b := el.Value.(*rangeBlock)
+		select {
+		case <-b.done:
+			r.lru.Remove(el)
+			delete(r.blocks, b.index)
+		default:
+			// Still being fetched, someone is waiting for it.
+		}
+		el = prev
+	}
+}
+
+// fetchRun fetches consecutive blocks with a single request.
+func (r *RangeReaderAt) fetchRun(run []*rangeBlock) {
+	bs := r.opts.BlockSize
+	off := run[0].index * bs
+	end := (run[len(run)-1].index + 1) * bs
+	if end > r.size {
+		end = r.size
+	}
+	data, err := r.fetchRange(off, end-off)
+
+	if err != nil {
+		// Forget the failed blocks so later reads retry them.
+		r.mu.Lock()
+		for _, b := range run {
+			if el, ok := r.blocks[b.index]; ok && el.Value == b {
+				r.lru.Remove(el)
+				delete(r.blocks, b.index)
+			}
+		}
+		r.mu.Unlock()
+	}
+	for i, b := range run {
+		if err != nil {
+			b.err = err
+		} else {
+			start := int64(i) * bs
+			stop := start + bs
+			if stop > int64(len(data)) {
+				stop = int64(len(data))
+			}
+			b.data = data[start:stop]
+		}
+		close(b.done)
+	}
+}
+
+func (r *RangeReaderAt) fetchRange(off, n int64) ([]byte, error) {
+	rc, err := r.fetch(off, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data := make([]byte, n)
+	if _, err := io.ReadFull(rc, data); err != nil {
+		return nil, fmt.Errorf("zip: fetching %d bytes at %d: %v", n, off, err)
+	}
+	return data, nil
+}
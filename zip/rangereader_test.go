@@ -0,0 +1,118 @@
+package zip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type rangeServer struct {
+	data []byte
+
+	mu       sync.Mutex
+	requests int
+	failNext bool
+	gate     chan struct{} // if non-nil, fetches wait for it
+}
+
+func (s *rangeServer) fetch(off, n int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	s.requests++
+	fail := s.failNext
+	s.failNext = false
+	gate := s.gate
+	s.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	if fail {
+		return nil, errors.New("503 slow down")
+	}
+	return ioutil.NopCloser(bytes.NewReader(s.data[off : off+n])), nil
+}
+
+func (s *rangeServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestRangeReaderAt(t *testing.T) {
+	contents := map[string]string{
+		"a.txt": strings.Repeat("alpha ", 2000),
+		"b.txt": strings.Repeat("bravo ", 2000),
+	}
+	s := &rangeServer{data: buildRepairTestZip(t, contents, []string{"a.txt", "b.txt"})}
+	ra := NewRangeReaderAt(int64(len(s.data)), s.fetch, RangeReaderOptions{BlockSize: 64, MaxBlocks: 1000})
+
+	if err := ra.PrefetchDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	before := s.count()
+	r, err := NewReader(ra, ra.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.count() != before {
+		t.Errorf("NewReader made %d requests after PrefetchDirectory", s.count()-before)
+	}
+	for _, f := range r.File {
+		testReadFile(t, f, &WriteTest{Name: f.Name, Data: []byte(contents[f.Name]), Mode: 0666})
+	}
+
+	// Reading a whole span of missing blocks takes a single request.
+	ra = NewRangeReaderAt(int64(len(s.data)), s.fetch, RangeReaderOptions{BlockSize: 64, MaxRun: 100})
+	before = s.count()
+	buf := make([]byte, len(s.data)-20)
+	if _, err := ra.ReadAt(buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, s.data[10:10+len(buf)]) {
+		t.Errorf("ReadAt returned the wrong data")
+	}
+	if got := s.count() - before; got != 1 {
+		t.Errorf("reading %d missing blocks took %d requests", len(buf)/64, got)
+	}
+
+	// Reading past the end returns what is there and io.EOF.
+	n, err := ra.ReadAt(make([]byte, 100), int64(len(s.data))-10)
+	if n != 10 || err != io.EOF {
+		t.Errorf("ReadAt at the end: got %d, %v", n, err)
+	}
+}
+
+func TestRangeReaderAtCoalescing(t *testing.T) {
+	s := &rangeServer{data: bytes.Repeat([]byte("x"), 1024), gate: make(chan struct{})}
+	ra := NewRangeReaderAt(1024, s.fetch, RangeReaderOptions{BlockSize: 256})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ra.ReadAt(make([]byte, 100), 10); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(s.gate)
+	wg.Wait()
+	if got := s.count(); got != 1 {
+		t.Errorf("concurrent reads of one block took %d requests", got)
+	}
+}
+
+func TestRangeReaderAtRetry(t *testing.T) {
+	s := &rangeServer{data: bytes.Repeat([]byte("x"), 1024), failNext: true}
+	ra := NewRangeReaderAt(1024, s.fetch, RangeReaderOptions{BlockSize: 256})
+	if _, err := ra.ReadAt(make([]byte, 10), 0); err == nil {
+		t.Fatal("expected the first read to fail")
+	}
+	if _, err := ra.ReadAt(make([]byte, 10), 0); err != nil {
+		t.Errorf("expected the failed block to be refetched, got %v", err)
+	}
+}
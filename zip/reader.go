@@ -6,27 +6,56 @@ package zip
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
 	"os"
+	"sort"
+	"sync"
 	"time"
 )
 
 var (
-	ErrFormat    = errors.New("zip: not a valid zip file")
+	ErrFormat = errors.New("zip: not a valid zip file")
+	// ErrAlgorithm is returned by Writers for methods without a
+	// compressor; readers return an *UnsupportedMethodError, which
+	// errors.Is reports as ErrAlgorithm.
 	ErrAlgorithm = errors.New("zip: unsupported compression algorithm")
 	ErrChecksum  = errors.New("zip: checksum error")
 )
 
+// A Reader serves content from a ZIP archive.
+//
+// Once created, a Reader is safe for concurrent use: any number of
+// goroutines may open and read its files at the same time, including
+// several readers over the same File. Each reader only uses the
+// underlying io.ReaderAt through ReadAt at explicit offsets, which must
+// itself be safe for concurrent use, as it is for *os.File.
+// RegisterDecompressor must not be called while files are being opened.
 type Reader struct {
 	r             io.ReaderAt
+	size          int64
 	File          []*File
 	Comment       string
 	decompressors map[uint16]Decompressor
+	opts          ReaderOptions
+
+	preloadMu sync.Mutex
+	preloaded map[*File]*preloadedFile // by Preload
+
+	decompressedMu sync.Mutex
+	decompressed   int64 // by all entry readers, for MaxTotalSize
+
+	lookupOnce sync.Once
+	byName     map[string]*File // for Lookup
+
+	fsOnce  sync.Once
+	fsNodes map[string]*fsNode // for Open
+
+	data []byte // the whole archive, from NewReaderBytes
 }
 
 type ReadCloser struct {
@@ -40,6 +69,8 @@ type File struct {
 	zipr         io.ReaderAt
 	zipsize      int64
 	headerOffset int64
+	bodyOffset   int64 // relative to headerOffset, if known from an index
+	missing      uint8 // values to infer, with QuirkBrokenZip64
 }
 
 func (f *File) hasDataDescriptor() bool {
@@ -81,42 +112,33 @@ func (z *Reader) init(r io.ReaderAt, size int64) error {
 	if err != nil {
 		return err
 	}
-	if end.directoryRecords > uint64(size)/fileHeaderLen {
-		return fmt.Errorf("archive/zip: TOC declares impossible %d files in %d byte zip", end.directoryRecords, size)
-	}
+	return z.initEnd(r, size, end)
+}
 
-	z.r = r
-	z.File = make([]*File, 0, end.directoryRecords)
-	z.Comment = end.comment
-	rs := io.NewSectionReader(r, 0, size)
-	if _, err = rs.Seek(int64(end.directoryOffset), io.SeekStart); err != nil {
+// initEnd is like init, with the end of central directory record of r
+// already read.
+func (z *Reader) initEnd(r io.ReaderAt, size int64, end *directoryEnd) error {
+	it, err := z.iterateEnd(r, size, end)
+	if err != nil {
 		return err
 	}
-	buf := bufio.NewReader(rs)
-
-	// The count of files inside a zip is truncated to fit in a uint16.
-	// Gloss over this by reading headers until we encounter
-	// a bad one, and then only report an ErrFormat or UnexpectedEOF if
-	// the file count modulo 65536 is incorrect.
-
+	it.inferLater = true
+	z.File = make([]*File, 0, it.end.directoryRecords)
 	for {
-		f := &File{zip: z, zipr: r, zipsize: size}
-		err = readDirectoryHeader(f, buf)
-		if err == ErrFormat || err == io.ErrUnexpectedEOF {
+		f, err := it.Next()
+		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return err
 		}
-		f.headerOffset += int64(end.startSkipLen)
-
 		z.File = append(z.File, f)
 	}
 
-	if uint16(len(z.File)) != uint16(end.directoryRecords) { // only compare 16 bits here
-		// Return the readDirectoryHeader error if we read
-		// the wrong number of directory entries.
-		return err
+	if z.opts.Quirks&QuirkBrokenZip64 != 0 {
+		if err := z.inferBrokenZip64(it.end); err != nil {
+			return err
+		}
 	}
 
 	err = normalizeNameEncoding(z)
@@ -124,7 +146,10 @@ func (z *Reader) init(r io.ReaderAt, size int64) error {
 		return err
 	}
 
-	return nil
+	if err := z.applyNamePolicy(); err != nil {
+		return err
+	}
+	return z.applyDuplicatePolicy()
 }
 
 // RegisterDecompressor registers or overrides a custom decompressor for a
@@ -145,6 +170,23 @@ func (z *Reader) decompressor(method uint16) Decompressor {
 	return dcomp
 }
 
+// FilesByOffset returns the archive's files sorted by the offset of
+// their local headers, which is the order their data is laid out in.
+// Sequential consumers, such as streaming or extraction to spinning
+// disks, read the archive front to back that way, whereas z.File is in
+// central directory order.
+func (z *Reader) FilesByOffset() []*File {
+	files := make([]*File, len(z.File))
+	copy(files, z.File)
+	SortFilesByOffset(files)
+	return files
+}
+
+// SortFilesByOffset sorts files by the offset of their local headers.
+func SortFilesByOffset(files []*File) {
+	sort.SliceStable(files, func(i, j int) bool { return files[i].headerOffset < files[j].headerOffset })
+}
+
 // Close closes the Zip file, rendering it unusable for I/O.
 func (rc *ReadCloser) Close() error {
 	return rc.f.Close()
@@ -164,30 +206,135 @@ func (f *File) DataOffset() (offset int64, err error) {
 }
 
 // Open returns a ReadCloser that provides access to the File's contents.
-// Multiple files may be read concurrently.
+// Multiple files may be read concurrently, and the same File may be
+// opened several times, each ReadCloser keeping its own position.
+// Encrypted entries fail with an *EncryptionError.
 func (f *File) Open() (io.ReadCloser, error) {
+	if f.zip != nil {
+		if rc := f.zip.takePreloaded(f); rc != nil {
+			return rc, nil
+		}
+	}
+	return f.OpenWithDecompressor(nil)
+}
+
+// OpenWithDecompressor is like Open, but decompresses the File's
+// contents with dcomp regardless of its Method, bypassing the Reader's
+// and the package's registrations. This helps when trying out another
+// inflate implementation, or reading archives that record the wrong
+// method. The checksum is still verified. If dcomp is nil, it behaves
+// like Open.
+func (f *File) OpenWithDecompressor(dcomp Decompressor) (io.ReadCloser, error) {
+	stored := dcomp == nil && f.Method == Store
+	if dcomp == nil {
+		if feature := f.encryptionFeature(); feature != 0 {
+			return nil, &EncryptionError{Name: f.Name, Feature: feature}
+		}
+		dcomp = f.zip.decompressor(f.Method)
+		if dcomp == nil {
+			return nil, unsupportedMethod(f.Method, f.Name)
+		}
+	}
 	bodyOffset, err := f.findBodyOffset()
 	if err != nil {
 		return nil, err
 	}
 	size := int64(f.CompressedSize64)
-	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
-	dcomp := f.zip.decompressor(f.Method)
-	if dcomp == nil {
-		return nil, ErrAlgorithm
+	data, inMemory := f.zip.slice(f.headerOffset+bodyOffset, size)
+	var r io.Reader = io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
+	if inMemory {
+		r = bytes.NewReader(data)
 	}
-	var rc io.ReadCloser = dcomp(r, f)
 	var desr io.Reader
-	if f.hasDataDescriptor() {
+	if f.hasDataDescriptor() && f.zip.opts.Quirks&QuirkIgnoreDataDescriptor == 0 {
 		desr = io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset+size, dataDescriptorLen)
 	}
-	rc = &checksumReader{
+	if timeout := f.zip.opts.StallTimeout; timeout > 0 {
+		r = newStallReader(r, timeout, f.Name)
+		if desr != nil {
+			desr = newStallReader(desr, timeout, f.Name)
+		}
+	}
+	if n := f.zip.opts.ReadBufferSize; n > 0 {
+		r = bufio.NewReaderSize(r, n)
+	}
+	var rc io.ReadCloser = dcomp(r, f)
+	if l := f.zip.decompressionLimiter(); l != nil && !stored {
+		rc = &throttledDecompressor{rc: rc, l: l}
+	}
+	if opts := &f.zip.opts; opts.MaxEntrySize > 0 || opts.MaxTotalSize > 0 {
+		rc = &limitedDecompressor{rc: rc, z: f.zip, name: f.Name}
+	}
+	cr := &checksumReader{
 		rc:   rc,
 		hash: crc32.NewIEEE(),
 		f:    f,
 		desr: desr,
 	}
-	return rc, nil
+	if br, ok := r.(*bytes.Reader); ok && stored && inMemory {
+		if _, limited := rc.(*limitedDecompressor); !limited {
+			return &storedSliceReader{checksumReader: cr, br: br, data: data}, nil
+		}
+	}
+	return cr, nil
+}
+
+// ReaderOptions returns the options of the Reader f was read by, for
+// decompressors registered outside this package to honor. Files that
+// were not read by a Reader have none.
+func (f *File) ReaderOptions() ReaderOptions {
+	if f.zip == nil {
+		return ReaderOptions{}
+	}
+	return f.zip.opts
+}
+
+// OpenRaw returns a Reader that provides access to the File's contents
+// without decompression.
+func (f *File) OpenRaw() (io.Reader, error) {
+	bodyOffset, err := f.findBodyOffset()
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := f.zip.slice(f.headerOffset+bodyOffset, int64(f.CompressedSize64)); ok {
+		return bytes.NewReader(data), nil
+	}
+	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, int64(f.CompressedSize64))
+	return r, nil
+}
+
+// A CompressedReader reads the compressed contents of an entry, and
+// carries what is needed to validate them once decompressed elsewhere.
+// It is a *io.SectionReader, so uploads can be split in parts or retried.
+type CompressedReader struct {
+	*io.SectionReader
+
+	Method             uint16
+	CRC32              uint32 // of the uncompressed contents
+	CompressedSize64   uint64
+	UncompressedSize64 uint64
+}
+
+// OpenCompressed returns a CompressedReader for the File's compressed
+// contents, so they can be stored or sent elsewhere, for example to a
+// CDN or object store that validates them on ingestion, without
+// decompressing and recompressing them.
+func (f *File) OpenCompressed() (*CompressedReader, error) {
+	bodyOffset, err := f.findBodyOffset()
+	if err != nil {
+		return nil, err
+	}
+	size := int64(f.CompressedSize64)
+	if f.headerOffset+bodyOffset+size > f.zipsize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &CompressedReader{
+		SectionReader:      io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size),
+		Method:             f.Method,
+		CRC32:              f.CRC32,
+		CompressedSize64:   f.CompressedSize64,
+		UncompressedSize64: f.UncompressedSize64,
+	}, nil
 }
 
 type checksumReader struct {
@@ -210,7 +357,7 @@ func (r *checksumReader) Read(b []byte) (n int, err error) {
 		return
 	}
 	if err == io.EOF {
-		if r.nread != r.f.UncompressedSize64 {
+		if r.nread != r.f.UncompressedSize64 && r.f.missing&missingUSize == 0 {
 			return 0, io.ErrUnexpectedEOF
 		}
 		if r.desr != nil {
@@ -238,9 +385,49 @@ func (r *checksumReader) Read(b []byte) (n int, err error) {
 
 func (r *checksumReader) Close() error { return r.rc.Close() }
 
+// WriteTo implements io.WriterTo, so that io.Copy out of an entry goes
+// through a large pooled buffer, of ReaderOptions.CopyBufferSize, rather
+// than a 32KiB one of its own.
+// Decompressors return at most their window per Read, so the buffer is
+// filled by several before being written out.
+func (r *checksumReader) WriteTo(w io.Writer) (int64, error) {
+	bp := getCopyBuffer(r.f.zip.opts.CopyBufferSize)
+	defer putCopyBuffer(bp)
+	buf := *bp
+	var n int64
+	for {
+		var m int
+		var err error
+		for m < len(buf) && err == nil {
+			var k int
+			k, err = r.Read(buf[m:])
+			m += k
+		}
+		if m > 0 {
+			k, werr := w.Write(buf[:m])
+			n += int64(k)
+			if werr != nil {
+				return n, werr
+			}
+			if k != m {
+				return n, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
 // findBodyOffset does the minimum work to verify the file has a header
 // and returns the file body offset.
 func (f *File) findBodyOffset() (int64, error) {
+	if f.bodyOffset != 0 {
+		return f.bodyOffset, nil
+	}
 	var buf [fileHeaderLen]byte
 	if _, err := f.zipr.ReadAt(buf[:], f.headerOffset); err != nil {
 		return 0, err
@@ -289,6 +476,7 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 		return err
 	}
 	f.Name = string(d[:filenameLen])
+	f.NameRaw = f.Name
 	f.Extra = d[filenameLen : filenameLen+extraLen]
 	f.Comment = string(d[filenameLen+extraLen:])
 
@@ -310,6 +498,12 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 		f.NonUTF8 = f.Flags&0x800 == 0
 	}
 
+	lenient := f.zip != nil && f.zip.opts.Quirks&QuirkBrokenZip64 != 0
+	fast := f.zip != nil && f.zip.opts.FastListing
+	var loc *time.Location
+	if f.zip != nil {
+		loc = f.zip.opts.Location
+	}
 	needUSize := f.UncompressedSize == ^uint32(0)
 	needCSize := f.CompressedSize == ^uint32(0)
 	needHeaderOffset := f.headerOffset == int64(^uint32(0))
@@ -327,6 +521,9 @@ parseExtras:
 		}
 
 		fieldBuf := extra.sub(fieldSize)
+		if fast && fieldTag != zip64ExtraID {
+			continue
+		}
 
 		switch fieldTag {
 		case zip64ExtraID:
@@ -336,24 +533,33 @@ parseExtras:
 			// See golang.org/issue/13367.
 
 			if needUSize {
-				needUSize = false
 				if len(fieldBuf) < 8 {
+					if lenient {
+						continue parseExtras
+					}
 					return ErrFormat
 				}
+				needUSize = false
 				f.UncompressedSize64 = fieldBuf.uint64()
 			}
 			if needCSize {
-				needCSize = false
 				if len(fieldBuf) < 8 {
+					if lenient {
+						continue parseExtras
+					}
 					return ErrFormat
 				}
+				needCSize = false
 				f.CompressedSize64 = fieldBuf.uint64()
 			}
 			if needHeaderOffset {
-				needHeaderOffset = false
 				if len(fieldBuf) < 8 {
+					if lenient {
+						continue parseExtras
+					}
 					return ErrFormat
 				}
+				needHeaderOffset = false
 				f.headerOffset = int64(fieldBuf.uint64())
 			}
 		case ntfsExtraID:
@@ -392,24 +598,42 @@ parseExtras:
 			}
 			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
 			modified = time.Unix(ts, 0)
+		case unicodePathExtraID:
+			if len(fieldBuf) < 5 || fieldBuf.uint8() != 1 {
+				continue parseExtras
+			}
+			// The field is stale if the name was changed by a tool
+			// that did not know about it.
+			if fieldBuf.uint32() == crc32.ChecksumIEEE(d[:filenameLen]) {
+				f.NameUnicode = string(fieldBuf)
+			}
 		}
 	}
 
-	msdosModified := msDosTimeToTime(f.ModifiedDate, f.ModifiedTime)
-	f.Modified = msdosModified
-	if !modified.IsZero() {
-		f.Modified = modified.UTC()
-
-		// If legacy MS-DOS timestamps are set, we can use the delta between
-		// the legacy and extended versions to estimate timezone offset.
-		//
-		// A non-UTC timezone is always used (even if offset is zero).
-		// Thus, FileHeader.Modified.Location() == time.UTC is useful for
-		// determining whether extended timestamps are present.
-		// This is necessary for users that need to do additional time
-		// calculations when dealing with legacy ZIP formats.
-		if f.ModifiedTime != 0 || f.ModifiedDate != 0 {
-			f.Modified = modified.In(timeZone(msdosModified.Sub(modified)))
+	if !fast && loc != nil {
+		// The caller told which time zone MS-DOS times are in, so
+		// exact timestamps are only converted to it.
+		f.Modified = dosTimeIn(f.ModifiedDate, f.ModifiedTime, loc)
+		if !modified.IsZero() {
+			f.Modified = modified.In(loc)
+		}
+	} else if !fast {
+		msdosModified := msDosTimeToTime(f.ModifiedDate, f.ModifiedTime)
+		f.Modified = msdosModified
+		if !modified.IsZero() {
+			f.Modified = modified.UTC()
+
+			// If legacy MS-DOS timestamps are set, we can use the delta between
+			// the legacy and extended versions to estimate timezone offset.
+			//
+			// A non-UTC timezone is always used (even if offset is zero).
+			// Thus, FileHeader.Modified.Location() == time.UTC is useful for
+			// determining whether extended timestamps are present.
+			// This is necessary for users that need to do additional time
+			// calculations when dealing with legacy ZIP formats.
+			if f.ModifiedTime != 0 || f.ModifiedDate != 0 {
+				f.Modified = modified.In(timeZone(msdosModified.Sub(modified)))
+			}
 		}
 	}
 
@@ -423,6 +647,19 @@ parseExtras:
 	// If nothing else, this keeps archive/zip working with 42.zip.
 	_ = needUSize
 
+	if lenient {
+		// Leave it to inferBrokenZip64, once all headers are read.
+		if needUSize {
+			f.missing |= missingUSize
+		}
+		if needCSize {
+			f.missing |= missingCSize
+		}
+		if needHeaderOffset {
+			f.missing |= missingOffset
+		}
+		return nil
+	}
 	if needCSize || needHeaderOffset {
 		return ErrFormat
 	}
@@ -637,7 +874,28 @@ func readDirectory64End(r io.ReaderAt, offset int64, d *directoryEnd) (err error
 	d.directoryRecords = b.uint64()   // total number of entries in the central directory
 	d.directorySize = b.uint64()      // size of the central directory
 	d.directoryOffset = b.uint64()    // offset of start of central directory with respect to the starting disk number
-
+	d.directory64Offset = offset
+
+	// Version 2 of the record describes an encrypted central directory.
+	recordLen := binary.LittleEndian.Uint64(buf[4:])
+	needed := binary.LittleEndian.Uint16(buf[14:])
+	if needed&0xff >= zipVersion62 && recordLen >= directory64EndLen-12+directory64EndV2Len {
+		buf := make([]byte, directory64EndV2Len)
+		if _, err := r.ReadAt(buf, offset+directory64EndLen); err != nil {
+			return err
+		}
+		b := readBuf(buf)
+		enc := &directoryEncryption{
+			method: b.uint16(),
+			csize:  b.uint64(),
+			usize:  b.uint64(),
+			algID:  b.uint16(),
+			bitLen: b.uint16(),
+		}
+		if enc.algID != 0 {
+			d.encryption = enc
+		}
+	}
 	return nil
 }
 
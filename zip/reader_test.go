@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
@@ -1061,3 +1063,292 @@ func TestIssue12449(t *testing.T) {
 		t.Errorf("Error reading the archive: %v", err)
 	}
 }
+
+func TestFileOpenCompressed(t *testing.T) {
+	contents := map[string]string{"a": strings.Repeat("hello ", 1000)}
+	b := buildRepairTestZip(t, contents, []string{"a"})
+	r, err := NewReaderBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+	cr, err := f.OpenCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Method != Deflate || cr.Size() != int64(f.CompressedSize64) || cr.UncompressedSize64 != 6000 {
+		t.Fatalf("got %+v", cr)
+	}
+	compressed, err := ioutil.ReadAll(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := DecompressLimited(cr.Method, compressed, int64(cr.UncompressedSize64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crc32.ChecksumIEEE(data) != cr.CRC32 || string(data) != contents["a"] {
+		t.Errorf("decompressed contents do not match")
+	}
+
+	// Entries running past the end of the archive are rejected upfront.
+	f.CompressedSize64 = uint64(len(b))
+	if _, err := f.OpenCompressed(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestFilesByOffset(t *testing.T) {
+	names := []string{"c", "a", "b"}
+	b := buildRepairTestZip(t, map[string]string{}, names)
+	r, err := NewReaderBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shuffle the central directory order.
+	r.File[0], r.File[2] = r.File[2], r.File[0]
+	files := r.FilesByOffset()
+	for i, f := range files {
+		if f.Name != names[i] {
+			t.Errorf("file %d: got %q, want %q", i, f.Name, names[i])
+		}
+	}
+	if r.File[0].Name != "b" {
+		t.Errorf("FilesByOffset modified r.File")
+	}
+}
+
+// concurrentOpenZip returns an archive holding a single deflated entry
+// of the given size.
+func concurrentOpenZip(tb testing.TB, size int) ([]byte, []byte) {
+	body := make([]byte, size)
+	for i := range body {
+		body[i] = byte(i * i >> 7)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fw, err := w.CreateHeader(&FileHeader{Name: "data", Method: Deflate})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	fw.Write(body)
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes(), body
+}
+
+func TestConcurrentOpenSameFile(t *testing.T) {
+	data, body := concurrentOpenZip(t, 1<<20)
+	r, err := NewReaderBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+
+	const readers = 8
+	errc := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		go func(i int) {
+			rc, err := f.Open()
+			if err != nil {
+				errc <- err
+				return
+			}
+			defer rc.Close()
+			// Interleave reads of different sizes between readers.
+			got := new(bytes.Buffer)
+			p := make([]byte, 1000+i*517)
+			for {
+				n, err := rc.Read(p)
+				got.Write(p[:n])
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					errc <- err
+					return
+				}
+			}
+			if !bytes.Equal(got.Bytes(), body) {
+				errc <- fmt.Errorf("reader %d: contents differ", i)
+				return
+			}
+			errc <- nil
+		}(i)
+	}
+	for i := 0; i < readers; i++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func BenchmarkConcurrentOpenSameFile(b *testing.B) {
+	data, body := concurrentOpenZip(b, 1<<20)
+	r, err := NewReaderBytes(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	f := r.File[0]
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rc, err := f.Open()
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+				b.Error(err)
+			}
+			rc.Close()
+		}
+	})
+}
+
+func TestFileOpenWithDecompressor(t *testing.T) {
+	b := buildRepairTestZip(t, map[string]string{"a": "hello"}, []string{"a"})
+	r, err := NewReaderBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+	// Pretend the entry records a method nothing is registered for.
+	f.Method = 0xfff1
+	if _, err := f.Open(); err == nil {
+		t.Fatal("Open: no error")
+	} else if me, ok := err.(*UnsupportedMethodError); !ok || me.Method != 0xfff1 || me.Entry != "a" {
+		t.Fatalf("Open: got error %#v, want an *UnsupportedMethodError", err)
+	}
+
+	called := false
+	rc, err := f.OpenWithDecompressor(func(r io.Reader, f *File) io.ReadCloser {
+		called = true
+		return newFlateReader(r, f)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called || string(got) != "hello" {
+		t.Errorf("got %q (decompressor called: %v), want %q", got, called, "hello")
+	}
+}
+
+// writeSizeRecorder records the largest write made to it.
+type writeSizeRecorder struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *writeSizeRecorder) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestFileWriteTo(t *testing.T) {
+	data := bytes.Repeat([]byte("write me out "), 100000)
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	w, err := zw.CreateHeader(&FileHeader{Name: "data", Method: Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, ok := rc.(io.WriterTo); !ok {
+		t.Fatal("entry reader is not an io.WriterTo")
+	}
+	dst := &writeSizeRecorder{}
+	n, err := io.Copy(dst, rc)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("copied %d bytes, %v", n, err)
+	}
+	if !bytes.Equal(dst.Bytes(), data) {
+		t.Error("contents differ")
+	}
+	if dst.max <= 32<<10 {
+		t.Errorf("largest write was %d bytes, want more than io.Copy's 32KiB", dst.max)
+	}
+
+	zr.File[0].CRC32++
+	rc, err = zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(ioutil.Discard, rc); err != ErrChecksum {
+		t.Errorf("copying with a bad CRC: got %v, want ErrChecksum", err)
+	}
+}
+
+// manyEntriesZip returns an archive of n empty entries with extended
+// timestamps, as most writers produce.
+func manyEntriesZip(tb testing.TB, n int) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		_, err := w.CreateHeader(&FileHeader{Name: fmt.Sprintf("dir/entry-%d.txt", i), Method: Store, Modified: mtime})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFastListing(t *testing.T) {
+	b := manyEntriesZip(t, 10)
+	r, err := NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{FastListing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != 10 {
+		t.Fatalf("got %d entries", len(r.File))
+	}
+	f := r.File[3]
+	if f.Name != "dir/entry-3.txt" || !f.Modified.IsZero() || f.ModifiedDate == 0 || len(f.Extra) == 0 {
+		t.Errorf("got %+v", f.FileHeader)
+	}
+	if err := readAllFile(f); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkListing(b *testing.B) {
+	zb := manyEntriesZip(b, 100000)
+	for _, fast := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fast=%v", fast), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := NewReaderWithOptions(bytes.NewReader(zb), int64(len(zb)), ReaderOptions{FastListing: fast})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
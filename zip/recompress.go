@@ -0,0 +1,124 @@
+package zip
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Recompress copies the file f (obtained from a Reader) into w like
+// CopyTransform with a nil transform, compressing its contents with w's
+// settings, as when repacking an archive at another flate level. Large
+// entries are kept busy on every compressing goroutine:
+//
+// Stored entries are read in ranges of the flate block size, as many at
+// once as blocks may be compressed at once, like CreateFromReaderAt
+// does, since their data can be read from anywhere. Other entries are
+// decompressed that many blocks ahead of the compressor, so that
+// inflating overlaps with deflating; deflate streams cannot be entered
+// in the middle, so decompression itself stays serial.
+//
+// The CRC-32 of stored entries is checked once they are copied.
+func (w *Writer) Recompress(f *File) error {
+	fh, err := w.transformHeader(f)
+	if err != nil {
+		return err
+	}
+	chunkSize, n := createFromChunkSize, 1
+	if fs := w.compressionSettings.Flate; fh.Method == Deflate && fs.BlockSize > 0 {
+		chunkSize, n = fs.BlockSize, fs.Blocks
+	}
+	if f.Method == Store && f.encryptionFeature() == 0 && f.zip.opts.StallTimeout == 0 &&
+		f.zip.opts.MaxEntrySize == 0 && f.zip.opts.MaxTotalSize == 0 {
+		return w.recompressStored(f, fh, uint64(chunkSize), n)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	fw, err := w.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	if err := copyAhead(fw, rc, chunkSize, n); err != nil {
+		return fmt.Errorf("zip: recompressing %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+func (w *Writer) recompressStored(f *File, fh *FileHeader, chunkSize uint64, n int) error {
+	offset, err := f.DataOffset()
+	if err != nil {
+		return err
+	}
+	fw, err := w.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	size := int64(f.CompressedSize64)
+	hash := crc32.NewIEEE()
+	written, err := copyReaderAt(io.MultiWriter(fw, hash), io.NewSectionReader(f.zipr, offset, size), size, chunkSize, n)
+	if err == nil && written != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && f.CRC32 != 0 && hash.Sum32() != f.CRC32 {
+		err = ErrChecksum
+	}
+	if err != nil {
+		return fmt.Errorf("zip: recompressing %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+// copyAhead copies r to dst, reading up to n chunks of chunkSize bytes
+// ahead of the writes on another goroutine.
+func copyAhead(dst io.Writer, r io.Reader, chunkSize, n int) error {
+	type chunk struct {
+		data []byte
+		err  error
+	}
+	chunks := make(chan chunk, n)
+	done := make(chan struct{})
+	// Don't return while the read goroutine is still using r.
+	var reads sync.WaitGroup
+	defer reads.Wait()
+	defer close(done)
+	reads.Add(1)
+	go func() {
+		defer reads.Done()
+		defer close(chunks)
+		for {
+			buf := make([]byte, chunkSize)
+			m, err := io.ReadFull(r, buf)
+			if err == io.ErrUnexpectedEOF || err == io.EOF {
+				err = nil
+				if m == 0 {
+					return
+				}
+			}
+			select {
+			case chunks <- chunk{data: buf[:m], err: err}:
+			case <-done:
+				return
+			}
+			if err != nil || m < chunkSize {
+				return
+			}
+		}
+	}()
+
+	for c := range chunks {
+		if len(c.data) > 0 {
+			if _, err := dst.Write(c.data); err != nil {
+				return err
+			}
+		}
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestRecompress(t *testing.T) {
+	// Compressible, but not trivially so.
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 1000000)
+	for i := range data {
+		data[i] = "abcdefgh"[rng.Intn(8)]
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range []*FileHeader{
+		{Name: "stored", Method: Store},
+		{Name: "deflated", Method: Deflate},
+		{Name: "empty", Method: Deflate},
+	} {
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fh.Name != "empty" {
+			fw.Write(data)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src := mustNewReader(t, buf.Bytes())
+
+	for _, level := range []int{1, 9} {
+		out := new(bytes.Buffer)
+		w := NewWriter(out)
+		s := DefaultCompressionSettings()
+		s.Flate.Level = level
+		s.Flate.BlockSize = 100000
+		if err := w.SetCompressionSettings(s); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range src.File {
+			if err := w.Recompress(f); err != nil {
+				t.Fatalf("level %d: %v", level, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		z := mustNewReader(t, out.Bytes())
+		for i, f := range z.File {
+			if f.Name != src.File[i].Name || f.Method != src.File[i].Method {
+				t.Errorf("level %d: entry %d is %s (method %d), want %s (method %d)",
+					level, i, f.Name, f.Method, src.File[i].Name, src.File[i].Method)
+			}
+			want := data
+			if f.Name == "empty" {
+				want = nil
+			}
+			if got := readFile(t, f); !bytes.Equal(got, want) {
+				t.Errorf("level %d: %s: got %d bytes, want %d", level, f.Name, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestRecompressStoredChecksum(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fw, err := w.CreateHeader(&FileHeader{Name: "stored", Method: Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "hello, world")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z := mustNewReader(t, buf.Bytes())
+	z.File[0].CRC32++
+
+	w = NewWriter(new(bytes.Buffer))
+	if err := w.Recompress(z.File[0]); err == nil {
+		t.Fatal("expected a checksum error")
+	}
+}
@@ -0,0 +1,236 @@
+package zip
+
+import (
+	"bufio"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// RecomputeHeaders fixes the CRC-32 and sizes recorded for the entries
+// of the archive of the given size stored in rw, for archives whose
+// producer wrote zeros or wrong values. Every entry is decompressed to
+// compute them, and only headers are rewritten, in place: local
+// headers, the CRC-32 of data descriptors, and the central directory.
+// It returns the new size of the archive, which the caller must
+// truncate rw to, and the names of the entries it fixed.
+//
+// Compressed sizes are measured for Deflate entries, and for Store
+// entries without a data descriptor that record none, from the gap to
+// the next entry. Other entries must record the right compressed size.
+// Local headers whose size fields cannot hold the new values are left
+// alone: readers going through the central directory, like this
+// package, ignore them.
+//
+// The archive is not modified if an error is returned before writing
+// starts, but an error while writing may leave it corrupt.
+func RecomputeHeaders(rw ReadWriterAt, size int64) (int64, []string, error) {
+	r, err := NewReader(rw, size)
+	if err != nil {
+		return 0, nil, err
+	}
+	end, err := readDirectoryEnd(rw, size)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Entries end where the next one starts, for measuring stored ones.
+	limits := make(map[*File]int64, len(r.File))
+	byOffset := r.FilesByOffset()
+	for i, f := range byOffset {
+		limits[f] = int64(end.directoryOffset)
+		if i+1 < len(byOffset) {
+			limits[f] = byOffset[i+1].headerOffset
+		}
+	}
+
+	headers := make([]FileHeader, len(r.File))
+	changed := make([]bool, len(r.File))
+	var fixed []string
+	for i, f := range r.File {
+		fh := withRawName(f.FileHeader)
+		if err := r.recompute(f, &fh, limits[f]); err != nil {
+			return 0, nil, fmt.Errorf("zip: %s: %v", f.Name, err)
+		}
+		if fh.CRC32 != f.CRC32 || fh.CompressedSize64 != f.CompressedSize64 || fh.UncompressedSize64 != f.UncompressedSize64 {
+			changed[i] = true
+			fixed = append(fixed, f.Name)
+		}
+		headers[i] = fh
+	}
+	if len(fixed) == 0 {
+		return size, nil, nil
+	}
+
+	for i, f := range r.File {
+		if !changed[i] {
+			continue
+		}
+		if err := fixLocalHeader(rw, f, &headers[i]); err != nil {
+			return 0, nil, err
+		}
+	}
+	newSize, err := rewriteDirectory(rw, r, end, headers)
+	if err != nil {
+		return 0, nil, err
+	}
+	return newSize, fixed, nil
+}
+
+// RecomputeHeadersInFile is like RecomputeHeaders for the zip file
+// specified by name, which it truncates to its new size. Writes go
+// through a journal, like those of RenameEntriesInFile.
+func RecomputeHeadersInFile(name string) ([]string, error) {
+	var fixed []string
+	err := updateFile(name, func(rw ReadWriterAt, size int64) (int64, error) {
+		var err error
+		size, fixed, err = RecomputeHeaders(rw, size)
+		return size, err
+	})
+	return fixed, err
+}
+
+// recompute sets the CRC-32 and sizes of fh from the contents of f,
+// whose data ends at limit at the latest.
+func (z *Reader) recompute(f *File, fh *FileHeader, limit int64) error {
+	bodyOffset, err := f.findBodyOffset()
+	if err != nil {
+		return err
+	}
+	start := f.headerOffset + bodyOffset
+	if start > limit {
+		return ErrFormat
+	}
+	crc := crc32.NewIEEE()
+
+	if f.Method == Deflate {
+		// Inflating reads exactly up to the end of the stream from
+		// an io.ByteReader, which gives the compressed size.
+		cr := &byteCounter{r: bufio.NewReader(io.NewSectionReader(z.r, start, limit-start))}
+		fr := flate.NewReader(cr)
+		n, err := io.Copy(crc, fr)
+		fr.Close()
+		if err != nil {
+			return err
+		}
+		fh.CompressedSize64 = uint64(cr.n)
+		fh.UncompressedSize64 = uint64(n)
+		fh.CRC32 = crc.Sum32()
+		return nil
+	}
+
+	csize := int64(f.CompressedSize64)
+	if f.Method == Store && csize == 0 && !f.hasDataDescriptor() {
+		csize = limit - start
+	}
+	if csize > limit-start {
+		return ErrFormat
+	}
+	dcomp := z.decompressor(f.Method)
+	if dcomp == nil {
+		return unsupportedMethod(f.Method, f.Name)
+	}
+	rc := dcomp(io.NewSectionReader(z.r, start, csize), f)
+	n, err := io.Copy(crc, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	fh.CompressedSize64 = uint64(csize)
+	fh.UncompressedSize64 = uint64(n)
+	fh.CRC32 = crc.Sum32()
+	return nil
+}
+
+// fixLocalHeader writes the CRC-32 and sizes of fh to the local header
+// of f, or to its data descriptor if it has one.
+func fixLocalHeader(rw ReadWriterAt, f *File, fh *FileHeader) error {
+	bodyOffset, err := f.findBodyOffset()
+	if err != nil {
+		return err
+	}
+	if f.hasDataDescriptor() {
+		// Local headers hold zeros then. Readers take sizes from
+		// the central directory, so only the CRC-32 is fixed.
+		off := f.headerOffset + bodyOffset + int64(fh.CompressedSize64)
+		var buf [4]byte
+		if _, err := rw.ReadAt(buf[:], off); err != nil {
+			return err
+		}
+		b := readBuf(buf[:])
+		if b.uint32() == dataDescriptorSignature {
+			off += 4
+		}
+		wb := writeBuf(buf[:])
+		wb.uint32(fh.CRC32)
+		_, err := rw.WriteAt(buf[:], off)
+		return err
+	}
+
+	var buf [12]byte // CRC-32, compressed and uncompressed sizes
+	if _, err := rw.ReadAt(buf[:], f.headerOffset+14); err != nil {
+		return err
+	}
+	b := readBuf(buf[4:])
+	zip64 := b.uint32() == uint32max && b.uint32() == uint32max
+	wb := writeBuf(buf[:])
+	wb.uint32(fh.CRC32)
+	switch {
+	case zip64:
+		if err := fixLocalZip64(rw, f, fh, bodyOffset); err != nil {
+			return err
+		}
+	case fh.CompressedSize64 < uint32max && fh.UncompressedSize64 < uint32max:
+		wb.uint32(uint32(fh.CompressedSize64))
+		wb.uint32(uint32(fh.UncompressedSize64))
+	default:
+		return nil
+	}
+	_, err = rw.WriteAt(buf[:], f.headerOffset+14)
+	return err
+}
+
+// fixLocalZip64 writes the sizes of fh to the zip64 extra field of the
+// local header of f, if it has one.
+func fixLocalZip64(rw ReadWriterAt, f *File, fh *FileHeader, bodyOffset int64) error {
+	extraOffset := f.headerOffset + fileHeaderLen + int64(len(f.Name))
+	extra := make([]byte, bodyOffset-(extraOffset-f.headerOffset))
+	if _, err := rw.ReadAt(extra, extraOffset); err != nil {
+		return err
+	}
+	pos := 0
+	for _, field := range parseExtra(extra) {
+		pos += 4
+		if field.id == zip64ExtraID && len(field.data) >= 16 {
+			var sizes [16]byte
+			wb := writeBuf(sizes[:])
+			wb.uint64(fh.UncompressedSize64)
+			wb.uint64(fh.CompressedSize64)
+			_, err := rw.WriteAt(sizes[:], extraOffset+int64(pos))
+			return err
+		}
+		pos += len(field.data)
+	}
+	return nil
+}
+
+// byteCounter counts the bytes read through it.
+type byteCounter struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,95 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zeroHeaders zeroes the CRC-32 and sizes of every central directory
+// header of b, and of the local headers of entries without a data
+// descriptor, as some exporters do.
+func zeroHeaders(t *testing.T, b []byte) {
+	t.Helper()
+	r := mustNewReader(t, b)
+	for _, f := range r.File {
+		if !f.hasDataDescriptor() {
+			copy(b[f.headerOffset+14:], make([]byte, 12))
+		}
+	}
+	end, err := readDirectoryEnd(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := int(end.directoryOffset)
+	for range r.File {
+		copy(b[p+16:], make([]byte, 12))
+		h := readBuf(b[p+28:])
+		p += directoryHeaderLen + int(h.uint16()) + int(h.uint16()) + int(h.uint16())
+	}
+}
+
+func TestRecomputeHeaders(t *testing.T) {
+	contents := map[string]string{
+		"deflated.txt": strings.Repeat("deflated ", 1000),
+		"stored.bin":   "stored contents",
+		"empty":        "",
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	fw, _ := w.Create("deflated.txt")
+	fw.Write([]byte(contents["deflated.txt"]))
+	raw := []byte(contents["stored.bin"])
+	fw, _ = w.CreateRaw(&FileHeader{Name: "stored.bin", Method: Store, CompressedSize64: uint64(len(raw))})
+	fw.Write(raw)
+	w.CreateRaw(&FileHeader{Name: "empty", Method: Store})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m := &memFile{b: buf.Bytes()}
+	zeroHeaders(t, m.b)
+
+	size, fixed, err := RecomputeHeaders(m, int64(len(m.b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.b = m.b[:size]
+	if want := []string{"deflated.txt", "stored.bin"}; !reflect.DeepEqual(fixed, want) {
+		t.Errorf("fixed %q, want %q", fixed, want)
+	}
+	for _, f := range mustNewReader(t, m.b).File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != contents[f.Name] {
+			t.Errorf("%s: got %d bytes, %v", f.Name, len(got), err)
+		}
+	}
+
+	// Local headers were fixed too.
+	lr := mustNewReader(t, m.b).File[1]
+	lb := readBuf(m.b[lr.headerOffset+14:])
+	if crc, csize := lb.uint32(), lb.uint32(); crc != lr.CRC32 || csize != uint32(len(raw)) {
+		t.Errorf("local header of stored.bin: CRC-32 %08x, size %d", crc, csize)
+	}
+
+	again, fixed, err := RecomputeHeaders(m, size)
+	if err != nil || again != size || fixed != nil {
+		t.Errorf("second pass: size %d, fixed %q, %v", again, fixed, err)
+	}
+}
+
+func TestRecomputeHeadersKeepsRawNames(t *testing.T) {
+	m := &memFile{b: buildCP437Zip(t)}
+	zeroHeaders(t, m.b)
+	size, _, err := RecomputeHeaders(m, int64(len(m.b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCP437Name(t, mustNewReader(t, m.b[:size]))
+}
@@ -0,0 +1,594 @@
+package zip
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A recovery record holds Reed-Solomon parity over an archive, so that
+// damaged parts of it can be rebuilt. AddRecoveryRecord appends it after
+// the end of central directory record, followed by a copy of the
+// central directory and a new end record pointing to that copy, so that
+// readers, which go by the last end record, still find the entries:
+//
+//	[archive, protected][header][parity blocks][header][directory copy][end]
+//
+// The protected bytes are cut into blocks, the last one padded with
+// zeros. Blocks are dealt out to stripes in turn, so that damage to a
+// run of consecutive blocks hits many stripes a little rather than one
+// a lot. Each stripe of k data blocks gets m parity blocks computed
+// with a Cauchy matrix over GF(2^8), and any m damaged blocks of a
+// stripe can be rebuilt. The header, stored twice, records the layout
+// and the CRC-32 of every block, which tells damaged ones.
+//
+// Header: signature, version (2 bytes), block size (4), protected size
+// (8), stripes (4), parity blocks per stripe (2), CRC-32 of each data
+// block then each parity block (4 each), CRC-32 of the header (4).
+
+const (
+	recoveryRecordSignature = 0x0c064b50 // "PK\x06\x0c"
+	recoveryVersion         = 1
+	recoveryHeaderFixedLen  = 24
+	recoveryMaxStripeBlocks = 128 // data blocks, leaving room for as many parity ones
+)
+
+var (
+	// ErrNoRecoveryRecord is returned by RepairFromRecoveryRecord for
+	// archives without an intact recovery record header.
+	ErrNoRecoveryRecord = errors.New("zip: no recovery record found")
+
+	errRecoveryRedundancy = errors.New("zip: recovery redundancy must be within (0,1]")
+)
+
+// RecoveryOptions configure AddRecoveryRecord.
+type RecoveryOptions struct {
+	// Redundancy is the share of each stripe of blocks that can be
+	// damaged and repaired, and about how much the record adds to the
+	// archive. Defaults to 0.05.
+	Redundancy float64
+	// BlockSize is the unit of damage: a flipped bit costs a block.
+	// Defaults to 64KiB, less for archives under 4MiB.
+	BlockSize int
+}
+
+// A RecoveryReport tells what RepairFromRecoveryRecord found.
+type RecoveryReport struct {
+	BlockSize int
+	// Damaged and Repaired count the damaged blocks of the protected
+	// archive, and those that were rebuilt.
+	Damaged  int
+	Repaired int
+	// Unrepairable holds the offsets of the damaged blocks that could
+	// not be rebuilt, their stripes having more damage than parity.
+	Unrepairable []int64
+}
+
+// recoveryLayout describes a recovery record.
+type recoveryLayout struct {
+	blockSize int64
+	protected int64 // size of the protected archive
+	stripes   int
+	parity    int // blocks per stripe
+	dataCRCs  []uint32
+	parCRCs   []uint32
+}
+
+func newRecoveryLayout(size int64, opts RecoveryOptions) (*recoveryLayout, error) {
+	r := opts.Redundancy
+	if r == 0 {
+		r = 0.05
+	}
+	if r < 0 || r > 1 {
+		return nil, errRecoveryRedundancy
+	}
+	bs := int64(opts.BlockSize)
+	if bs <= 0 {
+		bs = 64 << 10
+		if small := (size/64 + 511) &^ 511; small < bs {
+			bs = small
+		}
+		if bs < 512 {
+			bs = 512
+		}
+	}
+	blocks := (size + bs - 1) / bs
+	if blocks == 0 {
+		blocks = 1
+	}
+	stripes := (blocks + recoveryMaxStripeBlocks - 1) / recoveryMaxStripeBlocks
+	if stripes > math.MaxUint32 {
+		return nil, errors.New("zip: too many recovery blocks, use larger ones")
+	}
+	k := (blocks + stripes - 1) / stripes
+	m := int(math.Ceil(float64(k) * r))
+	if m < 1 {
+		m = 1
+	}
+	return &recoveryLayout{
+		blockSize: bs,
+		protected: size,
+		stripes:   int(stripes),
+		parity:    m,
+		dataCRCs:  make([]uint32, blocks),
+		parCRCs:   make([]uint32, int(stripes)*m),
+	}, nil
+}
+
+func (l *recoveryLayout) headerLen() int64 {
+	return recoveryHeaderFixedLen + 4*int64(len(l.dataCRCs)+len(l.parCRCs)) + 4
+}
+
+// parityOffset returns the offset of parity block j of stripe s.
+func (l *recoveryLayout) parityOffset(s, j int) int64 {
+	return l.protected + l.headerLen() + int64(s*l.parity+j)*l.blockSize
+}
+
+// end returns the offset right after the record.
+func (l *recoveryLayout) end() int64 {
+	return l.parityOffset(l.stripes, 0) + l.headerLen()
+}
+
+// stripeBlocks returns the indices of the data blocks of stripe s.
+func (l *recoveryLayout) stripeBlocks(s int) []int {
+	var blocks []int
+	for i := s; i < len(l.dataCRCs); i += l.stripes {
+		blocks = append(blocks, i)
+	}
+	return blocks
+}
+
+func (l *recoveryLayout) header() []byte {
+	buf := make([]byte, l.headerLen())
+	b := writeBuf(buf)
+	b.uint32(recoveryRecordSignature)
+	b.uint16(recoveryVersion)
+	b.uint32(uint32(l.blockSize))
+	b.uint64(uint64(l.protected))
+	b.uint32(uint32(l.stripes))
+	b.uint16(uint16(l.parity))
+	for _, crc := range l.dataCRCs {
+		b.uint32(crc)
+	}
+	for _, crc := range l.parCRCs {
+		b.uint32(crc)
+	}
+	b.uint32(crc32.ChecksumIEEE(buf[:len(buf)-4]))
+	return buf
+}
+
+// parseRecoveryHeader parses the header starting buf, which may go on
+// past it, and returns nil if it is not an intact one.
+func parseRecoveryHeader(buf []byte) *recoveryLayout {
+	if len(buf) < recoveryHeaderFixedLen {
+		return nil
+	}
+	b := readBuf(buf)
+	if b.uint32() != recoveryRecordSignature || b.uint16() != recoveryVersion {
+		return nil
+	}
+	l := &recoveryLayout{blockSize: int64(b.uint32()), protected: int64(b.uint64())}
+	l.stripes = int(b.uint32())
+	l.parity = int(b.uint16())
+	if l.blockSize <= 0 || l.protected < 0 || l.stripes <= 0 || l.parity <= 0 || l.parity > 256-recoveryMaxStripeBlocks {
+		return nil
+	}
+	blocks := (l.protected + l.blockSize - 1) / l.blockSize
+	if blocks == 0 {
+		blocks = 1
+	}
+	n := blocks + int64(l.stripes)*int64(l.parity)
+	if n > int64(len(b))/4 {
+		return nil
+	}
+	l.dataCRCs = make([]uint32, blocks)
+	l.parCRCs = make([]uint32, l.stripes*l.parity)
+	for i := range l.dataCRCs {
+		l.dataCRCs[i] = b.uint32()
+	}
+	for i := range l.parCRCs {
+		l.parCRCs[i] = b.uint32()
+	}
+	hlen := int(l.headerLen())
+	if len(buf) < hlen || crc32.ChecksumIEEE(buf[:hlen-4]) != binary.LittleEndian.Uint32(buf[hlen-4:]) {
+		return nil
+	}
+	return l
+}
+
+// readBlock reads block i of the protected archive, padded with zeros,
+// into buf, and reports whether it is intact.
+func (l *recoveryLayout) readBlock(r io.ReaderAt, i int, buf []byte) bool {
+	for j := range buf {
+		buf[j] = 0
+	}
+	off := int64(i) * l.blockSize
+	n := l.blockSize
+	if rem := l.protected - off; rem < n {
+		n = rem
+	}
+	m, _ := r.ReadAt(buf[:n], off)
+	return int64(m) == n && crc32.ChecksumIEEE(buf) == l.dataCRCs[i]
+}
+
+// AddRecoveryRecord appends a recovery record to the archive of the
+// given size stored in rw, and returns the new size of the archive. Up
+// to opts.Redundancy of the blocks of each stripe can then be rebuilt by
+// RepairFromRecoveryRecord if they are damaged, for archives stored for
+// a long time. The record is followed by a copy of the central
+// directory, which readers use from then on.
+//
+// Archives with an encrypted central directory are not supported.
+func AddRecoveryRecord(rw ReadWriterAt, size int64, opts RecoveryOptions) (int64, error) {
+	d, err := readDirectoryEnd(rw, size)
+	if err != nil {
+		return 0, err
+	}
+	if d.encryption != nil {
+		return 0, directoryEncryptionError(d)
+	}
+	l, err := newRecoveryLayout(size, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	data := make([][]byte, recoveryMaxStripeBlocks)
+	parity := make([][]byte, l.parity)
+	for j := range parity {
+		parity[j] = make([]byte, l.blockSize)
+	}
+	for s := 0; s < l.stripes; s++ {
+		blocks := l.stripeBlocks(s)
+		for c, i := range blocks {
+			if data[c] == nil {
+				data[c] = make([]byte, l.blockSize)
+			}
+			l.readBlock(rw, i, data[c])
+			l.dataCRCs[i] = crc32.ChecksumIEEE(data[c])
+		}
+		rsEncode(data[:len(blocks)], parity)
+		for j, p := range parity {
+			l.parCRCs[s*l.parity+j] = crc32.ChecksumIEEE(p)
+			if _, err := rw.WriteAt(p, l.parityOffset(s, j)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return writeRecoveryTail(rw, d, l)
+}
+
+// writeRecoveryTail writes the headers of the record, then the copy of
+// the central directory and end records, and returns where they end.
+func writeRecoveryTail(rw ReadWriterAt, d *directoryEnd, l *recoveryLayout) (int64, error) {
+	header := l.header()
+	if _, err := rw.WriteAt(header, l.protected); err != nil {
+		return 0, err
+	}
+	if _, err := rw.WriteAt(header, l.parityOffset(l.stripes, 0)); err != nil {
+		return 0, err
+	}
+
+	// Everything from the central directory to the end of the archive
+	// moves by delta: the directory, the zip64 end record and locator,
+	// and the end record with its comment.
+	start := int64(d.directoryOffset)
+	tail := make([]byte, l.protected-start)
+	if _, err := rw.ReadAt(tail, start); err != nil {
+		return 0, err
+	}
+	delta := uint64(l.end() - start)
+	endPos := len(tail) - directoryEndLen - int(d.commentLen)
+	if endPos < 0 || binary.LittleEndian.Uint32(tail[endPos:]) != directoryEndSignature {
+		return 0, errors.New("zip: cannot add a recovery record after data trailing the archive")
+	}
+	if d.directory64Offset > 0 {
+		p := d.directory64Offset - start
+		b := tail[p+48:]
+		binary.LittleEndian.PutUint64(b, binary.LittleEndian.Uint64(b)+delta)
+		b = tail[endPos-directory64LocLen+8:]
+		binary.LittleEndian.PutUint64(b, binary.LittleEndian.Uint64(b)+delta)
+	}
+	b := tail[endPos+16:]
+	if off := binary.LittleEndian.Uint32(b); off != uint32max {
+		moved := uint64(off) + delta
+		if moved >= uint32max {
+			return 0, errors.New("zip: central directory copy would need Zip64")
+		}
+		binary.LittleEndian.PutUint32(b, uint32(moved))
+	}
+	if _, err := rw.WriteAt(tail, l.end()); err != nil {
+		return 0, err
+	}
+	return l.end() + int64(len(tail)), nil
+}
+
+// findRecoveryHeader looks for an intact recovery record header in the
+// archive, from its end, since the one after the parity is closest.
+func findRecoveryHeader(r io.ReaderAt, size int64) *recoveryLayout {
+	const chunk = 1 << 20
+	sig := []byte{0x50, 0x4b, 0x06, 0x0c}
+	buf := make([]byte, chunk+3)
+	for end := size; end > 0; end -= chunk {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		n, _ := r.ReadAt(buf[:min64(uint64(end-start+3), uint64(size-start))], start)
+		b := buf[:n]
+		for i := len(b) - 4; i >= 0; i-- {
+			if b[i] != sig[0] || b[i+1] != sig[1] || b[i+2] != sig[2] || b[i+3] != sig[3] {
+				continue
+			}
+			fixed := make([]byte, recoveryHeaderFixedLen)
+			if _, err := r.ReadAt(fixed, start+int64(i)); err != nil {
+				continue
+			}
+			hl := headerLenFromFixed(fixed, size, size-(start+int64(i)))
+			if hl <= 0 {
+				continue
+			}
+			hdr := make([]byte, hl)
+			if _, err := r.ReadAt(hdr, start+int64(i)); err != nil {
+				continue
+			}
+			if l := parseRecoveryHeader(hdr); l != nil {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// headerLenFromFixed returns the length of the header whose fixed part
+// is b, in an archive of the given size, or 0 if it makes no sense or
+// is longer than the max bytes left after it starts. The fields come
+// from possibly damaged data, so they are bounded before they are
+// multiplied.
+func headerLenFromFixed(b []byte, size, max int64) int64 {
+	rb := readBuf(b[6:])
+	bs := int64(rb.uint32())
+	protected := int64(rb.uint64())
+	stripes := int64(rb.uint32())
+	parity := int64(rb.uint16())
+	if bs <= 0 || protected < 0 || protected > size || stripes <= 0 || parity <= 0 {
+		return 0
+	}
+	blocks := protected / bs
+	if protected%bs != 0 || blocks == 0 {
+		blocks++
+	}
+	// The header holds 4 bytes for each data and parity block.
+	room := (max - recoveryHeaderFixedLen - 4) / 4
+	if blocks > room || stripes > room/parity || blocks+stripes*parity > room {
+		return 0
+	}
+	return recoveryHeaderFixedLen + 4*(blocks+stripes*parity) + 4
+}
+
+// RepairFromRecoveryRecord rebuilds the damaged blocks of the archive
+// of the given size stored in rw from its recovery record, in place,
+// and rewrites the record and the central directory copy after it. It
+// returns the new size of the archive, which the caller must truncate
+// rw to; damage may have changed it. The archive is fully repaired if
+// the report lists no Unrepairable blocks.
+func RepairFromRecoveryRecord(rw ReadWriterAt, size int64) (int64, *RecoveryReport, error) {
+	l := findRecoveryHeader(rw, size)
+	if l == nil {
+		return 0, nil, ErrNoRecoveryRecord
+	}
+	report := &RecoveryReport{BlockSize: int(l.blockSize)}
+
+	data := make([][]byte, recoveryMaxStripeBlocks)
+	parity := make([][]byte, l.parity)
+	for s := 0; s < l.stripes; s++ {
+		blocks := l.stripeBlocks(s)
+		var missing []int // columns of damaged data blocks
+		for c, i := range blocks {
+			if data[c] == nil {
+				data[c] = make([]byte, l.blockSize)
+			}
+			if !l.readBlock(rw, i, data[c]) {
+				missing = append(missing, c)
+			}
+		}
+		var rows []int // intact parity blocks
+		for j := range parity {
+			if parity[j] == nil {
+				parity[j] = make([]byte, l.blockSize)
+			}
+			n, _ := rw.ReadAt(parity[j], l.parityOffset(s, j))
+			if int64(n) == l.blockSize && crc32.ChecksumIEEE(parity[j]) == l.parCRCs[s*l.parity+j] {
+				rows = append(rows, j)
+			}
+		}
+		report.Damaged += len(missing)
+		if len(missing) > len(rows) {
+			for _, c := range missing {
+				report.Unrepairable = append(report.Unrepairable, int64(blocks[c])*l.blockSize)
+			}
+			continue
+		}
+		if len(missing) > 0 {
+			rsReconstruct(data[:len(blocks)], parity, missing, rows[:len(missing)])
+			for _, c := range missing {
+				i := blocks[c]
+				n := l.blockSize
+				if rem := l.protected - int64(i)*l.blockSize; rem < n {
+					n = rem
+				}
+				if _, err := rw.WriteAt(data[c][:n], int64(i)*l.blockSize); err != nil {
+					return 0, report, err
+				}
+			}
+			report.Repaired += len(missing)
+		}
+		if len(rows) < l.parity {
+			// Rewrite the damaged parity, now that the data is whole.
+			rsEncode(data[:len(blocks)], parity)
+			for j, p := range parity {
+				if _, err := rw.WriteAt(p, l.parityOffset(s, j)); err != nil {
+					return 0, report, err
+				}
+			}
+		}
+	}
+	if len(report.Unrepairable) > 0 {
+		return size, report, nil
+	}
+
+	d, err := readDirectoryEnd(io.NewSectionReader(rw, 0, l.protected), l.protected)
+	if err != nil {
+		return 0, report, err
+	}
+	newSize, err := writeRecoveryTail(rw, d, l)
+	return newSize, report, err
+}
+
+// AddRecoveryRecordToFile is like AddRecoveryRecord for the zip file
+// specified by name. Writes go through a journal, like those of
+// RenameEntriesInFile.
+func AddRecoveryRecordToFile(name string, opts RecoveryOptions) error {
+	return updateFile(name, func(rw ReadWriterAt, size int64) (int64, error) {
+		return AddRecoveryRecord(rw, size, opts)
+	})
+}
+
+// RepairFileFromRecoveryRecord is like RepairFromRecoveryRecord for the
+// zip file specified by name.
+func RepairFileFromRecoveryRecord(name string) (*RecoveryReport, error) {
+	var report *RecoveryReport
+	err := updateFile(name, func(rw ReadWriterAt, size int64) (int64, error) {
+		newSize, r, err := RepairFromRecoveryRecord(rw, size)
+		report = r
+		return newSize, err
+	})
+	return report, err
+}
+
+// Reed-Solomon erasure coding over GF(2^8), with the polynomial 0x11d.
+
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// rsCoef returns the coefficient of data block c in parity block j: a
+// Cauchy matrix, any square submatrix of which is invertible.
+func rsCoef(j, c int) byte {
+	return gfInv(byte(j) ^ byte(recoveryMaxStripeBlocks+c))
+}
+
+// gfMulAdd adds c times src to dst.
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := int(gfLog[c])
+	for i, s := range src {
+		if s != 0 {
+			dst[i] ^= gfExp[int(gfLog[s])+lc]
+		}
+	}
+}
+
+// rsEncode computes the parity blocks of data.
+func rsEncode(data, parity [][]byte) {
+	for j, p := range parity {
+		for i := range p {
+			p[i] = 0
+		}
+		for c, d := range data {
+			gfMulAdd(p, d, rsCoef(j, c))
+		}
+	}
+}
+
+// rsReconstruct rebuilds the data blocks at columns missing from the
+// others and the parity blocks at rows, as many as missing.
+func rsReconstruct(data, parity [][]byte, missing, rows []int) {
+	e := len(missing)
+	isMissing := make(map[int]bool, e)
+	for _, c := range missing {
+		isMissing[c] = true
+	}
+	// Syndromes: the parity, minus what intact data contributes to it.
+	syn := make([][]byte, e)
+	for r, j := range rows {
+		syn[r] = append([]byte(nil), parity[j]...)
+		for c, d := range data {
+			if !isMissing[c] {
+				gfMulAdd(syn[r], d, rsCoef(j, c))
+			}
+		}
+	}
+	// Invert the matrix of the coefficients of the missing blocks.
+	a := make([][]byte, e)
+	inv := make([][]byte, e)
+	for r, j := range rows {
+		a[r] = make([]byte, e)
+		inv[r] = make([]byte, e)
+		inv[r][r] = 1
+		for k, c := range missing {
+			a[r][k] = rsCoef(j, c)
+		}
+	}
+	for col := 0; col < e; col++ {
+		pivot := col
+		for a[pivot][col] == 0 {
+			pivot++
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+		f := gfInv(a[col][col])
+		for k := 0; k < e; k++ {
+			a[col][k] = gfMul(a[col][k], f)
+			inv[col][k] = gfMul(inv[col][k], f)
+		}
+		for r := 0; r < e; r++ {
+			if r != col && a[r][col] != 0 {
+				f := a[r][col]
+				for k := 0; k < e; k++ {
+					a[r][k] ^= gfMul(f, a[col][k])
+					inv[r][k] ^= gfMul(f, inv[col][k])
+				}
+			}
+		}
+	}
+	for k, c := range missing {
+		d := data[c]
+		for i := range d {
+			d[i] = 0
+		}
+		for r := 0; r < e; r++ {
+			gfMulAdd(d, syn[r], inv[k][r])
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func buildRecoveryTestZip(t *testing.T) ([]byte, map[string][]byte) {
+	rnd := rand.New(rand.NewSource(1))
+	contents := make(map[string][]byte)
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, name := range []string{"a.bin", "b.bin", "c.bin"} {
+		b := make([]byte, 60000+rnd.Intn(10000))
+		rnd.Read(b)
+		contents[name] = b
+		fw, err := w.CreateHeader(&FileHeader{Name: name, Method: Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.SetComment("recovery test")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), contents
+}
+
+func checkRecoveryTestZip(t *testing.T, b []byte, contents map[string][]byte) {
+	t.Helper()
+	r := mustNewReader(t, b)
+	if len(r.File) != len(contents) {
+		t.Fatalf("got %d entries, want %d", len(r.File), len(contents))
+	}
+	if r.Comment != "recovery test" {
+		t.Errorf("comment = %q", r.Comment)
+	}
+	for _, f := range r.File {
+		if !bytes.Equal(readFile(t, f), contents[f.Name]) {
+			t.Errorf("%s: contents differ", f.Name)
+		}
+	}
+}
+
+func TestRecoveryRecord(t *testing.T) {
+	orig, contents := buildRecoveryTestZip(t)
+	m := &memFile{b: append([]byte(nil), orig...)}
+	size, err := AddRecoveryRecord(m, int64(len(m.b)), RecoveryOptions{Redundancy: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Truncate(size)
+	if !bytes.Equal(m.b[:len(orig)], orig) {
+		t.Fatal("protected archive changed")
+	}
+	checkRecoveryTestZip(t, m.b, contents)
+
+	// Undamaged archives repair to themselves.
+	protected := append([]byte(nil), m.b...)
+	size, report, err := RepairFromRecoveryRecord(m, int64(len(m.b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Damaged != 0 || size != int64(len(protected)) || !bytes.Equal(m.b, protected) {
+		t.Fatalf("undamaged archive changed by repair: %+v", report)
+	}
+
+	// Damage some blocks, including a run of them and the central
+	// directory, and cut off the end of the record.
+	bs := report.BlockSize
+	for _, off := range []int{100, 10 * bs, 11*bs + 7, 12 * bs, len(orig) - 30} {
+		m.b[off] ^= 0xff
+	}
+	m.Truncate(int64(len(m.b) - 50))
+
+	size, report, err = RepairFromRecoveryRecord(m, int64(len(m.b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Truncate(size)
+	if report.Damaged != 5 || report.Repaired != 5 || len(report.Unrepairable) != 0 {
+		t.Errorf("report = %+v, want 5 blocks damaged and repaired", report)
+	}
+	if !bytes.Equal(m.b, protected) {
+		t.Fatal("repaired archive differs from the protected one")
+	}
+	checkRecoveryTestZip(t, m.b, contents)
+}
+
+func TestRecoveryRecordParityDamage(t *testing.T) {
+	orig, contents := buildRecoveryTestZip(t)
+	m := &memFile{b: append([]byte(nil), orig...)}
+	size, err := AddRecoveryRecord(m, int64(len(m.b)), RecoveryOptions{BlockSize: 512, Redundancy: 0.02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Truncate(size)
+	protected := append([]byte(nil), m.b...)
+
+	// Damage parity and the first header copy: both get rewritten.
+	m.b[len(orig)+10] ^= 1
+	m.b[len(orig)+1<<12] ^= 1
+	m.b[700] ^= 1
+	size, report, err := RepairFromRecoveryRecord(m, int64(len(m.b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Truncate(size)
+	if report.Repaired != 1 || !bytes.Equal(m.b, protected) {
+		t.Fatalf("report = %+v, archive restored: %v", report, bytes.Equal(m.b, protected))
+	}
+	checkRecoveryTestZip(t, m.b, contents)
+}
+
+func TestRecoveryRecordUnrepairable(t *testing.T) {
+	orig, _ := buildRecoveryTestZip(t)
+	m := &memFile{b: append([]byte(nil), orig...)}
+	size, err := AddRecoveryRecord(m, int64(len(m.b)), RecoveryOptions{BlockSize: 4096, Redundancy: 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Truncate(size)
+	for off := 0; off < 4096*4; off += 4096 {
+		m.b[off+1] ^= 1
+	}
+	_, report, err := RepairFromRecoveryRecord(m, int64(len(m.b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unrepairable) != 4 || report.Repaired != 0 {
+		t.Errorf("report = %+v, want 4 unrepairable blocks", report)
+	}
+}
+
+func TestRecoveryRecordMissing(t *testing.T) {
+	orig, _ := buildRecoveryTestZip(t)
+	if _, _, err := RepairFromRecoveryRecord(&memFile{b: orig}, int64(len(orig))); err != ErrNoRecoveryRecord {
+		t.Errorf("err = %v, want ErrNoRecoveryRecord", err)
+	}
+}
+
+func TestRecoveryRecordCorruptHeader(t *testing.T) {
+	for _, tt := range []struct {
+		protected uint64
+		stripes   uint32
+		parity    uint16
+	}{
+		{1<<61 - 9, 1, 1}, // 4*blocks overflows
+		{1<<63 + 1, 1, 1},
+		{8, 1<<32 - 1, 1<<16 - 1},
+		{8, 1, 1}, // sane, but longer than the file
+	} {
+		b := make([]byte, 64)
+		h := b[16:]
+		copy(h, []byte{0x50, 0x4b, 0x06, 0x0c})
+		wb := writeBuf(h[6:])
+		wb.uint32(1) // block size
+		wb.uint64(tt.protected)
+		wb.uint32(tt.stripes)
+		wb.uint16(tt.parity)
+		m := &memFile{b: b}
+		if _, _, err := RepairFromRecoveryRecord(m, int64(len(b))); err != ErrNoRecoveryRecord {
+			t.Errorf("%+v: err = %v, want ErrNoRecoveryRecord", tt, err)
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	data := make([][]byte, 20)
+	for i := range data {
+		data[i] = make([]byte, 64)
+		rnd.Read(data[i])
+	}
+	parity := make([][]byte, 6)
+	for j := range parity {
+		parity[j] = make([]byte, 64)
+	}
+	rsEncode(data, parity)
+	want := make([][]byte, len(data))
+	for i, d := range data {
+		want[i] = append([]byte(nil), d...)
+	}
+	missing := []int{0, 3, 4, 19, 11, 7}
+	for _, c := range missing {
+		io.ReadFull(rnd, data[c])
+	}
+	rsReconstruct(data, parity, missing, []int{5, 0, 2, 1, 4, 3})
+	for i := range data {
+		if !bytes.Equal(data[i], want[i]) {
+			t.Errorf("block %d not reconstructed", i)
+		}
+	}
+}
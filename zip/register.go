@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"runtime"
 	"sync"
 
 	"github.com/itchio/arkive/pflate"
@@ -31,6 +32,8 @@ type Decompressor func(r io.Reader, f *File) io.ReadCloser
 
 type CompressionSettings struct {
 	Flate FlateSettings
+	Zstd  ZstdSettings
+	Xz    XzSettings
 }
 
 type FlateSettings struct {
@@ -40,6 +43,10 @@ type FlateSettings struct {
 	BlockSize int
 	// Defaults to 16 (Minimum 1)
 	Blocks int
+	// If non-nil, blocks are compressed on the pool's workers, which
+	// may be shared with other Writers, rather than on goroutines of
+	// their own.
+	Pool *pflate.Pool
 }
 
 func (fs *FlateSettings) Validate() error {
@@ -55,21 +62,120 @@ func (fs *FlateSettings) Validate() error {
 	return nil
 }
 
+// Normalize replaces the zero fields of fs that have a default with it.
+// The level is left alone, since zero means no compression.
+func (fs *FlateSettings) Normalize() {
+	if fs.BlockSize == 0 {
+		fs.BlockSize = defaultCompressionSettings.Flate.BlockSize
+	}
+	if fs.Blocks == 0 {
+		fs.Blocks = defaultCompressionSettings.Flate.Blocks
+	}
+}
+
+// ZstdSettings configure the Zstandard compressor, registered by
+// package github.com/itchio/arkive/methods/zstd.
+type ZstdSettings struct {
+	// Between 1 and 22, like the levels of the zstd command. Only
+	// some are distinct for now. 0, which Validate accepts, stands for
+	// the default, 3, which Normalize puts in its place.
+	Level int
+	// Largest back-reference distance, in bytes: a power of two
+	// between 1KiB and 512MiB. Defaults to what Level calls for.
+	Window int
+	// Goroutines compressing each entry. Defaults to GOMAXPROCS.
+	Workers int
+}
+
+// Window sizes Zstandard frames may use, as far as the compressor goes.
+const (
+	zstdMinWindow = 1 << 10
+	zstdMaxWindow = 1 << 29
+)
+
+// Validate checks zs. Zero fields are valid, and stand for defaults.
+func (zs *ZstdSettings) Validate() error {
+	if zs.Level < 0 || zs.Level > 22 {
+		return fmt.Errorf("zstd settings: level must be within [1,22], or 0 for the default, was %d", zs.Level)
+	}
+	if w := zs.Window; w != 0 && (w < zstdMinWindow || w > zstdMaxWindow || w&(w-1) != 0) {
+		return fmt.Errorf("zstd settings: window must be a power of two within [%d,%d], was %d", zstdMinWindow, zstdMaxWindow, w)
+	}
+	if zs.Workers < 0 {
+		return fmt.Errorf("zstd settings: workers must be equal or greater than 0")
+	}
+	return nil
+}
+
+// Normalize replaces the zero fields of zs that have a default with it.
+func (zs *ZstdSettings) Normalize() {
+	if zs.Level == 0 {
+		zs.Level = defaultCompressionSettings.Zstd.Level
+	}
+	if zs.Workers == 0 {
+		zs.Workers = runtime.GOMAXPROCS(0)
+	}
+}
+
+// XzSettings configure XZ compressors. None is built in: they are for
+// compressors registered for the XZ method to honor.
+type XzSettings struct {
+	// Between 0 and 9, like the presets of the xz command.
+	Preset int
+	// Goroutines compressing each entry. Defaults to GOMAXPROCS.
+	Workers int
+}
+
+func (xs *XzSettings) Validate() error {
+	if xs.Preset < 0 || xs.Preset > 9 {
+		return fmt.Errorf("xz settings: preset must be within [0,9], was %d", xs.Preset)
+	}
+	if xs.Workers < 0 {
+		return fmt.Errorf("xz settings: workers must be equal or greater than 0")
+	}
+	return nil
+}
+
+// Normalize replaces the zero fields of xs that have a default with it.
+// The preset is left alone, since zero is the fastest one.
+func (xs *XzSettings) Normalize() {
+	if xs.Workers == 0 {
+		xs.Workers = runtime.GOMAXPROCS(0)
+	}
+}
+
 func (cs *CompressionSettings) Validate() error {
 	err := cs.Flate.Validate()
 	if err != nil {
 		return err
 	}
+	if err := cs.Zstd.Validate(); err != nil {
+		return err
+	}
+	if err := cs.Xz.Validate(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// Normalize fills in the defaults of every section of cs, so that
+// settings only configuring some methods pass Validate, and compressors
+// see actual values. SetCompressionSettings does it.
+func (cs *CompressionSettings) Normalize() {
+	cs.Flate.Normalize()
+	cs.Zstd.Normalize()
+	cs.Xz.Normalize()
+}
+
 var defaultCompressionSettings = CompressionSettings{
 	Flate: FlateSettings{
 		Level:     flate.DefaultCompression,
 		BlockSize: 256 * 1024, // 256KiB
 		Blocks:    16,
 	},
+	Zstd: ZstdSettings{Level: 3},
+	Xz:   XzSettings{Preset: 6},
 }
 
 var bestCompressionSettings = CompressionSettings{
@@ -78,6 +184,8 @@ var bestCompressionSettings = CompressionSettings{
 		BlockSize: 512 * 1024, // 512KiB
 		Blocks:    16,
 	},
+	Zstd: ZstdSettings{Level: 19},
+	Xz:   XzSettings{Preset: 9},
 }
 
 func DefaultCompressionSettings() CompressionSettings {
@@ -88,11 +196,62 @@ func BestCompressionSettings() CompressionSettings {
 	return bestCompressionSettings
 }
 
+// flateWriterPools holds a sync.Pool of *pflate.Writer per
+// flateWriterKey, since a writer's block compressors are tied to its
+// level.
+var flateWriterPools sync.Map // map[flateWriterKey]*sync.Pool
+
+// flateWriterKey is FlateSettings without the Pool, which is set on
+// each writer as it is taken out: keying on it would keep a sync.Pool
+// for every pflate.Pool ever used, and the pflate.Pool with it.
+type flateWriterKey struct {
+	level, blockSize, blocks int
+}
+
 func newFlateWriter(s CompressionSettings, w io.Writer) io.WriteCloser {
-	fw, _ := pflate.NewWriter(w, s.Flate.Level)
+	key := flateWriterKey{s.Flate.Level, s.Flate.BlockSize, s.Flate.Blocks}
+	pi, ok := flateWriterPools.Load(key)
+	if !ok {
+		pi, _ = flateWriterPools.LoadOrStore(key, new(sync.Pool))
+	}
+	pool := pi.(*sync.Pool)
+	fw, ok := pool.Get().(*pflate.Writer)
+	if ok {
+		fw.Reset(w)
+	} else {
+		fw, _ = pflate.NewWriter(w, s.Flate.Level)
+	}
 	// error ignored on purpose
 	_ = fw.SetConcurrency(s.Flate.BlockSize, s.Flate.Blocks)
-	return fw
+	fw.SetPool(s.Flate.Pool)
+	return &pooledFlateWriter{fw: fw, pool: pool}
+}
+
+// pooledFlateWriter returns its writer to the pool once closed
+// successfully; a writer that failed may still have blocks in flight.
+type pooledFlateWriter struct {
+	fw   *pflate.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledFlateWriter) Write(p []byte) (n int, err error) {
+	if w.fw == nil {
+		return 0, errors.New("Write after Close")
+	}
+	return w.fw.Write(p)
+}
+
+func (w *pooledFlateWriter) Close() error {
+	if w.fw == nil {
+		return nil
+	}
+	err := w.fw.Close()
+	if err == nil {
+		w.fw.SetPool(nil)
+		w.pool.Put(w.fw)
+	}
+	w.fw = nil
+	return err
 }
 
 var flateReaderPool sync.Pool
@@ -148,7 +307,8 @@ func init() {
 }
 
 // RegisterDecompressor allows custom decompressors for a specified method ID.
-// The common methods Store and Deflate are built in.
+// The common methods Store and Deflate are built in; see package
+// github.com/itchio/arkive/methods for others, such as Zstd.
 func RegisterDecompressor(method uint16, dcomp Decompressor) {
 	if _, dup := decompressors.LoadOrStore(method, dcomp); dup {
 		panic("decompressor already registered")
@@ -156,13 +316,28 @@ func RegisterDecompressor(method uint16, dcomp Decompressor) {
 }
 
 // RegisterCompressor registers custom compressors for a specified method ID.
-// The common methods Store and Deflate are built in.
+// The common methods Store and Deflate are built in; see package
+// github.com/itchio/arkive/methods for others, such as Zstd.
 func RegisterCompressor(method uint16, comp Compressor) {
 	if _, dup := compressors.LoadOrStore(method, comp); dup {
 		panic("compressor already registered")
 	}
 }
 
+// UnregisterDecompressor removes the decompressor for a method ID,
+// including the built-in ones, so that archives using it fail with
+// an *UnsupportedMethodError. Readers' own decompressors are not affected.
+func UnregisterDecompressor(method uint16) {
+	decompressors.Delete(method)
+}
+
+// UnregisterCompressor removes the compressor for a method ID,
+// including the built-in ones, so that creating entries with it fails
+// with ErrAlgorithm. Writers' own compressors are not affected.
+func UnregisterCompressor(method uint16) {
+	compressors.Delete(method)
+}
+
 func compressor(method uint16) Compressor {
 	ci, ok := compressors.Load(method)
 	if !ok {
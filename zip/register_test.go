@@ -0,0 +1,43 @@
+package zip
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestCompressionSettingsValidate(t *testing.T) {
+	bad := []func(s *CompressionSettings){
+		func(s *CompressionSettings) { s.Zstd.Level = -1 },
+		func(s *CompressionSettings) { s.Zstd.Level = 23 },
+		func(s *CompressionSettings) { s.Zstd.Window = 3 << 20 },
+		func(s *CompressionSettings) { s.Zstd.Window = 512 },
+		func(s *CompressionSettings) { s.Zstd.Workers = -1 },
+		func(s *CompressionSettings) { s.Xz.Preset = 10 },
+		func(s *CompressionSettings) { s.Xz.Workers = -1 },
+	}
+	for i, f := range bad {
+		s := DefaultCompressionSettings()
+		f(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("#%d: invalid settings %+v validated", i, s)
+		}
+	}
+
+	// Settings only configuring flate get defaults for the rest.
+	s := CompressionSettings{Flate: FlateSettings{Level: 1}}
+	if err := s.Validate(); err == nil {
+		t.Error("zero flate block size validated")
+	}
+	s.Normalize()
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := CompressionSettings{
+		Flate: FlateSettings{Level: 1, BlockSize: 256 * 1024, Blocks: 16},
+		Zstd:  ZstdSettings{Level: 3, Workers: runtime.GOMAXPROCS(0)},
+		Xz:    XzSettings{Preset: 0, Workers: runtime.GOMAXPROCS(0)},
+	}
+	if s != want {
+		t.Errorf("normalized settings = %+v, want %+v", s, want)
+	}
+}
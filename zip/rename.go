@@ -0,0 +1,172 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReadWriterAt is the interface needed to update an archive in place.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// paddingExtraID marks the extra field RenameEntries uses to fill the
+// space freed in a local header by a shorter name.
+const paddingExtraID uint16 = 0x6b70 // "kp"
+
+// RenameEntries renames entries of the archive of the given size stored
+// in rw, mapping old names to new ones, without moving or recompressing
+// any entry data. It returns the new size of the archive, which the
+// caller must truncate rw to.
+//
+// The central directory is always rewritten. Local headers are updated
+// in place when the new name fits: when it has the same length, or is
+// shorter by at least 4 bytes, the difference being taken up by a
+// padding extra field. Otherwise the local header keeps the old name,
+// which readers going through the central directory, like this package,
+// ignore.
+//
+// RenameEntries returns a *NameCollisionError if a new name is already
+// used by an entry that is not renamed itself. The archive is not
+// modified if an error is returned before writing starts, but an error
+// while writing may leave it corrupt.
+func RenameEntries(rw ReadWriterAt, size int64, renames map[string]string) (int64, error) {
+	r, err := NewReader(rw, size)
+	if err != nil {
+		return 0, err
+	}
+	end, err := readDirectoryEnd(rw, size)
+	if err != nil {
+		return 0, err
+	}
+
+	names := make(map[string]bool, len(r.File))
+	for _, f := range r.File {
+		names[f.Name] = true
+	}
+	final := make(map[string]bool, len(r.File))
+	for _, f := range r.File {
+		name := f.Name
+		if newName, ok := renames[name]; ok {
+			if len(newName) > uint16max {
+				return 0, errLongName
+			}
+			name = newName
+		}
+		if final[name] {
+			return 0, &NameCollisionError{Name: name, Existing: name}
+		}
+		final[name] = true
+	}
+	for oldName := range renames {
+		if !names[oldName] {
+			return 0, fmt.Errorf("zip: no entry named %q", oldName)
+		}
+	}
+
+	headers := make([]FileHeader, len(r.File))
+	for i, f := range r.File {
+		fh := withRawName(f.FileHeader)
+		if newName, ok := renames[f.Name]; ok && newName != f.Name {
+			fh.Name = newName
+			fh.NonUTF8 = false
+			setUTF8Flag(&fh)
+			if err := renameLocalHeader(rw, f.headerOffset, &fh); err != nil {
+				return 0, err
+			}
+		}
+		headers[i] = fh
+	}
+	return rewriteDirectory(rw, r, end, headers)
+}
+
+// rewriteDirectory writes a central directory holding headers, one for
+// each entry of r, in place of the one described by end. It returns the
+// new size of the archive.
+func rewriteDirectory(rw ReadWriterAt, r *Reader, end *directoryEnd, headers []FileHeader) (int64, error) {
+	skip := int64(end.startSkipLen)
+	dirOffset := int64(end.directoryOffset)
+	w := NewWriter(&offsetWriter{w: rw, off: dirOffset})
+	w.SetOffset(dirOffset - skip)
+	if err := w.SetComment(r.Comment); err != nil {
+		return 0, err
+	}
+	for i, f := range r.File {
+		fh := headers[i]
+		// Close regenerates zip64 fields, which some writers add
+		// even to small entries.
+		fh.Extra = removeExtra(fh.Extra, zip64ExtraID)
+		if !fh.isZip64() {
+			fh.CompressedSize = uint32(fh.CompressedSize64)
+			fh.UncompressedSize = uint32(fh.UncompressedSize64)
+		}
+		w.dir = append(w.dir, &header{FileHeader: &fh, offset: uint64(f.headerOffset - skip)})
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return skip + w.cw.count, nil
+}
+
+// RenameEntriesInFile is like RenameEntries for the zip file specified
+// by name, which it truncates to its new size. Writes go through a
+// journal kept next to the file, so that the file is restored as it was
+// if renaming fails or is interrupted by a crash (see RecoverFile).
+func RenameEntriesInFile(name string, renames map[string]string) error {
+	return updateFile(name, func(rw ReadWriterAt, size int64) (int64, error) {
+		return RenameEntries(rw, size, renames)
+	})
+}
+
+// renameLocalHeader writes fh's name and flags to the local header at
+// offset if the name fits, and leaves it untouched otherwise.
+func renameLocalHeader(rw ReadWriterAt, offset int64, fh *FileHeader) error {
+	var buf [fileHeaderLen]byte
+	if _, err := rw.ReadAt(buf[:], offset); err != nil {
+		return err
+	}
+	b := readBuf(buf[:])
+	if sig := b.uint32(); sig != fileHeaderSignature {
+		return ErrFormat
+	}
+	b = b[22:] // skip over most of the header
+	nameLen := int(b.uint16())
+	extraLen := int(b.uint16())
+
+	extra := make([]byte, extraLen)
+	if _, err := rw.ReadAt(extra, offset+fileHeaderLen+int64(nameLen)); err != nil {
+		return err
+	}
+	switch diff := nameLen - len(fh.Name); {
+	case diff == 0:
+	case diff >= 4 && extraLen+diff <= uint16max:
+		extra = appendExtra(extra, paddingExtraID, make([]byte, diff-4))
+	default:
+		return nil
+	}
+
+	fields := writeBuf(buf[6:])
+	fields.uint16(fh.Flags)
+	fields = writeBuf(buf[26:])
+	fields.uint16(uint16(len(fh.Name)))
+	fields.uint16(uint16(len(extra)))
+	out := make([]byte, 0, fileHeaderLen+nameLen+extraLen)
+	out = append(out, buf[:]...)
+	out = append(out, fh.Name...)
+	out = append(out, extra...)
+	_, err := rw.WriteAt(out, offset)
+	return err
+}
+
+// offsetWriter writes sequentially to an io.WriterAt from an offset.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
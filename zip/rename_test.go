@@ -0,0 +1,145 @@
+package zip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// memFile is an in-memory ReadWriterAt.
+type memFile struct {
+	b []byte
+}
+
+func (m *memFile) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(m.b).ReadAt(p, off)
+}
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if need := int(off) + len(p); need > len(m.b) {
+		m.b = append(m.b, make([]byte, need-len(m.b))...)
+	}
+	return copy(m.b[off:], p), nil
+}
+
+func TestRenameEntries(t *testing.T) {
+	contents := map[string]string{
+		"a.txt":         strings.Repeat("alpha ", 100),
+		"long-name.txt": "bravo",
+		"dir/b.txt":     "charlie",
+		"keep.txt":      "delta",
+	}
+	names := []string{"a.txt", "long-name.txt", "dir/b.txt", "keep.txt"}
+	m := &memFile{b: buildRepairTestZip(t, contents, names)}
+
+	renames := map[string]string{
+		"a.txt":         "c.txt",                 // same length
+		"long-name.txt": "short.txt",             // shorter
+		"dir/b.txt":     "dir/much-longer-b.txt", // longer
+	}
+	size, err := RenameEntries(m, int64(len(m.b)), renames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.b = m.b[:size]
+
+	r, err := NewReader(bytes.NewReader(m.b), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLocal := map[string]string{
+		"c.txt":                 "c.txt",
+		"short.txt":             "short.txt",
+		"dir/much-longer-b.txt": "dir/b.txt",
+		"keep.txt":              "keep.txt",
+	}
+	for i, f := range r.File {
+		oldName := names[i]
+		wantName := oldName
+		if n, ok := renames[oldName]; ok {
+			wantName = n
+		}
+		if f.Name != wantName {
+			t.Errorf("entry %d: got name %q, want %q", i, f.Name, wantName)
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+		}
+		if string(b) != contents[oldName] {
+			t.Errorf("%s: got contents %q", f.Name, b)
+		}
+
+		var hdr [fileHeaderLen]byte
+		m.ReadAt(hdr[:], f.headerOffset)
+		nb := readBuf(hdr[26:])
+		nameLen := int(nb.uint16())
+		local := make([]byte, nameLen)
+		m.ReadAt(local, f.headerOffset+fileHeaderLen)
+		if string(local) != wantLocal[f.Name] {
+			t.Errorf("%s: local header name is %q, want %q", f.Name, local, wantLocal[f.Name])
+		}
+	}
+
+	_, err = RenameEntries(m, size, map[string]string{"c.txt": "keep.txt"})
+	if _, ok := err.(*NameCollisionError); !ok {
+		t.Errorf("renaming onto an existing entry: got %v, want a *NameCollisionError", err)
+	}
+	if _, err := RenameEntries(m, size, map[string]string{"nope": "x"}); err == nil {
+		t.Errorf("renaming a missing entry: expected an error")
+	}
+}
+
+// buildCP437Zip returns an archive holding "a.txt" and "caf\x82", the
+// CP-437 encoding of "café", without the UTF-8 flag.
+func buildCP437Zip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, fh := range []*FileHeader{
+		{Name: "a.txt", Method: Deflate},
+		{Name: "caf\x82", NonUTF8: true, Method: Deflate},
+	} {
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("contents of " + fh.Name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkCP437Name checks that the entry of r named "café" still has its
+// CP-437 name and flags.
+func checkCP437Name(t *testing.T, r *Reader) {
+	t.Helper()
+	for _, f := range r.File {
+		if f.Name != "café" {
+			continue
+		}
+		if f.NameRaw != "caf\x82" || f.Flags&0x800 != 0 {
+			t.Errorf("got raw name %q and flags %#x, want %q without the UTF-8 flag", f.NameRaw, f.Flags, "caf\x82")
+		}
+		return
+	}
+	t.Errorf("no entry named café")
+}
+
+func TestRenameEntriesKeepsRawNames(t *testing.T) {
+	m := &memFile{b: buildCP437Zip(t)}
+	size, err := RenameEntries(m, int64(len(m.b)), map[string]string{"a.txt": "b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCP437Name(t, mustNewReader(t, m.b[:size]))
+}
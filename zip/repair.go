@@ -0,0 +1,256 @@
+package zip
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// A Manifest is a known-good description of an archive's entries.
+// It is typically recorded when an archive is published, then used
+// by Repair to salvage a damaged copy of that archive.
+type Manifest struct {
+	Entries []ManifestEntry
+
+	// NewHash, if non-nil, creates the hash used to compute
+	// ManifestEntry.Hash over uncompressed contents.
+	NewHash func() hash.Hash
+}
+
+// A ManifestEntry describes a single entry of an archive.
+type ManifestEntry struct {
+	FileHeader
+
+	// Offset is the position of the entry's local file header,
+	// from the start of the archive file.
+	Offset int64
+
+	// Hash is the digest of the entry's uncompressed contents,
+	// computed with Manifest.NewHash.
+	Hash []byte
+}
+
+// NewManifest builds a Manifest from a known-good archive. If newHash
+// is non-nil, every entry is read to compute its Hash.
+func NewManifest(r *Reader, newHash func() hash.Hash) (*Manifest, error) {
+	m := &Manifest{
+		Entries: make([]ManifestEntry, 0, len(r.File)),
+		NewHash: newHash,
+	}
+	for _, f := range r.File {
+		e := ManifestEntry{
+			FileHeader: f.FileHeader,
+			Offset:     f.headerOffset,
+		}
+		if newHash != nil {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			h := newHash()
+			_, err = io.Copy(h, rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("zip: hashing %s: %v", f.Name, err)
+			}
+			e.Hash = h.Sum(nil)
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	return m, nil
+}
+
+// A FetchFunc returns the uncompressed contents of an entry that could
+// not be recovered from a damaged archive, for example by downloading
+// it again.
+type FetchFunc func(e *ManifestEntry) (io.ReadCloser, error)
+
+// RepairStatus tells what Repair did with an entry.
+type RepairStatus int
+
+const (
+	// EntryIntact entries were copied from the damaged archive.
+	EntryIntact RepairStatus = iota
+	// EntryRefetched entries were damaged and written from FetchFunc.
+	EntryRefetched
+	// EntryMissing entries were damaged and left out.
+	EntryMissing
+)
+
+func (s RepairStatus) String() string {
+	switch s {
+	case EntryIntact:
+		return "intact"
+	case EntryRefetched:
+		return "refetched"
+	case EntryMissing:
+		return "missing"
+	}
+	return fmt.Sprintf("RepairStatus(%d)", int(s))
+}
+
+// A RepairResult is the outcome of Repair for a single entry.
+type RepairResult struct {
+	Name   string
+	Status RepairStatus
+	// Damage tells why the entry could not be copied from the damaged
+	// archive. It is nil for intact entries.
+	Damage error
+}
+
+// A RepairReport lists what Repair did with each manifest entry.
+type RepairReport struct {
+	Entries []RepairResult
+}
+
+// Count returns the number of entries with the given status.
+func (rr *RepairReport) Count(status RepairStatus) int {
+	n := 0
+	for _, e := range rr.Entries {
+		if e.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Repair salvages the archive of the given size read from r, which may
+// be truncated, have garbage in places, or lack a central directory
+// entirely. Each entry of m is looked up at its recorded offset and
+// verified against its recorded name, sizes, CRC-32 and hash; intact
+// entries are copied to w without recompression. Damaged entries are
+// fetched with fetch if it is non-nil, and left out otherwise.
+//
+// The caller must Close w to write the rebuilt central directory.
+// Repair only returns an error if writing to w fails or if contents
+// returned by fetch do not match the manifest.
+func Repair(w *Writer, r io.ReaderAt, size int64, m *Manifest, fetch FetchFunc) (*RepairReport, error) {
+	report := &RepairReport{Entries: make([]RepairResult, 0, len(m.Entries))}
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		res := RepairResult{Name: e.Name}
+
+		body, damage := checkManifestEntry(r, size, m, e)
+		switch {
+		case damage == nil:
+			fh := withRawName(e.FileHeader)
+			fw, err := w.CreateRaw(&fh)
+			if err != nil {
+				return report, err
+			}
+			if _, err := io.Copy(fw, body); err != nil {
+				return report, err
+			}
+			res.Status = EntryIntact
+		case fetch != nil:
+			res.Damage = damage
+			if err := refetchEntry(w, e, fetch); err != nil {
+				return report, err
+			}
+			res.Status = EntryRefetched
+		default:
+			res.Damage = damage
+			res.Status = EntryMissing
+		}
+		report.Entries = append(report.Entries, res)
+	}
+	return report, nil
+}
+
+// checkManifestEntry verifies that e can be found intact in r, and returns
+// a reader for its compressed contents.
+func checkManifestEntry(r io.ReaderAt, size int64, m *Manifest, e *ManifestEntry) (*io.SectionReader, error) {
+	if e.Offset < 0 || e.Offset+fileHeaderLen > size {
+		return nil, fmt.Errorf("local header at %d is past the end of the archive", e.Offset)
+	}
+	var buf [fileHeaderLen]byte
+	if _, err := r.ReadAt(buf[:], e.Offset); err != nil {
+		return nil, err
+	}
+	b := readBuf(buf[:])
+	if sig := b.uint32(); sig != fileHeaderSignature {
+		return nil, fmt.Errorf("no local header signature at %d", e.Offset)
+	}
+	b = b[22:] // skip over most of the header
+	nameLen := int64(b.uint16())
+	extraLen := int64(b.uint16())
+	bodyOffset := e.Offset + fileHeaderLen + nameLen + extraLen
+	if bodyOffset+int64(e.CompressedSize64) > size {
+		return nil, fmt.Errorf("data is past the end of the archive")
+	}
+
+	// The local header name is raw: compare it with the raw name of
+	// the entry, which Name is decoded from in archives that are not
+	// UTF-8. Manifests built by hand may only have Name.
+	name := make([]byte, nameLen)
+	if _, err := r.ReadAt(name, e.Offset+fileHeaderLen); err != nil {
+		return nil, err
+	}
+	want := e.NameRaw
+	if want == "" {
+		want = e.Name
+	}
+	if string(name) != want {
+		return nil, fmt.Errorf("local header is for %q", name)
+	}
+
+	dcomp := decompressor(e.Method)
+	if dcomp == nil {
+		return nil, unsupportedMethod(e.Method, e.Name)
+	}
+	body := io.NewSectionReader(r, bodyOffset, int64(e.CompressedSize64))
+	rc := dcomp(body, &File{FileHeader: e.FileHeader})
+	defer rc.Close()
+
+	crc := crc32.NewIEEE()
+	var h hash.Hash
+	var dst io.Writer = crc
+	if m.NewHash != nil && e.Hash != nil {
+		h = m.NewHash()
+		dst = io.MultiWriter(crc, h)
+	}
+	n, err := io.Copy(dst, rc)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) != e.UncompressedSize64 {
+		return nil, fmt.Errorf("decompressed to %d bytes, want %d", n, e.UncompressedSize64)
+	}
+	if crc.Sum32() != e.CRC32 {
+		return nil, ErrChecksum
+	}
+	if h != nil && !bytes.Equal(h.Sum(nil), e.Hash) {
+		return nil, fmt.Errorf("hash mismatch")
+	}
+	return io.NewSectionReader(r, bodyOffset, int64(e.CompressedSize64)), nil
+}
+
+// refetchEntry writes e to w from contents returned by fetch.
+func refetchEntry(w *Writer, e *ManifestEntry, fetch FetchFunc) error {
+	rc, err := fetch(e)
+	if err != nil {
+		return fmt.Errorf("zip: fetching %s: %v", e.Name, err)
+	}
+	defer rc.Close()
+
+	fh := withRawName(e.FileHeader)
+	// Let CreateHeader regenerate the fields it owns.
+	for _, id := range []uint16{zip64ExtraID, extTimeExtraID, ntfsExtraID} {
+		fh.Extra = removeExtra(fh.Extra, id)
+	}
+	fw, err := w.CreateHeader(&fh)
+	if err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(fw, io.TeeReader(rc, crc))
+	if err != nil {
+		return err
+	}
+	if uint64(n) != e.UncompressedSize64 || crc.Sum32() != e.CRC32 {
+		return fmt.Errorf("zip: fetched contents of %s do not match the manifest", e.Name)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package zip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func buildRepairTestZip(t *testing.T, contents map[string]string, names []string) []byte {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, name := range names {
+		fw, err := w.CreateHeader(&FileHeader{Name: name, Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, contents[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRepair(t *testing.T) {
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	contents := map[string]string{
+		"a.txt": strings.Repeat("alpha ", 100),
+		"b.txt": strings.Repeat("bravo ", 100),
+		"c.txt": strings.Repeat("charlie ", 100),
+	}
+	good := buildRepairTestZip(t, contents, names)
+	gr, err := NewReader(bytes.NewReader(good), int64(len(good)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManifest(gr, sha256.New)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte in b.txt's data, and cut off the central directory.
+	damaged := append([]byte{}, good...)
+	off, err := gr.File[1].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged[off+3] ^= 0xff
+	cdOff := gr.File[2].headerOffset + 60
+	damaged = damaged[:cdOff]
+
+	for _, refetch := range []bool{false, true} {
+		var fetch FetchFunc
+		if refetch {
+			fetch = func(e *ManifestEntry) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader(contents[e.Name])), nil
+			}
+		}
+		out := new(bytes.Buffer)
+		w := NewWriter(out)
+		report, err := Repair(w, bytes.NewReader(damaged), int64(len(damaged)), m, fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		wantStatus := []RepairStatus{EntryIntact, EntryMissing, EntryMissing}
+		if refetch {
+			wantStatus = []RepairStatus{EntryIntact, EntryRefetched, EntryRefetched}
+		}
+		for i, res := range report.Entries {
+			if res.Status != wantStatus[i] {
+				t.Errorf("refetch=%v: %s is %v (%v), want %v", refetch, res.Name, res.Status, res.Damage, wantStatus[i])
+			}
+		}
+
+		r, err := NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := report.Count(EntryIntact) + report.Count(EntryRefetched); len(r.File) != want {
+			t.Fatalf("refetch=%v: repaired archive has %d entries, want %d", refetch, len(r.File), want)
+		}
+		for _, f := range r.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("refetch=%v: reading %s: %v", refetch, f.Name, err)
+			}
+			if string(b) != contents[f.Name] {
+				t.Errorf("refetch=%v: %s has wrong contents", refetch, f.Name)
+			}
+		}
+	}
+}
+
+func TestWriterCopy(t *testing.T) {
+	contents := map[string]string{"a": "hello hello hello", "b": ""}
+	src := buildRepairTestZip(t, contents, []string{"a", "b"})
+	sr, err := NewReader(bytes.NewReader(src), int64(len(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	w := NewWriter(out)
+	if err := w.Copy(sr.File[0]); err != nil {
+		t.Fatal(err)
+	}
+	// Without a data descriptor, CRC and sizes go in the local header.
+	fh := sr.File[1].FileHeader
+	fh.Flags &^= 0x8
+	fw, err := w.CreateRaw(&fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := sr.File[1].OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(fw, raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range r.File {
+		testReadFile(t, f, &WriteTest{Name: sr.File[i].Name, Data: []byte(contents[f.Name]), Mode: 0666})
+		if len(f.Extra) != len(sr.File[i].Extra) {
+			t.Errorf("%s: Extra has %d bytes after copy, want %d", f.Name, len(f.Extra), len(sr.File[i].Extra))
+		}
+	}
+}
+
+func TestWriterCopyNonUTF8Name(t *testing.T) {
+	sr := mustNewReader(t, buildCP437Zip(t))
+	out := new(bytes.Buffer)
+	w := NewWriter(out)
+	for _, f := range sr.File {
+		if err := w.Copy(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkCP437Name(t, mustNewReader(t, out.Bytes()))
+}
+
+func TestWriterCreateRawShortWrite(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer))
+	fh := &FileHeader{Name: "short", Method: Store, CompressedSize64: 10, UncompressedSize64: 10}
+	fw, err := w.CreateRaw(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("123"))
+	if err := w.Close(); err == nil {
+		t.Error("Close succeeded after a short raw write")
+	}
+}
+
+func TestRepairNonUTF8Name(t *testing.T) {
+	// "café.txt" in CP437.
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fw, err := w.CreateHeader(&FileHeader{Name: "caf\x82.txt", Method: Deflate, NonUTF8: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "coffee")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	gr := mustNewReader(t, good)
+	if gr.File[0].Name != "café.txt" {
+		t.Fatalf("name decoded as %q", gr.File[0].Name)
+	}
+	m, err := NewManifest(gr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	w = NewWriter(out)
+	report, err := Repair(w, bytes.NewReader(good), int64(len(good)), m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if res := report.Entries[0]; res.Status != EntryIntact {
+		t.Fatalf("%s is %v (%v), want intact", res.Name, res.Status, res.Damage)
+	}
+	r := mustNewReader(t, out.Bytes())
+	if f := r.File[0]; f.Name != "café.txt" || string(readFile(t, f)) != "coffee" {
+		t.Errorf("repaired entry is %q", f.Name)
+	}
+	if f := r.File[0]; f.NameRaw != "caf\x82.txt" || f.Flags&0x800 != 0 {
+		t.Errorf("repaired entry is stored as %q with flags %#x", f.NameRaw, f.Flags)
+	}
+}
@@ -0,0 +1,39 @@
+package zip
+
+import "errors"
+
+// SecurityDescriptorExtraID is the extra field ID used by
+// SetSecurityDescriptor. It sits in the range reserved for third-party
+// vendors, next to MetadataExtraID.
+const SecurityDescriptorExtraID uint16 = 0x6b73 // "sk"
+
+var errSecurityDescriptorTooLong = errors.New("zip: security descriptor does not fit in an extra field")
+
+// SetSecurityDescriptor records the Windows security descriptor of the
+// entry, in SDDL form (such as "O:BAG:SYD:(A;;FA;;;SY)"), replacing any
+// set earlier, so that deployments can restore owners and ACLs on
+// extraction. It is opt-in: nothing is recorded unless asked, and
+// extractors should only apply descriptors when told to, since they
+// usually require running elevated. An empty descriptor removes it.
+//
+// The descriptor is not validated here; arkive.CaptureSecurityDescriptor
+// and arkive.ApplySecurityDescriptor read and write it on Windows.
+func (h *FileHeader) SetSecurityDescriptor(sddl string) error {
+	extra := removeExtra(h.Extra, SecurityDescriptorExtraID)
+	if sddl == "" {
+		h.Extra = extra
+		return nil
+	}
+	if len(extra)+4+len(sddl) > uint16max {
+		return errSecurityDescriptorTooLong
+	}
+	h.Extra = appendExtra(extra, SecurityDescriptorExtraID, []byte(sddl))
+	return nil
+}
+
+// SecurityDescriptor returns the SDDL set with SetSecurityDescriptor, or
+// "" if the entry has none.
+func (h *FileHeader) SecurityDescriptor() string {
+	data, _ := findExtra(h.Extra, SecurityDescriptorExtraID)
+	return string(data)
+}
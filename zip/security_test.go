@@ -0,0 +1,49 @@
+package zip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSecurityDescriptor(t *testing.T) {
+	const sddl = "O:BAG:SYD:PAI(A;;FA;;;SY)(A;;FA;;;BA)(A;;0x1200a9;;;BU)"
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	fh := &FileHeader{Name: "app.exe"}
+	if err := fh.SetSecurityDescriptor("O:SYD:(A;;FA;;;SY)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fh.SetSecurityDescriptor(sddl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CreateHeader(fh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CreateHeader(&FileHeader{Name: "readme.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z := mustNewReader(t, buf.Bytes())
+	if got := z.File[0].SecurityDescriptor(); got != sddl {
+		t.Errorf("got %q, want %q", got, sddl)
+	}
+	if got := z.File[1].SecurityDescriptor(); got != "" {
+		t.Errorf("got %q for an entry without one", got)
+	}
+
+	h := z.File[0].FileHeader
+	if err := h.SetSecurityDescriptor(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.SecurityDescriptor(); got != "" {
+		t.Errorf("got %q after removing it", got)
+	}
+	if err := h.SetSecurityDescriptor(strings.Repeat("A", 70000)); err != errSecurityDescriptorTooLong {
+		t.Errorf("got %v for an oversized descriptor", err)
+	}
+}
@@ -0,0 +1,108 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxSymlinkTarget bounds how much of a symlink entry is read to find
+// its target.
+const maxSymlinkTarget = 4096
+
+// SelectFiles returns the files needed to extract just the entries with
+// the given names: the entries themselves, everything under those that
+// are directories, the directory entries of their parents, and the
+// targets of the symlinks among them, recursively. Files are returned
+// in the order of their local headers, so that extracting them reads
+// the archive front to back.
+//
+// Names may be given with or without a trailing slash for directories.
+// SelectFiles returns an error if a name matches no entry. Symlinks
+// pointing outside the archive are kept, without their targets.
+func (z *Reader) SelectFiles(names ...string) ([]*File, error) {
+	byName := make(map[string]*File, len(z.File))
+	for _, f := range z.File {
+		byName[strings.TrimSuffix(f.Name, "/")] = f
+	}
+
+	selected := make(map[*File]bool)
+	var queue []string
+	add := func(name string) bool {
+		name = strings.TrimSuffix(name, "/")
+		found := false
+		if f, ok := byName[name]; ok {
+			found = true
+			if !selected[f] {
+				selected[f] = true
+				queue = append(queue, name)
+			}
+		}
+		// Directories may be implicit, so look for children either way.
+		prefix := name + "/"
+		for _, f := range z.File {
+			if strings.HasPrefix(f.Name, prefix) {
+				found = true
+				if !selected[f] {
+					selected[f] = true
+					queue = append(queue, strings.TrimSuffix(f.Name, "/"))
+				}
+			}
+		}
+		return found
+	}
+
+	for _, name := range names {
+		if !add(name) {
+			return nil, fmt.Errorf("zip: no entry named %q", name)
+		}
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for p := path.Dir(name); p != "."; p = path.Dir(p) {
+			if f, ok := byName[p]; ok {
+				selected[f] = true
+			}
+		}
+
+		f := byName[name]
+		if f == nil || f.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := readSymlinkTarget(f)
+		if err != nil {
+			return nil, err
+		}
+		if path.IsAbs(target) {
+			continue
+		}
+		resolved := path.Join(path.Dir(name), target)
+		if !isLocalName(resolved) {
+			continue
+		}
+		add(resolved)
+	}
+
+	files := make([]*File, 0, len(selected))
+	for f := range selected {
+		files = append(files, f)
+	}
+	SortFilesByOffset(files)
+	return files, nil
+}
+
+func readSymlinkTarget(f *File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(rc, maxSymlinkTarget))
+	return string(b), err
+}
@@ -0,0 +1,68 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSelectFiles(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	add := func(name string, mode os.FileMode, body string) {
+		fh := &FileHeader{Name: name}
+		fh.SetMode(mode)
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, body)
+	}
+	add("lib/libfoo.so.1", 0755, "elf")
+	add("game/", os.ModeDir|0755, "")
+	add("game/bin/", os.ModeDir|0755, "")
+	add("game/bin/run", 0755, "#!/bin/sh")
+	add("game/bin/libfoo.so", os.ModeSymlink|0777, "../../lib/libfoo.so.1")
+	add("game/bin/outside", os.ModeSymlink|0777, "../../../etc/passwd")
+	add("game/data/a.dat", 0644, "a")
+	add("game/data/b.dat", 0644, "b")
+	add("other.txt", 0644, "other")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReaderBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(files []*File) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.Name)
+		}
+		return out
+	}
+
+	files, err := r.SelectFiles("game/bin/libfoo.so", "game/bin/outside", "game/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"lib/libfoo.so.1",
+		"game/",
+		"game/bin/",
+		"game/bin/libfoo.so",
+		"game/bin/outside",
+		"game/data/a.dat",
+		"game/data/b.dat",
+	}
+	if got := names(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := r.SelectFiles("nope.txt"); err == nil {
+		t.Errorf("expected an error for a missing entry")
+	}
+}
@@ -0,0 +1,36 @@
+package zip
+
+import "io"
+
+// WriteSkeleton writes to dst an archive with the same structure as r:
+// the same entries in the same order, with their names, comments,
+// times, attributes and extra fields, and the same archive comment, but
+// without any data. Such skeletons are tiny, which makes them handy as
+// test fixtures, or to compare the layout of two builds without
+// shipping their contents.
+//
+// Every entry of the skeleton is stored, with zero sizes and CRC-32, so
+// that it reads back as empty with any tool.
+func WriteSkeleton(dst io.Writer, r *Reader) error {
+	w := NewWriter(dst)
+	if err := w.SetComment(r.Comment); err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		if err := w.copySkeleton(f); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func (w *Writer) copySkeleton(f *File) error {
+	fh := f.FileHeader
+	fh.Method = Store
+	fh.Flags &^= 0x8 // no data descriptor
+	fh.CRC32 = 0
+	fh.CompressedSize64 = 0
+	fh.UncompressedSize64 = 0
+	_, err := w.CreateRaw(&fh)
+	return err
+}
@@ -0,0 +1,61 @@
+package zip
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSkeleton(t *testing.T) {
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	headers := []*FileHeader{
+		{Name: "bin/", Modified: mtime},
+		{Name: "bin/game", Method: Deflate, Modified: mtime, Comment: "the game"},
+		{Name: "data.pak", Method: Store, Modified: mtime},
+	}
+	headers[0].SetMode(os.ModeDir | 0755)
+	headers[1].SetMode(0755)
+	for _, fh := range headers {
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(fh.Name, "/") {
+			w.Write([]byte(strings.Repeat("content ", 10000)))
+		}
+	}
+	zw.SetComment("archive comment")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	orig := mustNewReader(t, buf.Bytes())
+
+	var skel bytes.Buffer
+	if err := WriteSkeleton(&skel, orig); err != nil {
+		t.Fatal(err)
+	}
+	if skel.Len() > 1024 {
+		t.Errorf("skeleton is %d bytes", skel.Len())
+	}
+	r := mustNewReader(t, skel.Bytes())
+	if r.Comment != orig.Comment || len(r.File) != len(orig.File) {
+		t.Fatalf("got comment %q and %d entries", r.Comment, len(r.File))
+	}
+	for i, f := range r.File {
+		o := orig.File[i]
+		if f.Name != o.Name || f.Comment != o.Comment || f.Mode() != o.Mode() || !f.Modified.Equal(o.Modified) {
+			t.Errorf("entry %d: got %s %q %v %v, want %s %q %v %v",
+				i, f.Name, f.Comment, f.Mode(), f.Modified, o.Name, o.Comment, o.Mode(), o.Modified)
+		}
+		if f.UncompressedSize64 != 0 {
+			t.Errorf("%s: size %d", f.Name, f.UncompressedSize64)
+		}
+		if err := readAllFile(f); err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+		}
+	}
+}
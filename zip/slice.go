@@ -0,0 +1,62 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewReaderBytes returns a Reader over the zip archive held in b,
+// such as one embedded in a binary or built by a test. Entries are read
+// straight from b: decompressors read sub-slices of it without going
+// through a buffer, readers of stored entries write their sub-slice
+// as is when copied with io.Copy, and OpenRaw returns readers over
+// sub-slices too. b must not be modified while the Reader is used.
+func NewReaderBytes(b []byte) (*Reader, error) {
+	zr := &Reader{data: b}
+	if err := zr.init(bytes.NewReader(b), int64(len(b))); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// slice returns the n bytes at off of the archive, for Readers created
+// by NewReaderBytes.
+func (z *Reader) slice(off, n int64) ([]byte, bool) {
+	if z == nil || z.data == nil || off < 0 || n < 0 || off+n > int64(len(z.data)) {
+		return nil, false
+	}
+	return z.data[off : off+n : off+n], true
+}
+
+// storedSliceReader reads a stored entry of a Reader created by
+// NewReaderBytes. Reads go through the checksumReader; WriteTo
+// hands the rest of the entry's sub-slice to the writer at once, rather
+// than copying it through a buffer.
+type storedSliceReader struct {
+	*checksumReader
+	br   *bytes.Reader // what the checksumReader reads from
+	data []byte
+}
+
+func (r *storedSliceReader) WriteTo(w io.Writer) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	rest := r.data[len(r.data)-r.br.Len():]
+	r.br.Seek(0, io.SeekEnd)
+	r.hash.Write(rest)
+	r.nread += uint64(len(rest))
+	n, err := w.Write(rest)
+	if err == nil && n != len(rest) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		r.err = err
+		return int64(n), err
+	}
+	// The data is consumed: this Read checks the sizes and checksum.
+	if _, err := r.checksumReader.Read(nil); err != io.EOF {
+		return int64(n), err
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,94 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// sliceRecorder keeps the slices it is given, without copying them.
+type sliceRecorder struct {
+	writes [][]byte
+}
+
+func (s *sliceRecorder) Write(p []byte) (int, error) {
+	s.writes = append(s.writes, p)
+	return len(p), nil
+}
+
+func TestNewReaderBytes(t *testing.T) {
+	contents := strings.Repeat("embedded ", 1000)
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range []*FileHeader{
+		{Name: "stored.txt", Method: Store},
+		{Name: "deflated.txt", Method: Deflate},
+	} {
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, contents)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	z, err := NewReaderBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range z.File {
+		if got := string(readFile(t, f)); got != contents {
+			t.Errorf("%s: got %d bytes, want %d", f.Name, len(got), len(contents))
+		}
+		raw, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := raw.(*bytes.Reader); !ok {
+			t.Errorf("%s: OpenRaw returned a %T", f.Name, raw)
+		}
+	}
+
+	// Copying the stored entry writes a sub-slice of b.
+	stored := z.File[0]
+	offset, err := stored.DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := stored.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(rc, head); err != nil {
+		t.Fatal(err)
+	}
+	rec := new(sliceRecorder)
+	if _, err := io.Copy(rec, rc); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if len(rec.writes) != 1 || &rec.writes[0][0] != &b[offset+100] {
+		t.Errorf("stored entry copied in %d writes, want a single one of a sub-slice", len(rec.writes))
+	}
+
+	// The checksum is still verified.
+	corrupt := append([]byte(nil), b...)
+	corrupt[offset] ^= 0xff
+	z, err = NewReaderBytes(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err = z.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, rc); err != ErrChecksum {
+		t.Errorf("got %v, want ErrChecksum", err)
+	}
+}
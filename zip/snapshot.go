@@ -0,0 +1,205 @@
+package zip
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+var errSnapshotClosed = errors.New("zip: read from closed Snapshot")
+
+// A SnapshotFile is a ReadWriterAt to pass to in-place updates, such as
+// RenameEntries and RecomputeHeaders, so that Readers opened on its
+// snapshots keep a consistent view of the archive as it was, while the
+// update runs and after it. Servers can keep serving an archive that is
+// being maintained that way.
+//
+// Before each write and truncation, the contents about to change are
+// saved for every open snapshot, the first time only: snapshots cost
+// memory for what was overwritten since they were taken, which is
+// little for updates that only rewrite headers and the central
+// directory. Snapshots only see through writes made through the
+// SnapshotFile, in this process.
+type SnapshotFile struct {
+	rw ReadWriterAt
+
+	mu    sync.RWMutex // held for writing while the file changes
+	size  int64
+	snaps map[*Snapshot]bool
+}
+
+// NewSnapshotFile returns a SnapshotFile for the archive of the given
+// size stored in rw.
+func NewSnapshotFile(rw ReadWriterAt, size int64) *SnapshotFile {
+	return &SnapshotFile{rw: rw, size: size, snaps: make(map[*Snapshot]bool)}
+}
+
+// Size returns the current size of the archive.
+func (s *SnapshotFile) Size() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size
+}
+
+// ReadAt reads the current contents of the archive.
+func (s *SnapshotFile) ReadAt(p []byte, off int64) (int, error) {
+	return s.rw.ReadAt(p, off)
+}
+
+// WriteAt saves the contents p overwrites for open snapshots, then
+// writes p.
+func (s *SnapshotFile) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for snap := range s.snaps {
+		if err := snap.save(off, off+int64(len(p))); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.rw.WriteAt(p, off)
+	if end := off + int64(n); end > s.size {
+		s.size = end
+	}
+	return n, err
+}
+
+// Truncate saves the end of the archive for open snapshots, then
+// truncates the underlying file, which must have a Truncate method like
+// *os.File. Updates return the size to truncate to.
+func (s *SnapshotFile) Truncate(size int64) error {
+	t, ok := s.rw.(interface{ Truncate(int64) error })
+	if !ok {
+		return errors.New("zip: SnapshotFile cannot truncate its file")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for snap := range s.snaps {
+		if err := snap.save(size, s.size); err != nil {
+			return err
+		}
+	}
+	if err := t.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+// Snapshot returns a view of the archive as it is now, to open a Reader
+// on with NewReader(snap, snap.Size()). It must be closed once the
+// Reader is no longer used, so the SnapshotFile stops saving contents
+// for it.
+func (s *SnapshotFile) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := &Snapshot{f: s, size: s.size}
+	s.snaps[snap] = true
+	return snap
+}
+
+// A Snapshot is an io.ReaderAt over the contents of a SnapshotFile as
+// they were when it was taken.
+type Snapshot struct {
+	f      *SnapshotFile
+	size   int64
+	saved  []savedRange // sorted, not overlapping
+	closed bool
+}
+
+// savedRange holds original contents, starting at off.
+type savedRange struct {
+	off  int64
+	data []byte
+}
+
+func (r savedRange) end() int64 { return r.off + int64(len(r.data)) }
+
+// Size returns the size of the archive when the snapshot was taken.
+func (s *Snapshot) Size() int64 { return s.size }
+
+// ReadAt reads the contents of the archive as they were when the
+// snapshot was taken.
+func (s *Snapshot) ReadAt(p []byte, off int64) (int, error) {
+	s.f.mu.RLock()
+	defer s.f.mu.RUnlock()
+	if s.closed {
+		return 0, errSnapshotClosed
+	}
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	var eof error
+	if rem := s.size - off; int64(len(p)) > rem {
+		p = p[:rem]
+		eof = io.EOF
+	}
+	n, err := s.f.rw.ReadAt(p, off)
+	// Contents changed since the snapshot was taken come from saved
+	// ranges, which also cover any part of p truncated away.
+	end := off + int64(len(p))
+	i := sort.Search(len(s.saved), func(i int) bool { return s.saved[i].end() > off })
+	for ; i < len(s.saved) && s.saved[i].off < end; i++ {
+		r := s.saved[i]
+		if r.off <= off+int64(n) && r.end() > off+int64(n) {
+			n = int(min64(uint64(r.end()-off), uint64(len(p))))
+		}
+		if r.off >= off {
+			copy(p[r.off-off:], r.data)
+		} else {
+			copy(p, r.data[off-r.off:])
+		}
+	}
+	if n == len(p) {
+		return n, eof
+	}
+	return n, err
+}
+
+// Close releases the contents saved for the snapshot. Reads fail
+// afterwards.
+func (s *Snapshot) Close() error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	delete(s.f.snaps, s)
+	s.saved = nil
+	s.closed = true
+	return nil
+}
+
+// save keeps the current contents of [start, end) that are not saved
+// yet, within the snapshot's size. The SnapshotFile must be locked for
+// writing.
+func (s *Snapshot) save(start, end int64) error {
+	if end > s.size {
+		end = s.size
+	}
+	var gaps []savedRange
+	pos := start
+	for _, r := range s.saved {
+		if pos >= end {
+			break
+		}
+		if r.end() <= pos {
+			continue
+		}
+		if r.off > pos {
+			gaps = append(gaps, savedRange{off: pos, data: make([]byte, min64(uint64(r.off), uint64(end))-uint64(pos))})
+		}
+		pos = r.end()
+	}
+	if pos < end {
+		gaps = append(gaps, savedRange{off: pos, data: make([]byte, end-pos)})
+	}
+	for _, g := range gaps {
+		if _, err := s.f.rw.ReadAt(g.data, g.off); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	if len(gaps) == 0 {
+		return nil
+	}
+	s.saved = append(s.saved, gaps...)
+	sort.Slice(s.saved, func(i, j int) bool { return s.saved[i].off < s.saved[j].off })
+	return nil
+}
@@ -0,0 +1,76 @@
+package zip
+
+import (
+	"strings"
+	"testing"
+)
+
+func (m *memFile) Truncate(size int64) error {
+	m.b = m.b[:size]
+	return nil
+}
+
+func TestSnapshot(t *testing.T) {
+	contents := map[string]string{
+		"a-very-long-name.txt": strings.Repeat("alpha ", 100),
+		"b.txt":                "bravo",
+	}
+	names := []string{"a-very-long-name.txt", "b.txt"}
+	m := &memFile{b: buildRepairTestZip(t, contents, names)}
+	sf := NewSnapshotFile(m, int64(len(m.b)))
+
+	snap := sf.Snapshot()
+	before, err := NewReader(snap, snap.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := RenameEntries(sf, sf.Size(), map[string]string{"a-very-long-name.txt": "a.txt", "b.txt": "c.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size >= snap.Size() {
+		t.Fatalf("archive grew from %d to %d bytes, the test expects it to shrink", snap.Size(), size)
+	}
+	if err := sf.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reader opened before the update still works, and so does a
+	// new one over the same snapshot.
+	again, err := NewReader(snap, snap.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, z := range []*Reader{before, again} {
+		for i, f := range z.File {
+			if f.Name != names[i] {
+				t.Errorf("snapshot: entry %d is %q, want %q", i, f.Name, names[i])
+			}
+			if got := string(readFile(t, f)); got != contents[names[i]] {
+				t.Errorf("snapshot: %s: got %q", f.Name, got)
+			}
+		}
+	}
+
+	after, err := NewReader(sf, sf.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"a.txt", "c.txt"} {
+		if got := after.File[i].Name; got != want {
+			t.Errorf("after update: entry %d is %q, want %q", i, got, want)
+		}
+		if got := string(readFile(t, after.File[i])); got != contents[names[i]] {
+			t.Errorf("after update: %s: got %q", want, got)
+		}
+	}
+
+	snap.Close()
+	if len(sf.snaps) != 0 {
+		t.Error("closed snapshot still tracked")
+	}
+	if _, err := snap.ReadAt(make([]byte, 1), 0); err != errSnapshotClosed {
+		t.Errorf("read after Close: got %v", err)
+	}
+}
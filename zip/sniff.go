@@ -0,0 +1,164 @@
+package zip
+
+import (
+	"encoding/binary"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// sniffLen is how much of each entry FindExecutables reads, enough for
+// the PE header of most executables.
+const sniffLen = 1024
+
+// An ExecutableCandidate is an entry that FindExecutables thinks may be
+// a program to launch.
+type ExecutableCandidate struct {
+	File *File
+
+	// Format is "elf", "mach-o", "pe" or "script", from the first
+	// bytes of the entry, or empty if they are not recognized.
+	Format string
+	// Arch is the architecture binaries are built for, such as "x86",
+	// "x86_64", "arm" or "arm64", or empty if unknown.
+	Arch string
+	// Library is set for shared libraries: DLLs, dylibs and .so files.
+	Library bool
+
+	// Confidence is between 0 and 1, and adds up the evidence: the
+	// format, the execute bits and the name.
+	Confidence float64
+	// Reasons lists the evidence, for logs and debugging.
+	Reasons []string
+}
+
+// FindExecutables looks for the entries that are likely executables, for
+// launchers to pick one without extracting the archive: it reads the
+// first kilobyte of every regular file for ELF, Mach-O and PE headers
+// and script shebangs, and looks at execute bits and names. Candidates
+// are returned with the most likely first, then by name.
+//
+// Entries that cannot be read, for example because they are encrypted,
+// are judged on their mode and name only.
+func (z *Reader) FindExecutables() []ExecutableCandidate {
+	var candidates []ExecutableCandidate
+	buf := make([]byte, sniffLen)
+	for _, f := range z.File {
+		mode := f.Mode()
+		if !mode.IsRegular() {
+			continue
+		}
+		c := ExecutableCandidate{File: f}
+		if n := sniffEntry(f, buf); n > 0 {
+			sniffFormat(&c, buf[:n])
+		}
+		switch {
+		case c.Format == "script":
+			c.add(0.3, "shebang")
+		case c.Format != "" && c.Library:
+			c.add(0.1, c.Format+" library")
+		case c.Format != "":
+			c.add(0.6, c.Format+" executable")
+		}
+		if mode&0111 != 0 && !c.Library {
+			c.add(0.3, "execute bits")
+		}
+		if hint := executableNameHint(f.Name); hint != "" && !c.Library {
+			c.add(0.1, hint)
+		}
+		if c.Confidence > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].File.Name < candidates[j].File.Name
+	})
+	return candidates
+}
+
+func (c *ExecutableCandidate) add(confidence float64, reason string) {
+	c.Confidence += confidence
+	if c.Confidence > 1 {
+		c.Confidence = 1
+	}
+	c.Reasons = append(c.Reasons, reason)
+}
+
+// sniffEntry reads the start of f into buf, and returns how much it got.
+func sniffEntry(f *File, buf []byte) int {
+	if f.UncompressedSize64 < 4 {
+		return 0
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return 0
+	}
+	defer rc.Close()
+	n, _ := io.ReadFull(rc, buf)
+	return n
+}
+
+var (
+	elfMachines = map[uint16]string{3: "x86", 40: "arm", 62: "x86_64", 183: "arm64"}
+	machoCPUs   = map[uint32]string{7: "x86", 12: "arm", 0x01000007: "x86_64", 0x0100000c: "arm64"}
+	peMachines  = map[uint16]string{0x14c: "x86", 0x1c0: "arm", 0x8664: "x86_64", 0xaa64: "arm64"}
+)
+
+// sniffFormat recognizes executable formats from the start of a file.
+func sniffFormat(c *ExecutableCandidate, b []byte) {
+	le := binary.LittleEndian
+	switch {
+	case strings.HasPrefix(string(b), "#!"):
+		c.Format = "script"
+	case len(b) >= 20 && string(b[:4]) == "\x7fELF":
+		var order binary.ByteOrder = le
+		if b[5] == 2 {
+			order = binary.BigEndian
+		}
+		c.Format = "elf"
+		c.Arch = elfMachines[order.Uint16(b[18:])]
+		// Position-independent executables are shared objects too, so
+		// only the name tells them from libraries.
+		typ := order.Uint16(b[16:])
+		c.Library = typ == 3 && isSharedObjectName(c.File.Name)
+	case len(b) >= 16 && (le.Uint32(b) == 0xfeedface || le.Uint32(b) == 0xfeedfacf):
+		c.Format = "mach-o"
+		c.Arch = machoCPUs[le.Uint32(b[4:])]
+		c.Library = le.Uint32(b[12:]) != 2 // MH_EXECUTE
+	case len(b) >= 8 && binary.BigEndian.Uint32(b) == 0xcafebabe && binary.BigEndian.Uint32(b[4:]) < 20:
+		// A universal binary; Java class files share the magic, but
+		// have a version number where this has a small count.
+		c.Format = "mach-o"
+		c.Library = isSharedObjectName(c.File.Name)
+	case len(b) >= 0x40 && string(b[:2]) == "MZ":
+		off := int(le.Uint32(b[0x3c:]))
+		if off < 0 || off+24 > len(b) || string(b[off:off+4]) != "PE\x00\x00" {
+			return
+		}
+		c.Format = "pe"
+		c.Arch = peMachines[le.Uint16(b[off+4:])]
+		c.Library = le.Uint16(b[off+22:])&0x2000 != 0 // IMAGE_FILE_DLL
+	}
+}
+
+func isSharedObjectName(name string) bool {
+	base := path.Base(name)
+	return strings.HasSuffix(base, ".dylib") || strings.HasSuffix(base, ".so") || strings.Contains(base, ".so.")
+}
+
+// executableNameHint returns why name looks like that of an executable,
+// or an empty string.
+func executableNameHint(name string) string {
+	if strings.Contains(name, ".app/Contents/MacOS/") {
+		return "in an app bundle"
+	}
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".exe", ".sh", ".x86", ".x86_64", ".appimage", ".command", ".bat":
+		return ext + " extension"
+	}
+	return ""
+}
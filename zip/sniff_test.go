@@ -0,0 +1,92 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func elfHeader(typ, machine uint16) []byte {
+	b := make([]byte, 64)
+	copy(b, "\x7fELF\x02\x01\x01")
+	binary.LittleEndian.PutUint16(b[16:], typ)
+	binary.LittleEndian.PutUint16(b[18:], machine)
+	return b
+}
+
+func peHeader(machine, characteristics uint16) []byte {
+	b := make([]byte, 256)
+	copy(b, "MZ")
+	binary.LittleEndian.PutUint32(b[0x3c:], 0x80)
+	copy(b[0x80:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(b[0x84:], machine)
+	binary.LittleEndian.PutUint16(b[0x96:], characteristics)
+	return b
+}
+
+func TestFindExecutables(t *testing.T) {
+	entries := []struct {
+		name string
+		mode os.FileMode
+		data []byte
+	}{
+		{"readme.txt", 0644, []byte("hello, world")},
+		{"game.x86_64", 0755, elfHeader(3, 62)},
+		{"lib/libfoo.so", 0755, elfHeader(3, 62)},
+		{"Game.exe", 0644, peHeader(0x14c, 0x0102)},
+		{"steam_api.dll", 0644, peHeader(0x8664, 0x2102)},
+		{"launch.sh", 0644, []byte("#!/bin/sh\nexec ./game.x86_64\n")},
+		{"Game.app/Contents/MacOS/Game", 0755, []byte{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0, 0, 0x01, 0, 0, 0, 0, 2, 0, 0, 0}},
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, e := range entries {
+		fh := &FileHeader{Name: e.name, Method: Deflate}
+		fh.SetMode(e.mode)
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z := mustNewReader(t, buf.Bytes())
+	candidates := z.FindExecutables()
+
+	want := []struct {
+		name    string
+		format  string
+		arch    string
+		library bool
+	}{
+		{"Game.app/Contents/MacOS/Game", "mach-o", "arm64", false},
+		{"game.x86_64", "elf", "x86_64", false},
+		{"Game.exe", "pe", "x86", false},
+		{"launch.sh", "script", "", false},
+		{"lib/libfoo.so", "elf", "x86_64", true},
+		{"steam_api.dll", "pe", "x86_64", true},
+	}
+	if len(candidates) != len(want) {
+		for _, c := range candidates {
+			t.Logf("%s: %v %v", c.File.Name, c.Confidence, c.Reasons)
+		}
+		t.Fatalf("got %d candidates, want %d", len(candidates), len(want))
+	}
+	for i, w := range want {
+		c := candidates[i]
+		if c.File.Name != w.name || c.Format != w.format || c.Arch != w.arch || c.Library != w.library {
+			t.Errorf("candidate %d = %s %q %q library=%v, want %s %q %q library=%v",
+				i, c.File.Name, c.Format, c.Arch, c.Library, w.name, w.format, w.arch, w.library)
+		}
+	}
+	if c := candidates[0]; c.Confidence < 0.99 {
+		t.Errorf("%s: confidence %v, want about 1 (reasons %v)", c.File.Name, c.Confidence, c.Reasons)
+	}
+}
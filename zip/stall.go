@@ -0,0 +1,73 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// A TimeoutError is returned by entry readers when the archive yields
+// no data for ReaderOptions.StallTimeout.
+type TimeoutError struct {
+	Name  string        // entry being read
+	After time.Duration // the StallTimeout that elapsed
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("zip: reading %s: no data for %v", e.Name, e.After)
+}
+
+// Timeout reports true, like the errors of the net package.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Temporary reports true: the read may succeed when retried.
+func (e *TimeoutError) Temporary() bool { return true }
+
+// stallReader fails reads of r that take longer than timeout. Reads
+// happen in their own goroutine, as a stuck ReaderAt cannot be
+// interrupted; one that times out is abandoned, and the stallReader
+// fails from then on.
+type stallReader struct {
+	r       io.Reader
+	timeout time.Duration
+	name    string
+	buf     []byte // handed to the reading goroutine
+	err     error  // sticky
+}
+
+type stallResult struct {
+	n   int
+	err error
+}
+
+func newStallReader(r io.Reader, timeout time.Duration, name string) *stallReader {
+	return &stallReader{r: r, timeout: timeout, name: name}
+}
+
+func (sr *stallReader) Read(p []byte) (int, error) {
+	if sr.err != nil {
+		return 0, sr.err
+	}
+	if cap(sr.buf) < len(p) {
+		sr.buf = make([]byte, len(p))
+	}
+	buf := sr.buf[:len(p)]
+	done := make(chan stallResult, 1)
+	go func() {
+		n, err := sr.r.Read(buf)
+		done <- stallResult{n, err}
+	}()
+
+	timer := time.NewTimer(sr.timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		copy(p, buf[:res.n])
+		return res.n, res.err
+	case <-timer.C:
+		// The goroutine still owns buf.
+		sr.buf = nil
+		sr.err = &TimeoutError{Name: sr.name, After: sr.timeout}
+		return 0, sr.err
+	}
+}
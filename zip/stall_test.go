@@ -0,0 +1,76 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// stallingReaderAt blocks reads past limit until release is closed.
+type stallingReaderAt struct {
+	r       io.ReaderAt
+	limit   int64
+	release chan struct{}
+}
+
+func (s *stallingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > s.limit {
+		<-s.release
+	}
+	return s.r.ReadAt(p, off)
+}
+
+func TestStallTimeout(t *testing.T) {
+	data := bytes.Repeat([]byte("stalled "), 100000)
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	w, err := zw.CreateHeader(&FileHeader{Name: "big", Method: Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// The whole archive is available: the timeout does not get in the
+	// way.
+	zr, err := NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{StallTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+
+	// The data stops coming halfway through.
+	sr := &stallingReaderAt{r: bytes.NewReader(b), limit: int64(len(b) / 2), release: make(chan struct{})}
+	defer close(sr.release)
+	zr.File[0].zipr = sr
+	zr.opts.StallTimeout = 50 * time.Millisecond
+	rc, err = zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = io.Copy(ioutil.Discard, rc)
+	te, ok := err.(*TimeoutError)
+	if !ok || te.Name != "big" || !te.Timeout() {
+		t.Fatalf("got %v, want a *TimeoutError", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("timing out took %v", d)
+	}
+	if _, err := rc.Read(make([]byte, 10)); err != te {
+		t.Errorf("read after timing out: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package zip
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// WriterStats is a snapshot of a Writer's progress, see Writer.Stats.
+type WriterStats struct {
+	// Entries is the number of entries completed.
+	Entries int
+	// BytesIn is the number of uncompressed bytes written to entries.
+	// Entries created with CreateRaw or Copy count their uncompressed
+	// size once complete.
+	BytesIn int64
+	// BytesOut is the number of bytes written to the underlying
+	// writer: compressed data, headers and, after Close, the central
+	// directory. Data buffered by the Writer is not counted yet.
+	BytesOut int64
+	// Ratio is BytesOut divided by BytesIn, or zero before anything
+	// was written.
+	Ratio float64
+	// Elapsed is the time since the Writer was created.
+	Elapsed time.Duration
+	// ETA is how long the bytes left to write should take, projected
+	// from the throughput so far, or -1 if no total was given with
+	// SetTotalBytes or nothing was written yet.
+	ETA time.Duration
+}
+
+// writerStats is updated by the writing goroutine, and by compressing
+// goroutines for BytesOut, and read by whoever polls Stats.
+type writerStats struct {
+	now   func() time.Time
+	start time.Time
+
+	mu      sync.Mutex
+	entries int
+	in      int64
+	out     int64
+	total   int64
+}
+
+func newWriterStats(now func() time.Time) *writerStats {
+	return &writerStats{now: now, start: now()}
+}
+
+func (s *writerStats) addIn(n int64) {
+	s.mu.Lock()
+	s.in += n
+	s.mu.Unlock()
+}
+
+func (s *writerStats) addOut(n int64) {
+	s.mu.Lock()
+	s.out += n
+	s.mu.Unlock()
+}
+
+func (s *writerStats) addEntry() {
+	s.mu.Lock()
+	s.entries++
+	s.mu.Unlock()
+}
+
+// SetTotalBytes tells the Writer how many uncompressed bytes will be
+// written in all, for Stats to estimate the time left.
+func (w *Writer) SetTotalBytes(n int64) {
+	w.stats.mu.Lock()
+	w.stats.total = n
+	w.stats.mu.Unlock()
+}
+
+// Stats returns the progress of the Writer. Unlike its other methods,
+// Stats may be called from any goroutine while entries are written,
+// so long packaging jobs can display live status.
+func (w *Writer) Stats() WriterStats {
+	s := w.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := WriterStats{
+		Entries:  s.entries,
+		BytesIn:  s.in,
+		BytesOut: s.out,
+		Elapsed:  s.now().Sub(s.start),
+		ETA:      -1,
+	}
+	if s.in > 0 {
+		st.Ratio = float64(s.out) / float64(s.in)
+	}
+	if s.total > 0 && s.in > 0 {
+		left := s.total - s.in
+		if left < 0 {
+			left = 0
+		}
+		st.ETA = time.Duration(float64(st.Elapsed) * float64(left) / float64(s.in))
+	}
+	return st
+}
+
+// statsWriter counts the bytes that reach the underlying writer.
+type statsWriter struct {
+	w io.Writer
+	s *writerStats
+}
+
+func (sw *statsWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.s.addOut(int64(n))
+	return n, err
+}
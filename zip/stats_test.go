@@ -0,0 +1,84 @@
+package zip
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriterStats(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.stats.now = clock.Now
+	w.stats.start = clock.t
+
+	if st := w.Stats(); st.Entries != 0 || st.BytesIn != 0 || st.Ratio != 0 || st.ETA != -1 {
+		t.Errorf("initial stats: %+v", st)
+	}
+
+	w.SetTotalBytes(40000)
+	data := bytes.Repeat([]byte("all work and no play "), 1000)
+	for _, name := range []string{"a", "b"} {
+		fw, err := w.CreateHeader(&FileHeader{Name: name, Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(data[:10000]); err != nil {
+			t.Fatal(err)
+		}
+		clock.t = clock.t.Add(time.Second)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := w.Stats()
+	if st.Entries != 2 || st.BytesIn != 20000 {
+		t.Errorf("got %d entries and %d bytes in, want 2 and 20000", st.Entries, st.BytesIn)
+	}
+	if st.BytesOut != int64(buf.Len()) {
+		t.Errorf("BytesOut = %d, want %d", st.BytesOut, buf.Len())
+	}
+	if want := float64(buf.Len()) / 20000; st.Ratio != want {
+		t.Errorf("Ratio = %g, want %g", st.Ratio, want)
+	}
+	if st.Elapsed != 2*time.Second || st.ETA != 2*time.Second {
+		t.Errorf("Elapsed = %v, ETA = %v, want 2s and 2s", st.Elapsed, st.ETA)
+	}
+}
+
+func TestWriterStatsConcurrent(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				w.Stats()
+			}
+		}
+	}()
+	data := make([]byte, 1<<20)
+	for i := 0; i < 4; i++ {
+		fw, err := w.CreateHeader(&FileHeader{Name: string(rune('a' + i)), Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+	if st := w.Stats(); st.Entries != 4 || st.BytesIn != 4<<20 {
+		t.Errorf("got %+v", st)
+	}
+}
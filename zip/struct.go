@@ -30,7 +30,33 @@ const (
 	Store   uint16 = 0 // no compression
 	Deflate uint16 = 8 // DEFLATE compressed
 
-	LZMA uint16 = 14 // LZMA compressed
+	BZIP2 uint16 = 12 // bzip2 compressed
+	LZMA  uint16 = 14 // LZMA compressed
+	Zstd  uint16 = 93 // Zstandard compressed
+	XZ    uint16 = 95 // XZ compressed
+)
+
+// Other compression methods defined by APPNOTE.TXT, section 4.4.5, and
+// in common use. None of them is built in; they are for registering
+// compressors and decompressors, and for reporting what archives use.
+const (
+	Shrink         uint16 = 1  // legacy PKZIP
+	Reduce1        uint16 = 2  // legacy PKZIP, compression factor 1
+	Reduce2        uint16 = 3  // legacy PKZIP, compression factor 2
+	Reduce3        uint16 = 4  // legacy PKZIP, compression factor 3
+	Reduce4        uint16 = 5  // legacy PKZIP, compression factor 4
+	Implode        uint16 = 6  // legacy PKZIP
+	Deflate64      uint16 = 9  // Enhanced Deflating
+	DCLImplode     uint16 = 10 // PKWARE Data Compression Library Imploding
+	IBMCMPSC       uint16 = 16 // IBM z/OS CMPSC
+	IBMTERSE       uint16 = 18 // IBM TERSE
+	IBMLZ77        uint16 = 19 // IBM LZ77 z Architecture
+	ZstdDeprecated uint16 = 20 // Zstandard, before it was assigned Zstd
+	MP3            uint16 = 94 // MP3 compressed
+	JPEG           uint16 = 96 // JPEG variant
+	WavPack        uint16 = 97 // WavPack compressed
+	PPMd           uint16 = 98 // PPMd version I, Rev 1
+	AES            uint16 = 99 // WinZip AE-x encryption, see AESEncryption
 )
 
 const (
@@ -77,6 +103,7 @@ const (
 	unixExtraID        = 0x000d // UNIX
 	extTimeExtraID     = 0x5455 // Extended timestamp
 	infoZipUnixExtraID = 0x5855 // Info-ZIP Unix extension
+	unicodePathExtraID = 0x7075 // Info-ZIP Unicode Path
 )
 
 // FileHeader describes a file within a zip file.
@@ -101,6 +128,14 @@ type FileHeader struct {
 	// automatically sets the ZIP format's UTF-8 flag for valid UTF-8 strings.
 	NonUTF8 bool
 
+	// NameRaw and NameUnicode are only set when reading. NameRaw is the
+	// name as stored in the header, before any decoding. NameUnicode is
+	// the name from an Info-ZIP Unicode Path extra field, if there is one
+	// that was written for NameRaw. ReaderOptions.Names decides which of
+	// them Name comes from.
+	NameRaw     string
+	NameUnicode string
+
 	CreatorVersion uint16
 	ReaderVersion  uint16
 	Flags          uint16
@@ -115,7 +150,8 @@ type FileHeader struct {
 	// If only the MS-DOS date is present, the timezone is assumed to be UTC.
 	//
 	// When writing, an extended timestamp (which is timezone-agnostic) is
-	// always emitted. The legacy MS-DOS date field is encoded according to the
+	// emitted by default; see Writer.SetTimestampFormat for alternatives.
+	// The legacy MS-DOS date field is encoded according to the
 	// location of the Modified time.
 	Modified     time.Time
 	ModifiedTime uint16 // Deprecated: Legacy MS-DOS date; use Modified instead.
@@ -185,6 +221,9 @@ type directoryEnd struct {
 	commentLen         uint16
 	comment            string
 	startSkipLen       uint64
+
+	directory64Offset int64                // of the zip64 directory end, if any
+	encryption        *directoryEncryption // if the directory is encrypted
 }
 
 // timeZone returns a *time.Location based on the provided offset.
@@ -0,0 +1,169 @@
+package zip
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Summary describes the contents of an archive, as computed by
+// Reader.Summary. It only uses the central directory: no entry
+// is decompressed.
+type Summary struct {
+	Files    int // regular files
+	Dirs     int // explicit directory entries
+	Symlinks int
+
+	CompressedSize   uint64
+	UncompressedSize uint64
+
+	// Extensions maps lower-cased file extensions, including the leading
+	// dot, to statistics about files that have them. Files without an
+	// extension are counted under "".
+	Extensions map[string]*EntryStats
+
+	// Methods maps compression method IDs to statistics about the
+	// entries that use them.
+	Methods map[uint16]*EntryStats
+
+	// Largest lists the biggest files by uncompressed size, largest first.
+	Largest []*File
+
+	// EstimatedExtractTime is a rough guess of how long extracting
+	// every entry would take, based on the throughputs in SummaryOptions.
+	EstimatedExtractTime time.Duration
+}
+
+// EntryStats aggregates a group of entries in a Summary.
+type EntryStats struct {
+	Count            int
+	CompressedSize   uint64
+	UncompressedSize uint64
+}
+
+// Ratio returns the compressed size divided by the uncompressed size,
+// or 1 if the group is empty.
+func (s *EntryStats) Ratio() float64 {
+	if s.UncompressedSize == 0 {
+		return 1
+	}
+	return float64(s.CompressedSize) / float64(s.UncompressedSize)
+}
+
+// SummaryOptions tunes Reader.SummaryWithOptions.
+type SummaryOptions struct {
+	// Largest is how many files to list in Summary.Largest. Negative
+	// values list none, like zero.
+	Largest int
+
+	// Throughputs used for EstimatedExtractTime, in bytes per second
+	// of uncompressed data. Methods without an entry in Decompress are
+	// assumed to decompress at DecompressFallback.
+	Decompress         map[uint16]float64
+	DecompressFallback float64
+	Disk               float64
+
+	// PerEntry is a fixed cost added for every entry (file creation,
+	// metadata updates).
+	PerEntry time.Duration
+}
+
+// DefaultSummaryOptions returns the options used by Reader.Summary.
+// The throughputs are conservative figures for a desktop machine
+// writing to an SSD.
+func DefaultSummaryOptions() SummaryOptions {
+	return SummaryOptions{
+		Largest: 10,
+		Decompress: map[uint16]float64{
+			Store:   0, // free
+			Deflate: 200 << 20,
+		},
+		DecompressFallback: 50 << 20,
+		Disk:               150 << 20,
+		PerEntry:           100 * time.Microsecond,
+	}
+}
+
+// Summary computes statistics about the archive's contents, using
+// DefaultSummaryOptions.
+func (z *Reader) Summary() *Summary {
+	return z.SummaryWithOptions(DefaultSummaryOptions())
+}
+
+// SummaryWithOptions computes statistics about the archive's contents.
+func (z *Reader) SummaryWithOptions(opts SummaryOptions) *Summary {
+	s := &Summary{
+		Extensions: make(map[string]*EntryStats),
+		Methods:    make(map[uint16]*EntryStats),
+	}
+	add := func(m map[string]*EntryStats, key string, f *File) {
+		st := m[key]
+		if st == nil {
+			st = new(EntryStats)
+			m[key] = st
+		}
+		st.add(f)
+	}
+
+	var seconds float64
+	var files []*File
+	for _, f := range z.File {
+		s.CompressedSize += f.CompressedSize64
+		s.UncompressedSize += f.UncompressedSize64
+
+		ms := s.Methods[f.Method]
+		if ms == nil {
+			ms = new(EntryStats)
+			s.Methods[f.Method] = ms
+		}
+		ms.add(f)
+
+		seconds += opts.PerEntry.Seconds()
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			s.Dirs++
+			continue
+		case mode&os.ModeSymlink != 0:
+			s.Symlinks++
+			continue
+		}
+		s.Files++
+		files = append(files, f)
+		add(s.Extensions, strings.ToLower(path.Ext(f.Name)), f)
+
+		size := float64(f.UncompressedSize64)
+		tp, ok := opts.Decompress[f.Method]
+		if !ok {
+			tp = opts.DecompressFallback
+		}
+		if tp > 0 {
+			seconds += size / tp
+		}
+		if opts.Disk > 0 {
+			seconds += size / opts.Disk
+		}
+	}
+	s.EstimatedExtractTime = time.Duration(seconds * float64(time.Second))
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].UncompressedSize64 > files[j].UncompressedSize64
+	})
+	largest := opts.Largest
+	if largest < 0 {
+		largest = 0
+	}
+	if len(files) > largest {
+		files = files[:largest]
+	}
+	s.Largest = files
+	return s
+}
+
+func (s *EntryStats) add(f *File) {
+	s.Count++
+	s.CompressedSize += f.CompressedSize64
+	s.UncompressedSize += f.UncompressedSize64
+}
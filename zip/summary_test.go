@@ -0,0 +1,74 @@
+package zip
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReaderSummary(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	entries := []struct {
+		name   string
+		method uint16
+		mode   os.FileMode
+		size   int
+	}{
+		{"data/", Store, os.ModeDir | 0755, 0},
+		{"data/a.PNG", Store, 0644, 3000},
+		{"data/b.png", Store, 0644, 1000},
+		{"data/level.pak", Deflate, 0644, 50000},
+		{"README", Deflate, 0644, 200},
+		{"run.sh", Store, os.ModeSymlink | 0777, 8},
+	}
+	for _, e := range entries {
+		fh := &FileHeader{Name: e.name, Method: e.method}
+		fh.SetMode(e.mode)
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(strings.Repeat("x", e.size))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultSummaryOptions()
+	opts.Largest = 2
+	s := r.SummaryWithOptions(opts)
+	if s.Files != 4 || s.Dirs != 1 || s.Symlinks != 1 {
+		t.Errorf("got %d files, %d dirs, %d symlinks; want 4, 1, 1", s.Files, s.Dirs, s.Symlinks)
+	}
+	if s.UncompressedSize != 54208 {
+		t.Errorf("UncompressedSize = %d, want 54208", s.UncompressedSize)
+	}
+	if png := s.Extensions[".png"]; png == nil || png.Count != 2 || png.UncompressedSize != 4000 {
+		t.Errorf("Extensions[.png] = %+v, want 2 entries totalling 4000 bytes", png)
+	}
+	if none := s.Extensions[""]; none == nil || none.Count != 1 {
+		t.Errorf("Extensions[\"\"] = %+v, want 1 entry", none)
+	}
+	if d := s.Methods[Deflate]; d == nil || d.Count != 2 || d.Ratio() >= 1 {
+		t.Errorf("Methods[Deflate] = %+v, want 2 compressed entries", d)
+	}
+	if len(s.Largest) != 2 || s.Largest[0].Name != "data/level.pak" || s.Largest[1].Name != "data/a.PNG" {
+		t.Errorf("unexpected Largest list: %v", s.Largest)
+	}
+	if s.EstimatedExtractTime <= 0 {
+		t.Errorf("EstimatedExtractTime = %v, want > 0", s.EstimatedExtractTime)
+	}
+
+	opts.Largest = -1
+	if s := r.SummaryWithOptions(opts); len(s.Largest) != 0 {
+		t.Errorf("Largest = -1: got %d files, want none", len(s.Largest))
+	}
+}
@@ -0,0 +1,114 @@
+package zip
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// teeDepth is how many writes of the Writer each tee may lag behind.
+// Most are the size of the Writer's buffer, 4KiB.
+const teeDepth = 256
+
+// Tee makes w copy everything it writes to the underlying writer into
+// each of writers as well, such as a hash.Hash and an upload, so that
+// packaging and uploading overlap and the archive's digest is known as
+// soon as Close returns. Each tee is written to on a goroutine of its
+// own, and may lag behind by about a megabyte; beyond that, w waits for
+// it. Entries dropped for exceeding a size limit are not truncated
+// away, since tees have seen them. The first error a tee returns fails
+// w's next write, and Close.
+//
+// It must be called before any entry is created, and only once. Close
+// returns once every tee has been given all the data; it does not close
+// them.
+func (w *Writer) Tee(writers ...io.Writer) {
+	if w.last != nil || len(w.dir) != 0 || w.cw.w.(*bufio.Writer).Buffered() != 0 {
+		panic("zip: Tee called after data was written")
+	}
+	if w.tee != nil {
+		panic("zip: Tee called twice")
+	}
+	if len(writers) == 0 {
+		return
+	}
+	w.tee = newTeeWriter(w.dest, writers)
+	w.cw.w = bufio.NewWriter(&statsWriter{w: w.tee, s: w.stats})
+}
+
+// A teeWriter writes to dest, and queues copies of the data for tees.
+type teeWriter struct {
+	dest   io.Writer
+	queues []chan []byte
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error // first error of a tee
+	closed bool
+}
+
+func newTeeWriter(dest io.Writer, writers []io.Writer) *teeWriter {
+	t := &teeWriter{dest: dest}
+	for _, tw := range writers {
+		q := make(chan []byte, teeDepth)
+		t.queues = append(t.queues, q)
+		t.wg.Add(1)
+		go t.drain(tw, q)
+	}
+	return t
+}
+
+func (t *teeWriter) drain(w io.Writer, q chan []byte) {
+	defer t.wg.Done()
+	var err error
+	for p := range q {
+		if err != nil {
+			// Keep receiving, so the Writer never waits on this tee.
+			continue
+		}
+		if _, err = w.Write(p); err != nil {
+			t.mu.Lock()
+			if t.err == nil {
+				t.err = err
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+func (t *teeWriter) failed() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if err := t.failed(); err != nil {
+		return 0, err
+	}
+	n, err := t.dest.Write(p)
+	if n > 0 {
+		// The caller may reuse p, as bufio does, so tees get a copy.
+		data := append([]byte(nil), p[:n]...)
+		for _, q := range t.queues {
+			q <- data
+		}
+	}
+	return n, err
+}
+
+// close waits for the tees to be given everything written so far, and
+// returns the first error one of them returned.
+func (t *teeWriter) close() error {
+	t.mu.Lock()
+	closed := t.closed
+	t.closed = true
+	t.mu.Unlock()
+	if !closed {
+		for _, q := range t.queues {
+			close(q)
+		}
+	}
+	t.wg.Wait()
+	return t.failed()
+}
@@ -0,0 +1,83 @@
+package zip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// slowWriter sleeps before each write, like an upload would.
+type slowWriter struct {
+	buf   bytes.Buffer
+	delay time.Duration
+}
+
+func (s *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.buf.Write(p)
+}
+
+type failingWriter struct{ err error }
+
+func (f failingWriter) Write(p []byte) (int, error) { return 0, f.err }
+
+func TestTee(t *testing.T) {
+	dest := new(bytes.Buffer)
+	w := NewWriter(dest)
+	h := sha256.New()
+	upload := &slowWriter{delay: time.Millisecond}
+	w.Tee(h, upload)
+
+	data := bytes.Repeat([]byte("tee "), 100000)
+	for _, name := range []string{"a", "b"} {
+		fw, err := w.CreateHeader(&FileHeader{Name: name, Method: Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum := sha256.Sum256(dest.Bytes()); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Error("hash tee does not match the archive")
+	}
+	if !bytes.Equal(upload.buf.Bytes(), dest.Bytes()) {
+		t.Errorf("upload tee got %d bytes, want %d", upload.buf.Len(), dest.Len())
+	}
+	if err := w.Close(); err == nil {
+		t.Error("expected an error closing twice")
+	}
+}
+
+func TestTeeError(t *testing.T) {
+	errUpload := errors.New("upload failed")
+	w := NewWriter(new(bytes.Buffer))
+	w.Tee(failingWriter{errUpload})
+
+	fw, err := w.CreateHeader(&FileHeader{Name: "a", Method: Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(make([]byte, 100000))
+	if err := w.Close(); err != errUpload {
+		t.Errorf("Close returned %v, want %v", err, errUpload)
+	}
+}
+
+func TestTeeAfterWrite(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer))
+	if _, err := w.Create("a"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	w.Tee(ioutil.Discard)
+}
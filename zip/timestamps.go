@@ -0,0 +1,139 @@
+package zip
+
+import (
+	"time"
+)
+
+// A TimestampFormat selects how a Writer encodes entry modification times.
+type TimestampFormat int
+
+const (
+	// ExtendedTimestamps writes the MS-DOS date fields plus an Info-ZIP
+	// "extended timestamp" extra field (1s resolution). This is the default.
+	ExtendedTimestamps TimestampFormat = iota
+	// DOSTimestamps writes only the legacy MS-DOS date fields
+	// (2s resolution, no timezone).
+	DOSTimestamps
+	// NTFSTimestamps writes the MS-DOS date fields plus an NTFS extra
+	// field (100ns resolution).
+	NTFSTimestamps
+	// NoTimestamps writes 1980-01-01 00:00:00 in the MS-DOS date fields
+	// and no extra field, removing the extended and NTFS timestamp
+	// fields FileHeader.Extra may already hold, for deterministic builds.
+	NoTimestamps
+)
+
+// dosEpochDate is 1980-01-01, the earliest MS-DOS date.
+const dosEpochDate = 1<<5 | 1
+
+// SetTimestampFormat selects how the modification times of entries
+// created afterwards are encoded.
+func (w *Writer) SetTimestampFormat(f TimestampFormat) {
+	w.timestampFormat = f
+}
+
+// SetTimestampPrecision truncates the modification time of entries
+// created afterwards to a multiple of d, for example time.Second to
+// discard sub-second precision from NTFS timestamps, or 2*time.Second
+// to make extended timestamps agree with the MS-DOS fields.
+// Zero or negative values disable truncation.
+func (w *Writer) SetTimestampPrecision(d time.Duration) {
+	w.timestampPrecision = d
+}
+
+// SetTimeLocation sets the time zone the MS-DOS date fields of entries
+// created afterwards are encoded in, for readers without support for
+// extended timestamps, which are exact. Readers should be told the same
+// zone (see ReaderOptions.Location). If nil, the default, the fields
+// hold the wall clock of Modified in its own location, which is
+// time.Local for times from os.FileInfo.
+func (w *Writer) SetTimeLocation(loc *time.Location) {
+	w.timeLocation = loc
+}
+
+// encodeModified sets fh's MS-DOS date fields and appends the timestamp
+// extra field selected by the Writer's TimestampFormat.
+func (w *Writer) encodeModified(fh *FileHeader) {
+	if w.timestampFormat == NoTimestamps {
+		fh.Modified = time.Time{}
+		fh.ModifiedDate, fh.ModifiedTime = dosEpochDate, 0
+		// Timestamps carried over from another archive would make the
+		// output depend on when its entries were modified.
+		fh.Extra = removeExtra(fh.Extra, extTimeExtraID)
+		fh.Extra = removeExtra(fh.Extra, ntfsExtraID)
+		return
+	}
+
+	// If Modified is set, this takes precedence over MS-DOS timestamp fields.
+	if fh.Modified.IsZero() {
+		return
+	}
+	if w.timestampPrecision > 0 {
+		fh.Modified = fh.Modified.Truncate(w.timestampPrecision)
+	}
+
+	// Contrary to the FileHeader.SetModTime method, we intentionally
+	// do not convert to UTC, because we assume the user intends to encode
+	// the date using the specified timezone. A user may want this control
+	// because many legacy ZIP readers interpret the timestamp according
+	// to the local timezone.
+	//
+	// The timezone is only non-UTC if a user directly sets the Modified
+	// field directly themselves. All other approaches sets UTC.
+	if w.timeLocation != nil {
+		fh.ModifiedDate, fh.ModifiedTime = timeToMsDosTime(fh.Modified.In(w.timeLocation))
+	} else {
+		fh.ModifiedDate, fh.ModifiedTime = timeToMsDosTime(fh.Modified)
+	}
+	if w.compat.NoExtra {
+		return
+	}
+
+	switch w.timestampFormat {
+	case ExtendedTimestamps:
+		// Use "extended timestamp" format since this is what Info-ZIP uses.
+		// Nearly every major ZIP implementation uses a different format,
+		// but at least most seem to be able to understand the other formats.
+		//
+		// This format happens to be identical for both local and central header
+		// if modification time is the only timestamp being encoded.
+		var mbuf [9]byte // 2*SizeOf(uint16) + SizeOf(uint8) + SizeOf(uint32)
+		mt := uint32(fh.Modified.Unix())
+		eb := writeBuf(mbuf[:])
+		eb.uint16(extTimeExtraID)
+		eb.uint16(5)  // Size: SizeOf(uint8) + SizeOf(uint32)
+		eb.uint8(1)   // Flags: ModTime
+		eb.uint32(mt) // ModTime
+		fh.Extra = append(fh.Extra, mbuf[:]...)
+	case NTFSTimestamps:
+		// The NTFS extra field carries modification, access and creation
+		// times; we only know the first, so it is used for all three.
+		var mbuf [36]byte // 2*SizeOf(uint16) + SizeOf(uint32) + 2*SizeOf(uint16) + 3*SizeOf(uint64)
+		ts := timeToNTFSTime(fh.Modified)
+		eb := writeBuf(mbuf[:])
+		eb.uint16(ntfsExtraID)
+		eb.uint16(32) // Size: SizeOf(uint32) + 2*SizeOf(uint16) + 3*SizeOf(uint64)
+		eb.uint32(0)  // Reserved
+		eb.uint16(1)  // Attribute tag: timestamps
+		eb.uint16(24) // Attribute size: 3*SizeOf(uint64)
+		eb.uint64(ts) // ModTime
+		eb.uint64(ts) // AcTime
+		eb.uint64(ts) // CrTime
+		fh.Extra = append(fh.Extra, mbuf[:]...)
+	}
+}
+
+// dosTimeIn is like msDosTimeToTime, with the MS-DOS date fields taken
+// as a wall clock in loc.
+func dosTimeIn(dosDate, dosTime uint16, loc *time.Location) time.Time {
+	t := msDosTimeToTime(dosDate, dosTime)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+// timeToNTFSTime converts t to 100ns ticks since 1601-01-01 UTC.
+func timeToNTFSTime(t time.Time) uint64 {
+	const ticksPerSecond = 1e7 // Windows timestamp resolution
+	epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+	secs := t.Unix() - epoch.Unix()
+	return uint64(secs*ticksPerSecond + int64(t.Nanosecond())/(1e9/ticksPerSecond))
+}
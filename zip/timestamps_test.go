@@ -0,0 +1,124 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestWriterTimestampFormat(t *testing.T) {
+	mtime := time.Date(2019, time.March, 14, 15, 9, 27, 123456700, time.UTC)
+
+	tests := []struct {
+		format    TimestampFormat
+		precision time.Duration
+		want      time.Time
+		extra     int // expected length of Extra in the central directory
+	}{
+		{ExtendedTimestamps, 0, mtime.Truncate(time.Second), 9},
+		{DOSTimestamps, 0, time.Date(2019, time.March, 14, 15, 9, 26, 0, time.UTC), 0},
+		{NTFSTimestamps, 0, mtime, 36},
+		{NTFSTimestamps, time.Millisecond, mtime.Truncate(time.Millisecond), 36},
+		{NoTimestamps, 0, time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC), 0},
+	}
+
+	for i, tt := range tests {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		w.SetTimestampFormat(tt.format)
+		w.SetTimestampPrecision(tt.precision)
+		if _, err := w.CreateHeader(&FileHeader{Name: "a.txt", Modified: mtime}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := r.File[0]
+		if !f.Modified.Equal(tt.want) {
+			t.Errorf("#%d: Modified = %v, want %v", i, f.Modified, tt.want)
+		}
+		if len(f.Extra) != tt.extra {
+			t.Errorf("#%d: len(Extra) = %d, want %d", i, len(f.Extra), tt.extra)
+		}
+	}
+}
+
+func TestWriterNoTimestampsDeterministic(t *testing.T) {
+	build := func(mtime time.Time) []byte {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		w.SetTimestampFormat(NoTimestamps)
+		// Timestamp fields left over from another archive go too.
+		ext := make([]byte, 5)
+		ext[0] = 1
+		binary.LittleEndian.PutUint32(ext[1:], uint32(mtime.Unix()))
+		ntfs := make([]byte, 32)
+		binary.LittleEndian.PutUint16(ntfs[4:], 1)
+		binary.LittleEndian.PutUint16(ntfs[6:], 24)
+		binary.LittleEndian.PutUint64(ntfs[8:], uint64(mtime.UnixNano()/100))
+		extra := appendExtra(appendExtra(nil, extTimeExtraID, ext), ntfsExtraID, ntfs)
+		fh := &FileHeader{Name: "a.txt", Method: Deflate, Extra: extra}
+		fh.SetModTime(mtime)
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("same contents"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	a := build(time.Now())
+	b := build(time.Now().Add(-48 * time.Hour))
+	if !bytes.Equal(a, b) {
+		t.Error("archives built at different times differ")
+	}
+}
+
+func TestTimeLocation(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	mtime := time.Date(2019, time.March, 14, 15, 9, 26, 0, time.UTC)
+
+	for _, format := range []TimestampFormat{DOSTimestamps, ExtendedTimestamps} {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		w.SetTimestampFormat(format)
+		w.SetTimeLocation(tokyo)
+		if _, err := w.CreateHeader(&FileHeader{Name: "a.txt", Modified: mtime}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f := mustNewReader(t, buf.Bytes()).File[0]
+		if h := f.ModifiedTime >> 11; h != 0 {
+			t.Errorf("format %d: MS-DOS hour = %d, want 0 in Tokyo", format, h)
+		}
+
+		for _, loc := range []*time.Location{tokyo, time.UTC} {
+			r, err := NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ReaderOptions{Location: loc})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := r.File[0].Modified
+			if got.Location() != loc {
+				t.Errorf("format %d, %v: Modified in %v", format, loc, got.Location())
+			}
+			// Without an exact timestamp, reading in another zone
+			// than the one written is off by the difference.
+			want := mtime
+			if format == DOSTimestamps && loc == time.UTC {
+				want = mtime.Add(9 * time.Hour)
+			}
+			if !got.Equal(want) {
+				t.Errorf("format %d, %v: Modified = %v, want %v", format, loc, got, want)
+			}
+		}
+	}
+}
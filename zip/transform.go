@@ -0,0 +1,56 @@
+package zip
+
+import (
+	"fmt"
+	"io"
+)
+
+// CopyTransform copies the file f (obtained from a Reader) into w like
+// Copy, but decompresses its contents, passes them through transform,
+// and compresses what it returns with w's settings. Asset optimization
+// passes can run during a repack that way, for example optimizing PNGs
+// or normalizing line endings. A nil transform recompresses the
+// contents as they are.
+//
+// The entry keeps f's name and metadata, as copied by
+// FileHeader.CloneMetadataFrom, and its method if w has a compressor
+// for it, or Deflate otherwise. Sizes and CRC-32 are those of the
+// transformed contents.
+func (w *Writer) CopyTransform(f *File, transform func(io.Reader) io.Reader) error {
+	fh, err := w.transformHeader(f)
+	if err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	fw, err := w.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = rc
+	if transform != nil {
+		r = transform(r)
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return fmt.Errorf("zip: copying %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+// transformHeader returns the header of the copy of f that CopyTransform
+// and Recompress write.
+func (w *Writer) transformHeader(f *File) (*FileHeader, error) {
+	method := f.Method
+	if w.compressor(method) == nil {
+		method = Deflate
+	}
+	fh := &FileHeader{Name: f.Name, NonUTF8: f.NonUTF8, Method: method}
+	if err := fh.CloneMetadataFrom(&f.FileHeader, nil); err != nil {
+		return nil, err
+	}
+	return fh, nil
+}
@@ -0,0 +1,75 @@
+package zip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestCopyTransform(t *testing.T) {
+	mtime := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range []*FileHeader{
+		{Name: "readme.txt", Method: Deflate, Comment: "docs"},
+		{Name: "run.sh", Method: Store},
+	} {
+		fh.Modified = mtime
+		fh.SetMode(0755)
+		if err := fh.SetMetadata(map[string]string{"k": "v"}); err != nil {
+			t.Fatal(err)
+		}
+		fw, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, "line 1\r\nline 2\r\n")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src := mustNewReader(t, buf.Bytes())
+
+	unix := func(r io.Reader) io.Reader {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return &errReader{err}
+		}
+		return bytes.NewReader(bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1))
+	}
+	buf2 := new(bytes.Buffer)
+	w = NewWriter(buf2)
+	for _, f := range src.File {
+		if err := w.CopyTransform(f, unix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, f := range mustNewReader(t, buf2.Bytes()).File {
+		orig := src.File[i]
+		if got := string(readFile(t, f)); got != "line 1\nline 2\n" {
+			t.Errorf("%s: read %q", f.Name, got)
+		}
+		if f.Name != orig.Name || f.Method != orig.Method || f.Comment != orig.Comment {
+			t.Errorf("%s: got method %d, comment %q", f.Name, f.Method, f.Comment)
+		}
+		if !f.Modified.Equal(mtime) || f.Mode() != 0755 {
+			t.Errorf("%s: got %v, %v", f.Name, f.Modified, f.Mode())
+		}
+		if md, _ := f.Metadata(); md["k"] != "v" {
+			t.Errorf("%s: metadata %v", f.Name, md)
+		}
+		if f.UncompressedSize64 != 14 {
+			t.Errorf("%s: size %d, want 14", f.Name, f.UncompressedSize64)
+		}
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,67 @@
+package zip
+
+import "fmt"
+
+// A NamePolicy decides where a Reader takes entry names from, when
+// entries have both a name in the header, which is CP-437 or some local
+// encoding unless flagged as UTF-8, and an Info-ZIP Unicode Path extra
+// field, as written by Info-ZIP and 7-Zip for non-ASCII names. Both are
+// available as FileHeader.NameRaw and NameUnicode either way. The
+// policy is applied to Reader.File as the archive is opened, so Lookup,
+// listings and extraction all use the same names.
+//
+// Unicode Path fields are not read with ReaderOptions.FastListing.
+type NamePolicy int
+
+const (
+	// HeaderNames takes names from the header, decoded to UTF-8 when
+	// they are not already; see NonUTF8. This is the default.
+	HeaderNames NamePolicy = iota
+	// UnicodePathNames takes names from Unicode Path fields, for
+	// entries that have one.
+	UnicodePathNames
+	// RejectNameConflicts takes names from the header, and makes
+	// opening the archive fail with a *NameConflictError if the name
+	// of a Unicode Path field is different.
+	RejectNameConflicts
+)
+
+// A NameConflictError is returned when opening an archive with the
+// RejectNameConflicts policy, for an entry whose names disagree.
+type NameConflictError struct {
+	Name        string // decoded from the header
+	NameUnicode string // from the Unicode Path field
+}
+
+func (e *NameConflictError) Error() string {
+	return fmt.Sprintf("zip: entry %q has a different Unicode name %q", e.Name, e.NameUnicode)
+}
+
+// applyNamePolicy sets the names of z.File according to z.opts.Names.
+// It runs after the header names were decoded.
+func (z *Reader) applyNamePolicy() error {
+	for _, f := range z.File {
+		if f.NameUnicode == "" || f.NameUnicode == f.Name {
+			continue
+		}
+		switch z.opts.Names {
+		case UnicodePathNames:
+			f.Name = f.NameUnicode
+		case RejectNameConflicts:
+			return &NameConflictError{Name: f.Name, NameUnicode: f.NameUnicode}
+		}
+	}
+	return nil
+}
+
+// withRawName returns a copy of fh with the name it was read with, for
+// writing the entry back as it was: Name may have been decoded from
+// CP-437 or Shift-JIS, or taken from a Unicode Path field, while Flags
+// and NonUTF8 still describe the name as stored. Headers that were not
+// read are returned unchanged.
+func withRawName(fh FileHeader) FileHeader {
+	if fh.NameRaw != "" {
+		fh.Name = fh.NameRaw
+	}
+	return fh
+}
@@ -0,0 +1,82 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+func unicodePathExtra(raw, name string) []byte {
+	data := make([]byte, 5, 5+len(name))
+	data[0] = 1
+	binary.LittleEndian.PutUint32(data[1:], crc32.ChecksumIEEE([]byte(raw)))
+	return appendExtra(nil, unicodePathExtraID, append(data, name...))
+}
+
+func TestNamePolicy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, fh := range []*FileHeader{
+		// CP-437 for "café", with a matching Unicode name.
+		{Name: "caf\x82", NonUTF8: true, Extra: unicodePathExtra("caf\x82", "café")},
+		// Renamed without updating the field, which is then ignored.
+		{Name: "renamed", Extra: unicodePathExtra("original", "original")},
+		// A Unicode name that does not match the header name.
+		{Name: "a.txt", Extra: unicodePathExtra("a.txt", "b.txt")},
+	} {
+		if _, err := w.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(policy NamePolicy) (*Reader, error) {
+		return NewReaderWithOptions(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ReaderOptions{Names: policy})
+	}
+	names := func(r *Reader) []string {
+		var names []string
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	r, err := open(HeaderNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(r), []string{"café", "renamed", "a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HeaderNames: got %q, want %q", got, want)
+	}
+	var raw, unicode []string
+	for _, f := range r.File {
+		raw = append(raw, f.NameRaw)
+		unicode = append(unicode, f.NameUnicode)
+	}
+	if want := []string{"caf\x82", "renamed", "a.txt"}; !reflect.DeepEqual(raw, want) {
+		t.Errorf("NameRaw: got %q, want %q", raw, want)
+	}
+	if want := []string{"café", "", "b.txt"}; !reflect.DeepEqual(unicode, want) {
+		t.Errorf("NameUnicode: got %q, want %q", unicode, want)
+	}
+
+	r, err = open(UnicodePathNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(r), []string{"café", "renamed", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnicodePathNames: got %q, want %q", got, want)
+	}
+	if _, ok := r.Lookup("b.txt"); !ok {
+		t.Error("UnicodePathNames: b.txt not found")
+	}
+
+	_, err = open(RejectNameConflicts)
+	if ce, ok := err.(*NameConflictError); !ok || ce.Name != "a.txt" || ce.NameUnicode != "b.txt" {
+		t.Errorf("RejectNameConflicts: got %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package zip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// A VerifyJob is an archive for a Verifier to check. Either Path is set,
+// or ReaderAt and Size are.
+type VerifyJob struct {
+	// Name identifies the job in results. It defaults to Path.
+	Name     string
+	Path     string
+	ReaderAt io.ReaderAt
+	Size     int64
+}
+
+// An EntryError is a failure to verify a single entry of an archive.
+type EntryError struct {
+	Name string
+	Err  error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+// A VerifyResult is the outcome of verifying one archive.
+type VerifyResult struct {
+	Job VerifyJob
+
+	// Err is set if the archive could not be opened at all.
+	Err error
+	// Failures lists the entries that could not be decompressed
+	// or whose checksum did not match.
+	Failures []*EntryError
+
+	Entries int    // number of entries checked
+	Bytes   uint64 // uncompressed bytes checked
+}
+
+// OK reports whether the archive and all its entries are valid.
+func (r *VerifyResult) OK() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// VerifierOptions configures a Verifier.
+type VerifierOptions struct {
+	// Workers is the number of entries decompressed concurrently,
+	// across all archives. Defaults to runtime.NumCPU().
+	Workers int
+
+	// MemoryBudget bounds the estimated memory held by the central
+	// directories of archives being verified at once, in bytes.
+	// Archives wait for budget before being opened; an archive larger
+	// than the whole budget is verified alone. Defaults to 256MiB.
+	MemoryBudget int64
+}
+
+// fileOverhead is a rough estimate of the memory used by a *File,
+// on top of its name, extra and comment.
+const fileOverhead = 256
+
+// A Verifier checks many archives concurrently, sharing a single pool
+// of decompression workers and a memory budget between them. It is
+// meant for ingestion pipelines validating uploads at scale.
+type Verifier struct {
+	opts   VerifierOptions
+	budget *weightedSemaphore
+}
+
+// NewVerifier returns a Verifier with the given options.
+func NewVerifier(opts VerifierOptions) *Verifier {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.MemoryBudget <= 0 {
+		opts.MemoryBudget = 256 << 20
+	}
+	return &Verifier{
+		opts:   opts,
+		budget: newWeightedSemaphore(opts.MemoryBudget),
+	}
+}
+
+type verifyTask struct {
+	f    *File
+	done chan<- *EntryError
+}
+
+// Run verifies archives received on jobs until it is closed or ctx is
+// done, and sends one result per archive on the returned channel, in
+// completion order. The channel is closed once all results are sent;
+// once ctx is done, results that are not received are dropped.
+func (v *Verifier) Run(ctx context.Context, jobs <-chan VerifyJob) <-chan VerifyResult {
+	results := make(chan VerifyResult)
+	tasks := make(chan verifyTask)
+
+	var workers sync.WaitGroup
+	for i := 0; i < v.opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for t := range tasks {
+				t.done <- verifyEntry(t.f)
+			}
+		}()
+	}
+
+	go func() {
+		var archives sync.WaitGroup
+	loop:
+		for {
+			var job VerifyJob
+			var ok bool
+			select {
+			case job, ok = <-jobs:
+				if !ok {
+					break loop
+				}
+			case <-ctx.Done():
+				break loop
+			}
+			if job.Name == "" {
+				job.Name = job.Path
+			}
+
+			r, closer, cost, err := v.openJob(ctx, job)
+			if err != nil {
+				select {
+				case results <- VerifyResult{Job: job, Err: err}:
+				case <-ctx.Done():
+				}
+				continue
+			}
+			archives.Add(1)
+			go func() {
+				defer archives.Done()
+				defer v.budget.release(cost)
+				if closer != nil {
+					defer closer.Close()
+				}
+				res := v.verifyArchive(ctx, job, r, tasks)
+				select {
+				case results <- res:
+				case <-ctx.Done():
+				}
+			}()
+		}
+		archives.Wait()
+		close(tasks)
+		workers.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// openJob waits for enough budget to hold the job's central directory,
+// or for ctx to be done, then parses it.
+func (v *Verifier) openJob(ctx context.Context, job VerifyJob) (*Reader, io.Closer, int64, error) {
+	ra, size := job.ReaderAt, job.Size
+	var closer io.Closer
+	if ra == nil {
+		f, err := os.Open(job.Path)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, 0, err
+		}
+		ra, size, closer = f, fi.Size(), f
+	}
+	fail := func(err error) (*Reader, io.Closer, int64, error) {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, nil, 0, err
+	}
+
+	end, err := readDirectoryEnd(ra, size)
+	if err != nil {
+		return fail(err)
+	}
+	cost := int64(end.directorySize) + int64(end.directoryRecords)*fileOverhead
+	cost, err = v.budget.acquire(ctx, cost)
+	if err != nil {
+		return fail(err)
+	}
+
+	r := new(Reader)
+	if err := r.initEnd(ra, size, end); err != nil {
+		v.budget.release(cost)
+		return fail(err)
+	}
+	return r, closer, cost, nil
+}
+
+func (v *Verifier) verifyArchive(ctx context.Context, job VerifyJob, r *Reader, tasks chan<- verifyTask) VerifyResult {
+	res := VerifyResult{Job: job}
+	done := make(chan *EntryError, len(r.File))
+	submitted := 0
+	for _, f := range r.File {
+		select {
+		case tasks <- verifyTask{f: f, done: done}:
+			submitted++
+		case <-ctx.Done():
+			res.Err = ctx.Err()
+		}
+		if res.Err != nil {
+			break
+		}
+		res.Entries++
+		res.Bytes += f.UncompressedSize64
+	}
+	for i := 0; i < submitted; i++ {
+		if ee := <-done; ee != nil {
+			res.Failures = append(res.Failures, ee)
+		}
+	}
+	return res
+}
+
+func verifyEntry(f *File) *EntryError {
+	rc, err := f.Open()
+	if err != nil {
+		return &EntryError{Name: f.Name, Err: err}
+	}
+	defer rc.Close()
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		return &EntryError{Name: f.Name, Err: err}
+	}
+	return nil
+}
+
+// weightedSemaphore hands out units of a fixed capacity.
+type weightedSemaphore struct {
+	mu       sync.Mutex
+	size     int64
+	used     int64
+	released chan struct{} // closed and replaced by release
+}
+
+func newWeightedSemaphore(size int64) *weightedSemaphore {
+	return &weightedSemaphore{size: size, released: make(chan struct{})}
+}
+
+// acquire blocks until n units are available or ctx is done, and
+// returns the number of units actually taken: requests larger than the
+// capacity are clamped to it.
+func (s *weightedSemaphore) acquire(ctx context.Context, n int64) (int64, error) {
+	if n > s.size {
+		n = s.size
+	}
+	for {
+		s.mu.Lock()
+		if s.used+n <= s.size {
+			s.used += n
+			s.mu.Unlock()
+			return n, nil
+		}
+		released := s.released
+		s.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (s *weightedSemaphore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+	close(s.released)
+	s.released = make(chan struct{})
+}
@@ -0,0 +1,97 @@
+package zip
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifier(t *testing.T) {
+	contents := map[string]string{
+		"a.txt": strings.Repeat("alpha ", 100),
+		"b.txt": strings.Repeat("bravo ", 100),
+	}
+	names := []string{"a.txt", "b.txt"}
+	good := buildRepairTestZip(t, contents, names)
+
+	bad := append([]byte{}, good...)
+	r, err := NewReader(bytes.NewReader(good), int64(len(good)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, err := r.File[1].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad[off+3] ^= 0xff
+
+	jobs := make(chan VerifyJob)
+	go func() {
+		for i := 0; i < 4; i++ {
+			jobs <- VerifyJob{Name: "good", ReaderAt: bytes.NewReader(good), Size: int64(len(good))}
+		}
+		jobs <- VerifyJob{Name: "bad", ReaderAt: bytes.NewReader(bad), Size: int64(len(bad))}
+		jobs <- VerifyJob{Name: "junk", ReaderAt: strings.NewReader("not a zip"), Size: 9}
+		jobs <- VerifyJob{Path: filepath.Join("testdata", "does-not-exist.zip")}
+		close(jobs)
+	}()
+
+	// A budget smaller than one archive's directory makes archives
+	// wait for each other.
+	v := NewVerifier(VerifierOptions{Workers: 2, MemoryBudget: 64})
+	counts := make(map[string]int)
+	for res := range v.Run(context.Background(), jobs) {
+		counts[res.Job.Name]++
+		switch res.Job.Name {
+		case "good":
+			if !res.OK() || res.Entries != 2 || res.Bytes != 1200 {
+				t.Errorf("good: got %+v", res)
+			}
+		case "bad":
+			if res.Err != nil || len(res.Failures) != 1 || res.Failures[0].Name != "b.txt" {
+				t.Errorf("bad: got %+v", res)
+			}
+		case "junk", filepath.Join("testdata", "does-not-exist.zip"):
+			if res.Err == nil {
+				t.Errorf("%s: expected an error", res.Job.Name)
+			}
+		default:
+			t.Errorf("unexpected result for %q", res.Job.Name)
+		}
+	}
+	if counts["good"] != 4 || counts["bad"] != 1 || counts["junk"] != 1 || len(counts) != 4 {
+		t.Errorf("got results %v", counts)
+	}
+}
+
+func TestVerifierCancel(t *testing.T) {
+	good := buildRepairTestZip(t, map[string]string{"a.txt": "alpha"}, []string{"a.txt"})
+	v := NewVerifier(VerifierOptions{Workers: 1, MemoryBudget: 64})
+	// Hold the whole budget, so the job waits for it until ctx is done.
+	if _, err := v.budget.acquire(context.Background(), 64); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan VerifyJob, 1)
+	jobs <- VerifyJob{Name: "good", ReaderAt: bytes.NewReader(good), Size: int64(len(good))}
+	results := v.Run(ctx, jobs)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		for res := range results {
+			if res.Err != context.Canceled {
+				t.Errorf("got %+v, want context.Canceled", res)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not stop waiting for budget once ctx was done")
+	}
+}
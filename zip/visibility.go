@@ -0,0 +1,43 @@
+package zip
+
+import "errors"
+
+// VisibilityExtraID is the extra field ID used by SetVisibility. It sits
+// in the range reserved for third-party vendors, next to
+// MetadataExtraID.
+const VisibilityExtraID uint16 = 0x6b76 // "vk"
+
+// Common visibility tags. Hosting backends may define their own, such
+// as "group:testers".
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+var errVisibilityTooLong = errors.New("zip: visibility tag does not fit in an extra field")
+
+// SetVisibility tags the entry with an access control tag, replacing any
+// set earlier, so that backends serving archives can expose some entries
+// publicly (screenshots, manifests) while keeping the rest gated. The
+// tag is only a hint for such backends: it does not protect the entry's
+// contents. An empty tag removes it.
+func (h *FileHeader) SetVisibility(tag string) error {
+	extra := removeExtra(h.Extra, VisibilityExtraID)
+	if tag == "" {
+		h.Extra = extra
+		return nil
+	}
+	if len(extra)+4+len(tag) > uint16max {
+		return errVisibilityTooLong
+	}
+	h.Extra = appendExtra(extra, VisibilityExtraID, []byte(tag))
+	return nil
+}
+
+// Visibility returns the tag set with SetVisibility, or "" if the entry
+// has none. Backends should treat untagged entries according to their
+// own default, usually VisibilityPrivate.
+func (h *FileHeader) Visibility() string {
+	data, _ := findExtra(h.Extra, VisibilityExtraID)
+	return string(data)
+}
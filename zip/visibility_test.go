@@ -0,0 +1,50 @@
+package zip
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVisibility(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	tags := map[string]string{
+		"screenshot.png": VisibilityPublic,
+		"game.exe":       VisibilityPrivate,
+		"beta.pak":       "group:testers",
+		"readme.txt":     "",
+	}
+	for _, name := range []string{"screenshot.png", "game.exe", "beta.pak", "readme.txt"} {
+		fh := &FileHeader{Name: name}
+		if err := fh.SetMetadata(map[string]string{"k": "v"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := fh.SetVisibility("stale"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fh.SetVisibility(tags[name]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range mustNewReader(t, buf.Bytes()).File {
+		if got := f.Visibility(); got != tags[f.Name] {
+			t.Errorf("%s: Visibility() = %q, want %q", f.Name, got, tags[f.Name])
+		}
+		if md, err := f.Metadata(); err != nil || md["k"] != "v" {
+			t.Errorf("%s: metadata lost next to visibility: %v, %v", f.Name, md, err)
+		}
+	}
+
+	fh := &FileHeader{}
+	if err := fh.SetVisibility(strings.Repeat("x", uint16max)); err == nil {
+		t.Error("oversized tag accepted")
+	}
+}
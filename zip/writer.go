@@ -6,12 +6,19 @@ package zip
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
+	"os"
+	"strings"
+	"time"
 	"unicode/utf8"
+
+	"golang.org/x/text/cases"
 )
 
 var (
@@ -28,6 +35,24 @@ type Writer struct {
 	compressors         map[uint16]Compressor
 	comment             string
 	compressionSettings CompressionSettings
+	dirOrder            EntryOrder
+	collisions          CollisionSettings
+	names               map[string]string // collision key => entry name
+	caser               cases.Caser
+	timestampFormat     TimestampFormat
+	timestampPrecision  time.Duration
+	timeLocation        *time.Location
+	executablePatterns  []string
+	budget              *timeBudget
+	dirOffset           int64 // where Close wrote the central directory
+	dest                io.Writer
+	limits              *sizeLimiter
+	compat              Compatibility
+	digest              bool
+	compressDirectory   bool
+	stats               *writerStats
+	tee                 *teeWriter
+	payloads            PayloadCache
 
 	// testHookCloseSizeOffset if non-nil is called with the size
 	// of offset of the central directory at Close.
@@ -41,18 +66,28 @@ type header struct {
 
 // NewWriter returns a new Writer writing a zip file to w.
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{cw: &countWriter{w: bufio.NewWriter(w)}, compressionSettings: defaultCompressionSettings}
+	stats := newWriterStats(time.Now)
+	return &Writer{
+		cw:                  &countWriter{w: bufio.NewWriter(&statsWriter{w: w, s: stats})},
+		dest:                w,
+		compressionSettings: defaultCompressionSettings,
+		stats:               stats,
+	}
 }
 
 func (w *Writer) GetCompressionSettings() CompressionSettings {
 	return w.compressionSettings
 }
 
+// SetCompressionSettings sets the settings compressors get for entries
+// created afterwards. Sections left to their zero value get defaults,
+// see CompressionSettings.Normalize.
 func (w *Writer) SetCompressionSettings(s CompressionSettings) error {
 	err := s.Validate()
 	if err != nil {
 		return err
 	}
+	s.Normalize()
 	w.compressionSettings = s
 	return nil
 }
@@ -85,11 +120,29 @@ func (w *Writer) SetComment(comment string) error {
 }
 
 // Close finishes writing the zip file by writing the central directory.
-// It does not (and cannot) close the underlying writer.
+// It does not (and cannot) close the underlying writer. Writers set
+// with Tee have been given everything once it returns.
 func (w *Writer) Close() error {
+	err := w.close()
+	if w.tee != nil {
+		if terr := w.tee.close(); err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+func (w *Writer) close() error {
+	// An entry dropped for exceeding a size limit is reported once the
+	// archive is finished without it.
+	var limitErr *LimitError
 	if w.last != nil && !w.last.closed {
 		if err := w.last.close(); err != nil {
-			return err
+			le, ok := err.(*LimitError)
+			if !ok {
+				return err
+			}
+			limitErr = le
 		}
 		w.last = nil
 	}
@@ -99,7 +152,23 @@ func (w *Writer) Close() error {
 	w.closed = true
 
 	// write central directory
+	w.sortDirectory()
 	start := w.cw.count
+	if w.compat.NoZip64 && (len(w.dir) >= uint16max || start >= uint32max) {
+		return &CompatibilityError{Feature: "Zip64"}
+	}
+	w.dirOffset = start
+	var dw io.Writer = w.cw
+	var dc *directoryCompressor
+	if w.compressDirectory {
+		dc = newDirectoryCompressor()
+		dw = dc
+	}
+	var digest hash.Hash
+	if w.digest {
+		digest = sha256.New()
+		dw = io.MultiWriter(dw, digest)
+	}
 	for _, h := range w.dir {
 		var buf [directoryHeaderLen]byte
 		b := writeBuf(buf[:])
@@ -141,16 +210,21 @@ func (w *Writer) Close() error {
 		} else {
 			b.uint32(uint32(h.offset))
 		}
-		if _, err := w.cw.Write(buf[:]); err != nil {
+		if _, err := dw.Write(buf[:]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(dw, h.Name); err != nil {
 			return err
 		}
-		if _, err := io.WriteString(w.cw, h.Name); err != nil {
+		if _, err := dw.Write(h.Extra); err != nil {
 			return err
 		}
-		if _, err := w.cw.Write(h.Extra); err != nil {
+		if _, err := io.WriteString(dw, h.Comment); err != nil {
 			return err
 		}
-		if _, err := io.WriteString(w.cw, h.Comment); err != nil {
+	}
+	if dc != nil {
+		if err := dc.writeRecord(w.cw); err != nil {
 			return err
 		}
 	}
@@ -165,6 +239,9 @@ func (w *Writer) Close() error {
 	}
 
 	if records >= uint16max || size >= uint32max || offset >= uint32max {
+		if w.compat.NoZip64 {
+			return &CompatibilityError{Feature: "Zip64"}
+		}
 		var buf [directory64EndLen + directory64LocLen]byte
 		b := writeBuf(buf[:])
 
@@ -197,24 +274,38 @@ func (w *Writer) Close() error {
 		offset = uint32max
 	}
 
+	comment := w.comment
+	if digest != nil {
+		var err error
+		if comment, err = w.digestComment(digest.Sum(nil)); err != nil {
+			return err
+		}
+	}
+
 	// write end record
 	var buf [directoryEndLen]byte
 	b := writeBuf(buf[:])
 	b.uint32(uint32(directoryEndSignature))
-	b = b[4:]                        // skip over disk number and first disk number (2x uint16)
-	b.uint16(uint16(records))        // number of entries this disk
-	b.uint16(uint16(records))        // number of entries total
-	b.uint32(uint32(size))           // size of directory
-	b.uint32(uint32(offset))         // start of directory
-	b.uint16(uint16(len(w.comment))) // byte size of EOCD comment
+	b = b[4:]                      // skip over disk number and first disk number (2x uint16)
+	b.uint16(uint16(records))      // number of entries this disk
+	b.uint16(uint16(records))      // number of entries total
+	b.uint32(uint32(size))         // size of directory
+	b.uint32(uint32(offset))       // start of directory
+	b.uint16(uint16(len(comment))) // byte size of EOCD comment
 	if _, err := w.cw.Write(buf[:]); err != nil {
 		return err
 	}
-	if _, err := io.WriteString(w.cw, w.comment); err != nil {
+	if _, err := io.WriteString(w.cw, comment); err != nil {
 		return err
 	}
 
-	return w.cw.w.(*bufio.Writer).Flush()
+	if err := w.cw.w.(*bufio.Writer).Flush(); err != nil {
+		return err
+	}
+	if limitErr != nil {
+		return limitErr
+	}
+	return nil
 }
 
 // Create adds a file to the zip file using the provided name.
@@ -233,6 +324,28 @@ func (w *Writer) Create(name string) (io.Writer, error) {
 	return w.CreateHeader(header)
 }
 
+// CreateDir adds an explicit directory entry to the zip file, so that
+// empty directories, and the mode and modification time of any
+// directory, survive a round trip. A trailing slash is appended to name
+// if needed. If fi is nil, the entry gets mode 0755 and no timestamp.
+func (w *Writer) CreateDir(name string, fi os.FileInfo) error {
+	if !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	fh := &FileHeader{
+		Name:   name,
+		Method: Store,
+	}
+	mode := os.FileMode(0755)
+	if fi != nil {
+		mode = fi.Mode().Perm() | fi.Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)
+		fh.Modified = fi.ModTime()
+	}
+	fh.SetMode(mode | os.ModeDir)
+	_, err := w.CreateHeader(fh)
+	return err
+}
+
 // detectUTF8 reports whether s is a valid UTF-8 string, and whether the string
 // must be considered UTF-8 encoding (i.e., not compatible with CP-437, ASCII,
 // or any other common encoding).
@@ -264,18 +377,95 @@ func detectUTF8(s string) (valid, require bool) {
 // The file's contents must be written to the io.Writer before the next
 // call to Create, CreateHeader, or Close.
 func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
+	if err := w.prepare(fh); err != nil {
+		return nil, err
+	}
+	w.applyExecutablePatterns(fh)
+
+	fh.Flags |= 0x8 // we will write a data descriptor
+
+	setUTF8Flag(fh)
+
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
+	fh.ReaderVersion = zipVersion20
+
+	w.encodeModified(fh)
+	if err := w.compat.checkHeader(fh, w.cw.count); err != nil {
+		w.forgetCollision(fh)
+		return nil, err
+	}
+
+	settings := w.compressionSettings
+	if w.budget != nil {
+		settings = w.budget.apply(fh, settings)
+	}
+	if w.limits != nil {
+		if err := w.limits.checkHeader(fh, false); err != nil {
+			w.forgetCollision(fh)
+			return nil, err
+		}
+	}
+
+	fw := &fileWriter{
+		zipw:      w.cw,
+		compCount: &countWriter{w: w.cw},
+		crc32:     crc32.NewIEEE(),
+		budget:    w.budget,
+		limits:    w.limits,
+		noZip64:   w.compat.NoZip64,
+		stats:     w.stats,
+	}
+	if w.limits != nil {
+		fw.compCount.w = &limitedWriter{l: w.limits, name: fh.Name}
+	}
+	comp := w.compressor(fh.Method)
+	if comp == nil {
+		w.forgetCollision(fh)
+		return nil, ErrAlgorithm
+	}
+	var err error
+	fw.comp, err = comp(settings, fw.compCount)
+	if err != nil {
+		w.forgetCollision(fh)
+		return nil, err
+	}
+	fw.rawCount = &countWriter{w: fw.comp}
+
+	h := &header{
+		FileHeader: fh,
+		offset:     uint64(w.cw.count),
+	}
+	if err := writeHeader(w.cw, fh); err != nil {
+		w.forgetCollision(fh)
+		return nil, err
+	}
+	w.dir = append(w.dir, h)
+	if w.limits != nil {
+		w.limits.added(fh)
+	}
+	fw.header = h
+
+	w.last = fw
+	return fw, nil
+}
+
+// prepare finishes the previous entry and checks that fh can be added.
+func (w *Writer) prepare(fh *FileHeader) error {
 	if w.last != nil && !w.last.closed {
 		if err := w.last.close(); err != nil {
-			return nil, err
+			return err
 		}
 	}
 	if len(w.dir) > 0 && w.dir[len(w.dir)-1].FileHeader == fh {
 		// See https://golang.org/issue/11144 confusion.
-		return nil, errors.New("archive/zip: invalid duplicate FileHeader")
+		return errors.New("archive/zip: invalid duplicate FileHeader")
 	}
+	return w.checkCollision(fh)
+}
 
-	fh.Flags |= 0x8 // we will write a data descriptor
-
+// setUTF8Flag sets or clears the UTF-8 flag according to the encoding
+// of fh's name and comment.
+func setUTF8Flag(fh *FileHeader) {
 	// The ZIP format has a sad state of affairs regarding character encoding.
 	// Officially, the name and comment fields are supposed to be encoded
 	// in CP-437 (which is mostly compatible with ASCII), unless the UTF-8
@@ -300,69 +490,87 @@ func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
 	case (utf8Require1 || utf8Require2) && (utf8Valid1 && utf8Valid2):
 		fh.Flags |= 0x800
 	}
+}
 
-	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
-	fh.ReaderVersion = zipVersion20
-
-	// If Modified is set, this takes precedence over MS-DOS timestamp fields.
-	if !fh.Modified.IsZero() {
-		// Contrary to the FileHeader.SetModTime method, we intentionally
-		// do not convert to UTC, because we assume the user intends to encode
-		// the date using the specified timezone. A user may want this control
-		// because many legacy ZIP readers interpret the timestamp according
-		// to the local timezone.
-		//
-		// The timezone is only non-UTC if a user directly sets the Modified
-		// field directly themselves. All other approaches sets UTC.
-		fh.ModifiedDate, fh.ModifiedTime = timeToMsDosTime(fh.Modified)
-
-		// Use "extended timestamp" format since this is what Info-ZIP uses.
-		// Nearly every major ZIP implementation uses a different format,
-		// but at least most seem to be able to understand the other formats.
-		//
-		// This format happens to be identical for both local and central header
-		// if modification time is the only timestamp being encoded.
-		var mbuf [9]byte // 2*SizeOf(uint16) + SizeOf(uint8) + SizeOf(uint32)
-		mt := uint32(fh.Modified.Unix())
-		eb := writeBuf(mbuf[:])
-		eb.uint16(extTimeExtraID)
-		eb.uint16(5)  // Size: SizeOf(uint8) + SizeOf(uint32)
-		eb.uint8(1)   // Flags: ModTime
-		eb.uint32(mt) // ModTime
-		fh.Extra = append(fh.Extra, mbuf[:]...)
-	}
-
-	fw := &fileWriter{
-		zipw:      w.cw,
-		compCount: &countWriter{w: w.cw},
-		crc32:     crc32.NewIEEE(),
+// CreateRaw adds a file to the zip archive using the provided FileHeader
+// and returns a Writer to which the already-compressed file contents
+// should be written. Nothing is compressed or checksummed: the caller
+// must set Method, CRC32, CompressedSize64 and UncompressedSize64, and
+// write exactly CompressedSize64 bytes.
+//
+// Timestamps and other extra fields are kept verbatim; Zip64 extra
+// fields are regenerated as needed. The file's contents must be written
+// to the io.Writer before the next call to Create, CreateHeader,
+// CreateRaw, or Close.
+func (w *Writer) CreateRaw(fh *FileHeader) (io.Writer, error) {
+	if err := w.prepare(fh); err != nil {
+		return nil, err
 	}
-	comp := w.compressor(fh.Method)
-	if comp == nil {
-		return nil, ErrAlgorithm
+	setUTF8Flag(fh)
+	fh.Extra = removeExtra(fh.Extra, zip64ExtraID)
+	if fh.isZip64() {
+		fh.CompressedSize = uint32max
+		fh.UncompressedSize = uint32max
+		if fh.ReaderVersion < zipVersion45 {
+			fh.ReaderVersion = zipVersion45
+		}
+	} else {
+		fh.CompressedSize = uint32(fh.CompressedSize64)
+		fh.UncompressedSize = uint32(fh.UncompressedSize64)
 	}
-	var err error
-	fw.comp, err = comp(w.compressionSettings, fw.compCount)
-	if err != nil {
+	if err := w.compat.checkHeader(fh, w.cw.count); err != nil {
+		w.forgetCollision(fh)
 		return nil, err
 	}
-	fw.rawCount = &countWriter{w: fw.comp}
+	if w.limits != nil {
+		if err := w.limits.checkHeader(fh, true); err != nil {
+			w.forgetCollision(fh)
+			return nil, err
+		}
+	}
 
 	h := &header{
 		FileHeader: fh,
 		offset:     uint64(w.cw.count),
 	}
-	w.dir = append(w.dir, h)
-	fw.header = h
-
 	if err := writeHeader(w.cw, fh); err != nil {
+		w.forgetCollision(fh)
 		return nil, err
 	}
+	w.dir = append(w.dir, h)
+	if w.limits != nil {
+		w.limits.added(fh)
+	}
 
+	fw := &fileWriter{
+		header:    h,
+		zipw:      w.cw,
+		compCount: &countWriter{w: w.cw},
+		raw:       true,
+		stats:     w.stats,
+	}
 	w.last = fw
 	return fw, nil
 }
 
+// Copy copies the file f (obtained from a Reader) into w, without
+// decompressing and recompressing its contents. f's FileHeader is
+// copied, so the original is left untouched, and the entry keeps the
+// name it is stored under, in whatever encoding that is.
+func (w *Writer) Copy(f *File) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	fh := withRawName(f.FileHeader)
+	fw, err := w.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
 func writeHeader(w io.Writer, h *FileHeader) error {
 	const maxUint16 = 1<<16 - 1
 	if len(h.Name) > maxUint16 {
@@ -380,18 +588,42 @@ func writeHeader(w io.Writer, h *FileHeader) error {
 	b.uint16(h.Method)
 	b.uint16(h.ModifiedTime)
 	b.uint16(h.ModifiedDate)
-	b.uint32(0) // since we are writing a data descriptor crc32,
-	b.uint32(0) // compressed size,
-	b.uint32(0) // and uncompressed size should be zero
+	extra := h.Extra
+	if h.Flags&0x8 != 0 {
+		b.uint32(0) // since we are writing a data descriptor crc32,
+		b.uint32(0) // compressed size,
+		b.uint32(0) // and uncompressed size should be zero
+	} else {
+		// Raw entries without a data descriptor: sizes are known upfront.
+		b.uint32(h.CRC32)
+		if h.isZip64() {
+			b.uint32(uint32max) // compressed size
+			b.uint32(uint32max) // uncompressed size
+
+			var zbuf [20]byte // 2x uint16 + 2x uint64
+			eb := writeBuf(zbuf[:])
+			eb.uint16(zip64ExtraID)
+			eb.uint16(16) // size = 2x uint64
+			eb.uint64(h.UncompressedSize64)
+			eb.uint64(h.CompressedSize64)
+			extra = append(extra[:len(extra):len(extra)], zbuf[:]...)
+			if len(extra) > maxUint16 {
+				return errLongExtra
+			}
+		} else {
+			b.uint32(h.CompressedSize)
+			b.uint32(h.UncompressedSize)
+		}
+	}
 	b.uint16(uint16(len(h.Name)))
-	b.uint16(uint16(len(h.Extra)))
+	b.uint16(uint16(len(extra)))
 	if _, err := w.Write(buf[:]); err != nil {
 		return err
 	}
 	if _, err := io.WriteString(w, h.Name); err != nil {
 		return err
 	}
-	_, err := w.Write(h.Extra)
+	_, err := w.Write(extra)
 	return err
 }
 
@@ -421,14 +653,78 @@ type fileWriter struct {
 	compCount *countWriter
 	crc32     hash.Hash32
 	closed    bool
+	raw       bool        // contents are written as-is, see CreateRaw
+	budget    *timeBudget // if non-nil, told about bytes written
+
+	limits         *sizeLimiter // if non-nil, enforced on writes
+	entryUnlimited bool         // MaxEntrySize was lifted for this entry
+	dropped        *LimitError  // why the entry was dropped, if it was
+
+	noZip64 bool // see Compatibility
+
+	stats *writerStats
 }
 
 func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.dropped != nil {
+		return 0, w.dropped
+	}
 	if w.closed {
 		return 0, errors.New("zip: write to closed file")
 	}
+	if w.raw {
+		return w.compCount.Write(p)
+	}
+	if w.noZip64 && (w.rawCount.count+int64(len(p)) >= uint32max || w.compCount.count >= uint32max) {
+		return 0, &CompatibilityError{Name: w.Name, Feature: "Zip64"}
+	}
+	if l := w.limits; l != nil && !w.entryUnlimited {
+		max := l.MaxEntrySize
+		if err := l.exceeded(max, w.rawCount.count+int64(len(p)), w.Name, true); err != nil {
+			l.drop(w, err)
+			return 0, err
+		}
+		w.entryUnlimited = max > 0 && w.rawCount.count+int64(len(p)) > max
+	}
 	w.crc32.Write(p)
-	return w.rawCount.Write(p)
+	n, err := w.rawCount.Write(p)
+	w.stats.addIn(int64(n))
+	if err != nil && w.limits != nil {
+		if le := w.limits.failed(); le != nil {
+			w.limits.drop(w, le)
+			return n, le
+		}
+	}
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom, so that io.Copy into an entry reads
+// its source in large chunks, into a pooled buffer, rather than through
+// a 32KiB buffer of its own.
+func (w *fileWriter) ReadFrom(r io.Reader) (int64, error) {
+	bp := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(bp)
+	buf := *bp
+	var n int64
+	for {
+		m, err := r.Read(buf)
+		if m > 0 {
+			k, werr := w.Write(buf[:m])
+			n += int64(k)
+			if werr != nil {
+				return n, werr
+			}
+			if k != m {
+				return n, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
 }
 
 func (w *fileWriter) close() error {
@@ -436,7 +732,25 @@ func (w *fileWriter) close() error {
 		return errors.New("zip: file closed twice")
 	}
 	w.closed = true
+	if w.raw {
+		fh := w.header.FileHeader
+		if uint64(w.compCount.count) != fh.CompressedSize64 {
+			return fmt.Errorf("zip: wrote %d bytes of raw data for %q, header says %d", w.compCount.count, fh.Name, fh.CompressedSize64)
+		}
+		w.stats.addIn(int64(fh.UncompressedSize64))
+		w.stats.addEntry()
+		if fh.Flags&0x8 == 0 {
+			return nil
+		}
+		return w.writeDataDescriptor()
+	}
 	if err := w.comp.Close(); err != nil {
+		if w.limits != nil {
+			if le := w.limits.failed(); le != nil {
+				w.limits.drop(w, le)
+				return le
+			}
+		}
 		return err
 	}
 
@@ -445,7 +759,13 @@ func (w *fileWriter) close() error {
 	fh.CRC32 = w.crc32.Sum32()
 	fh.CompressedSize64 = uint64(w.compCount.count)
 	fh.UncompressedSize64 = uint64(w.rawCount.count)
+	if w.budget != nil {
+		w.budget.add(w.rawCount.count)
+	}
 
+	if w.noZip64 && fh.isZip64() {
+		return &CompatibilityError{Name: fh.Name, Feature: "Zip64"}
+	}
 	if fh.isZip64() {
 		fh.CompressedSize = uint32max
 		fh.UncompressedSize = uint32max
@@ -455,6 +775,13 @@ func (w *fileWriter) close() error {
 		fh.UncompressedSize = uint32(fh.UncompressedSize64)
 	}
 
+	w.stats.addEntry()
+	return w.writeDataDescriptor()
+}
+
+func (w *fileWriter) writeDataDescriptor() error {
+	fh := w.header.FileHeader
+
 	// Write data descriptor. This is more complicated than one would
 	// think, see e.g. comments in zipfile.c:putextended() and
 	// http://bugs.sun.com/bugdatabase/view_bug.do?bug_id=7073588.
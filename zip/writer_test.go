@@ -14,6 +14,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/itchio/arkive/pflate"
 )
 
 // TODO(adg): a more sophisticated test suite
@@ -369,3 +371,257 @@ func BenchmarkCompressedZipGarbage(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkSmallEntries(b *testing.B) {
+	data := bytes.Repeat([]byte("small entry "), 100)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(100 * len(data)))
+	var buf bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		zw := NewWriter(&buf)
+		for j := 0; j < 100; j++ {
+			w, _ := zw.CreateHeader(&FileHeader{
+				Name:   fmt.Sprintf("file%d", j),
+				Method: Deflate,
+			})
+			w.Write(data)
+		}
+		zw.Close()
+	}
+}
+
+func TestWriterSharedPool(t *testing.T) {
+	pool := pflate.NewPool(2)
+	defer pool.Close()
+	s := DefaultCompressionSettings()
+	s.Flate.Pool = pool
+
+	content := func(i int) []byte {
+		b := make([]byte, 700<<10) // several blocks
+		for j := range b {
+			b[j] = byte(i + j*j/97)
+		}
+		return b
+	}
+	errc := make(chan error, 8)
+	for i := 0; i < cap(errc); i++ {
+		go func(i int) {
+			var buf bytes.Buffer
+			zw := NewWriter(&buf)
+			zw.SetCompressionSettings(s)
+			w, err := zw.Create("data")
+			if err == nil {
+				_, err = w.Write(content(i))
+			}
+			if err == nil {
+				err = zw.Close()
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				errc <- err
+				return
+			}
+			rc, err := zr.File[0].Open()
+			if err != nil {
+				errc <- err
+				return
+			}
+			got, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err == nil && !bytes.Equal(got, content(i)) {
+				err = fmt.Errorf("archive %d: contents differ", i)
+			}
+			errc <- err
+		}(i)
+	}
+	for i := 0; i < cap(errc); i++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFlateWriterPoolsIgnorePool(t *testing.T) {
+	count := func() int {
+		n := 0
+		flateWriterPools.Range(func(k, v interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	before := count()
+	for i := 0; i < 3; i++ {
+		pool := pflate.NewPool(1)
+		s := DefaultCompressionSettings()
+		s.Flate.Pool = pool
+		var buf bytes.Buffer
+		zw := NewWriter(&buf)
+		zw.SetCompressionSettings(s)
+		w, err := zw.Create("data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("some data"))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		pool.Close()
+	}
+	if n := count(); n > before+1 {
+		t.Errorf("got %d writer pools after using 3 pflate pools, had %d", n, before)
+	}
+}
+
+func TestWriterReusesFlateWriters(t *testing.T) {
+	// Entries of several archives, written concurrently with different
+	// settings, must not get mixed up by writers going through the pool.
+	settings := []CompressionSettings{DefaultCompressionSettings(), BestCompressionSettings()}
+	errc := make(chan error, 4)
+	for i := 0; i < cap(errc); i++ {
+		go func(i int) {
+			var buf bytes.Buffer
+			zw := NewWriter(&buf)
+			zw.SetCompressionSettings(settings[i%2])
+			for j := 0; j < 50; j++ {
+				w, err := zw.CreateHeader(&FileHeader{Name: fmt.Sprintf("%d/%d", i, j), Method: Deflate})
+				if err != nil {
+					errc <- err
+					return
+				}
+				fmt.Fprintf(w, "archive %d, entry %d, %s", i, j, strings.Repeat("x", j*100))
+			}
+			if err := zw.Close(); err != nil {
+				errc <- err
+				return
+			}
+			zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				errc <- err
+				return
+			}
+			for j, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					errc <- err
+					return
+				}
+				got, err := ioutil.ReadAll(rc)
+				rc.Close()
+				want := fmt.Sprintf("archive %d, entry %d, %s", i, j, strings.Repeat("x", j*100))
+				if err != nil || string(got) != want {
+					errc <- fmt.Errorf("%s: got %q, %v", f.Name, got, err)
+					return
+				}
+			}
+			errc <- nil
+		}(i)
+	}
+	for i := 0; i < cap(errc); i++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// readSizeRecorder records the largest read made from it.
+type readSizeRecorder struct {
+	r   io.Reader
+	max int
+}
+
+func (r *readSizeRecorder) Read(p []byte) (int, error) {
+	if len(p) > r.max {
+		r.max = len(p)
+	}
+	return r.r.Read(p)
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data[:len(data)/2])
+	for _, method := range []uint16{Store, Deflate} {
+		var buf bytes.Buffer
+		zw := NewWriter(&buf)
+		w, err := zw.CreateHeader(&FileHeader{Name: "data", Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Fatal("entry writer is not an io.ReaderFrom")
+		}
+		src := &readSizeRecorder{r: bytes.NewReader(data)}
+		n, err := io.Copy(w, struct{ io.Reader }{src})
+		if err != nil || n != int64(len(data)) {
+			t.Fatalf("method %d: copied %d bytes, %v", method, n, err)
+		}
+		if src.max != copyBufferSize {
+			t.Errorf("method %d: largest read was %d bytes, want %d", method, src.max, copyBufferSize)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		testReadFile(t, mustNewReader(t, buf.Bytes()).File[0], &WriteTest{Name: "data", Data: data, Method: method, Mode: 0666})
+	}
+}
+
+func mustNewReader(t *testing.T, b []byte) *Reader {
+	zr, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestWriterCreateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-createdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mtime := time.Date(2018, time.July, 4, 12, 30, 0, 0, time.UTC)
+	if err := os.Chmod(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dir, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err := w.CreateDir("empty", fi); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.CreateDir("default/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.File[0].Name; got != "empty/" {
+		t.Errorf("Name = %q, want %q", got, "empty/")
+	}
+	testFileMode(t, r.File[0], os.ModeDir|0750)
+	if !r.File[0].Modified.Equal(mtime) {
+		t.Errorf("Modified = %v, want %v", r.File[0].Modified, mtime)
+	}
+	testFileMode(t, r.File[1], os.ModeDir|0755)
+	if r.File[0].UncompressedSize64 != 0 {
+		t.Errorf("directory entry has %d bytes of data", r.File[0].UncompressedSize64)
+	}
+}
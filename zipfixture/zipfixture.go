@@ -0,0 +1,202 @@
+// Package zipfixture builds zip archives in memory for tests, both
+// well-formed ones and ones broken in specific ways:
+//
+//	b, err := zipfixture.New().
+//		AddDirEntry("data/").
+//		AddFile("data/a.txt", []byte("hello")).
+//		CorruptCRC("data/a.txt").
+//		Bytes()
+//
+// Calls are recorded and only applied by Bytes, so they can be given in
+// any order that makes sense to the reader of the test.
+package zipfixture
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"time"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// Modified is the modification time of every entry, so that fixtures
+// are the same byte for byte on every run.
+var Modified = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type entry struct {
+	name       string
+	data       []byte
+	method     uint16
+	corruptCRC bool
+}
+
+// A Builder describes an archive to build. Its methods return the
+// Builder, so calls can be chained.
+type Builder struct {
+	entries  []*entry
+	comment  string
+	truncate int64 // if non-zero, where to cut the archive
+	err      error
+}
+
+// New returns a Builder for an empty archive.
+func New() *Builder {
+	return new(Builder)
+}
+
+// AddFile adds a deflated file entry.
+func (b *Builder) AddFile(name string, data []byte) *Builder {
+	return b.AddFileMethod(name, data, zip.Deflate)
+}
+
+// AddFileMethod adds a file entry compressed with the given method,
+// which must be zip.Store or zip.Deflate.
+func (b *Builder) AddFileMethod(name string, data []byte, method uint16) *Builder {
+	if method != zip.Store && method != zip.Deflate {
+		return b.fail(fmt.Errorf("zipfixture: %s: unsupported method %d", name, method))
+	}
+	b.entries = append(b.entries, &entry{name: name, data: data, method: method})
+	return b
+}
+
+// AddDirEntry adds a directory entry. A slash is appended to name if it
+// does not end with one.
+func (b *Builder) AddDirEntry(name string) *Builder {
+	if !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	b.entries = append(b.entries, &entry{name: name, method: zip.Store})
+	return b
+}
+
+// Comment sets the archive comment.
+func (b *Builder) Comment(comment string) *Builder {
+	b.comment = comment
+	return b
+}
+
+// CorruptCRC records a wrong CRC-32 for the contents of the entries
+// added so far with the given name, in both their local and central
+// directory headers, so that reading them fails with zip.ErrChecksum.
+func (b *Builder) CorruptCRC(name string) *Builder {
+	found := false
+	for _, e := range b.entries {
+		if e.name == name {
+			e.corruptCRC = true
+			found = true
+		}
+	}
+	if !found {
+		return b.fail(fmt.Errorf("zipfixture: CorruptCRC: no entry named %q", name))
+	}
+	return b
+}
+
+// DuplicateName adds another entry with the same name and contents as
+// the last one added with that name.
+func (b *Builder) DuplicateName(name string) *Builder {
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		if e := b.entries[i]; e.name == name {
+			dup := *e
+			b.entries = append(b.entries, &dup)
+			return b
+		}
+	}
+	return b.fail(fmt.Errorf("zipfixture: DuplicateName: no entry named %q", name))
+}
+
+// TruncateAt cuts the archive to its first n bytes, or drops its last
+// -n bytes if n is negative.
+func (b *Builder) TruncateAt(n int64) *Builder {
+	if n == 0 {
+		return b.fail(fmt.Errorf("zipfixture: TruncateAt(0)"))
+	}
+	b.truncate = n
+	return b
+}
+
+func (b *Builder) fail(err error) *Builder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Bytes builds the archive. It returns the first error of the calls
+// made on b, if any.
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := zw.SetComment(b.comment); err != nil {
+		return nil, err
+	}
+	for _, e := range b.entries {
+		if err := e.write(zw); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	out := buf.Bytes()
+	switch n := b.truncate; {
+	case n > int64(len(out)) || -n > int64(len(out)):
+		return nil, fmt.Errorf("zipfixture: cannot truncate a %d-byte archive at %d", len(out), n)
+	case n > 0:
+		out = out[:n]
+	case n < 0:
+		out = out[:int64(len(out))+n]
+	}
+	return out, nil
+}
+
+// MustBytes is like Bytes, but panics on error.
+func (b *Builder) MustBytes() []byte {
+	out, err := b.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// write adds e to zw, compressing it itself so that any CRC-32 can be
+// recorded.
+func (e *entry) write(zw *zip.Writer) error {
+	compressed := e.data
+	if e.method == zip.Deflate {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		fw.Write(e.data)
+		if err := fw.Close(); err != nil {
+			return err
+		}
+		compressed = buf.Bytes()
+	}
+	fh := &zip.FileHeader{
+		Name:               e.name,
+		Method:             e.method,
+		CRC32:              crc32.ChecksumIEEE(e.data),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(len(e.data)),
+	}
+	fh.SetModTime(Modified)
+	if e.corruptCRC {
+		fh.CRC32 = ^fh.CRC32
+	}
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(compressed)
+	return err
+}
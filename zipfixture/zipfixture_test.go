@@ -0,0 +1,80 @@
+package zipfixture
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+)
+
+func open(t *testing.T, b []byte) *zip.Reader {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func read(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func TestWellFormed(t *testing.T) {
+	b := New().
+		AddDirEntry("data").
+		AddFile("data/a.txt", []byte("hello")).
+		AddFileMethod("data/b.bin", []byte("stored"), zip.Store).
+		Comment("fixture").
+		MustBytes()
+	r := open(t, b)
+	if r.Comment != "fixture" || len(r.File) != 3 {
+		t.Fatalf("got comment %q and %d entries", r.Comment, len(r.File))
+	}
+	if r.File[0].Name != "data/" || !r.File[0].Modified.Equal(Modified) {
+		t.Errorf("dir entry = %+v", r.File[0].FileHeader)
+	}
+	for i, want := range []string{"", "hello", "stored"} {
+		got, err := read(r.File[i])
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", r.File[i].Name, got, err)
+		}
+	}
+	if again := New().AddDirEntry("data").AddFile("data/a.txt", []byte("hello")).
+		AddFileMethod("data/b.bin", []byte("stored"), zip.Store).Comment("fixture").MustBytes(); !bytes.Equal(b, again) {
+		t.Error("fixtures differ between builds")
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	r := open(t, New().AddFile("a", []byte("aaa")).AddFile("b", []byte("bbb")).CorruptCRC("b").MustBytes())
+	if _, err := read(r.File[0]); err != nil {
+		t.Errorf("intact entry: %v", err)
+	}
+	if _, err := read(r.File[1]); err != zip.ErrChecksum {
+		t.Errorf("corrupt entry: got %v, want ErrChecksum", err)
+	}
+
+	r = open(t, New().AddFile("a", []byte("first")).DuplicateName("a").MustBytes())
+	if len(r.File) != 2 || r.File[0].Name != r.File[1].Name {
+		t.Errorf("duplicate: got %d entries", len(r.File))
+	}
+
+	b := New().AddFile("a", []byte("aaa")).TruncateAt(-10).MustBytes()
+	if _, err := zip.NewReader(bytes.NewReader(b), int64(len(b))); err == nil {
+		t.Error("truncated archive opened")
+	}
+
+	if _, err := New().CorruptCRC("missing").Bytes(); err == nil {
+		t.Error("CorruptCRC of a missing entry succeeded")
+	}
+	if _, err := New().TruncateAt(1 << 20).Bytes(); err == nil {
+		t.Error("truncating past the end succeeded")
+	}
+}
@@ -0,0 +1,551 @@
+// Package zipformat encodes and decodes the individual records of the
+// zip file format: local file headers, central directory headers, data
+// descriptors, and the (Zip64) end of central directory records.
+//
+// It does no I/O and keeps no state, which makes it suitable for
+// forensic and repair tools that need to look at structures directly,
+// including damaged ones. Most programs should use package zip instead.
+//
+// Parse functions take a byte slice starting with the record, and
+// return the record along with the number of bytes it spans.
+// Variable-length fields alias the input slice. They return
+// io.ErrUnexpectedEOF if b is too short, and ErrSignature if the record
+// does not start with the expected signature.
+package zipformat
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Record signatures.
+const (
+	LocalHeaderSignature        = 0x04034b50
+	DirectoryHeaderSignature    = 0x02014b50
+	DirectoryEndSignature       = 0x06054b50
+	Directory64LocatorSignature = 0x07064b50
+	Directory64EndSignature     = 0x06064b50
+	DataDescriptorSignature     = 0x08074b50 // de-facto standard, optional
+)
+
+// Fixed lengths of records, not counting variable-length fields.
+const (
+	LocalHeaderLen        = 30
+	DirectoryHeaderLen    = 46
+	DirectoryEndLen       = 22
+	Directory64LocatorLen = 20
+	Directory64EndLen     = 56
+)
+
+// Zip64ExtraID is the ID of the extra field holding 64-bit sizes and
+// offsets.
+const Zip64ExtraID = 0x0001
+
+// ErrSignature is returned when a record does not start with the
+// expected signature.
+var ErrSignature = errors.New("zipformat: bad signature")
+
+type readBuf []byte
+
+func (b *readBuf) uint16() uint16 {
+	v := binary.LittleEndian.Uint16(*b)
+	*b = (*b)[2:]
+	return v
+}
+
+func (b *readBuf) uint32() uint32 {
+	v := binary.LittleEndian.Uint32(*b)
+	*b = (*b)[4:]
+	return v
+}
+
+func (b *readBuf) uint64() uint64 {
+	v := binary.LittleEndian.Uint64(*b)
+	*b = (*b)[8:]
+	return v
+}
+
+func (b *readBuf) sub(n int) []byte {
+	b2 := (*b)[:n:n]
+	*b = (*b)[n:]
+	return b2
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
+
+// checkRecord checks that b holds at least n bytes starting with sig.
+func checkRecord(b []byte, n int, sig uint32) error {
+	if len(b) < n {
+		return io.ErrUnexpectedEOF
+	}
+	if binary.LittleEndian.Uint32(b) != sig {
+		return ErrSignature
+	}
+	return nil
+}
+
+// A LocalHeader is the header preceding each entry's data.
+type LocalHeader struct {
+	ReaderVersion    uint16
+	Flags            uint16
+	Method           uint16
+	ModifiedTime     uint16
+	ModifiedDate     uint16
+	CRC32            uint32
+	CompressedSize   uint32
+	UncompressedSize uint32
+	Name             []byte
+	Extra            []byte
+}
+
+// ParseLocalHeader decodes the local file header at the start of b.
+func ParseLocalHeader(b []byte) (*LocalHeader, int, error) {
+	if err := checkRecord(b, LocalHeaderLen, LocalHeaderSignature); err != nil {
+		return nil, 0, err
+	}
+	r := readBuf(b[4:])
+	h := &LocalHeader{
+		ReaderVersion:    r.uint16(),
+		Flags:            r.uint16(),
+		Method:           r.uint16(),
+		ModifiedTime:     r.uint16(),
+		ModifiedDate:     r.uint16(),
+		CRC32:            r.uint32(),
+		CompressedSize:   r.uint32(),
+		UncompressedSize: r.uint32(),
+	}
+	nameLen := int(r.uint16())
+	extraLen := int(r.uint16())
+	n := LocalHeaderLen + nameLen + extraLen
+	if len(b) < n {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	h.Name = r.sub(nameLen)
+	h.Extra = r.sub(extraLen)
+	return h, n, nil
+}
+
+// Append appends the encoded header to b. Name and Extra must be
+// shorter than 64KiB.
+func (h *LocalHeader) Append(b []byte) []byte {
+	b = appendUint32(b, LocalHeaderSignature)
+	b = appendUint16(b, h.ReaderVersion)
+	b = appendUint16(b, h.Flags)
+	b = appendUint16(b, h.Method)
+	b = appendUint16(b, h.ModifiedTime)
+	b = appendUint16(b, h.ModifiedDate)
+	b = appendUint32(b, h.CRC32)
+	b = appendUint32(b, h.CompressedSize)
+	b = appendUint32(b, h.UncompressedSize)
+	b = appendUint16(b, uint16(len(h.Name)))
+	b = appendUint16(b, uint16(len(h.Extra)))
+	b = append(b, h.Name...)
+	return append(b, h.Extra...)
+}
+
+// A DirectoryHeader is an entry's record in the central directory.
+type DirectoryHeader struct {
+	CreatorVersion   uint16
+	ReaderVersion    uint16
+	Flags            uint16
+	Method           uint16
+	ModifiedTime     uint16
+	ModifiedDate     uint16
+	CRC32            uint32
+	CompressedSize   uint32
+	UncompressedSize uint32
+	DiskNumberStart  uint16
+	InternalAttrs    uint16
+	ExternalAttrs    uint32
+	Offset           uint32 // of the local header
+	Name             []byte
+	Extra            []byte
+	Comment          []byte
+}
+
+// ParseDirectoryHeader decodes the central directory header at the
+// start of b.
+func ParseDirectoryHeader(b []byte) (*DirectoryHeader, int, error) {
+	if err := checkRecord(b, DirectoryHeaderLen, DirectoryHeaderSignature); err != nil {
+		return nil, 0, err
+	}
+	r := readBuf(b[4:])
+	h := &DirectoryHeader{
+		CreatorVersion:   r.uint16(),
+		ReaderVersion:    r.uint16(),
+		Flags:            r.uint16(),
+		Method:           r.uint16(),
+		ModifiedTime:     r.uint16(),
+		ModifiedDate:     r.uint16(),
+		CRC32:            r.uint32(),
+		CompressedSize:   r.uint32(),
+		UncompressedSize: r.uint32(),
+	}
+	nameLen := int(r.uint16())
+	extraLen := int(r.uint16())
+	commentLen := int(r.uint16())
+	h.DiskNumberStart = r.uint16()
+	h.InternalAttrs = r.uint16()
+	h.ExternalAttrs = r.uint32()
+	h.Offset = r.uint32()
+	n := DirectoryHeaderLen + nameLen + extraLen + commentLen
+	if len(b) < n {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	h.Name = r.sub(nameLen)
+	h.Extra = r.sub(extraLen)
+	h.Comment = r.sub(commentLen)
+	return h, n, nil
+}
+
+// Append appends the encoded header to b. Name, Extra and Comment must
+// be shorter than 64KiB.
+func (h *DirectoryHeader) Append(b []byte) []byte {
+	b = appendUint32(b, DirectoryHeaderSignature)
+	b = appendUint16(b, h.CreatorVersion)
+	b = appendUint16(b, h.ReaderVersion)
+	b = appendUint16(b, h.Flags)
+	b = appendUint16(b, h.Method)
+	b = appendUint16(b, h.ModifiedTime)
+	b = appendUint16(b, h.ModifiedDate)
+	b = appendUint32(b, h.CRC32)
+	b = appendUint32(b, h.CompressedSize)
+	b = appendUint32(b, h.UncompressedSize)
+	b = appendUint16(b, uint16(len(h.Name)))
+	b = appendUint16(b, uint16(len(h.Extra)))
+	b = appendUint16(b, uint16(len(h.Comment)))
+	b = appendUint16(b, h.DiskNumberStart)
+	b = appendUint16(b, h.InternalAttrs)
+	b = appendUint32(b, h.ExternalAttrs)
+	b = appendUint32(b, h.Offset)
+	b = append(b, h.Name...)
+	b = append(b, h.Extra...)
+	return append(b, h.Comment...)
+}
+
+// A DataDescriptor follows the data of entries written with bit 3 of
+// their flags set, and holds their CRC-32 and sizes.
+type DataDescriptor struct {
+	// Signature tells whether the optional signature is present.
+	Signature        bool
+	CRC32            uint32
+	CompressedSize   uint64
+	UncompressedSize uint64
+}
+
+// ParseDataDescriptor decodes the data descriptor at the start of b,
+// with or without a signature. Sizes are 64-bit if zip64 is set, which
+// should be the case when the entry's local header has a Zip64 extra
+// field.
+func ParseDataDescriptor(b []byte, zip64 bool) (*DataDescriptor, int, error) {
+	d := new(DataDescriptor)
+	r := readBuf(b)
+	n := 12
+	if zip64 {
+		n = 20
+	}
+	if len(b) >= 4 && binary.LittleEndian.Uint32(b) == DataDescriptorSignature {
+		d.Signature = true
+		n += 4
+	}
+	if len(b) < n {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	if d.Signature {
+		r.uint32()
+	}
+	d.CRC32 = r.uint32()
+	if zip64 {
+		d.CompressedSize = r.uint64()
+		d.UncompressedSize = r.uint64()
+	} else {
+		d.CompressedSize = uint64(r.uint32())
+		d.UncompressedSize = uint64(r.uint32())
+	}
+	return d, n, nil
+}
+
+// Append appends the encoded descriptor to b, with 64-bit sizes if
+// zip64 is set.
+func (d *DataDescriptor) Append(b []byte, zip64 bool) []byte {
+	if d.Signature {
+		b = appendUint32(b, DataDescriptorSignature)
+	}
+	b = appendUint32(b, d.CRC32)
+	if zip64 {
+		b = appendUint64(b, d.CompressedSize)
+		return appendUint64(b, d.UncompressedSize)
+	}
+	b = appendUint32(b, uint32(d.CompressedSize))
+	return appendUint32(b, uint32(d.UncompressedSize))
+}
+
+// A DirectoryEnd is the end of central directory record, which ends
+// every zip file.
+type DirectoryEnd struct {
+	DiskNumber      uint16
+	DirectoryDisk   uint16
+	DiskRecords     uint16
+	Records         uint16
+	DirectorySize   uint32
+	DirectoryOffset uint32
+	Comment         []byte
+}
+
+// FindDirectoryEnd returns the offset in b of the last end of central
+// directory record whose comment ends within b, or -1 if there is none.
+// b is typically the last 64KiB of a file.
+func FindDirectoryEnd(b []byte) int {
+	for i := len(b) - DirectoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(b[i:]) != DirectoryEndSignature {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(b[i+DirectoryEndLen-2:]))
+		if i+DirectoryEndLen+commentLen <= len(b) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseDirectoryEnd decodes the end of central directory record at the
+// start of b.
+func ParseDirectoryEnd(b []byte) (*DirectoryEnd, int, error) {
+	if err := checkRecord(b, DirectoryEndLen, DirectoryEndSignature); err != nil {
+		return nil, 0, err
+	}
+	r := readBuf(b[4:])
+	d := &DirectoryEnd{
+		DiskNumber:      r.uint16(),
+		DirectoryDisk:   r.uint16(),
+		DiskRecords:     r.uint16(),
+		Records:         r.uint16(),
+		DirectorySize:   r.uint32(),
+		DirectoryOffset: r.uint32(),
+	}
+	commentLen := int(r.uint16())
+	n := DirectoryEndLen + commentLen
+	if len(b) < n {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	d.Comment = r.sub(commentLen)
+	return d, n, nil
+}
+
+// Append appends the encoded record to b. Comment must be shorter than
+// 64KiB.
+func (d *DirectoryEnd) Append(b []byte) []byte {
+	b = appendUint32(b, DirectoryEndSignature)
+	b = appendUint16(b, d.DiskNumber)
+	b = appendUint16(b, d.DirectoryDisk)
+	b = appendUint16(b, d.DiskRecords)
+	b = appendUint16(b, d.Records)
+	b = appendUint32(b, d.DirectorySize)
+	b = appendUint32(b, d.DirectoryOffset)
+	b = appendUint16(b, uint16(len(d.Comment)))
+	return append(b, d.Comment...)
+}
+
+// IsZip64 reports whether the record's fields are maxed out, meaning
+// that the Zip64 end of central directory record must be used instead.
+func (d *DirectoryEnd) IsZip64() bool {
+	return d.Records == 0xffff || d.DiskRecords == 0xffff ||
+		d.DirectorySize == 0xffffffff || d.DirectoryOffset == 0xffffffff
+}
+
+// A Directory64Locator immediately precedes the end of central
+// directory record of Zip64 archives, and points to the Zip64 end of
+// central directory record.
+type Directory64Locator struct {
+	DirectoryEndDisk   uint32
+	DirectoryEndOffset uint64
+	TotalDisks         uint32
+}
+
+// ParseDirectory64Locator decodes the Zip64 end of central directory
+// locator at the start of b.
+func ParseDirectory64Locator(b []byte) (*Directory64Locator, int, error) {
+	if err := checkRecord(b, Directory64LocatorLen, Directory64LocatorSignature); err != nil {
+		return nil, 0, err
+	}
+	r := readBuf(b[4:])
+	l := &Directory64Locator{
+		DirectoryEndDisk:   r.uint32(),
+		DirectoryEndOffset: r.uint64(),
+		TotalDisks:         r.uint32(),
+	}
+	return l, Directory64LocatorLen, nil
+}
+
+// Append appends the encoded locator to b.
+func (l *Directory64Locator) Append(b []byte) []byte {
+	b = appendUint32(b, Directory64LocatorSignature)
+	b = appendUint32(b, l.DirectoryEndDisk)
+	b = appendUint64(b, l.DirectoryEndOffset)
+	return appendUint32(b, l.TotalDisks)
+}
+
+// A Directory64End is the Zip64 end of central directory record.
+type Directory64End struct {
+	CreatorVersion  uint16
+	ReaderVersion   uint16
+	DiskNumber      uint32
+	DirectoryDisk   uint32
+	DiskRecords     uint64
+	Records         uint64
+	DirectorySize   uint64
+	DirectoryOffset uint64
+	// Extensible is the extensible data sector, which the spec
+	// reserves for PKWARE's use.
+	Extensible []byte
+}
+
+// ParseDirectory64End decodes the Zip64 end of central directory record
+// at the start of b.
+func ParseDirectory64End(b []byte) (*Directory64End, int, error) {
+	if err := checkRecord(b, Directory64EndLen, Directory64EndSignature); err != nil {
+		return nil, 0, err
+	}
+	r := readBuf(b[4:])
+	size := r.uint64() // of the rest of the record
+	d := &Directory64End{
+		CreatorVersion:  r.uint16(),
+		ReaderVersion:   r.uint16(),
+		DiskNumber:      r.uint32(),
+		DirectoryDisk:   r.uint32(),
+		DiskRecords:     r.uint64(),
+		Records:         r.uint64(),
+		DirectorySize:   r.uint64(),
+		DirectoryOffset: r.uint64(),
+	}
+	if size < Directory64EndLen-12 || size > uint64(len(b)-12) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	n := int(size) + 12
+	d.Extensible = r.sub(n - Directory64EndLen)
+	return d, n, nil
+}
+
+// Append appends the encoded record to b.
+func (d *Directory64End) Append(b []byte) []byte {
+	b = appendUint32(b, Directory64EndSignature)
+	b = appendUint64(b, uint64(Directory64EndLen-12+len(d.Extensible)))
+	b = appendUint16(b, d.CreatorVersion)
+	b = appendUint16(b, d.ReaderVersion)
+	b = appendUint32(b, d.DiskNumber)
+	b = appendUint32(b, d.DirectoryDisk)
+	b = appendUint64(b, d.DiskRecords)
+	b = appendUint64(b, d.Records)
+	b = appendUint64(b, d.DirectorySize)
+	b = appendUint64(b, d.DirectoryOffset)
+	return append(b, d.Extensible...)
+}
+
+// A Zip64Extra holds the contents of a Zip64 extended information extra
+// field. It only contains the values whose 32-bit counterparts in the
+// header are maxed out, in a fixed order.
+type Zip64Extra struct {
+	UncompressedSize uint64
+	CompressedSize   uint64
+	Offset           uint64
+	DiskNumberStart  uint32
+}
+
+// Zip64Fields tells which values a Zip64 extra field holds.
+type Zip64Fields struct {
+	UncompressedSize bool
+	CompressedSize   bool
+	Offset           bool
+	DiskNumberStart  bool
+}
+
+// ParseZip64Extra decodes the data of a Zip64 extra field, which holds
+// the values selected by fields.
+func ParseZip64Extra(data []byte, fields Zip64Fields) (*Zip64Extra, error) {
+	n := 0
+	for _, f := range []bool{fields.UncompressedSize, fields.CompressedSize, fields.Offset} {
+		if f {
+			n += 8
+		}
+	}
+	if fields.DiskNumberStart {
+		n += 4
+	}
+	if len(data) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r := readBuf(data)
+	z := new(Zip64Extra)
+	if fields.UncompressedSize {
+		z.UncompressedSize = r.uint64()
+	}
+	if fields.CompressedSize {
+		z.CompressedSize = r.uint64()
+	}
+	if fields.Offset {
+		z.Offset = r.uint64()
+	}
+	if fields.DiskNumberStart {
+		z.DiskNumberStart = r.uint32()
+	}
+	return z, nil
+}
+
+// Append appends the data of a Zip64 extra field holding the values
+// selected by fields to b, without the extra field's ID and size.
+func (z *Zip64Extra) Append(b []byte, fields Zip64Fields) []byte {
+	if fields.UncompressedSize {
+		b = appendUint64(b, z.UncompressedSize)
+	}
+	if fields.CompressedSize {
+		b = appendUint64(b, z.CompressedSize)
+	}
+	if fields.Offset {
+		b = appendUint64(b, z.Offset)
+	}
+	if fields.DiskNumberStart {
+		b = appendUint32(b, z.DiskNumberStart)
+	}
+	return b
+}
+
+// An ExtraField is a single record of a header's extra fields.
+type ExtraField struct {
+	ID   uint16
+	Data []byte
+}
+
+// ParseExtra splits the extra fields of a header into records. Trailing
+// bytes that do not form a complete record are returned as rest.
+func ParseExtra(extra []byte) (fields []ExtraField, rest []byte) {
+	r := readBuf(extra)
+	for len(r) >= 4 {
+		id := binary.LittleEndian.Uint16(r)
+		size := int(binary.LittleEndian.Uint16(r[2:]))
+		if len(r) < 4+size {
+			break
+		}
+		r = r[4:]
+		fields = append(fields, ExtraField{ID: id, Data: r.sub(size)})
+	}
+	return fields, r
+}
+
+// AppendExtra appends an extra field record to b. data must be shorter
+// than 64KiB.
+func AppendExtra(b []byte, id uint16, data []byte) []byte {
+	b = appendUint16(b, id)
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,139 @@
+package zipformat
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+)
+
+func TestParseArchive(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Comment: "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, "hello, "+name)
+	}
+	if err := w.SetComment("archive comment"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	off := FindDirectoryEnd(b)
+	if off < 0 {
+		t.Fatal("no end of central directory record")
+	}
+	end, n, err := ParseDirectoryEnd(b[off:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off+n != len(b) || end.Records != 2 || string(end.Comment) != "archive comment" || end.IsZip64() {
+		t.Fatalf("got %+v spanning %d bytes", end, n)
+	}
+
+	dir := b[end.DirectoryOffset : end.DirectoryOffset+end.DirectorySize]
+	for i := 0; i < int(end.Records); i++ {
+		dh, n, err := ParseDirectoryHeader(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := dh.Append(nil); !bytes.Equal(got, dir[:n]) {
+			t.Errorf("directory header %d does not round-trip", i)
+		}
+		dir = dir[n:]
+
+		lh, n, err := ParseLocalHeader(b[dh.Offset:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(lh.Name, dh.Name) || lh.Method != dh.Method {
+			t.Errorf("local header %+v does not match directory header %+v", lh, dh)
+		}
+		if got := lh.Append(nil); !bytes.Equal(got, b[dh.Offset:int(dh.Offset)+n]) {
+			t.Errorf("local header %d does not round-trip", i)
+		}
+
+		ddOff := int(dh.Offset) + n + int(dh.CompressedSize)
+		dd, _, err := ParseDataDescriptor(b[ddOff:], false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !dd.Signature || dd.CRC32 != dh.CRC32 || dd.CompressedSize != uint64(dh.CompressedSize) {
+			t.Errorf("data descriptor %+v does not match directory header %+v", dd, dh)
+		}
+	}
+	if len(dir) != 0 {
+		t.Errorf("%d trailing bytes in the central directory", len(dir))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	d64 := &Directory64End{
+		CreatorVersion: 45, ReaderVersion: 45,
+		DiskRecords: 70000, Records: 70000,
+		DirectorySize: 1 << 33, DirectoryOffset: 1 << 34,
+		Extensible: []byte{1, 2, 3},
+	}
+	got, n, err := ParseDirectory64End(d64.Append(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != Directory64EndLen+3 || !reflect.DeepEqual(got, d64) {
+		t.Errorf("got %+v spanning %d bytes, want %+v", got, n, d64)
+	}
+
+	loc := &Directory64Locator{DirectoryEndOffset: 1 << 35, TotalDisks: 1}
+	gotLoc, _, err := ParseDirectory64Locator(loc.Append(nil))
+	if err != nil || !reflect.DeepEqual(gotLoc, loc) {
+		t.Errorf("got %+v, %v, want %+v", gotLoc, err, loc)
+	}
+
+	for _, zip64 := range []bool{false, true} {
+		for _, sig := range []bool{false, true} {
+			dd := &DataDescriptor{Signature: sig, CRC32: 0xcafe, CompressedSize: 10, UncompressedSize: 20}
+			got, _, err := ParseDataDescriptor(dd.Append(nil, zip64), zip64)
+			if err != nil || !reflect.DeepEqual(got, dd) {
+				t.Errorf("zip64=%v: got %+v, %v, want %+v", zip64, got, err, dd)
+			}
+		}
+	}
+
+	fields := Zip64Fields{UncompressedSize: true, Offset: true}
+	z := &Zip64Extra{UncompressedSize: 1 << 40, Offset: 1 << 33}
+	extra := AppendExtra(nil, Zip64ExtraID, z.Append(nil, fields))
+	extra = AppendExtra(extra, 0x5455, []byte{1, 0, 0, 0, 0})
+	fs, rest := ParseExtra(append(extra, 0xaa))
+	if len(fs) != 2 || fs[0].ID != Zip64ExtraID || fs[1].ID != 0x5455 || len(rest) != 1 {
+		t.Fatalf("ParseExtra: got %+v, rest %x", fs, rest)
+	}
+	gotZ, err := ParseZip64Extra(fs[0].Data, fields)
+	if err != nil || *gotZ != *z {
+		t.Errorf("got %+v, %v, want %+v", gotZ, err, z)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, _, err := ParseLocalHeader(make([]byte, LocalHeaderLen)); err != ErrSignature {
+		t.Errorf("got %v, want ErrSignature", err)
+	}
+	h := (&LocalHeader{Name: []byte("name")}).Append(nil)
+	if _, _, err := ParseLocalHeader(h[:len(h)-1]); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	d64 := (&Directory64End{}).Append(nil)
+	d64[4] = 0xff // claim a huge extensible data sector
+	if _, _, err := ParseDirectory64End(d64); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	if FindDirectoryEnd([]byte("PK\x05\x06")) != -1 {
+		t.Errorf("found a truncated end of central directory record")
+	}
+}
@@ -0,0 +1,82 @@
+// +build go1.16
+
+package ziphttp
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// AddFS adds the files and directories of fsys under root to the
+// archive, named by their path relative to root. Entries that are
+// neither regular files nor directories, such as symbolic links, are
+// skipped. It stops with the Writer's context.
+func (w *Writer) AddFS(fsys fs.FS, root string) error {
+	root = path.Clean(root)
+	return fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := w.rw.ctx.Err(); err != nil {
+			return err
+		}
+		if name == root {
+			return nil
+		}
+		rel := name
+		if root != "." {
+			rel = strings.TrimPrefix(name, root+"/")
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.CreateDir(rel, fi)
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return w.CreateFrom(rel, f, fi)
+	})
+}
+
+// ServeFS replies to r with a zip archive of the files of fsys under
+// root, built as it is sent. The archive is named after root unless
+// opts say otherwise.
+//
+// Errors met before anything was sent, such as a missing root, are
+// replied with a 404 or 500 status. Later ones leave the client with a
+// truncated archive, which zip readers reject; they are returned for
+// logging, like those of writing to a client that went away.
+func ServeFS(w http.ResponseWriter, r *http.Request, fsys fs.FS, root string, opts Options) error {
+	if opts.Name == "" {
+		if base := path.Base(path.Clean(root)); base != "." && base != "/" {
+			opts.Name = base + ".zip"
+		}
+	}
+	zw := NewWriter(r.Context(), w, opts)
+	err := zw.AddFS(fsys, root)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil && zw.Written() == 0 {
+		h := w.Header()
+		h.Del("Content-Type")
+		h.Del("Content-Disposition")
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "404 page not found", http.StatusNotFound)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+// +build go1.16
+
+package ziphttp
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/index.html":    {Data: []byte("<h1>hello</h1>")},
+		"site/img/logo.png":  {Data: []byte("png")},
+		"site/empty":         {Mode: 0755 | fs.ModeDir},
+		"site/link":          {Data: []byte("index.html"), Mode: fs.ModeSymlink},
+		"other/not-included": {Data: []byte("no")},
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/download", nil)
+	if err := ServeFS(rec, req, fsys, "site", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=site.zip" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	files := openResponse(t, rec.Body.Bytes())
+	want := map[string]string{
+		"empty/":       "",
+		"img/":         "",
+		"img/logo.png": "png",
+		"index.html":   "<h1>hello</h1>",
+	}
+	if len(files) != len(want) {
+		t.Errorf("got entries %v", files)
+	}
+	for name, data := range want {
+		if got, ok := files[name]; !ok || string(got) != data {
+			t.Errorf("%s = %q, %v, want %q", name, got, ok, data)
+		}
+	}
+}
+
+func TestServeFSMissing(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/download", nil)
+	if err := ServeFS(rec, req, fstest.MapFS{}, "nope", Options{}); err == nil {
+		t.Fatal("no error")
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("Content-Disposition = %q on error", got)
+	}
+}
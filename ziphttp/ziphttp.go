@@ -0,0 +1,139 @@
+// Package ziphttp streams zip archives into HTTP responses, as "download
+// this folder as a zip" endpoints do:
+//
+//	func download(w http.ResponseWriter, r *http.Request) {
+//		zw := ziphttp.NewWriter(r.Context(), w, ziphttp.Options{Name: "photos.zip"})
+//		fw, err := zw.Create("hello.txt")
+//		...
+//		if err := zw.Close(); err != nil {
+//			log.Print(err)
+//		}
+//	}
+//
+// The archive is written as it is built, without a Content-Length, so
+// that the download starts right away whatever its size. On Go 1.16 and
+// later, ServeFS does all of the above for the files of an fs.FS.
+package ziphttp
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// Options configure a Writer.
+type Options struct {
+	// Name is the file name offered to clients, in the
+	// Content-Disposition header. Defaults to "archive.zip".
+	Name string
+	// The response is flushed to the client once FlushBytes were
+	// written since the last flush, or once FlushInterval passed,
+	// so that slowly compressed archives trickle to clients instead
+	// of stalling in buffers until proxies time out. Default to 64KiB
+	// and 200ms.
+	FlushBytes    int
+	FlushInterval time.Duration
+}
+
+const (
+	defaultName          = "archive.zip"
+	defaultFlushBytes    = 64 << 10
+	defaultFlushInterval = 200 * time.Millisecond
+)
+
+// A Writer is a zip.Writer writing into an HTTP response.
+type Writer struct {
+	*zip.Writer
+	rw *responseWriter
+}
+
+// NewWriter returns a Writer writing an archive into w. It sets the
+// Content-Type and Content-Disposition headers unless they are already
+// set, but headers are only sent with the first bytes of the archive,
+// so that handlers can still reply with an error until then; see
+// Written. Writes fail with ctx's error once it is done, which is
+// typically the request's context: the client went away.
+func NewWriter(ctx context.Context, w http.ResponseWriter, opts Options) *Writer {
+	if opts.Name == "" {
+		opts.Name = defaultName
+	}
+	if opts.FlushBytes <= 0 {
+		opts.FlushBytes = defaultFlushBytes
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/zip")
+	}
+	if h.Get("Content-Disposition") == "" {
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": opts.Name}))
+	}
+	// The length is not known in advance, and a stale one set by a
+	// middleware would cut the archive short.
+	h.Del("Content-Length")
+
+	rw := &responseWriter{ctx: ctx, w: w, opts: opts, now: time.Now}
+	rw.flusher, _ = w.(http.Flusher)
+	rw.lastFlush = rw.now()
+	return &Writer{Writer: zip.NewWriter(rw), rw: rw}
+}
+
+// Written returns the number of bytes of the archive sent so far. Until
+// it is non-zero, the response status and headers can still be changed,
+// for example to reply with an error instead.
+func (w *Writer) Written() int64 {
+	return w.rw.written
+}
+
+// Close finishes writing the archive and flushes it to the client. It
+// does not close the response, which is done once the handler returns.
+func (w *Writer) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	w.rw.flush()
+	return nil
+}
+
+// responseWriter writes to an http.ResponseWriter, flushing it as
+// Options say, and fails once its context is done.
+type responseWriter struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	flusher http.Flusher
+	opts    Options
+	now     func() time.Time
+
+	written   int64
+	unflushed int
+	lastFlush time.Time
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if err := rw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := rw.w.Write(p)
+	rw.written += int64(n)
+	rw.unflushed += n
+	if err != nil {
+		return n, err
+	}
+	if rw.unflushed >= rw.opts.FlushBytes || rw.now().Sub(rw.lastFlush) >= rw.opts.FlushInterval {
+		rw.flush()
+	}
+	return n, nil
+}
+
+func (rw *responseWriter) flush() {
+	if rw.flusher != nil && rw.unflushed > 0 {
+		rw.flusher.Flush()
+	}
+	rw.unflushed = 0
+	rw.lastFlush = rw.now()
+}
@@ -0,0 +1,128 @@
+package ziphttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/itchio/arkive/zip"
+)
+
+// flushRecorder counts flushes of a ResponseRecorder.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func openResponse(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestWriter(t *testing.T) {
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec.Header().Set("Content-Length", "12")
+	zw := NewWriter(context.Background(), rec, Options{Name: "résumé.zip", FlushBytes: 4096})
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "random.bin", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for b := data; len(b) > 0; b = b[1000:] {
+		if _, err := fw.Write(b[:1000]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := rec.Header()
+	if got := h.Get("Content-Type"); got != "application/zip" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := h.Get("Content-Disposition"); got != "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.zip" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := h.Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q, want none", got)
+	}
+	if rec.flushes < 100000/4096/2 {
+		t.Errorf("%d flushes, want one every 4096 bytes or so", rec.flushes)
+	}
+	if !rec.Flushed {
+		t.Error("response not flushed on Close")
+	}
+	if zw.Written() != int64(rec.Body.Len()) {
+		t.Errorf("Written() = %d, want %d", zw.Written(), rec.Body.Len())
+	}
+	if files := openResponse(t, rec.Body.Bytes()); !bytes.Equal(files["random.bin"], data) {
+		t.Error("random.bin differs")
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	zw := NewWriter(context.Background(), rec, Options{FlushInterval: time.Second})
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	zw.rw.now = func() time.Time { return now }
+	zw.rw.lastFlush = now
+
+	zw.rw.Write([]byte("a"))
+	if rec.flushes != 0 {
+		t.Fatal("flushed too early")
+	}
+	now = now.Add(time.Second)
+	zw.rw.Write([]byte("b"))
+	if rec.flushes != 1 {
+		t.Fatalf("%d flushes after the interval, want 1", rec.flushes)
+	}
+}
+
+func TestWriterCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	zw := NewWriter(ctx, rec, Options{})
+	fw, err := zw.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	_, err = io.Copy(fw, io.LimitReader(rand.New(rand.NewSource(1)), 1<<20))
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("%d bytes sent after cancellation", rec.Body.Len())
+	}
+}
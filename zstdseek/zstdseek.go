@@ -0,0 +1,351 @@
+// Package zstdseek reads and writes zstd streams in the seekable format,
+// for random access into compressed tarballs (.tar.zst).
+//
+// A seekable stream is made of independently compressed frames, followed
+// by a seek table in a skippable frame, so it still decompresses with any
+// zstd decoder. Given the seek table, a Reader only decompresses the
+// frames covering the bytes asked for. See
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+//
+// To extract a single file from a tarball, record the offset of its tar
+// header while writing, then read the tarball from there:
+//
+//	zr, _ := zstdseek.NewReader(f, size)
+//	tr := tar.NewReader(io.NewSectionReader(zr, offset, zr.Size()-offset))
+//	hdr, _ := tr.Next()
+package zstdseek
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	skippableFrameMagic = 0x184D2A5E
+	seekableMagic       = 0x8F92EAB1
+
+	skippableHeaderLen = 8 // magic, frame size
+	seekTableFooterLen = 9 // number of frames, descriptor, seekable magic
+	seekEntryLen       = 8 // compressed size, decompressed size
+	checksumFlag       = 1 << 7
+
+	// maxFrameSize is the largest decompressed frame the format allows.
+	maxFrameSize = 1<<32 - 1
+)
+
+// DefaultFrameSize is the amount of uncompressed data in each frame when
+// none is given to NewWriter. Smaller frames make seeking cheaper, at
+// some cost in compression ratio.
+const DefaultFrameSize = 1 << 20
+
+var (
+	// ErrNoSeekTable is returned by NewReader for zstd streams that are
+	// not in the seekable format.
+	ErrNoSeekTable = errors.New("zstdseek: no seek table")
+	// ErrSeekTable is returned by NewReader for malformed seek tables.
+	ErrSeekTable = errors.New("zstdseek: invalid seek table")
+)
+
+// A Writer compresses data into a seekable zstd stream.
+type Writer struct {
+	w         io.Writer
+	enc       *zstd.Encoder
+	frameSize int
+	buf       []byte
+	frames    []frame
+	err       error
+}
+
+// NewWriter returns a Writer that compresses data written to it into
+// frames of frameSize uncompressed bytes, written to w. If frameSize is
+// zero, DefaultFrameSize is used. Options are passed to the zstd encoder.
+// The caller must Close the Writer to write the seek table.
+func NewWriter(w io.Writer, frameSize int, opts ...zstd.EOption) (*Writer, error) {
+	if frameSize <= 0 {
+		frameSize = DefaultFrameSize
+	}
+	if int64(frameSize) > maxFrameSize {
+		return nil, errors.New("zstdseek: frame size too large")
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:         w,
+		enc:       enc,
+		frameSize: frameSize,
+		buf:       make([]byte, 0, frameSize),
+	}, nil
+}
+
+// Write compresses p, writing out every frame it fills.
+func (zw *Writer) Write(p []byte) (int, error) {
+	if zw.err != nil {
+		return 0, zw.err
+	}
+	n := 0
+	for len(p) > 0 {
+		m := copy(zw.buf[len(zw.buf):zw.frameSize], p)
+		zw.buf = zw.buf[:len(zw.buf)+m]
+		n += m
+		p = p[m:]
+		if len(zw.buf) == zw.frameSize {
+			if err := zw.Flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush ends the current frame, if it holds any data, so that data
+// written so far can be decompressed on its own. Flushing at boundaries
+// of interest, such as between tar entries, makes reads starting there
+// cheaper.
+func (zw *Writer) Flush() error {
+	if zw.err != nil {
+		return zw.err
+	}
+	if len(zw.buf) == 0 {
+		return nil
+	}
+	comp := zw.enc.EncodeAll(zw.buf, nil)
+	if _, err := zw.w.Write(comp); err != nil {
+		zw.err = err
+		return err
+	}
+	zw.frames = append(zw.frames, frame{
+		compSize: int64(len(comp)),
+		size:     int64(len(zw.buf)),
+	})
+	zw.buf = zw.buf[:0]
+	return nil
+}
+
+// Close flushes the last frame and writes the seek table. It does not
+// close the underlying writer.
+func (zw *Writer) Close() error {
+	if err := zw.Flush(); err != nil {
+		return err
+	}
+	defer zw.enc.Close()
+	zw.err = errors.New("zstdseek: write after close")
+
+	tableLen := len(zw.frames)*seekEntryLen + seekTableFooterLen
+	b := make([]byte, skippableHeaderLen, skippableHeaderLen+tableLen)
+	binary.LittleEndian.PutUint32(b[0:], skippableFrameMagic)
+	binary.LittleEndian.PutUint32(b[4:], uint32(tableLen))
+	var entry [seekEntryLen]byte
+	for _, f := range zw.frames {
+		binary.LittleEndian.PutUint32(entry[0:], uint32(f.compSize))
+		binary.LittleEndian.PutUint32(entry[4:], uint32(f.size))
+		b = append(b, entry[:]...)
+	}
+	var footer [seekTableFooterLen]byte
+	binary.LittleEndian.PutUint32(footer[0:], uint32(len(zw.frames)))
+	footer[4] = 0 // no checksums
+	binary.LittleEndian.PutUint32(footer[5:], seekableMagic)
+	b = append(b, footer[:]...)
+	_, err := zw.w.Write(b)
+	return err
+}
+
+type frame struct {
+	compOffset int64
+	compSize   int64
+	offset     int64 // decompressed
+	size       int64 // decompressed
+}
+
+// A Reader gives random access to the decompressed contents of a
+// seekable zstd stream. It implements io.ReaderAt, which is safe for
+// concurrent use, and io.ReadSeeker.
+type Reader struct {
+	r      io.ReaderAt
+	dec    *zstd.Decoder
+	frames []frame
+	size   int64
+	pos    int64 // for Read and Seek
+
+	mu      sync.Mutex
+	cached  int // index of the frame in cache, or -1
+	cache   []byte
+	scratch []byte
+}
+
+// NewReader reads the seek table of the seekable zstd stream of the given
+// size in r. It returns ErrNoSeekTable if the stream has none.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < skippableHeaderLen+seekTableFooterLen {
+		return nil, ErrNoSeekTable
+	}
+	var footer [seekTableFooterLen]byte
+	if _, err := r.ReadAt(footer[:], size-seekTableFooterLen); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, ErrNoSeekTable
+	}
+	n := int64(binary.LittleEndian.Uint32(footer[0:]))
+	desc := footer[4]
+	entryLen := int64(seekEntryLen)
+	if desc&checksumFlag != 0 {
+		entryLen += 4
+	}
+	if desc&0x7c != 0 { // reserved bits
+		return nil, ErrSeekTable
+	}
+	tableLen := n*entryLen + seekTableFooterLen
+	start := size - tableLen - skippableHeaderLen
+	if start < 0 {
+		return nil, ErrSeekTable
+	}
+
+	table := make([]byte, skippableHeaderLen+tableLen)
+	if _, err := r.ReadAt(table, start); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table[0:]) != skippableFrameMagic ||
+		int64(binary.LittleEndian.Uint32(table[4:])) != tableLen {
+		return nil, ErrSeekTable
+	}
+
+	frames := make([]frame, n)
+	var compOffset, offset int64
+	for i := range frames {
+		e := table[skippableHeaderLen+int64(i)*entryLen:]
+		f := frame{
+			compOffset: compOffset,
+			compSize:   int64(binary.LittleEndian.Uint32(e[0:])),
+			offset:     offset,
+			size:       int64(binary.LittleEndian.Uint32(e[4:])),
+		}
+		compOffset += f.compSize
+		offset += f.size
+		frames[i] = f
+	}
+	if compOffset > start {
+		return nil, ErrSeekTable
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		r:      r,
+		dec:    dec,
+		frames: frames,
+		size:   offset,
+		cached: -1,
+	}, nil
+}
+
+// Size returns the decompressed size of the stream.
+func (zr *Reader) Size() int64 {
+	return zr.size
+}
+
+// Frames returns the number of frames in the stream.
+func (zr *Reader) Frames() int {
+	return len(zr.frames)
+}
+
+// Close releases the resources of the decoder. It does not close the
+// underlying reader.
+func (zr *Reader) Close() error {
+	zr.dec.Close()
+	return nil
+}
+
+// ReadAt reads decompressed data starting at off, decompressing only
+// the frames it spans. The last frame read is kept in memory, so
+// sequential reads decompress each frame once.
+func (zr *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("zstdseek: negative offset")
+	}
+	n := 0
+	for len(p) > 0 {
+		if off >= zr.size {
+			return n, io.EOF
+		}
+		i := sort.Search(len(zr.frames), func(i int) bool {
+			f := zr.frames[i]
+			return f.offset+f.size > off
+		})
+		m, err := zr.readFrame(i, p, off-zr.frames[i].offset)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// readFrame copies the decompressed contents of frame i, from off, to p.
+func (zr *Reader) readFrame(i int, p []byte, off int64) (int, error) {
+	zr.mu.Lock()
+	defer zr.mu.Unlock()
+	if zr.cached != i {
+		f := zr.frames[i]
+		if int64(cap(zr.scratch)) < f.compSize {
+			zr.scratch = make([]byte, f.compSize)
+		}
+		comp := zr.scratch[:f.compSize]
+		if _, err := zr.r.ReadAt(comp, f.compOffset); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		data, err := zr.dec.DecodeAll(comp, zr.cache[:0])
+		if err != nil {
+			zr.cached = -1
+			return 0, err
+		}
+		if int64(len(data)) != f.size {
+			zr.cached = -1
+			return 0, errors.New("zstdseek: frame size does not match the seek table")
+		}
+		zr.cache = data
+		zr.cached = i
+	}
+	return copy(p, zr.cache[off:]), nil
+}
+
+// Read reads decompressed data from the current position.
+func (zr *Reader) Read(p []byte) (int, error) {
+	n, err := zr.ReadAt(p, zr.pos)
+	zr.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position for the next Read.
+func (zr *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += zr.pos
+	case io.SeekEnd:
+		offset += zr.size
+	default:
+		return 0, errors.New("zstdseek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("zstdseek: negative position")
+	}
+	zr.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,133 @@
+package zstdseek
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/itchio/arkive/tar"
+	"github.com/klauspost/compress/zstd"
+)
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestSeekableTar(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := &countWriter{w: zw}
+	tw := tar.NewWriter(cw)
+
+	var plain bytes.Buffer
+	offsets := make(map[string]int64)
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("file%02d.txt", i)
+		body := bytes.Repeat([]byte(name), 100*i+1)
+		// Header offsets are only known once the previous entry is
+		// padded, which tar.Writer does in Flush.
+		if err := tw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		offsets[name] = cw.n
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(body); err != nil {
+			t.Fatal(err)
+		}
+		plain.WriteString(name)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any zstd decoder can read the stream, skipping the seek table.
+	dec, err := zstd.NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err := ioutil.ReadAll(dec)
+	dec.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(whole)) != cw.n {
+		t.Fatalf("decompressed %d bytes, want %d", len(whole), cw.n)
+	}
+
+	zr, err := NewReader(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if zr.Size() != cw.n || zr.Frames() < 2 {
+		t.Fatalf("got size %d in %d frames, want %d in several", zr.Size(), zr.Frames(), cw.n)
+	}
+
+	// Random access matches the decompressed stream.
+	for _, off := range []int64{0, 100, 4095, 4096, 10000, zr.Size() - 10} {
+		p := make([]byte, 5000)
+		n, err := zr.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(p[:n], whole[off:off+int64(n)]) {
+			t.Errorf("ReadAt(%d): contents differ", off)
+		}
+	}
+
+	// Jump straight to an entry.
+	off := offsets["file13.txt"]
+	tr := tar.NewReader(io.NewSectionReader(zr, off, zr.Size()-off))
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "file13.txt" || !bytes.Equal(body, bytes.Repeat([]byte(hdr.Name), 1301)) {
+		t.Errorf("got %s with %d bytes", hdr.Name, len(body))
+	}
+
+	// Sequential reading through Read and Seek.
+	if _, err := zr.Seek(off, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, whole[off:]) {
+		t.Errorf("Read after Seek: contents differ")
+	}
+}
+
+func TestNoSeekTable(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := enc.EncodeAll(bytes.Repeat([]byte("plain zstd "), 100), nil)
+	enc.Close()
+	if _, err := NewReader(bytes.NewReader(b), int64(len(b))); err != ErrNoSeekTable {
+		t.Errorf("got error %v, want ErrNoSeekTable", err)
+	}
+}